@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/backup"
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/schedule"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// runBackup backs up every tracked entry without the TUI.
+func runBackup(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	scheduled := fs.Bool("scheduled", false, "record the result as the last scheduled run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !cfg.IsConfigured() {
+		return fmt.Errorf("dfc is not configured — run dfc to complete setup first")
+	}
+
+	started := time.Now()
+	res, err := backup.Unattended(cfg, cfg.Entries, "dfc: scheduled backup")
+
+	for _, p := range res.Progress {
+		for _, h := range p.Hooks {
+			fmt.Printf("  %s: %s\n", p.Entry.Path, h.Summary())
+		}
+		switch {
+		case p.Err != nil:
+			fmt.Printf("✗ %s: %v\n", p.Entry.Path, p.Err)
+		case p.Warning != "":
+			fmt.Printf("⚠ %s: %s\n", p.Entry.Path, p.Warning)
+		}
+		if p.Err == nil {
+			for _, reason := range p.SkipReasons {
+				fmt.Printf("  %s: skipped %s\n", p.Entry.Path, reason)
+			}
+		}
+	}
+	for _, cr := range res.Held {
+		fmt.Printf("⚡ %s: %s — not backed up\n", cr.Entry.Path, cr.State)
+	}
+	for _, c := range res.Contests {
+		if c.Kept {
+			fmt.Printf("⚡ %s: also backed up on another device, this copy was kept (%s)\n", c.Entry.Path, c.Conflict)
+		} else {
+			fmt.Printf("⚡ %s: also backed up on another device, the repo kept theirs (%s) — review it in Restore\n", c.Entry.Path, c.Conflict)
+		}
+	}
+
+	var diverged *gsync.DivergedError
+	var summary string
+	switch {
+	case errors.As(err, &diverged):
+		summary = "committed locally, not pushed: conflicts with the remote need resolving in " + cfg.RepoPath
+	case errors.Is(err, backup.ErrUnreachable) && len(res.Bumped)+len(res.Retagged) > 0:
+		summary = changes(res) + ", committed locally (push pending)"
+	case errors.Is(err, backup.ErrUnreachable):
+		summary = "remote unreachable, nothing new to commit"
+	case err != nil:
+		summary = "backup failed"
+	case len(res.Bumped)+len(res.Retagged) > 0:
+		summary = changes(res)
+	default:
+		summary = "all entries up to date"
+	}
+	if len(res.Bumped) > 0 && res.Impact.Files > 0 {
+		summary += fmt.Sprintf(" — added to the repo: %s", res.Impact)
+	}
+	if len(res.Held) > 0 {
+		summary += fmt.Sprintf(", %d held back (conflict)", len(res.Held))
+	}
+	fmt.Println(summary)
+	warnPendingHooks(cfg)
+
+	if *scheduled {
+		recordRun(schedule.ModeBackup, started, summary, err)
+	}
+	return err
+}
+
+// changes lists the keys a backup gave new versions, and apart from them
+// those whose tags or definition alone changed.
+func changes(res backup.UnattendedResult) string {
+	var parts []string
+	if len(res.Bumped) > 0 {
+		parts = append(parts, fmt.Sprintf("%d updated: %s", len(res.Bumped), strings.Join(res.Bumped, ", ")))
+	}
+	if len(res.Retagged) > 0 {
+		parts = append(parts, fmt.Sprintf("%d with only tags or definition changed: %s", len(res.Retagged), strings.Join(res.Retagged, ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// recordRun saves the outcome of a scheduled run for the main menu.
+func recordRun(mode schedule.Mode, started time.Time, summary string, err error) {
+	r := schedule.LastRun{
+		Mode:       mode,
+		StartedAt:  started,
+		FinishedAt: time.Now(),
+		OK:         err == nil,
+		Summary:    summary,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	_ = schedule.SaveLastRun(r)
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/charmbracelet/x/term"
+	"github.com/solarisjon/dfc/internal/bundle"
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/devices"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// passphraseEnv supplies a bundle passphrase without a prompt, for scripts.
+const passphraseEnv = "DFC_BUNDLE_PASSPHRASE"
+
+// runExport writes tracked entries from the repo to a bundle.
+func runExport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("o", "", "bundle to write, or - for stdout (default dfc-<host>-<date>.tar.gz)")
+	encrypt := fs.Bool("encrypt", false, "encrypt the bundle with a passphrase (prompted, or $"+passphraseEnv+")")
+	opts := bundle.Options{Profile: cfg.DeviceProfile}
+	fs.Func("recipient", "encrypt the bundle to an age public key (repeatable)", func(s string) error {
+		r, err := age.ParseX25519Recipient(s)
+		if err != nil {
+			return err
+		}
+		opts.Recipients = append(opts.Recipients, r)
+		return nil
+	})
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dfc export [-o file] [-encrypt] [-recipient age1...] [entry...]")
+		fmt.Fprintln(fs.Output(), "Exports the named entries (by path or name), or all tracked entries.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !cfg.IsConfigured() {
+		return fmt.Errorf("dfc is not configured — run dfc to complete setup first")
+	}
+
+	entries := cfg.Entries
+	if fs.NArg() > 0 {
+		entries = nil
+		for _, target := range fs.Args() {
+			target = tildePath(target)
+			found := false
+			for _, e := range cfg.Entries {
+				if e.Path == target || strings.EqualFold(e.Name, target) {
+					entries = append(entries, e)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s is not tracked", target)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no entries to export")
+	}
+
+	err := gsync.EnsureRepo(cfg.RepoURL, cfg.RepoPath)
+	gsync.TrackUnpushed(cfg)
+	if errors.Is(err, gsync.ErrOffline) {
+		fmt.Fprintf(os.Stderr, "offline — exporting the repo as last fetched %s\n", gsync.LastFetched(cfg.RepoPath).Format(time.DateTime))
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if *encrypt {
+		if opts.Passphrase, err = readPassphrase(true); err != nil {
+			return err
+		}
+	}
+	if *out == "" {
+		*out = fmt.Sprintf("dfc-%s-%s.tar.gz", devices.Hostname(), time.Now().Format("2006-01-02"))
+		if *encrypt || len(opts.Recipients) > 0 {
+			*out += ".age"
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.OpenFile(*out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	info, err := bundle.Export(w, cfg.RepoPath, entries, opts)
+	if err != nil {
+		if *out != "-" {
+			_ = os.Remove(*out)
+		}
+		return err
+	}
+
+	exported := make(map[string]bool)
+	for _, e := range info.Entries {
+		exported[e.Path] = true
+	}
+	for _, e := range entries {
+		if !exported[e.Path] {
+			fmt.Fprintf(os.Stderr, "⚠ %s: not in the repo yet — back it up first\n", e.Path)
+		}
+	}
+	if *out != "-" {
+		size := int64(0)
+		if st, err := os.Stat(*out); err == nil {
+			size = st.Size()
+		}
+		fmt.Printf("exported %d entries to %s (%s)\n", len(info.Entries), *out, config.FormatSize(size))
+	}
+	return nil
+}
+
+// runImport loads a bundle into the repo, or restores it directly.
+func runImport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	restoreNow := fs.Bool("restore", false, "restore the bundle's entries to this machine instead of adding them to the repo")
+	force := fs.Bool("force", false, "replace differing repo content, or overwrite locally changed files with -restore")
+	identity := fs.String("identity", "", "age identity file to decrypt a bundle encrypted to a public key")
+	hooks := fs.Bool("hooks", false, "keep the hooks of the bundle's entries, printing each command (they are dropped otherwise)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dfc import [-restore] [-force] [-hooks] [-identity file] <bundle>")
+		fs.PrintDefaults()
+	}
+	// Allow the bundle before or after the flags.
+	var file string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		file, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if file == "" {
+		file = fs.Arg(0)
+	}
+	if file == "" {
+		fs.Usage()
+		return fmt.Errorf("no bundle given")
+	}
+	if !*restoreNow && !cfg.IsConfigured() {
+		return fmt.Errorf("dfc is not configured — run dfc to complete setup first, or use -restore")
+	}
+
+	dir, err := os.MkdirTemp("", "dfc-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	info, err := extractBundle(file, dir, *identity)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("bundle from %s, %s: %d entries\n", info.CreatedBy, info.Created.Local().Format(time.DateTime), len(info.Entries))
+
+	// Hooks are shell commands: run by -restore at once, and by the next
+	// backup or restore otherwise. Keep them only when asked to.
+	if cmds := info.HookCommands(dir); len(cmds) > 0 {
+		if *hooks {
+			fmt.Println("keeping the bundle's hooks, which run on this machine:")
+		} else {
+			if err := info.StripHooks(dir); err != nil {
+				return err
+			}
+			fmt.Println("⚠ dropped the hooks of the bundle's entries (-hooks keeps them):")
+		}
+		for _, c := range cmds {
+			fmt.Printf("  %s\n", c)
+		}
+	}
+
+	if *restoreNow {
+		return importRestore(cfg, dir, info, *force)
+	}
+	return importToRepo(cfg, dir, info, *force)
+}
+
+// extractBundle extracts file to dir, asking for what it takes to decrypt
+// it if it is encrypted.
+func extractBundle(file, dir, identityFile string) (*bundle.Info, error) {
+	open := func(ids ...age.Identity) (*bundle.Info, error) {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return bundle.Extract(f, dir, ids...)
+	}
+	info, err := open()
+	if !errors.Is(err, bundle.ErrEncrypted) {
+		return info, err
+	}
+
+	if identityFile != "" {
+		f, err := os.Open(identityFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		ids, err := age.ParseIdentities(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", identityFile, err)
+		}
+		return open(ids...)
+	}
+	pass, err := readPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	id, err := age.NewScryptIdentity(pass)
+	if err != nil {
+		return nil, err
+	}
+	return open(id)
+}
+
+// importRestore restores a bundle straight to the filesystem.
+func importRestore(cfg *config.Config, dir string, info *bundle.Info, force bool) error {
+	results, held, err := bundle.Restore(cfg, dir, info, force)
+	if err != nil {
+		return err
+	}
+	restored := 0
+	for _, p := range results {
+		for _, h := range p.Hooks {
+			fmt.Printf("  %s: %s\n", p.Entry.Path, h.Summary())
+		}
+		switch {
+		case p.Err != nil:
+			fmt.Printf("✗ %s: %v\n", p.Entry.Path, p.Err)
+		default:
+			restored++
+			fmt.Printf("✓ %s\n", p.Entry.Path)
+			for _, reason := range p.SkipReasons {
+				fmt.Printf("  %s: skipped %s\n", p.Entry.Path, reason)
+			}
+		}
+	}
+	for _, cr := range held {
+		fmt.Printf("⚡ %s: %s — not restored (-force overwrites it)\n", cr.Entry.Path, cr.State)
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("%d restored, %d held back\n", restored, len(held))
+	return nil
+}
+
+// importToRepo adds a bundle's content to the repo and tracks its entries,
+// ready to restore.
+func importToRepo(cfg *config.Config, dir string, info *bundle.Info, force bool) error {
+	err := gsync.EnsureRepo(cfg.RepoURL, cfg.RepoPath)
+	defer gsync.TrackUnpushed(cfg)
+	offline := errors.Is(err, gsync.ErrOffline)
+	if err != nil && !offline {
+		return err
+	}
+
+	res, err := bundle.AddToRepo(dir, cfg.RepoPath, force)
+	if err != nil {
+		return err
+	}
+	for _, key := range res.Added {
+		fmt.Printf("  %-20s %s\n", "added", key)
+	}
+	for _, key := range res.Replaced {
+		fmt.Printf("  %-20s %s\n", "replaced", key)
+	}
+	for _, key := range res.Kept {
+		fmt.Printf("  %-20s %s (the repo has another version; -force replaces it)\n", "kept repo's", key)
+	}
+
+	tracked := make(map[string]bool)
+	for _, e := range cfg.Entries {
+		tracked[e.Path] = true
+	}
+	added := 0
+	for _, e := range info.Entries {
+		if !tracked[e.Path] && config.TagsMatch(e.Tags, cfg.DeviceTagSet()) {
+			cfg.Entries = append(cfg.Entries, e)
+			added++
+		}
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	if changed := len(res.Added) + len(res.Replaced); changed > 0 {
+		message := fmt.Sprintf("dfc: import bundle from %s: %s", info.CreatedBy, strings.Join(append(res.Added, res.Replaced...), ", "))
+		if offline {
+			if _, err := gsync.Commit(cfg.RepoPath, message); err != nil {
+				return err
+			}
+			fmt.Println("offline — committed locally (push pending)")
+		} else if err := gsync.CommitAndPush(cfg.RepoPath, message); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("%d added to the repo, %d now tracked — restore them from dfc's Restore menu\n", len(res.Added)+len(res.Replaced), added)
+	return nil
+}
+
+// readPassphrase reads a bundle passphrase from the environment or the
+// terminal, asking twice when it is new.
+func readPassphrase(confirm bool) (string, error) {
+	if pass := os.Getenv(passphraseEnv); pass != "" {
+		return pass, nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return "", fmt.Errorf("no terminal to ask for the passphrase — set $%s", passphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	pass, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(pass) == 0 {
+		return "", fmt.Errorf("empty passphrase")
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Again: ")
+		again, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(again) != string(pass) {
+			return "", fmt.Errorf("the passphrases don't match")
+		}
+	}
+	return string(pass), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/solarisjon/dfc/internal/config"
+)
+
+const usage = `Usage: dfc [command]
+
+Without a command, dfc starts the interactive TUI.
+
+Commands:
+  backup    Back up all tracked entries, commit and push
+  pull      Sync the repo and report entries that differ
+  edit      Rename or relocate an entry, or change its name or description
+  hooks     Review, accept or reject entry hooks other devices shared
+  watch     Watch tracked entries and back them up automatically
+  schedule  Install, inspect or remove periodic backup/pull timers
+  export    Write entries from the repo to a portable .tar.gz bundle
+  import    Load a bundle into the repo, or restore it with -restore
+  check     Verify the integrity of a deduplicating (dedup:) store
+  prune     Reclaim the space of chunks a dedup: store no longer uses
+  help      Show this help
+`
+
+// runCommand dispatches a non-interactive subcommand.
+func runCommand(cfg *config.Config, name string, args []string) error {
+	switch name {
+	case "backup":
+		return runBackup(cfg, args)
+	case "pull":
+		return runPull(cfg, args)
+	case "edit":
+		return runEdit(cfg, args)
+	case "hooks":
+		return runHooks(cfg, args)
+	case "schedule":
+		return runSchedule(cfg, args)
+	case "watch":
+		return runWatch(cfg, args)
+	case "export":
+		return runExport(cfg, args)
+	case "import":
+		return runImport(cfg, args)
+	case "check":
+		return runCheck(cfg, args)
+	case "prune":
+		return runPrune(cfg, args)
+	case "merge-file": // git merge driver, see sync.installMergeDriver
+		return runMergeFile(args)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
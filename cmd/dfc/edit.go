@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/entry"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// runEdit changes an entry's path, name, description or limits. A new path
+// moves the entry's content in the repo, keeping its version, and records
+// the move so other devices follow it.
+func runEdit(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	newPath := fs.String("path", "", "new path of the entry")
+	name := fs.String("name", "", "new name")
+	desc := fs.String("description", "", "new description")
+	replace := fs.Bool("replace", false, "if the new path already has a copy in the repo, replace it")
+	keep := fs.Bool("keep", false, "if the new path already has a copy in the repo, keep it")
+	var limits config.Limits
+	fs.Func("max-file-size", "skip the entry's files larger than this (e.g. 10MiB, none, or \"\" for the global limit)", sizeFlag(&limits.MaxFileSize))
+	fs.Func("max-entry-size", "skip the entry's files beyond this total", sizeFlag(&limits.MaxEntrySize))
+	fs.Func("lfs-over", "store the entry's files larger than this through Git LFS", sizeFlag(&limits.LFSOver))
+	fs.Func("binary", "what to do with binary files: keep, skip or lfs (\"\" for the global setting)", func(s string) error {
+		limits.Binary = strings.TrimSpace(s)
+		return config.ValidateBinary(limits.Binary)
+	})
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: dfc edit <path|name> [-path new] [-name n] [-description d] [-replace|-keep] [-max-file-size s] [-max-entry-size s] [-lfs-over s] [-binary b]")
+		fs.PrintDefaults()
+	}
+	// Allow the entry before or after the flags.
+	var target string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		target, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if target == "" {
+		target = fs.Arg(0)
+	}
+	if target == "" {
+		fs.Usage()
+		return fmt.Errorf("no entry given")
+	}
+	target = tildePath(target)
+
+	index := -1
+	for i, e := range cfg.Entries {
+		if e.Path == target || strings.EqualFold(e.Name, target) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("%s is not tracked", target)
+	}
+
+	from := cfg.Entries[index]
+	to := from
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["name"] {
+		to.Name = strings.TrimSpace(*name)
+	}
+	if set["description"] {
+		to.Description = strings.TrimSpace(*desc)
+	}
+	if set["max-file-size"] {
+		to.Limits.MaxFileSize = limits.MaxFileSize
+	}
+	if set["max-entry-size"] {
+		to.Limits.MaxEntrySize = limits.MaxEntrySize
+	}
+	if set["lfs-over"] {
+		to.Limits.LFSOver = limits.LFSOver
+	}
+	if set["binary"] {
+		to.Limits.Binary = limits.Binary
+	}
+	if set["path"] {
+		to.Path = tildePath(strings.TrimSpace(*newPath))
+		if to.Path == "" {
+			return fmt.Errorf("path cannot be empty")
+		}
+		for i, e := range cfg.Entries {
+			if i != index && e.Path == to.Path {
+				return fmt.Errorf("%s is already tracked", to.Path)
+			}
+		}
+		if !set["name"] && from.Name == entry.FriendlyName(from.Path) {
+			to.Name = entry.FriendlyName(to.Path)
+		}
+		if entry.Exists(to.Path) {
+			to.IsDir = entry.IsDir(to.Path)
+		}
+	}
+	if to.Name == "" {
+		to.Name = entry.FriendlyName(to.Path)
+	}
+
+	if to.Path == from.Path || !cfg.IsConfigured() {
+		cfg.Entries[index] = to
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Updated %s\n", to.Path)
+		return nil
+	}
+
+	if err := gsync.EnsureRepo(cfg.RepoURL, cfg.RepoPath); err != nil {
+		return err
+	}
+	// Every profile's copy moves, so a sparse clone needs them all.
+	if err := gsync.CheckoutAll(cfg.RepoPath); err != nil {
+		return err
+	}
+	if storage.RelocateTargetExists(cfg.RepoPath, from, to) && !*replace && !*keep {
+		return fmt.Errorf("the repo already has a copy at %s — pass -replace or -keep", to.Path)
+	}
+	mf, err := manifest.Load(cfg.RepoPath)
+	if err != nil {
+		return err
+	}
+	oldVer := mf.GetVersion(storage.ManifestKey(from, cfg.DeviceProfile))
+	moved, err := storage.RelocateEntry(cfg.RepoPath, mf, from, to, *keep && !*replace)
+	if err != nil {
+		return err
+	}
+	mf.SetMeta(&to)
+	if err := mf.Save(cfg.RepoPath); err != nil {
+		return err
+	}
+
+	to.Variant = storage.ResolveVariant(cfg.RepoPath, to, cfg.DeviceProfile)
+	switch {
+	case *keep && !*replace && moved:
+		to.LocalVersion = 0
+	case to.LocalVersion == oldVer:
+		to.LocalVersion = mf.GetVersion(storage.ManifestKey(to, cfg.DeviceProfile))
+	}
+	cfg.Entries[index] = to
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	if err := gsync.CommitAndPush(cfg.RepoPath, fmt.Sprintf("dfc: rename %s to %s", from.Path, to.Path)); err != nil {
+		return err
+	}
+	fmt.Printf("Renamed %s to %s\n", from.Path, to.Path)
+	return nil
+}
+
+// sizeFlag parses a size flag into dst.
+func sizeFlag(dst *config.ByteSize) func(string) error {
+	return func(s string) error {
+		v, err := config.ParseByteSize(s)
+		if err != nil {
+			return err
+		}
+		*dst = v
+		return nil
+	}
+}
+
+// tildePath rewrites an absolute path under the home directory (as the shell
+// expands ~/...) to the ~/ form entries are stored in.
+func tildePath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || !filepath.IsAbs(path) {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return "~/" + filepath.ToSlash(rel)
+	}
+	return path
+}
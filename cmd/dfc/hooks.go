@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/hooks"
+)
+
+const hooksUsage = `Usage:
+  dfc hooks                     list hook changes other devices shared
+  dfc hooks accept [entry...]   run them from now on (all when no entry is given)
+  dfc hooks reject [entry...]   keep this device's hooks; the next backup shares them
+`
+
+// runHooks lists and confirms entry hooks that arrived from the repo. They
+// are commands, so none runs on this device until it is accepted here or
+// in the TUI.
+func runHooks(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		n := 0
+		for _, e := range cfg.Entries {
+			if e.PendingHooks == nil {
+				continue
+			}
+			n++
+			fmt.Printf("%s\n", e.Path)
+			for _, c := range hooks.Changes(e.Hooks, *e.PendingHooks) {
+				fmt.Printf("  %s\n", c)
+			}
+		}
+		if n == 0 {
+			fmt.Println("No hook changes waiting")
+		}
+		return nil
+	}
+
+	var apply func(*config.Entry) bool
+	var done string
+	switch args[0] {
+	case "accept":
+		apply, done = (*config.Entry).AcceptHooks, "accepted"
+	case "reject":
+		apply, done = (*config.Entry).RejectHooks, "rejected"
+	default:
+		fmt.Print(hooksUsage)
+		return fmt.Errorf("unknown hooks subcommand %q", args[0])
+	}
+
+	targets := args[1:]
+	changed := 0
+	for _, t := range targets {
+		tracked := false
+		for _, e := range cfg.Entries {
+			tracked = tracked || matchesAny(e, []string{t})
+		}
+		if !tracked {
+			return fmt.Errorf("%s is not tracked", t)
+		}
+	}
+	for i := range cfg.Entries {
+		e := &cfg.Entries[i]
+		if len(targets) > 0 && !matchesAny(*e, targets) {
+			continue
+		}
+		if apply(e) {
+			changed++
+			fmt.Printf("  %-10s %s\n", done, e.Path)
+		}
+	}
+	if changed == 0 {
+		fmt.Println("No hook changes waiting")
+		return nil
+	}
+	return cfg.Save()
+}
+
+// matchesAny reports whether e is one of targets, given by path or name.
+func matchesAny(e config.Entry, targets []string) bool {
+	for _, t := range targets {
+		t = tildePath(t)
+		if e.Path == t || strings.EqualFold(e.Name, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// warnPendingHooks points at dfc hooks when entries have hook changes
+// waiting for confirmation.
+func warnPendingHooks(cfg *config.Config) {
+	n := 0
+	for _, e := range cfg.Entries {
+		if e.PendingHooks != nil {
+			n++
+		}
+	}
+	if n > 0 {
+		fmt.Printf("⚠ hooks another device shared for %d tracked entries wait for confirmation and don't run until accepted — see dfc hooks\n", n)
+	}
+}
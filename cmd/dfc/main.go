@@ -6,6 +6,7 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/solarisjon/dfc/internal/config"
+	gsync "github.com/solarisjon/dfc/internal/sync"
 	"github.com/solarisjon/dfc/internal/ui"
 )
 
@@ -15,6 +16,20 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
 	}
+	if err := gsync.SetBackend(cfg.GitBackend); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in config: %v\n", err)
+		os.Exit(1)
+	}
+	gsync.SetCheckout(cfg)
+
+	// Subcommands run non-interactively; no arguments starts the TUI.
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	m := ui.New(cfg)
 	p := tea.NewProgram(m, tea.WithAltScreen())
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/solarisjon/dfc/internal/devices"
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+// runMergeFile is the git merge driver for the manifest and the device
+// registry. git calls it with the common ancestor, our version, their
+// version and the file's path in the repo; the merged file is written over
+// ours. Entries where both sides wrote different content are reported but
+// do not fail the merge — the manifest flags them.
+func runMergeFile(args []string) error {
+	if len(args) != 4 {
+		return fmt.Errorf("usage: dfc merge-file <base> <ours> <theirs> <path>")
+	}
+	base, ours, theirs := args[0], args[1], args[2]
+
+	switch filepath.Base(args[3]) {
+	case devices.FileName:
+		var regs [3]*devices.Registry
+		for i, path := range args[:3] {
+			r, err := devices.LoadFile(path)
+			if err != nil {
+				return err
+			}
+			regs[i] = r
+		}
+		return devices.Merge(regs[0], regs[1], regs[2]).SaveFile(ours)
+
+	default:
+		var mfs [3]*manifest.Manifest
+		for i, path := range []string{base, ours, theirs} {
+			mf, err := manifest.LoadFile(path)
+			if err != nil {
+				return err
+			}
+			mfs[i] = mf
+		}
+		merged, conflicts := manifest.Merge(mfs[0], mfs[1], mfs[2])
+		for _, key := range conflicts {
+			fmt.Fprintf(os.Stderr, "dfc: %s was backed up on two devices: %s\n", key, merged.Entries[key].Conflict)
+		}
+		return merged.SaveFile(ours)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/restore"
+	"github.com/solarisjon/dfc/internal/schedule"
+	"github.com/solarisjon/dfc/internal/storage"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// runPull syncs the local clone and reports which entries differ from the
+// repo. Nothing on the filesystem is restored.
+func runPull(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("pull", flag.ContinueOnError)
+	scheduled := fs.Bool("scheduled", false, "record the result as the last scheduled run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !cfg.IsConfigured() {
+		return fmt.Errorf("dfc is not configured — run dfc to complete setup first")
+	}
+
+	started := time.Now()
+	err := gsync.EnsureRepo(cfg.RepoURL, cfg.RepoPath)
+	gsync.TrackUnpushed(cfg)
+	if errors.Is(err, gsync.ErrOffline) {
+		fmt.Printf("offline — comparing against the repo as last fetched %s\n", gsync.LastFetched(cfg.RepoPath).Format(time.DateTime))
+		err = nil
+	}
+	if err != nil {
+		if *scheduled {
+			recordRun(schedule.ModePull, started, "sync failed", err)
+		}
+		return err
+	}
+
+	mf, err := manifest.Load(cfg.RepoPath)
+	if err != nil {
+		return err
+	}
+	rec := storage.Reconcile(cfg, mf)
+	for old, path := range rec.Moved {
+		fmt.Printf("  %-20s %s → %s\n", "moved", old, path)
+	}
+	for _, e := range rec.Untracked {
+		fmt.Printf("  %-20s %s (removed from the repo by %s)\n", "untracked", e.Path, mf.Removed[e.Path].RemovedBy)
+	}
+	for _, e := range rec.Hooks {
+		fmt.Printf("  %-20s %s (not run until accepted — see dfc hooks)\n", "hooks changed", e.Path)
+	}
+	for _, c := range rec.Contests {
+		outcome := "repo kept the other device's copy"
+		if c.Kept {
+			outcome = "repo kept this device's copy"
+		}
+		fmt.Printf("  %-20s %s (%s: %s)\n", "backed up twice", c.Entry.Path, outcome, c.Conflict)
+	}
+	if rec.Changed {
+		_ = cfg.Save()
+	}
+
+	counts := make(map[restore.ConflictState]int)
+	for _, cr := range restore.CheckConflicts(cfg.Entries, mf, cfg.DeviceProfile) {
+		counts[cr.State]++
+		if cr.State == restore.StateClean {
+			continue
+		}
+		ev := mf.GetEntry(storage.ManifestKey(cr.Entry, cfg.DeviceProfile))
+		fmt.Printf("  %-20s %s (local v%d, repo v%d)\n", cr.State, cr.Entry.Path, cr.Entry.LocalVersion, ev.Version)
+		if ev.Conflict != "" {
+			fmt.Printf("  %-20s %s\n", "", ev.Conflict)
+		}
+	}
+
+	var parts []string
+	for _, st := range []restore.ConflictState{restore.StateNewerInRepo, restore.StateConflict, restore.StateModifiedLocal} {
+		if counts[st] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[st], st))
+		}
+	}
+	summary := "all entries in sync"
+	if len(parts) > 0 {
+		summary = strings.Join(parts, ", ")
+	}
+	fmt.Println(summary)
+
+	if *scheduled {
+		recordRun(schedule.ModePull, started, summary, nil)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/schedule"
+)
+
+const scheduleUsage = `Usage:
+  dfc schedule install [-mode backup|pull] [-every 1h] [-cron] [-print]
+  dfc schedule status
+  dfc schedule remove [-mode backup|pull]
+`
+
+// runSchedule manages systemd user timers (or crontab lines) that run
+// `dfc backup` or `dfc pull` periodically.
+func runSchedule(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Print(scheduleUsage)
+		return fmt.Errorf("missing schedule subcommand")
+	}
+
+	switch args[0] {
+	case "install":
+		fs := flag.NewFlagSet("schedule install", flag.ContinueOnError)
+		mode := fs.String("mode", string(schedule.ModeBackup), "what to run: backup or pull")
+		every := fs.Duration("every", time.Hour, "how often to run")
+		cron := fs.Bool("cron", false, "install a crontab line instead of systemd units")
+		printOnly := fs.Bool("print", false, "print the units or crontab line without installing")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if !cfg.IsConfigured() {
+			return fmt.Errorf("dfc is not configured — run dfc to complete setup first")
+		}
+		opts := schedule.Options{Mode: schedule.Mode(*mode), Interval: *every, Cron: *cron}
+		if !*cron && !schedule.HasSystemd() {
+			fmt.Println("systemd user manager not available — falling back to cron")
+			opts.Cron = true
+		}
+		if *printOnly {
+			return printSchedule(opts)
+		}
+		desc, err := schedule.Install(opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Installed " + desc)
+		return nil
+
+	case "status":
+		installed, err := schedule.Status()
+		if err != nil {
+			return err
+		}
+		if len(installed) == 0 {
+			fmt.Println("No schedules installed")
+		}
+		for _, in := range installed {
+			fmt.Printf("%-7s %-8s %s\n", in.Mode, in.Kind, in.Detail)
+		}
+		last, err := schedule.LoadLastRun()
+		if err != nil {
+			return err
+		}
+		if last != nil {
+			status := "ok"
+			if !last.OK {
+				status = "failed: " + last.Error
+			}
+			fmt.Printf("\nLast run: %s at %s — %s (%s)\n",
+				last.Mode, last.FinishedAt.Format(time.RFC1123), last.Summary, status)
+		}
+		return nil
+
+	case "remove":
+		fs := flag.NewFlagSet("schedule remove", flag.ContinueOnError)
+		mode := fs.String("mode", "", "only remove this mode (default: all)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		removed, err := schedule.Remove(schedule.Mode(*mode))
+		for _, r := range removed {
+			fmt.Println("Removed " + r)
+		}
+		if err == nil && len(removed) == 0 {
+			fmt.Println("No schedules installed")
+		}
+		return err
+
+	default:
+		fmt.Print(scheduleUsage)
+		return fmt.Errorf("unknown schedule subcommand %q", args[0])
+	}
+}
+
+func printSchedule(opts schedule.Options) error {
+	if !opts.Mode.Valid() {
+		return fmt.Errorf("unknown mode %q (want backup or pull)", opts.Mode)
+	}
+	if exe, err := os.Executable(); err == nil {
+		opts.Binary = exe
+	}
+	if opts.Cron {
+		line, err := schedule.CronLine(opts)
+		if err != nil {
+			return err
+		}
+		fmt.Println(line)
+		return nil
+	}
+	fmt.Print(schedule.ServiceUnit(opts))
+	fmt.Println()
+	fmt.Print(schedule.TimerUnit(opts))
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/solarisjon/dfc/internal/config"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// runCheck verifies the integrity of a deduplicating store.
+func runCheck(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !cfg.IsConfigured() {
+		return fmt.Errorf("dfc is not configured — run dfc to complete setup first")
+	}
+
+	report, err := gsync.CheckStore(cfg.RepoURL)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d snapshots; the newest holds %d files (%s)\n", report.Snapshots, report.Files, config.FormatSize(report.FileSize))
+	fmt.Printf("%d chunks, %s stored\n", report.Chunks, config.FormatSize(report.ChunkSize))
+	if report.Unused > 0 {
+		fmt.Printf("%d chunks unused — run dfc prune to reclaim them\n", report.Unused)
+	}
+	for _, p := range report.Problems {
+		fmt.Printf("✗ %s\n", p)
+	}
+	if len(report.Problems) > 0 {
+		return fmt.Errorf("%d problems found in %s", len(report.Problems), cfg.RepoURL)
+	}
+	fmt.Println("no problems found")
+	return nil
+}
+
+// runPrune removes the chunks of a deduplicating store no snapshot uses.
+func runPrune(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !cfg.IsConfigured() {
+		return fmt.Errorf("dfc is not configured — run dfc to complete setup first")
+	}
+
+	removed, freed, err := gsync.PruneStore(cfg.RepoURL)
+	if removed > 0 {
+		fmt.Printf("removed %d unused chunks, %s reclaimed\n", removed, config.FormatSize(freed))
+	} else if err == nil {
+		fmt.Println("nothing to prune")
+	}
+	return err
+}
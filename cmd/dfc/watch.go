@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/watch"
+)
+
+func runWatch(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	debounce := fs.Duration("debounce", watch.DefaultDebounce, "quiet period after the last write before backing up")
+	maxBackoff := fs.Duration("max-backoff", watch.DefaultMaxBackoff, "longest delay between retries while the remote is unreachable")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !cfg.IsConfigured() {
+		return fmt.Errorf("dfc is not configured — run dfc to complete setup first")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return watch.Run(ctx, watch.Options{
+		Debounce:   *debounce,
+		MaxBackoff: *maxBackoff,
+		Logger:     log.New(os.Stdout, "", log.LstdFlags),
+	})
+}
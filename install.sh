@@ -4,8 +4,10 @@ set -euo pipefail
 BINARY="dfc"
 INSTALL_DIR="${HOME}/.local/bin"
 
-echo "Building ${BINARY}..."
-go build -o "${BINARY}" ./cmd/dfc
+VERSION="$(git describe --tags --always --dirty 2>/dev/null || echo dev)"
+
+echo "Building ${BINARY} ${VERSION}..."
+go build -ldflags "-X github.com/solarisjon/dfc/internal/version.Version=${VERSION}" -o "${BINARY}" ./cmd/dfc
 
 mkdir -p "${INSTALL_DIR}"
 mv "${BINARY}" "${INSTALL_DIR}/${BINARY}"
@@ -10,7 +10,9 @@ import (
 
 	"github.com/solarisjon/dfc/internal/config"
 	"github.com/solarisjon/dfc/internal/hash"
+	"github.com/solarisjon/dfc/internal/hooks"
 	"github.com/solarisjon/dfc/internal/storage"
+	gsync "github.com/solarisjon/dfc/internal/sync"
 )
 
 // Progress reports the status of a single entry backup.
@@ -22,17 +24,33 @@ type Progress struct {
 	Err         error
 	BytesCopied int64
 	BytesTotal  int64
-	ContentHash string   // SHA256 hash of the source after backup
-	Skipped     int      // number of files skipped due to errors
-	SkipReasons []string // why each file was skipped
-	Copied      int      // number of files successfully copied
-	Warning     string   // human-readable warning if something noteworthy happened
+	ContentHash string         // SHA256 hash of the source after backup
+	Skipped     int            // number of files skipped due to errors
+	SkipReasons []string       // why each file was skipped
+	Copied      int            // number of files successfully copied
+	RepoFiles   int            // files the backup adds to or changes in the repo
+	RepoNew     int            // of RepoFiles, files new to the repo
+	RepoBytes   int64          // size of those files
+	LFSBytes    int64          // of RepoBytes, what is stored through Git LFS
+	LFSFiles    []string       // the entry's files stored through Git LFS, relative to the repo
+	Warning     string         // human-readable warning if something noteworthy happened
+	Hooks       []hooks.Result // hook commands run for this entry
+	Layers      []string       // profile layers written to, for layered entries
 }
 
 // Run backs up all entries into the repo working tree.
 // It sends progress updates on the returned channel.
 // The profile parameter determines where profile-specific entries are stored.
-func Run(entries []config.Entry, repoPath string, profile string) <-chan Progress {
+// When the profile inherits from other layers, each file is written back to
+// the layer it was restored from; new files go to the entry's Layer, or to
+// the profile's own layer if none is set.
+// Global hooks run before the first entry and after the last; their results
+// are reported on the first and last entry's progress respectively. With no
+// entries neither runs.
+// Files over the size limits (each entry's merged over limits), or binary
+// when those are to be skipped, stay out of the repo with the reason in
+// SkipReasons; files routed through Git LFS are added to .gitattributes.
+func Run(entries []config.Entry, repoPath string, profile string, global config.Hooks, limits config.Limits) <-chan Progress {
 	ch := make(chan Progress)
 
 	go func() {
@@ -40,14 +58,43 @@ func Run(entries []config.Entry, repoPath string, profile string) <-chan Progres
 
 		repoPath = expandHome(repoPath)
 		total := len(entries)
+		// The global post-hook rides on the last entry's progress, so with
+		// no entries neither global hook runs and a pre/post pair is never
+		// left half done.
+		if total == 0 {
+			return
+		}
+		lfs := gsync.LFS(repoPath)
+
+		// Global pre-hook: a failure with skip_on_failure skips every entry.
+		globalPre, hasGlobalPre := hooks.Run(global, hooks.PreBackup, config.Entry{}, true)
+		skipAll := hasGlobalPre && globalPre.Failed() && global.SkipOnFailure
 
 		for i, entry := range entries {
 			p := Progress{Entry: entry, Index: i, Total: total}
+			if i == 0 && hasGlobalPre {
+				p.Hooks = append(p.Hooks, globalPre)
+			}
+			if skipAll {
+				p.Done = true
+				p.Err = fmt.Errorf("skipped: global pre-backup hook failed")
+				sendWithPostHooks(ch, p, global, i == total-1)
+				continue
+			}
+
+			if r, ok := hooks.Run(entry.Hooks, hooks.PreBackup, entry, false); ok {
+				p.Hooks = append(p.Hooks, r)
+				if r.Failed() && entry.Hooks.SkipOnFailure {
+					p.Done = true
+					p.Err = fmt.Errorf("skipped: %v", r.Err)
+					sendWithPostHooks(ch, p, global, i == total-1)
+					continue
+				}
+			}
 
 			srcPath := expandHome(entry.Path)
 			// Use storage paths: shared/ or profiles/<profile>/
-			relPath := storage.RepoDir(entry, profile)
-			destPath := filepath.Join(repoPath, relPath)
+			destPath := filepath.Join(repoPath, storage.RepoDir(entry, profile))
 
 			// Skip entries whose source path doesn't exist on this machine.
 			// For directory entries, create the directory first so it exists
@@ -57,41 +104,22 @@ func Run(entries []config.Entry, repoPath string, profile string) <-chan Progres
 					if mkErr := os.MkdirAll(srcPath, 0755); mkErr != nil {
 						p.Done = true
 						p.Warning = "source path not found — skipping"
-						ch <- p
+						sendWithPostHooks(ch, p, global, i == total-1)
 						continue
 					}
 					// Fall through — directory now exists, back it up
 				} else {
 					p.Done = true
 					p.Warning = "source path not found — skipping"
-					ch <- p
+					sendWithPostHooks(ch, p, global, i == total-1)
 					continue
 				}
 			}
 
-			// Auto-detect the actual type on disk in case the config entry is wrong
-			// (e.g. a path that used to be a file is now a directory).
-			isDir := entry.IsDir
-			if !isDir {
-				if info, statErr := os.Stat(srcPath); statErr == nil && info.IsDir() {
-					isDir = true
-				}
-			}
-
-			// If we're about to copy a directory but the destination exists as a
-			// file (left over from a previous backup when the entry was a file),
-			// remove the stale file so MkdirAll can create the directory.
-			if isDir {
-				if dstInfo, dstErr := os.Stat(destPath); dstErr == nil && !dstInfo.IsDir() {
-					os.Remove(destPath)
-				}
-			}
-
-			var err error
-			if isDir {
-				err = copyDir(srcPath, destPath, &p)
-			} else {
-				err = copyFile(srcPath, destPath, &p)
+			c := &copier{p: &p, repoPath: repoPath, limits: entry.Limits.Merge(limits), lfs: lfs}
+			isDir, err := c.copyEntry(entry, srcPath, destPath, profile)
+			if err == nil && len(p.LFSFiles) > 0 {
+				err = gsync.TrackLFS(repoPath, p.LFSFiles)
 			}
 
 			p.Done = true
@@ -106,21 +134,107 @@ func Run(entries []config.Entry, repoPath string, profile string) <-chan Progres
 				if hashErr == nil {
 					p.ContentHash = h
 				}
+				if r, ok := hooks.Run(entry.Hooks, hooks.PostBackup, entry, false); ok {
+					p.Hooks = append(p.Hooks, r)
+				}
 			}
-			ch <- p
+			sendWithPostHooks(ch, p, global, i == total-1)
 		}
 	}()
 
 	return ch
 }
 
-func copyFile(src, dst string, p *Progress) error {
+// Plan works out what backing up entries would add to the repo without
+// writing anything: each result has RepoFiles, RepoBytes and LFSBytes, and
+// the files the limits would skip. Entries missing on this machine are left
+// out.
+func Plan(entries []config.Entry, repoPath string, profile string, limits config.Limits) []Progress {
+	repoPath = expandHome(repoPath)
+	lfs := gsync.LFS(repoPath)
+	var results []Progress
+	for i, entry := range entries {
+		srcPath := expandHome(entry.Path)
+		if _, err := os.Lstat(srcPath); err != nil {
+			continue
+		}
+		p := Progress{Entry: entry, Index: i, Total: len(entries), Done: true}
+		c := &copier{p: &p, repoPath: repoPath, limits: entry.Limits.Merge(limits), lfs: lfs, dry: true}
+		_, p.Err = c.copyEntry(entry, srcPath, filepath.Join(repoPath, storage.RepoDir(entry, profile)), profile)
+		results = append(results, p)
+	}
+	return results
+}
+
+// copier copies one entry into the repo, applying its limits. A dry copier
+// only works out what the copy would add.
+type copier struct {
+	p        *Progress
+	repoPath string
+	limits   config.Limits
+	lfs      gsync.LFSSupport
+	dry      bool
+	stored   int64 // bytes stored directly so far, for MaxEntrySize
+}
+
+// copyEntry copies the entry at srcPath to destPath, or across its layers,
+// and reports whether it is a directory.
+func (c *copier) copyEntry(entry config.Entry, srcPath, destPath, profile string) (bool, error) {
+	// Auto-detect the actual type on disk in case the config entry is wrong
+	// (e.g. a path that used to be a file is now a directory).
+	isDir := entry.IsDir
+	if !isDir {
+		if info, statErr := os.Stat(srcPath); statErr == nil && info.IsDir() {
+			isDir = true
+		}
+	}
+
+	// If we're about to copy a directory but the destination exists as a
+	// file (left over from a previous backup when the entry was a file),
+	// remove the stale file so MkdirAll can create the directory.
+	if isDir && !c.dry {
+		if dstInfo, dstErr := os.Stat(destPath); dstErr == nil && !dstInfo.IsDir() {
+			os.Remove(destPath)
+		}
+	}
+
+	if layers := storage.EntryLayers(c.repoPath, entry, profile); len(layers) > 1 {
+		return isDir, c.copyLayered(srcPath, entry, layers, isDir)
+	} else if isDir {
+		return isDir, c.copyDir(srcPath, destPath)
+	}
+	return isDir, c.copyFile(srcPath, destPath)
+}
+
+// sendWithPostHooks sends p, first running the global post-backup hook if
+// this is the last entry so its result is reported alongside it.
+func sendWithPostHooks(ch chan<- Progress, p Progress, global config.Hooks, last bool) {
+	if last {
+		if r, ok := hooks.Run(global, hooks.PostBackup, config.Entry{}, true); ok {
+			p.Hooks = append(p.Hooks, r)
+		}
+	}
+	ch <- p
+}
+
+func (c *copier) copyFile(src, dst string) error {
+	p := c.p
 	info, err := os.Stat(src)
 	if err != nil {
 		return fmt.Errorf("stat %s: %w", src, err)
 	}
 	p.BytesTotal = info.Size()
 
+	lfs, reason := c.admit(src, info.Size())
+	if reason != "" {
+		skipFile(p, src, filepath.Dir(src), reason)
+		return fmt.Errorf("skipped: %s", reason)
+	}
+	c.account(src, dst, info.Size(), lfs)
+	if c.dry {
+		return nil
+	}
+
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 		return err
 	}
@@ -146,7 +260,93 @@ func copyFile(src, dst string, p *Progress) error {
 	return out.Chmod(info.Mode())
 }
 
-func copyDir(src, dst string, p *Progress) error {
+// NewFileLayer returns the layer new files of a layered entry are written
+// to: the entry's Layer if it is one of layers, otherwise the most specific.
+func NewFileLayer(entry config.Entry, layers []string) string {
+	for _, l := range layers {
+		if strings.EqualFold(l, entry.Layer) {
+			return l
+		}
+	}
+	return layers[0]
+}
+
+// NewFiles lists the files of a layered entry that exist locally but in
+// none of its layers — the files whose layer is ambiguous. A file entry
+// that is in no layer yet is reported as ".".
+func NewFiles(entry config.Entry, repoPath string, layers []string) []string {
+	overlay := storage.Overlay(repoPath, entry, layers)
+	src := expandHome(entry.Path)
+	var files []string
+	_ = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return nil
+		}
+		if _, ok := overlay[rel]; !ok {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files
+}
+
+// copyLayered backs up a layered entry, writing each file into the layer
+// that currently provides it (see storage.Overlay) and new files into
+// NewFileLayer. The layers written to are recorded on p.
+func (c *copier) copyLayered(src string, entry config.Entry, layers []string, isDir bool) error {
+	repoPath := c.repoPath
+	overlay := storage.Overlay(repoPath, entry, layers)
+	newLayer := NewFileLayer(entry, layers)
+	written := make(map[string]bool)
+	layerFor := func(rel string) string {
+		l, ok := overlay[rel]
+		if !ok {
+			l = newLayer
+		}
+		written[l] = true
+		return l
+	}
+
+	var err error
+	if isDir {
+		err = c.copyTree(src, func(rel string, dir bool) string {
+			if dir {
+				return "" // created on demand beneath each file's layer
+			}
+			return filepath.Join(repoPath, storage.LayerDir(entry, layerFor(rel)), rel)
+		})
+	} else {
+		err = c.copyFile(src, filepath.Join(repoPath, storage.LayerDir(entry, layerFor("."))))
+	}
+
+	for _, l := range layers {
+		if written[l] {
+			c.p.Layers = append(c.p.Layers, l)
+		}
+	}
+	return err
+}
+
+func (c *copier) copyDir(src, dst string) error {
+	return c.copyTree(src, func(rel string, _ bool) string {
+		return filepath.Join(dst, rel)
+	})
+}
+
+// copyTree copies the tree at src, placing each path at dest(rel, isDir).
+// An empty destination for a directory means it is not created up front.
+func (c *copier) copyTree(src string, dest func(rel string, isDir bool) string) error {
+	p := c.p
 	// Count total bytes first (skip .git dirs and symlinks)
 	var totalBytes int64
 	_ = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
@@ -184,7 +384,7 @@ func copyDir(src, dst string, p *Progress) error {
 			skipFile(p, path, src, fmt.Sprintf("path error: %v", err))
 			return nil
 		}
-		target := filepath.Join(dst, rel)
+		target := dest(rel, d.IsDir())
 
 		// Handle symlinks: recreate them rather than following
 		if d.Type()&fs.ModeSymlink != 0 {
@@ -193,6 +393,9 @@ func copyDir(src, dst string, p *Progress) error {
 				skipFile(p, path, src, fmt.Sprintf("symlink read error: %v", err))
 				return nil
 			}
+			if c.dry {
+				return nil
+			}
 			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
 				skipFile(p, path, src, fmt.Sprintf("mkdir error: %v", err))
 				return nil
@@ -212,6 +415,9 @@ func copyDir(src, dst string, p *Progress) error {
 		}
 
 		if d.IsDir() {
+			if target == "" || c.dry {
+				return nil
+			}
 			return os.MkdirAll(target, 0755)
 		}
 
@@ -221,6 +427,16 @@ func copyDir(src, dst string, p *Progress) error {
 			return nil
 		}
 
+		lfs, reason := c.admit(path, info.Size())
+		if reason != "" {
+			skipFile(p, path, src, reason)
+			return nil
+		}
+		c.account(path, target, info.Size(), lfs)
+		if c.dry {
+			return nil
+		}
+
 		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
 			skipFile(p, path, src, fmt.Sprintf("mkdir error: %v", err))
 			return nil
@@ -262,8 +478,10 @@ func skipFile(p *Progress, path, base, reason string) {
 }
 
 // describeSkippedDir inspects a directory to explain why nothing was copied.
+// Returns "" if it has regular files, which were skipped for their own
+// reasons.
 func describeSkippedDir(dir string) string {
-	var symlinks, sockets, other int
+	var symlinks, sockets, other, regular int
 	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return nil
@@ -274,9 +492,14 @@ func describeSkippedDir(dir string) string {
 			sockets++
 		} else if !d.Type().IsRegular() {
 			other++
+		} else {
+			regular++
 		}
 		return nil
 	})
+	if regular > 0 {
+		return "" // skipped for the reasons in SkipReasons
+	}
 
 	parts := []string{}
 	if symlinks > 0 {
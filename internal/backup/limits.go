@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/hash"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// sniffLen is how much of a file binary detection reads, as git does.
+const sniffLen = 8000
+
+// admit decides whether the file at path, of size bytes, goes into the
+// repo. A non-empty reason means it is skipped; lfs means it is stored
+// through Git LFS. Files through LFS don't count towards MaxEntrySize.
+func (c *copier) admit(path string, size int64) (lfs bool, reason string) {
+	l := c.limits
+	if max := l.MaxFileSize.Limit(); max >= 0 && size > max {
+		return false, fmt.Sprintf("%s is over max_file_size (%s)", config.FormatSize(size), l.MaxFileSize)
+	}
+
+	binary := (l.Binary == config.BinarySkip || l.Binary == config.BinaryLFS) && isBinary(path)
+	if binary && l.Binary == config.BinarySkip {
+		return false, "binary file"
+	}
+	over := l.LFSOver.Limit()
+	lfs = binary || (over >= 0 && size > over)
+	if lfs {
+		switch c.lfs {
+		case gsync.LFSUnneeded:
+			lfs = false // a store keeps large files as they are
+		case gsync.LFSMissing:
+			why := "binary file"
+			if !binary {
+				why = fmt.Sprintf("%s is over lfs_over (%s)", config.FormatSize(size), l.LFSOver)
+			}
+			return false, why + " and Git LFS needs git-lfs and the git binary"
+		}
+	}
+
+	if !lfs {
+		if max := l.MaxEntrySize.Limit(); max >= 0 && c.stored+size > max {
+			return false, fmt.Sprintf("the entry would be over max_entry_size (%s)", l.MaxEntrySize)
+		}
+		c.stored += size
+	}
+	return lfs, ""
+}
+
+// account records a file the backup writes to dst: it adds to the repo
+// unless dst already holds the same content.
+func (c *copier) account(src, dst string, size int64, lfs bool) {
+	p := c.p
+	if lfs {
+		if rel, err := filepath.Rel(c.repoPath, dst); err == nil {
+			p.LFSFiles = append(p.LFSFiles, filepath.ToSlash(rel))
+		}
+	}
+	if !differs(src, dst, size) {
+		return
+	}
+	if _, err := os.Lstat(dst); err != nil {
+		p.RepoNew++
+	}
+	p.RepoFiles++
+	p.RepoBytes += size
+	if lfs {
+		p.LFSBytes += size
+	}
+}
+
+// differs reports whether dst is missing or has other content than src.
+func differs(src, dst string, size int64) bool {
+	info, err := os.Lstat(dst)
+	if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		return true
+	}
+	a, err := hash.HashFile(src)
+	if err != nil {
+		return true
+	}
+	b, err := hash.HashFile(dst)
+	return err != nil || a != b
+}
+
+// isBinary reports whether the file at path looks binary: it has a NUL
+// byte near the start, the test git uses.
+func isBinary(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, sniffLen)
+	n, _ := io.ReadFull(f, buf)
+	return bytes.IndexByte(buf[:n], 0) >= 0
+}
+
+// Impact is what a backup adds to the repo.
+type Impact struct {
+	Files    int
+	Bytes    int64
+	LFSBytes int64 // of Bytes, what goes through Git LFS
+	Skipped  int   // files left out
+}
+
+// SizeImpact totals the repo impact of backup results.
+func SizeImpact(results []Progress) Impact {
+	var im Impact
+	for _, p := range results {
+		im.Files += p.RepoFiles
+		im.Bytes += p.RepoBytes
+		im.LFSBytes += p.LFSBytes
+		im.Skipped += p.Skipped
+	}
+	return im
+}
+
+func (im Impact) String() string {
+	s := fmt.Sprintf("%d %s, %s", im.Files, plural(im.Files, "file"), config.FormatSize(im.Bytes))
+	if im.LFSBytes > 0 {
+		s += fmt.Sprintf(" (%s through Git LFS)", config.FormatSize(im.LFSBytes))
+	}
+	return s
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
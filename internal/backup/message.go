@@ -0,0 +1,138 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/devices"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+)
+
+// Commit message trailers, one Dfc-Entry per manifest key the backup bumped:
+//
+//	Dfc-Device: laptop
+//	Dfc-Profile: work
+//	Dfc-Entry: shared/~/.zshrc v4
+//
+// List an entry's history with
+// git log --grep '^Dfc-Entry: shared/~/.zshrc v'.
+const (
+	TrailerDevice  = "Dfc-Device"
+	TrailerProfile = "Dfc-Profile"
+	TrailerEntry   = "Dfc-Entry"
+)
+
+// CommitMessage describes a backup recorded with Record: a subject of
+// prefix and the changed entries' names, a paragraph per entry with its
+// manifest keys, new versions and file changes, and trailers for scripts.
+// Keys in retagged only had their tags or definition updated; they are
+// listed as such and get no Dfc-Entry trailer, as they have no new version.
+func CommitMessage(prefix string, cfg *config.Config, results []Progress, bumped, retagged []string) string {
+	mf, err := manifest.Load(cfg.RepoPath)
+	if err != nil {
+		mf = &manifest.Manifest{}
+	}
+
+	var names, paragraphs []string
+	for _, p := range results {
+		if !p.Done || p.Err != nil {
+			continue
+		}
+		// Its own key, those of profiles inheriting a layer it wrote, and any
+		// key whose tags or definition alone changed.
+		keys, retags := keysFor(p.Entry.Path, bumped), keysFor(p.Entry.Path, retagged)
+		if len(keys) == 0 && len(retags) == 0 {
+			continue
+		}
+
+		name := p.Entry.Name
+		if name == "" {
+			name = p.Entry.Path
+		}
+		names = append(names, name)
+		var b strings.Builder
+		if name == p.Entry.Path {
+			b.WriteString(name + "\n")
+		} else {
+			fmt.Fprintf(&b, "%s (%s)\n", name, p.Entry.Path)
+		}
+		for _, key := range keys {
+			fmt.Fprintf(&b, "  %s → version %d\n", key, mf.GetVersion(key))
+		}
+		for _, key := range retags {
+			fmt.Fprintf(&b, "  %s: tags or definition updated, still version %d\n", key, mf.GetVersion(key))
+		}
+		if len(keys) > 0 {
+			if len(p.Layers) > 0 {
+				fmt.Fprintf(&b, "  written to layers: %s\n", strings.Join(p.Layers, ", "))
+			}
+			fmt.Fprintf(&b, "  %s\n", fileChanges(p))
+		}
+		paragraphs = append(paragraphs, b.String())
+	}
+
+	var b strings.Builder
+	b.WriteString(prefix + " " + summarizeNames(names, len(bumped)+len(retagged)) + "\n")
+	for _, para := range paragraphs {
+		b.WriteString("\n" + para)
+	}
+	fmt.Fprintf(&b, "\n%s: %s\n", TrailerDevice, devices.Hostname())
+	if cfg.DeviceProfile != "" {
+		fmt.Fprintf(&b, "%s: %s\n", TrailerProfile, cfg.DeviceProfile)
+	}
+	for _, key := range bumped {
+		fmt.Fprintf(&b, "%s: %s v%d\n", TrailerEntry, key, mf.GetVersion(key))
+	}
+	return b.String()
+}
+
+// keysFor returns the keys in keys that belong to the entry at path.
+func keysFor(path string, keys []string) []string {
+	var own []string
+	for _, key := range keys {
+		if e, _, ok := storage.ParseKey(key); ok && e.Path == path {
+			own = append(own, key)
+		}
+	}
+	return own
+}
+
+// fileChanges summarises what a backup changed in the repo for one entry,
+// e.g. "2 files added, 1 changed, 4.2 KiB".
+func fileChanges(p Progress) string {
+	if p.RepoFiles == 0 {
+		return "no file changes"
+	}
+	var parts []string
+	if p.RepoNew > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s added", p.RepoNew, plural(p.RepoNew, "file")))
+	}
+	if changed := p.RepoFiles - p.RepoNew; changed > 0 {
+		if len(parts) == 0 {
+			parts = append(parts, fmt.Sprintf("%d %s changed", changed, plural(changed, "file")))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d changed", changed))
+		}
+	}
+	s := strings.Join(parts, ", ") + ", " + config.FormatSize(p.RepoBytes)
+	if p.LFSBytes > 0 {
+		s += fmt.Sprintf(" (%s through Git LFS)", config.FormatSize(p.LFSBytes))
+	}
+	return s
+}
+
+// summarizeNames lists up to three entry names for a commit subject.
+func summarizeNames(names []string, keys int) string {
+	const max = 3
+	switch {
+	case len(names) == 0 && keys == 1:
+		return "1 entry"
+	case len(names) == 0:
+		return fmt.Sprintf("%d entries", keys)
+	case len(names) <= max:
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:max], ", "), len(names)-max)
+}
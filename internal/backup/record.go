@@ -0,0 +1,139 @@
+package backup
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/devices"
+	"github.com/solarisjon/dfc/internal/hash"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+)
+
+// Record bumps manifest versions for successfully backed-up entries, stores
+// their tags and definitions, and updates the matching config entries' LocalVersion and
+// LastHash. Results are matched to cfg.Entries by path. The config is always
+// saved; the manifest and this device's registry record only when something
+// changed, so they are always part of the commit that follows.
+// Layered entries also bump every other profile that inherits a layer that
+// was written, so those devices see the change as a new version.
+// Returns the manifest keys with a new version, and separately those whose
+// tags or definition changed while their content did not.
+func Record(cfg *config.Config, results []Progress) (bumped, retagged []string, err error) {
+	mf, err := manifest.Load(cfg.RepoPath)
+	if err != nil {
+		mf = &manifest.Manifest{Entries: make(map[string]manifest.EntryVersion)}
+	}
+
+	for _, p := range results {
+		if !p.Done || p.Err != nil {
+			continue
+		}
+		for i := range cfg.Entries {
+			e := &cfg.Entries[i]
+			if e.Path != p.Entry.Path {
+				continue
+			}
+			mkey := storage.ManifestKey(*e, cfg.DeviceProfile)
+			versionBumped := mf.BumpVersion(mkey, p.ContentHash)
+			if !versionBumped && p.RepoFiles > 0 && p.ContentHash != e.LastHash {
+				// The source changed and the repo's copy with it, but the
+				// manifest already records its hash. A repo copy that merely
+				// differs from an unchanged source is not a new version.
+				ev := mf.Entries[mkey]
+				ev.ContentHash = ""
+				mf.Entries[mkey] = ev
+				versionBumped = mf.BumpVersion(mkey, p.ContentHash)
+			}
+			if mf.Revive(e.Path) {
+				versionBumped = true // the tombstone must go out with this commit
+			}
+			metaChanged := mf.SetMeta(e)
+			tagsChanged := mf.SetTags(mkey, config.NormalizeTags(e.Tags))
+			switch {
+			case versionBumped:
+				bumped = append(bumped, mkey)
+			case tagsChanged || metaChanged:
+				retagged = append(retagged, mkey)
+			}
+			e.LocalVersion = mf.GetVersion(mkey)
+			e.LastHash = p.ContentHash
+			if len(p.Layers) > 0 {
+				bumped = append(bumped, bumpInheritors(cfg, mf, *e, p.Layers)...)
+			}
+			break
+		}
+	}
+
+	if err := cfg.Save(); err != nil {
+		return bumped, retagged, err
+	}
+	if len(bumped) > 0 || len(retagged) > 0 {
+		if err := mf.Save(cfg.RepoPath); err != nil {
+			return bumped, retagged, err
+		}
+		reg, err := devices.Load(cfg.RepoPath)
+		if err != nil {
+			return bumped, retagged, err
+		}
+		reg.Update(cfg, true)
+		if err := reg.Save(cfg.RepoPath); err != nil {
+			return bumped, retagged, err
+		}
+	}
+	return bumped, retagged, nil
+}
+
+// bumpInheritors re-hashes a layered entry as seen by every other profile
+// whose layers include one of written, bumping their manifest keys if the
+// combined content changed. Returns the keys that were bumped.
+func bumpInheritors(cfg *config.Config, mf *manifest.Manifest, e config.Entry, written []string) []string {
+	profiles, err := storage.LoadProfiles(cfg.RepoPath)
+	if err != nil {
+		return nil
+	}
+	repoPath := expandHome(cfg.RepoPath)
+
+	var bumped []string
+	for _, name := range profiles.Names() {
+		if strings.EqualFold(name, cfg.DeviceProfile) {
+			continue
+		}
+		layers := profiles.Layers(name)
+		if !inheritsAny(layers, written) {
+			continue
+		}
+		overlay := storage.Overlay(repoPath, e, layers)
+		if len(overlay) == 0 {
+			continue
+		}
+		files := make(map[string]string, len(overlay))
+		for rel, l := range overlay {
+			files[rel] = filepath.Join(repoPath, storage.LayerDir(e, l), rel)
+		}
+
+		var h string
+		if e.IsDir {
+			h = hash.HashTree(files)
+		} else if h, err = hash.HashFile(files["."]); err != nil {
+			continue
+		}
+		key := storage.LayerKey(e, name)
+		if mf.BumpVersion(key, h) {
+			bumped = append(bumped, key)
+		}
+	}
+	return bumped
+}
+
+func inheritsAny(layers, written []string) bool {
+	for _, l := range layers {
+		for _, w := range written {
+			if l == w {
+				return true
+			}
+		}
+	}
+	return false
+}
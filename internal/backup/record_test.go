@@ -0,0 +1,42 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+func TestRecordBumpsOnlyChangedSources(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		lastHash string // this device's hash at its previous backup
+		want     int
+	}{
+		{"repo copy differs, source unchanged", "h2", 2},
+		{"source changed to the recorded hash", "h1", 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			repo := t.TempDir()
+			mf := &manifest.Manifest{Entries: map[string]manifest.EntryVersion{
+				"shared/~/.zshrc": {Version: 2, ContentHash: "h2"},
+			}}
+			if err := mf.Save(repo); err != nil {
+				t.Fatal(err)
+			}
+			cfg := &config.Config{RepoPath: repo, Entries: []config.Entry{
+				{Path: "~/.zshrc", LocalVersion: 2, LastHash: tc.lastHash},
+			}}
+			results := []Progress{{Entry: cfg.Entries[0], Done: true, ContentHash: "h2", RepoFiles: 1}}
+
+			bumped, _, err := Record(cfg, results)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.Entries[0].LocalVersion; got != tc.want {
+				t.Errorf("LocalVersion = %d, want %d (bumped %v)", got, tc.want, bumped)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package backup
+
+import (
+	"errors"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/restore"
+	"github.com/solarisjon/dfc/internal/storage"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// ErrUnreachable wraps failures talking to the remote. Callers that run
+// unattended retry these later instead of treating them as fatal.
+var ErrUnreachable = gsync.ErrOffline
+
+// UnattendedResult summarises a non-interactive backup.
+type UnattendedResult struct {
+	Progress []Progress               // per-entry outcome, in order
+	Held     []restore.ConflictResult // entries not backed up because of conflicts
+	Bumped   []string                 // manifest keys whose version changed
+	Retagged []string                 // manifest keys whose tags or definition alone changed
+	Pushed   bool                     // a commit was pushed (including a queued one)
+	Contests []storage.Contest        // entries another device backed up at the same time
+	Hooks    []config.Entry           // entries whose hooks another device changed, awaiting confirmation
+	Impact   Impact                   // what the backup added to the repo
+}
+
+// Unattended runs a complete backup without user interaction: sync the repo
+// (which pushes any commit left over from an earlier failed push), back up
+// entries that are safe to push, bump the manifest, then commit and push.
+// Entries that are in conflict or have a newer version in the repo are held
+// back rather than overwriting another device's work. The commit message
+// starts with prefix (see CommitMessage).
+// If the remote can't be reached the backup runs against the local clone as
+// last fetched and is committed locally; the error then wraps ErrUnreachable
+// and cfg.UnpushedSince is set until a later sync pushes it.
+func Unattended(cfg *config.Config, entries []config.Entry, prefix string) (UnattendedResult, error) {
+	var res UnattendedResult
+	defer gsync.TrackUnpushed(cfg)
+
+	queued := gsync.HasUnpushed(cfg.RepoPath)
+	offline := gsync.EnsureRepo(cfg.RepoURL, cfg.RepoPath)
+	if offline != nil && !errors.Is(offline, ErrUnreachable) {
+		return res, offline
+	}
+	res.Pushed = offline == nil && queued
+
+	mf, err := manifest.Load(cfg.RepoPath)
+	if err != nil {
+		return res, err
+	}
+	if migrated, err := storage.MigrateLegacyLayout(cfg, mf); err == nil && migrated > 0 {
+		_ = mf.Save(cfg.RepoPath)
+	}
+	rec := storage.Reconcile(cfg, mf)
+	res.Contests, res.Hooks = rec.Contests, rec.Hooks
+	if rec.Changed {
+		_ = cfg.Save()
+		entries = refreshEntries(entries, cfg.Entries, rec.Moved)
+	}
+
+	var safe []config.Entry
+	for _, cr := range restore.CheckConflicts(entries, mf, cfg.DeviceProfile) {
+		switch cr.State {
+		case restore.StateConflict, restore.StateNewerInRepo:
+			res.Held = append(res.Held, cr)
+		default:
+			safe = append(safe, cr.Entry)
+		}
+	}
+	if len(safe) == 0 {
+		return res, offline
+	}
+
+	for p := range Run(safe, cfg.RepoPath, cfg.DeviceProfile, cfg.Hooks, cfg.Limits) {
+		res.Progress = append(res.Progress, p)
+	}
+	res.Impact = SizeImpact(res.Progress)
+
+	res.Bumped, res.Retagged, err = Record(cfg, res.Progress)
+	if err != nil {
+		return res, err
+	}
+	if len(res.Bumped) == 0 && len(res.Retagged) == 0 {
+		return res, offline
+	}
+
+	message := CommitMessage(prefix, cfg, res.Progress, res.Bumped, res.Retagged)
+	if offline != nil {
+		if _, err := gsync.Commit(cfg.RepoPath, message); err != nil {
+			return res, err
+		}
+		return res, offline
+	}
+	if err := gsync.CommitAndPush(cfg.RepoPath, message); err != nil {
+		// Committed locally if the push failed; the next sync pushes it.
+		// Only an unreachable remote is worth retrying.
+		return res, err
+	}
+	res.Pushed = true
+	mf, err = manifest.Load(cfg.RepoPath)
+	if err != nil {
+		return res, err
+	}
+	if contests := storage.Recheck(cfg, mf); len(contests) > 0 {
+		res.Contests = append(res.Contests, contests...)
+		err = cfg.Save()
+	}
+	return res, err
+}
+
+// refreshEntries returns entries as they are now in resolved, matched by
+// path. Entries another device renamed are matched by their new path, and
+// dropped if they merged into one already in the result or were retired.
+func refreshEntries(entries, resolved []config.Entry, moved map[string]string) []config.Entry {
+	out := make([]config.Entry, 0, len(entries))
+	for _, e := range entries {
+		path := e.Path
+		if to, ok := moved[path]; ok {
+			path = to
+		}
+		for _, r := range resolved {
+			if r.Path == path && !containsPath(out, path) {
+				out = append(out, r)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func containsPath(entries []config.Entry, path string) bool {
+	for _, e := range entries {
+		if e.Path == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,660 @@
+// Package bundle moves entries between machines without the repo: Export
+// writes a selection of entries to a single .tar.gz, optionally encrypted,
+// and a bundle is loaded into another repo with AddToRepo or restored
+// straight to the filesystem with Restore.
+//
+// A bundle holds:
+//
+//	dfc-bundle.yaml          what it holds (Info)
+//	repo/.dfc-manifest.yaml  the manifest subset for its entries
+//	repo/.dfc-profiles.yaml  the profile layers, if the repo has any
+//	repo/shared/...          the entries' content in every profile layer
+//	repo/profiles/...        and variant, laid out as in the repo
+//	repo/variants/...
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/devices"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/restore"
+	"github.com/solarisjon/dfc/internal/storage"
+	"github.com/solarisjon/dfc/internal/version"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	infoFile = "dfc-bundle.yaml"
+	repoDir  = "repo"
+
+	manifestFile = ".dfc-manifest.yaml"
+	profilesFile = ".dfc-profiles.yaml"
+
+	format = 1 // of Info, raised when older dfc can't read a bundle
+)
+
+// ErrEncrypted is returned by Extract for an encrypted bundle when no
+// identity was given.
+var ErrEncrypted = errors.New("the bundle is encrypted")
+
+// Info describes a bundle. Its entries carry their definitions only, none
+// of the exporting device's sync state.
+type Info struct {
+	Format     int            `yaml:"format"`
+	Created    time.Time      `yaml:"created"`
+	CreatedBy  string         `yaml:"created_by"`        // hostname
+	Profile    string         `yaml:"profile,omitempty"` // the exporting device's profile
+	DFCVersion string         `yaml:"dfc_version"`
+	Entries    []config.Entry `yaml:"entries"`
+}
+
+// HookCommands lists the hook commands a bundle extracted to dir carries,
+// in its entries and in the definitions its manifest holds, one
+// "path: hook: command" line each. They would run on this machine, so
+// show them before keeping them.
+func (info *Info) HookCommands(dir string) []string {
+	var cmds []string
+	seen := make(map[string]bool)
+	add := func(path string, h config.Hooks) {
+		for _, c := range hookLines(path, h) {
+			if !seen[c] {
+				seen[c] = true
+				cmds = append(cmds, c)
+			}
+		}
+	}
+	for _, e := range info.Entries {
+		add(e.Path, e.Hooks)
+	}
+	if mf, err := Manifest(dir); err == nil {
+		paths := make([]string, 0, len(mf.Meta))
+		for p := range mf.Meta {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			add(p, mf.Meta[p].Hooks)
+		}
+	}
+	return cmds
+}
+
+func hookLines(path string, h config.Hooks) []string {
+	var lines []string
+	for _, c := range []struct{ name, cmd string }{
+		{"pre_backup", h.PreBackup},
+		{"post_backup", h.PostBackup},
+		{"pre_restore", h.PreRestore},
+		{"post_restore", h.PostRestore},
+	} {
+		if c.cmd != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s: %s", path, c.name, c.cmd))
+		}
+	}
+	return lines
+}
+
+// StripHooks drops the hooks of a bundle extracted to dir, from its entries
+// and from the definitions in its manifest, so that importing it runs no
+// commands its maker chose — not even once another device syncs them.
+func (info *Info) StripHooks(dir string) error {
+	for i := range info.Entries {
+		info.Entries[i].Hooks = config.Hooks{}
+	}
+	mf, err := Manifest(dir)
+	if err != nil {
+		return err
+	}
+	for p, meta := range mf.Meta {
+		meta.Hooks = config.Hooks{}
+		mf.Meta[p] = meta
+	}
+	return mf.Save(RepoPath(dir))
+}
+
+// Options control how a bundle is made. With neither Passphrase nor
+// Recipients set it isn't encrypted.
+type Options struct {
+	Profile    string          // the exporting device's profile, for machines without one
+	Passphrase string          // encrypt to a passphrase
+	Recipients []age.Recipient // encrypt to age public keys
+}
+
+// Export writes entries' content from the repo, with their manifest records
+// and definitions, to w. Entries with nothing in the repo are left out of
+// the bundle; the returned Info lists those that went in.
+func Export(w io.Writer, repoPath string, entries []config.Entry, opts Options) (*Info, error) {
+	repoPath = expandHome(repoPath)
+	mf, err := manifest.Load(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, e := range entries {
+		wanted[e.Path] = true
+	}
+	sub := &manifest.Manifest{Entries: make(map[string]manifest.EntryVersion), Meta: make(map[string]manifest.EntryMeta)}
+	var dirs []string
+	found := make(map[string]bool)
+	for key, ev := range mf.Entries {
+		e, _, ok := storage.ParseKey(key)
+		if !ok || !wanted[e.Path] {
+			continue
+		}
+		dir, _ := storage.KeyDir(key)
+		if _, err := os.Lstat(filepath.Join(repoPath, dir)); err != nil {
+			continue
+		}
+		sub.Entries[key] = ev
+		dirs = append(dirs, dir)
+		found[e.Path] = true
+	}
+
+	info := &Info{Format: format, Created: time.Now().UTC(), CreatedBy: devices.Hostname(), Profile: opts.Profile, DFCVersion: version.String()}
+	for _, e := range entries {
+		if !found[e.Path] {
+			continue
+		}
+		if meta, ok := mf.Meta[e.Path]; ok {
+			sub.Meta[e.Path] = meta
+		}
+		info.Entries = append(info.Entries, config.Entry{
+			Path:            e.Path,
+			Name:            e.Name,
+			Description:     e.Description,
+			IsDir:           e.IsDir,
+			ProfileSpecific: e.ProfileSpecific,
+			Tags:            e.Tags,
+			Layer:           e.Layer,
+			Hooks:           e.Hooks,
+			Limits:          e.Limits,
+		})
+	}
+	if len(info.Entries) == 0 {
+		return nil, fmt.Errorf("none of the entries has been backed up to the repo")
+	}
+
+	out, err := encrypt(w, opts)
+	if err != nil {
+		return nil, err
+	}
+	zw := gzip.NewWriter(out)
+	tw := tar.NewWriter(zw)
+
+	infoData, err := yaml.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	mfData, err := yaml.Marshal(sub)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeData(tw, infoFile, infoData); err != nil {
+		return nil, err
+	}
+	if err := writeData(tw, repoDir+"/"+manifestFile, mfData); err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(filepath.Join(repoPath, profilesFile)); err == nil {
+		if err := writeData(tw, repoDir+"/"+profilesFile, data); err != nil {
+			return nil, err
+		}
+	}
+	for _, dir := range dirs {
+		if err := writeTree(tw, repoPath, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return info, out.Close()
+}
+
+// encrypt wraps w in age encryption if opts ask for it.
+func encrypt(w io.Writer, opts Options) (io.WriteCloser, error) {
+	recipients := opts.Recipients
+	if opts.Passphrase != "" {
+		r, err := age.NewScryptRecipient(opts.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	if len(recipients) == 0 {
+		return nopCloser{w}, nil
+	}
+	return age.Encrypt(w, recipients...)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func writeData(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// writeTree adds the repo-relative file or directory rel, preserving
+// symlinks rather than following them.
+func writeTree(tw *tar.Writer, repoPath, rel string) error {
+	return filepath.WalkDir(filepath.Join(repoPath, rel), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(repoPath, p)
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = repoDir + "/" + filepath.ToSlash(relPath)
+		hdr.Uname, hdr.Gname = "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// Extract unpacks a bundle into dir, which should be empty, and returns its
+// Info. An encrypted bundle needs an identity that can decrypt it, or
+// Extract returns ErrEncrypted.
+func Extract(r io.Reader, dir string, identities ...age.Identity) (*Info, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len("age-encryption.org/")); string(magic) == "age-encryption.org/" {
+		if len(identities) == 0 {
+			return nil, ErrEncrypted
+		}
+		plain, err := age.Decrypt(br, identities...)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting the bundle: %w", err)
+		}
+		br = bufio.NewReader(plain)
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("not a dfc bundle: %w", err)
+	}
+	tr := tar.NewReader(zr)
+
+	var info *Info
+	var haveManifest bool
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading the bundle: %w", err)
+		}
+		name := path.Clean(hdr.Name)
+		if name == infoFile {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			info = &Info{}
+			if err := yaml.Unmarshal(data, info); err != nil {
+				return nil, fmt.Errorf("reading %s: %w", infoFile, err)
+			}
+			if info.Format > format {
+				return nil, fmt.Errorf("the bundle was made by a newer dfc (%s)", info.DFCVersion)
+			}
+			continue
+		}
+		if !strings.HasPrefix(name, repoDir+"/") || strings.HasPrefix(name, "/") || strings.Contains("/"+name+"/", "/../") {
+			return nil, fmt.Errorf("the bundle holds an unexpected path %q", hdr.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if name == repoDir+"/"+manifestFile {
+			// Its keys name the directories AddToRepo replaces, so check
+			// them all before writing anything.
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkKeys(data); err != nil {
+				return nil, err
+			}
+			if err := writeFile(target, bytes.NewReader(data), 0644); err != nil {
+				return nil, err
+			}
+			haveManifest = true
+			continue
+		}
+		if !haveManifest {
+			return nil, fmt.Errorf("the bundle holds %q before its manifest", hdr.Name)
+		}
+		if err := checkParents(dir, filepath.Dir(target)); err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeSymlink:
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+				err = os.Symlink(hdr.Linkname, target)
+			}
+		case tar.TypeReg:
+			err = writeFile(target, tr, fs.FileMode(hdr.Mode).Perm())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if info == nil {
+		return nil, fmt.Errorf("not a dfc bundle: no %s", infoFile)
+	}
+	return info, nil
+}
+
+// checkKeys refuses a bundle manifest with a key whose directory isn't
+// inside the repo, such as "shared/~/../../tmp/x".
+func checkKeys(data []byte) error {
+	mf, err := manifest.Parse(data)
+	if err != nil {
+		return fmt.Errorf("reading the bundle's manifest: %w", err)
+	}
+	for key := range mf.Entries {
+		if _, ok := storage.KeyDir(key); !ok {
+			return fmt.Errorf("the bundle's manifest holds an unsafe key %q", key)
+		}
+	}
+	return nil
+}
+
+// checkParents refuses to write below a symlink the bundle created, which
+// would put the file outside dir.
+func checkParents(dir, parent string) error {
+	for p := parent; len(p) > len(dir); p = filepath.Dir(p) {
+		if fi, err := os.Lstat(p); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("the bundle writes through a symlink at %s", p)
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, r io.Reader, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Manifest returns the manifest subset of a bundle extracted to dir.
+func Manifest(dir string) (*manifest.Manifest, error) {
+	return manifest.Load(filepath.Join(dir, repoDir))
+}
+
+// RepoPath returns where the content of a bundle extracted to dir is, laid
+// out as a repo for restore.Run.
+func RepoPath(dir string) string {
+	return filepath.Join(dir, repoDir)
+}
+
+// Imported lists what AddToRepo did with each of a bundle's manifest keys.
+type Imported struct {
+	Added     []string // not in the repo before
+	Replaced  []string // the repo had another version, replaced because of force
+	Kept      []string // the repo has another version, which was kept
+	Unchanged []string // the repo has the same content
+}
+
+// AddToRepo copies the content of a bundle extracted to dir into the repo
+// and records it in the repo's manifest. A key the repo holds with other
+// content keeps the repo's version unless force is set, in which case the
+// bundle's replaces it as a new version. The repo's profile layers are
+// taken from the bundle only if it has none. The caller commits.
+func AddToRepo(dir, repoPath string, force bool) (*Imported, error) {
+	repoPath = expandHome(repoPath)
+	src := filepath.Join(dir, repoDir)
+	bmf, err := manifest.Load(src)
+	if err != nil {
+		return nil, err
+	}
+	mf, err := manifest.Load(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Imported{}
+	host := devices.Hostname()
+	for key, bev := range bmf.Entries {
+		rel, ok := storage.KeyDir(key)
+		if !ok {
+			continue
+		}
+		ev, exists := mf.Entries[key]
+		switch {
+		case exists && ev.ContentHash == bev.ContentHash:
+			res.Unchanged = append(res.Unchanged, key)
+			continue
+		case exists && !force:
+			res.Kept = append(res.Kept, key)
+			continue
+		}
+
+		if err := os.RemoveAll(filepath.Join(repoPath, rel)); err != nil {
+			return nil, err
+		}
+		if err := copyTree(filepath.Join(src, rel), filepath.Join(repoPath, rel)); err != nil {
+			return nil, err
+		}
+		bev.Conflict, bev.LostHash = "", ""
+		if exists {
+			bev.Version = ev.Version + 1
+			bev.UpdatedAt = time.Now().UTC()
+			bev.UpdatedBy = host
+			res.Replaced = append(res.Replaced, key)
+		} else {
+			res.Added = append(res.Added, key)
+		}
+		mf.Entries[key] = bev
+		e, _, _ := storage.ParseKey(key)
+		mf.Revive(e.Path)
+	}
+
+	for p, meta := range bmf.Meta {
+		cur, ok := mf.Meta[p]
+		if ok && !force {
+			continue
+		}
+		if mf.Meta == nil {
+			mf.Meta = make(map[string]manifest.EntryMeta)
+		}
+		meta.Revision = max(meta.Revision, cur.Revision+1)
+		mf.Meta[p] = meta
+	}
+
+	if _, err := os.Stat(filepath.Join(repoPath, profilesFile)); os.IsNotExist(err) {
+		if data, err := os.ReadFile(filepath.Join(src, profilesFile)); err == nil {
+			if err := os.WriteFile(filepath.Join(repoPath, profilesFile), data, 0644); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, mf.Save(repoPath)
+}
+
+// copyTree copies a file, symlink or directory, preserving symlinks and
+// the executable bit.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			return writeFile(target, bytes.NewReader(data), info.Mode().Perm())
+		}
+	})
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// Restore restores a bundle extracted to dir straight to the filesystem,
+// for a machine without access to the repo. Entries cfg tracks are
+// restored with its sync state, and the others are added to it. As with
+// a restore from the repo, entries whose local copy changed are held back
+// unless force is set, and entries whose tags don't match this device are
+// skipped. A device with no profile yet restores the exporting device's.
+// The caller saves cfg.
+func Restore(cfg *config.Config, dir string, info *Info, force bool) ([]restore.Progress, []restore.ConflictResult, error) {
+	repo := RepoPath(dir)
+	bmf, err := manifest.Load(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+	profile := cfg.DeviceProfile
+	if profile == "" {
+		profile = info.Profile
+	}
+
+	tracked := make(map[string]int)
+	for i, e := range cfg.Entries {
+		tracked[e.Path] = i
+	}
+	var entries []config.Entry
+	for _, e := range info.Entries {
+		if i, ok := tracked[e.Path]; ok {
+			e = cfg.Entries[i]
+		}
+		if !config.TagsMatch(e.Tags, cfg.DeviceTagSet()) {
+			continue
+		}
+		e.Variant = storage.ResolveVariant(repo, e, profile)
+		entries = append(entries, e)
+	}
+
+	var safe []config.Entry
+	var held []restore.ConflictResult
+	for _, cr := range restore.CheckConflicts(entries, bmf, profile) {
+		switch {
+		case !force && (cr.State == restore.StateConflict || cr.State == restore.StateModifiedLocal) && exists(cr.Entry.Path):
+			held = append(held, cr)
+		default:
+			safe = append(safe, cr.Entry)
+		}
+	}
+
+	var results []restore.Progress
+	if len(safe) > 0 {
+		for p := range restore.Run(safe, repo, profile, cfg.Hooks) {
+			results = append(results, p)
+		}
+	}
+	for _, p := range results {
+		if !p.Done || p.Err != nil {
+			continue
+		}
+		e := p.Entry
+		ev := bmf.GetEntry(storage.ManifestKey(e, profile))
+		e.LocalVersion, e.LastHash = ev.Version, ev.ContentHash
+		if i, ok := tracked[e.Path]; ok {
+			cfg.Entries[i] = e
+		} else {
+			cfg.Entries = append(cfg.Entries, e)
+			tracked[e.Path] = len(cfg.Entries) - 1
+		}
+	}
+	return results, held, nil
+}
+
+// exists reports whether an entry's path is on disk. A missing directory
+// hashes like an empty one, so a conflict check alone can't tell.
+func exists(path string) bool {
+	_, err := os.Lstat(expandHome(path))
+	return err == nil
+}
@@ -0,0 +1,115 @@
+package bundle
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+)
+
+// hookedRepo makes a repo with one backed-up entry, ~/.zshrc, whose
+// definition in the manifest carries a hook.
+func hookedRepo(t *testing.T) (string, config.Entry) {
+	t.Helper()
+	repo := t.TempDir()
+	e := config.Entry{Path: "~/.zshrc", Name: "zsh", Hooks: config.Hooks{PostRestore: "touch /tmp/pwned"}}
+	if err := os.MkdirAll(filepath.Join(repo, "shared"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "shared", ".zshrc"), []byte("export A=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mf := &manifest.Manifest{Entries: map[string]manifest.EntryVersion{
+		"shared/~/.zshrc": {Version: 1, ContentHash: "abc"},
+	}}
+	mf.SetMeta(&e)
+	if err := mf.Save(repo); err != nil {
+		t.Fatal(err)
+	}
+	return repo, e
+}
+
+func exportTo(t *testing.T, repo string, e config.Entry) (string, *Info) {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Export(&buf, repo, []config.Entry{e}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	info, err := Extract(&buf, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, info
+}
+
+// Importing without -hooks must not bring hooks in through the bundle's
+// definitions either, which the next sync would copy onto the entry.
+func TestStripHooksDropsDefinitionHooks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	src, e := hookedRepo(t)
+	// A bundle may carry hooks in its definitions alone.
+	e.Hooks = config.Hooks{}
+	dir, info := exportTo(t, src, e)
+
+	want := "~/.zshrc: post_restore: touch /tmp/pwned"
+	if cmds := info.HookCommands(dir); !slices.Contains(cmds, want) {
+		t.Fatalf("HookCommands = %q, want it to list %q", cmds, want)
+	}
+	if err := info.StripHooks(dir); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := info.HookCommands(dir); len(cmds) > 0 {
+		t.Fatalf("HookCommands after StripHooks = %q, want none", cmds)
+	}
+
+	repo := t.TempDir()
+	if err := (&manifest.Manifest{Entries: map[string]manifest.EntryVersion{}}).Save(repo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddToRepo(dir, repo, false); err != nil {
+		t.Fatal(err)
+	}
+	mf, err := manifest.Load(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := mf.Meta["~/.zshrc"].Hooks; h != (config.Hooks{}) {
+		t.Errorf("repo definition kept hooks %+v", h)
+	}
+	if mf.Meta["~/.zshrc"].Name != "zsh" {
+		t.Errorf("repo definition lost its name: %+v", mf.Meta["~/.zshrc"])
+	}
+
+	cfg := &config.Config{RepoPath: repo, Entries: []config.Entry{{Path: "~/.zshrc"}}}
+	storage.Reconcile(cfg, mf)
+	if h := cfg.Entries[0].Hooks; h != (config.Hooks{}) {
+		t.Errorf("entry picked up hooks %+v on sync", h)
+	}
+}
+
+func TestAddToRepoKeepsHooksWhenAsked(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	src, e := hookedRepo(t)
+	dir, _ := exportTo(t, src, e)
+
+	repo := t.TempDir()
+	if err := (&manifest.Manifest{Entries: map[string]manifest.EntryVersion{}}).Save(repo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AddToRepo(dir, repo, false); err != nil {
+		t.Fatal(err)
+	}
+	mf, err := manifest.Load(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mf.Meta["~/.zshrc"].Hooks.PostRestore; got != "touch /tmp/pwned" {
+		t.Errorf("repo definition hook = %q, want the bundle's", got)
+	}
+}
@@ -4,27 +4,102 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Entry represents a tracked dotfile or directory.
 type Entry struct {
-	Path            string `yaml:"path"`
-	Name            string `yaml:"name"`
-	Description     string `yaml:"description,omitempty"`
-	IsDir           bool   `yaml:"is_dir,omitempty"`
-	ProfileSpecific bool   `yaml:"profile_specific,omitempty"` // stored per device profile
-	LocalVersion    int    `yaml:"local_version,omitempty"`    // last backed-up or restored version
-	LastHash        string `yaml:"last_hash,omitempty"`        // hash at last backup or restore
+	Path            string   `yaml:"path"`
+	Name            string   `yaml:"name"`
+	Description     string   `yaml:"description,omitempty"`
+	IsDir           bool     `yaml:"is_dir,omitempty"`
+	ProfileSpecific bool     `yaml:"profile_specific,omitempty"` // stored per device profile
+	Tags            []string `yaml:"tags,omitempty"`             // devices this may restore to (empty = all)
+	Layer           string   `yaml:"layer,omitempty"`            // profile layer new files are backed up to
+	Variant         string   `yaml:"variant,omitempty"`          // host/OS variant in effect here, resolved from the repo
+	LocalVersion    int      `yaml:"local_version,omitempty"`    // last backed-up or restored version
+	LastHash        string   `yaml:"last_hash,omitempty"`        // hash at last backup or restore
+	MetaRevision    int      `yaml:"meta_revision,omitempty"`    // revision of the shared definition last seen
+	Hooks           Hooks    `yaml:"hooks,omitempty"`
+	PendingHooks    *Hooks   `yaml:"pending_hooks,omitempty"` // shared by another device, not run until accepted
+	Limits          Limits   `yaml:"limits,omitempty"`        // size and binary limits, over the global ones
+}
+
+// AcceptHooks makes the entry's pending hooks its own, so they run from
+// now on. Returns false if none were pending.
+func (e *Entry) AcceptHooks() bool {
+	if e.PendingHooks == nil {
+		return false
+	}
+	e.Hooks, e.PendingHooks = *e.PendingHooks, nil
+	return true
+}
+
+// RejectHooks drops the entry's pending hooks and keeps its own, which the
+// next backup shares in their place. Returns false if none were pending.
+func (e *Entry) RejectHooks() bool {
+	if e.PendingHooks == nil {
+		return false
+	}
+	e.PendingHooks = nil
+	return true
+}
+
+// Hooks are shell commands run around backup and restore.
+// On an entry they run for that entry only; on Config they run once
+// before the first and after the last entry of each operation.
+type Hooks struct {
+	PreBackup     string `yaml:"pre_backup,omitempty"`
+	PostBackup    string `yaml:"post_backup,omitempty"`
+	PreRestore    string `yaml:"pre_restore,omitempty"`
+	PostRestore   string `yaml:"post_restore,omitempty"`
+	Timeout       int    `yaml:"timeout,omitempty"`         // seconds, 0 = default
+	SkipOnFailure bool   `yaml:"skip_on_failure,omitempty"` // failing pre-hook skips the entry
+}
+
+// IsZero reports whether no hooks are configured (used by yaml omitempty).
+func (h Hooks) IsZero() bool {
+	return h == Hooks{}
 }
 
 // Config holds all dfc configuration.
 type Config struct {
-	RepoURL       string  `yaml:"repo_url"`
-	RepoPath      string  `yaml:"repo_path"`
-	DeviceProfile string  `yaml:"device_profile,omitempty"` // e.g. "work", "home"
-	Entries       []Entry `yaml:"entries,omitempty"`
+	RepoURL       string   `yaml:"repo_url"`
+	RepoPath      string   `yaml:"repo_path"`
+	DeviceProfile string   `yaml:"device_profile,omitempty"` // e.g. "work", "home"
+	DeviceTags    []string `yaml:"device_tags,omitempty"`    // e.g. "laptop"; profile and OS are implied
+	Entries       []Entry  `yaml:"entries,omitempty"`
+	Hooks         Hooks    `yaml:"hooks,omitempty"`  // global hooks
+	Limits        Limits   `yaml:"limits,omitempty"` // global size and binary limits
+
+	// Provider hosts the repo: "github", "gitlab" or "gitea". ProviderURL
+	// is the web address of a self-hosted GitLab or Gitea server.
+	Provider    string `yaml:"provider,omitempty"`
+	ProviderURL string `yaml:"provider_url,omitempty"`
+
+	// GitBackend is how dfc runs git: "git" for the git binary, "builtin"
+	// for the in-process implementation, or empty to use git when installed.
+	GitBackend string `yaml:"git_backend,omitempty"`
+
+	// SparseCheckout keeps other profiles' content out of the local clone.
+	// PartialClone clones without file contents, which git fetches as they
+	// are checked out. Both need the git binary.
+	SparseCheckout bool `yaml:"sparse_checkout,omitempty"`
+	PartialClone   bool `yaml:"partial_clone,omitempty"`
+
+	// UnpushedSince is set while the local clone has backups the remote
+	// hasn't received, e.g. after backing up offline.
+	UnpushedSince time.Time `yaml:"unpushed_since,omitempty"`
+
+	// RestoredAt is when entries were last restored on this device. The
+	// next backup copies it into the device registry, so a restore never
+	// commits or pushes anything itself.
+	RestoredAt time.Time `yaml:"restored_at,omitempty"`
 }
 
 func Dir() (string, error) {
@@ -102,6 +177,55 @@ func (cfg *Config) Save() error {
 	return os.WriteFile(path, data, 0600)
 }
 
+// DeviceTagSet returns every tag that describes this device: the configured
+// device tags plus the device profile and the OS (e.g. "linux", "darwin").
+func (cfg *Config) DeviceTagSet() []string {
+	tags := append([]string{}, cfg.DeviceTags...)
+	if cfg.DeviceProfile != "" {
+		tags = append(tags, cfg.DeviceProfile)
+	}
+	return NormalizeTags(append(tags, runtime.GOOS))
+}
+
+// TagsMatch reports whether an entry with entryTags may be restored on a
+// device with deviceTags. Untagged entries match every device.
+func TagsMatch(entryTags, deviceTags []string) bool {
+	if len(entryTags) == 0 {
+		return true
+	}
+	for _, t := range entryTags {
+		for _, d := range deviceTags {
+			if strings.EqualFold(t, d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseTags splits a comma- or space-separated tag list.
+func ParseTags(s string) []string {
+	return NormalizeTags(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	}))
+}
+
+// NormalizeTags lowercases, de-duplicates and sorts tags.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
 // IsConfigured returns true if a repo URL has been set.
 func (cfg *Config) IsConfigured() bool {
 	return cfg.RepoURL != ""
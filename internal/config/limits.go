@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// What a backup does with binary files, set with Limits.Binary.
+const (
+	BinaryKeep = "keep" // back them up like any other file (the default)
+	BinarySkip = "skip" // leave them out of the repo
+	BinaryLFS  = "lfs"  // store them through Git LFS
+)
+
+// DefaultConfirmOver is how much a backup may add to the repo before the
+// TUI asks to confirm the commit, unless Limits.ConfirmOver says otherwise.
+const DefaultConfirmOver = 5 << 20
+
+// Limits keep large and binary files out of the repo's history. They are
+// set globally and on entries; an entry's non-zero fields override the
+// global ones.
+type Limits struct {
+	MaxFileSize  ByteSize `yaml:"max_file_size,omitempty"`  // skip files larger than this
+	MaxEntrySize ByteSize `yaml:"max_entry_size,omitempty"` // skip an entry's files once it reaches this
+	Binary       string   `yaml:"binary,omitempty"`         // BinaryKeep, BinarySkip or BinaryLFS
+	LFSOver      ByteSize `yaml:"lfs_over,omitempty"`       // store files larger than this through Git LFS
+	ConfirmOver  ByteSize `yaml:"confirm_over,omitempty"`   // global only: ask before committing more than this
+}
+
+// IsZero reports whether no limits are set (used by yaml omitempty).
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// Merge returns l with its unset fields taken from global.
+func (l Limits) Merge(global Limits) Limits {
+	if l.MaxFileSize == 0 {
+		l.MaxFileSize = global.MaxFileSize
+	}
+	if l.MaxEntrySize == 0 {
+		l.MaxEntrySize = global.MaxEntrySize
+	}
+	if l.Binary == "" {
+		l.Binary = global.Binary
+	}
+	if l.LFSOver == 0 {
+		l.LFSOver = global.LFSOver
+	}
+	if l.ConfirmOver == 0 {
+		l.ConfirmOver = global.ConfirmOver
+	}
+	return l
+}
+
+// UsesLFS reports whether any file may be routed through Git LFS.
+func (l Limits) UsesLFS() bool {
+	return l.LFSOver > 0 || l.Binary == BinaryLFS
+}
+
+// ConfirmSize returns how much a backup may add to the repo unconfirmed,
+// or -1 if it never asks.
+func (l Limits) ConfirmSize() int64 {
+	if l.ConfirmOver == 0 {
+		return DefaultConfirmOver
+	}
+	return int64(l.ConfirmOver)
+}
+
+// LimitsFor returns the limits in effect for e.
+func (cfg *Config) LimitsFor(e Entry) Limits {
+	return e.Limits.Merge(cfg.Limits)
+}
+
+// ValidateBinary checks a Limits.Binary value.
+func ValidateBinary(s string) error {
+	switch s {
+	case "", BinaryKeep, BinarySkip, BinaryLFS:
+		return nil
+	}
+	return fmt.Errorf("binary: want %q, %q or %q, not %q", BinaryKeep, BinarySkip, BinaryLFS, s)
+}
+
+// ByteSize is a size in bytes, written like "10MiB", "512k" or "2G" (the
+// units are powers of 1024). NoLimit, written "none", lifts a global limit
+// for one entry.
+type ByteSize int64
+
+// NoLimit is the ByteSize of a limit that is explicitly off.
+const NoLimit ByteSize = -1
+
+var sizeUnits = []struct {
+	suffix string
+	shift  uint
+}{
+	{"gib", 30}, {"gb", 30}, {"g", 30},
+	{"mib", 20}, {"mb", 20}, {"m", 20},
+	{"kib", 10}, {"kb", 10}, {"k", 10},
+	{"b", 0},
+}
+
+// ParseByteSize parses a size such as "10MiB", "1.5g" or "none".
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "":
+		return 0, nil
+	case "none", "off", "unlimited":
+		return NoLimit, nil
+	}
+	num, shift := s, uint(0)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			num, shift = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.shift
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 10MiB, 512k or none)", s)
+	}
+	return ByteSize(n * float64(int64(1)<<shift)), nil
+}
+
+// Limit returns the size as a limit in bytes, or -1 if there is none.
+func (b ByteSize) Limit() int64 {
+	if b <= 0 {
+		return -1
+	}
+	return int64(b)
+}
+
+func (b ByteSize) String() string {
+	switch {
+	case b < 0:
+		return "none"
+	case b >= 1<<30 && b%(1<<30) == 0:
+		return fmt.Sprintf("%dGiB", b>>30)
+	case b >= 1<<20 && b%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", b>>20)
+	case b >= 1<<10 && b%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", b>>10)
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+// FormatSize formats a byte count for people, e.g. "1.5 MiB".
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// MarshalYAML writes the size in its readable form.
+func (b ByteSize) MarshalYAML() (any, error) {
+	return b.String(), nil
+}
+
+// UnmarshalYAML accepts anything ParseByteSize does, or a plain number of
+// bytes.
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	v, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
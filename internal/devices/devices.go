@@ -0,0 +1,199 @@
+package devices
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/storage"
+	"github.com/solarisjon/dfc/internal/version"
+	"gopkg.in/yaml.v3"
+)
+
+// Device is one machine that syncs with the repo.
+type Device struct {
+	Profile     string         `yaml:"profile,omitempty"`
+	OS          string         `yaml:"os"` // GOOS/GOARCH
+	Version     string         `yaml:"dfc_version"`
+	LastBackup  time.Time      `yaml:"last_backup,omitempty"`
+	LastRestore time.Time      `yaml:"last_restore,omitempty"`
+	Entries     map[string]int `yaml:"entries,omitempty"` // manifest key → version last synced
+}
+
+// Registry lists every device using the repo, keyed by hostname.
+// Stored as .dfc-devices.yaml in the repo root.
+type Registry struct {
+	Devices map[string]*Device `yaml:"devices"`
+}
+
+// FileName is the registry file in the repo root.
+const FileName = ".dfc-devices.yaml"
+
+// Load reads the registry from the repo. Returns an empty registry if not found.
+func Load(repoPath string) (*Registry, error) {
+	return LoadFile(filepath.Join(expandHome(repoPath), FileName))
+}
+
+// LoadFile reads a registry from any path, such as a version git hands to a
+// merge driver. Returns an empty registry if the file does not exist.
+func LoadFile(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Registry{Devices: make(map[string]*Device)}, nil
+		}
+		return nil, fmt.Errorf("reading device registry: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes a registry. Empty data is an empty registry.
+func Parse(data []byte) (*Registry, error) {
+	var r Registry
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parsing device registry: %w", err)
+	}
+	if r.Devices == nil {
+		r.Devices = make(map[string]*Device)
+	}
+	return &r, nil
+}
+
+// Save writes the registry to the repo.
+func (r *Registry) Save(repoPath string) error {
+	return r.SaveFile(filepath.Join(expandHome(repoPath), FileName))
+}
+
+// SaveFile writes the registry to any path.
+func (r *Registry) SaveFile(path string) error {
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshaling device registry: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Merge combines two registries that diverged from base. Each device only
+// writes its own record, so records are merged per hostname: a record
+// changed on one side takes that side, and one changed on both keeps the
+// most recently synced.
+func Merge(base, ours, theirs *Registry) *Registry {
+	out := &Registry{Devices: make(map[string]*Device)}
+	for host, d := range theirs.Devices {
+		out.Devices[host] = d
+	}
+	for host, d := range ours.Devices {
+		t, ok := theirs.Devices[host]
+		if !ok || lastSync(d).After(lastSync(t)) {
+			out.Devices[host] = d
+		}
+	}
+	// A record removed on one side stays removed if the other left it alone.
+	for host, b := range base.Devices {
+		d, inOurs := ours.Devices[host]
+		t, inTheirs := theirs.Devices[host]
+		if (!inOurs && inTheirs && sameDevice(b, t)) || (!inTheirs && inOurs && sameDevice(b, d)) {
+			delete(out.Devices, host)
+		}
+	}
+	return out
+}
+
+func lastSync(d *Device) time.Time {
+	if d.LastRestore.After(d.LastBackup) {
+		return d.LastRestore
+	}
+	return d.LastBackup
+}
+
+func sameDevice(a, b *Device) bool {
+	return a.Profile == b.Profile && a.OS == b.OS && a.Version == b.Version &&
+		a.LastBackup.Equal(b.LastBackup) && a.LastRestore.Equal(b.LastRestore) &&
+		sameVersions(a.Entries, b.Entries)
+}
+
+// Hostname returns this machine's registry key.
+func Hostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	return host
+}
+
+// Update refreshes this device's record from cfg: profile, OS, dfc version,
+// the version of every entry it has synced and the time of its last
+// restore. When backedUp is true the last backup time is set to now.
+// Returns true if anything changed, so callers only commit the registry
+// when there is something new to say.
+func (r *Registry) Update(cfg *config.Config, backedUp bool) bool {
+	host := Hostname()
+	old := r.Devices[host]
+
+	d := &Device{
+		Profile: cfg.DeviceProfile,
+		OS:      runtime.GOOS + "/" + runtime.GOARCH,
+		Version: version.String(),
+		Entries: make(map[string]int),
+	}
+	if old != nil {
+		d.LastBackup = old.LastBackup
+		d.LastRestore = old.LastRestore
+	}
+	if cfg.RestoredAt.After(d.LastRestore) {
+		d.LastRestore = cfg.RestoredAt
+	}
+	for _, e := range cfg.Entries {
+		if e.LocalVersion > 0 {
+			d.Entries[storage.ManifestKey(e, cfg.DeviceProfile)] = e.LocalVersion
+		}
+	}
+
+	changed := old == nil || old.Profile != d.Profile || old.OS != d.OS ||
+		old.Version != d.Version || !d.LastRestore.Equal(old.LastRestore) ||
+		!sameVersions(old.Entries, d.Entries)
+	if backedUp {
+		d.LastBackup = time.Now()
+		changed = true
+	}
+	if changed {
+		r.Devices[host] = d
+	}
+	return changed
+}
+
+// Hostnames returns the registered hostnames in sorted order.
+func (r *Registry) Hostnames() []string {
+	hosts := make([]string, 0, len(r.Devices))
+	for h := range r.Devices {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func sameVersions(a, b map[string]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
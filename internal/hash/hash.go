@@ -33,46 +33,58 @@ func HashFile(path string) (string, error) {
 // It walks files in sorted order, hashing each file's relative path
 // and content into a single digest. Skips .git directories.
 func HashDir(path string) (string, error) {
-	// Collect all file paths first, then sort for determinism.
-	var files []string
-	var symlinks []string
+	files := make(map[string]string)
 	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return nil // skip inaccessible files
 		}
-		if d.IsDir() && d.Name() == ".git" {
-			return filepath.SkipDir
-		}
-		if d.Type()&fs.ModeSymlink != 0 {
-			symlinks = append(symlinks, p)
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		// Skip special files (sockets, pipes, devices)
-		if !d.IsDir() && !d.Type().IsRegular() {
-			return nil
-		}
-		if !d.IsDir() {
-			files = append(files, p)
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return nil // skip files we can't resolve
 		}
+		files[rel] = p
 		return nil
 	})
 	if err != nil {
 		return "", fmt.Errorf("hash dir %s: %w", path, err)
 	}
+	return HashTree(files), nil
+}
 
-	sort.Strings(files)
+// HashTree hashes a set of files given as relative path → absolute path,
+// exactly as HashDir would hash a directory holding them. Used for trees
+// assembled from several directories, such as layered profile entries.
+func HashTree(files map[string]string) string {
+	// Regular files first, then symlinks, each in sorted order.
+	var regular, symlinks []string
+	for rel, p := range files {
+		info, err := os.Lstat(p)
+		if err != nil {
+			continue
+		}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			symlinks = append(symlinks, rel)
+		case info.Mode().IsRegular():
+			regular = append(regular, rel)
+		}
+		// Skip special files (sockets, pipes, devices)
+	}
+	sort.Strings(regular)
 	sort.Strings(symlinks)
 
 	h := sha256.New()
-	for _, fp := range files {
-		rel, err := filepath.Rel(path, fp)
-		if err != nil {
-			continue // skip files we can't resolve
-		}
+	for _, rel := range regular {
 		// Include the relative path in the hash so renames are detected.
 		h.Write([]byte(rel))
 
-		f, err := os.Open(fp)
+		f, err := os.Open(files[rel])
 		if err != nil {
 			continue // skip unreadable files
 		}
@@ -84,20 +96,16 @@ func HashDir(path string) (string, error) {
 	}
 
 	// Include symlinks: hash their relative path + link target
-	for _, sp := range symlinks {
-		rel, err := filepath.Rel(path, sp)
-		if err != nil {
-			continue
-		}
+	for _, rel := range symlinks {
 		h.Write([]byte("symlink:" + rel))
-		linkTarget, err := os.Readlink(sp)
+		linkTarget, err := os.Readlink(files[rel])
 		if err != nil {
 			continue // skip broken symlinks
 		}
 		h.Write([]byte(linkTarget))
 	}
 
-	return hex.EncodeToString(h.Sum(nil)), nil
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // HashEntry hashes the local file or directory for a config entry.
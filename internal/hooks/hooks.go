@@ -0,0 +1,184 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/config"
+)
+
+// Stage identifies when a hook runs.
+type Stage string
+
+const (
+	PreBackup   Stage = "pre-backup"
+	PostBackup  Stage = "post-backup"
+	PreRestore  Stage = "pre-restore"
+	PostRestore Stage = "post-restore"
+)
+
+// DefaultTimeout applies when Hooks.Timeout is unset.
+const DefaultTimeout = 30 * time.Second
+
+// maxOutput caps how much hook output is kept for display.
+const maxOutput = 4096
+
+// Result is the outcome of running a single hook command.
+type Result struct {
+	Stage    Stage
+	Command  string
+	Global   bool   // configured on Config rather than the entry
+	Output   string // combined stdout/stderr, trimmed
+	ExitCode int
+	TimedOut bool
+	Err      error // set when the command failed to start, exited non-zero, or timed out
+}
+
+// Failed reports whether the hook did not complete successfully.
+func (r Result) Failed() bool {
+	return r.Err != nil
+}
+
+// Summary returns a one-line description such as "pre-backup: exit 0".
+func (r Result) Summary() string {
+	scope := ""
+	if r.Global {
+		scope = "global "
+	}
+	switch {
+	case r.TimedOut:
+		return fmt.Sprintf("%s%s: timed out", scope, r.Stage)
+	case r.Err != nil && r.ExitCode < 0:
+		return fmt.Sprintf("%s%s: %v", scope, r.Stage, r.Err)
+	default:
+		return fmt.Sprintf("%s%s: exit %d", scope, r.Stage, r.ExitCode)
+	}
+}
+
+// Command returns the configured command for a stage (empty if none).
+func Command(h config.Hooks, stage Stage) string {
+	switch stage {
+	case PreBackup:
+		return h.PreBackup
+	case PostBackup:
+		return h.PostBackup
+	case PreRestore:
+		return h.PreRestore
+	case PostRestore:
+		return h.PostRestore
+	}
+	return ""
+}
+
+// Changes describes how to differs from from, one line per changed
+// setting, e.g. `post-restore: (none) → "make install"`. Used to show hooks
+// another device shared before they are accepted.
+func Changes(from, to config.Hooks) []string {
+	var lines []string
+	for _, stage := range []Stage{PreBackup, PostBackup, PreRestore, PostRestore} {
+		if a, b := Command(from, stage), Command(to, stage); a != b {
+			lines = append(lines, fmt.Sprintf("%s: %s → %s", stage, quoteCommand(a), quoteCommand(b)))
+		}
+	}
+	if from.Timeout != to.Timeout {
+		lines = append(lines, fmt.Sprintf("timeout: %s → %s", Timeout(from), Timeout(to)))
+	}
+	if from.SkipOnFailure != to.SkipOnFailure {
+		lines = append(lines, fmt.Sprintf("skip_on_failure: %t → %t", from.SkipOnFailure, to.SkipOnFailure))
+	}
+	return lines
+}
+
+func quoteCommand(c string) string {
+	if c == "" {
+		return "(none)"
+	}
+	return fmt.Sprintf("%q", c)
+}
+
+// Timeout returns the effective timeout for a set of hooks.
+func Timeout(h config.Hooks) time.Duration {
+	if h.Timeout > 0 {
+		return time.Duration(h.Timeout) * time.Second
+	}
+	return DefaultTimeout
+}
+
+// Run executes the hook for stage via `sh -c`, if one is configured.
+// Returns ok=false when no hook is set for the stage.
+// The entry (zero value for global hooks) is exposed to the command through
+// DFC_* environment variables. Commands run from the user's home directory.
+// On timeout the command is killed along with any children it started.
+func Run(h config.Hooks, stage Stage, e config.Entry, global bool) (Result, bool) {
+	command := strings.TrimSpace(Command(h, stage))
+	if command == "" {
+		return Result{}, false
+	}
+
+	r := Result{Stage: stage, Command: command, Global: global}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout(h))
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.WaitDelay = 2 * time.Second
+	killGroupOnCancel(cmd)
+	if home, err := os.UserHomeDir(); err == nil {
+		cmd.Dir = home
+	}
+	cmd.Env = append(os.Environ(),
+		"DFC_HOOK="+string(stage),
+		"DFC_ENTRY_PATH="+expandHome(e.Path),
+		"DFC_ENTRY_NAME="+e.Name,
+	)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+	r.Output = trimOutput(out.String())
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		r.TimedOut = true
+		r.ExitCode = -1
+		r.Err = fmt.Errorf("%s hook timed out after %s", stage, Timeout(h))
+	case err != nil:
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			r.ExitCode = exitErr.ExitCode()
+			r.Err = fmt.Errorf("%s hook exited with status %d", stage, r.ExitCode)
+		} else {
+			r.ExitCode = -1
+			r.Err = fmt.Errorf("%s hook: %w", stage, err)
+		}
+	}
+	return r, true
+}
+
+// trimOutput strips surrounding whitespace and keeps only the tail of
+// very long output so the progress view stays readable.
+func trimOutput(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > maxOutput {
+		s = "…" + s[len(s)-maxOutput:]
+	}
+	return s
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
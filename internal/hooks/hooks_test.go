@@ -0,0 +1,47 @@
+package hooks
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/config"
+)
+
+func TestRunTimeoutKillsBackgroundChildren(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads process state from /proc")
+	}
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	h := config.Hooks{PostRestore: "sleep 60 & echo $! > " + pidFile + "; wait", Timeout: 1}
+
+	r, ok := Run(h, PostRestore, config.Entry{}, false)
+	if !ok || !r.TimedOut {
+		t.Fatalf("Run = %+v, %t; want a timeout", r, ok)
+	}
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Killed children may linger as zombies until they are reaped.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background child %d still running after the hook timed out", pid)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
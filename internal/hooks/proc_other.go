@@ -0,0 +1,9 @@
+//go:build !unix
+
+package hooks
+
+import "os/exec"
+
+// killGroupOnCancel leaves the default of killing only the shell on
+// platforms without process groups.
+func killGroupOnCancel(cmd *exec.Cmd) {}
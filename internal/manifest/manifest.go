@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/solarisjon/dfc/internal/config"
 	"gopkg.in/yaml.v3"
 )
 
@@ -16,21 +17,77 @@ type EntryVersion struct {
 	UpdatedAt   time.Time `yaml:"updated_at"`
 	UpdatedBy   string    `yaml:"updated_by,omitempty"` // hostname
 	ContentHash string    `yaml:"content_hash,omitempty"`
+	Tags        []string  `yaml:"tags,omitempty"`     // devices this may restore to (empty = all)
+	Conflict    string    `yaml:"conflict,omitempty"` // set when a merge had to pick between two devices' versions
+	LostHash    string    `yaml:"lost_hash,omitempty"` // content hash of the version the merge did not keep
+}
+
+// Move records that an entry was renamed, so devices still tracking the
+// old path can follow it.
+type Move struct {
+	Path        string    `yaml:"path"` // new entry path
+	Name        string    `yaml:"name,omitempty"`
+	Description string    `yaml:"description,omitempty"`
+	MovedAt     time.Time `yaml:"moved_at"`
+	MovedBy     string    `yaml:"moved_by,omitempty"` // hostname
+}
+
+// Tombstone records that an entry was retired and removed from the repo,
+// so devices still tracking it can untrack it.
+type Tombstone struct {
+	Version   int       `yaml:"version"` // highest version at removal
+	RemovedAt time.Time `yaml:"removed_at"`
+	RemovedBy string    `yaml:"removed_by,omitempty"` // hostname
+}
+
+// EntryMeta is the shared definition of a tracked entry, so a new machine
+// reproduces the entry list exactly and edits reach every device. Revision
+// increases with every change; devices remember the revision they last saw
+// in Entry.MetaRevision.
+type EntryMeta struct {
+	Name        string        `yaml:"name"`
+	Description string        `yaml:"description,omitempty"`
+	IsDir       bool          `yaml:"is_dir,omitempty"`
+	Hooks       config.Hooks  `yaml:"hooks,omitempty"`
+	Limits      config.Limits `yaml:"limits,omitempty"`
+	Revision    int           `yaml:"revision"`
+	UpdatedBy   string        `yaml:"updated_by,omitempty"` // hostname
+}
+
+// metaOf is e's definition as shared. Hooks awaiting confirmation stand in
+// for e's own, so not having accepted them yet doesn't undo their change.
+func metaOf(e config.Entry) EntryMeta {
+	hooks := e.Hooks
+	if e.PendingHooks != nil {
+		hooks = *e.PendingHooks
+	}
+	return EntryMeta{Name: e.Name, Description: e.Description, IsDir: e.IsDir, Hooks: hooks, Limits: e.Limits}
+}
+
+// sameMeta compares the definition, ignoring revision bookkeeping.
+func sameMeta(a, b EntryMeta) bool {
+	return a.Name == b.Name && a.Description == b.Description && a.IsDir == b.IsDir && a.Hooks == b.Hooks && a.Limits == b.Limits
 }
 
 // Manifest tracks versions of all entries in the repo.
 // Stored as .dfc-manifest.yaml in the repo root.
 type Manifest struct {
-	Entries map[string]EntryVersion `yaml:"entries"` // keyed by entry path
+	Entries map[string]EntryVersion `yaml:"entries"`           // keyed by entry path
+	Moves   map[string]Move         `yaml:"moves,omitempty"`   // keyed by old entry path
+	Removed map[string]Tombstone    `yaml:"removed,omitempty"` // keyed by entry path
+	Meta    map[string]EntryMeta    `yaml:"meta,omitempty"`    // keyed by entry path
 }
 
 const fileName = ".dfc-manifest.yaml"
 
 // Load reads the manifest from the repo. Returns empty manifest if not found.
 func Load(repoPath string) (*Manifest, error) {
-	repoPath = expandHome(repoPath)
-	path := filepath.Join(repoPath, fileName)
+	return LoadFile(filepath.Join(expandHome(repoPath), fileName))
+}
 
+// LoadFile reads a manifest from any path, such as a version git hands to
+// a merge driver. Returns an empty manifest if the file does not exist.
+func LoadFile(path string) (*Manifest, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -38,7 +95,11 @@ func Load(repoPath string) (*Manifest, error) {
 		}
 		return nil, fmt.Errorf("reading manifest: %w", err)
 	}
+	return Parse(data)
+}
 
+// Parse decodes a manifest. Empty data is an empty manifest.
+func Parse(data []byte) (*Manifest, error) {
 	var m Manifest
 	if err := yaml.Unmarshal(data, &m); err != nil {
 		return nil, fmt.Errorf("parsing manifest: %w", err)
@@ -51,9 +112,11 @@ func Load(repoPath string) (*Manifest, error) {
 
 // Save writes the manifest to the repo.
 func (m *Manifest) Save(repoPath string) error {
-	repoPath = expandHome(repoPath)
-	path := filepath.Join(repoPath, fileName)
+	return m.SaveFile(filepath.Join(expandHome(repoPath), fileName))
+}
 
+// SaveFile writes the manifest to any path.
+func (m *Manifest) SaveFile(path string) error {
 	data, err := yaml.Marshal(m)
 	if err != nil {
 		return fmt.Errorf("marshaling manifest: %w", err)
@@ -73,6 +136,8 @@ func (m *Manifest) BumpVersion(entryPath string, contentHash string) bool {
 	ev.Version++
 	ev.UpdatedAt = time.Now()
 	ev.ContentHash = contentHash
+	ev.Conflict = ""
+	ev.LostHash = ""
 	if host, err := os.Hostname(); err == nil {
 		ev.UpdatedBy = host
 	}
@@ -80,6 +145,118 @@ func (m *Manifest) BumpVersion(entryPath string, contentHash string) bool {
 	return true
 }
 
+// SetTags records the restore tags for an entry that is already in the
+// manifest. Returns true if the stored tags changed.
+func (m *Manifest) SetTags(entryPath string, tags []string) bool {
+	ev, ok := m.Entries[entryPath]
+	if !ok || strings.Join(ev.Tags, ",") == strings.Join(tags, ",") {
+		return false
+	}
+	ev.Tags = tags
+	m.Entries[entryPath] = ev
+	return true
+}
+
+// RecordMove notes that the entry at path from now lives at to. Earlier
+// moves that ended at from are pointed at to, so a device that missed
+// several renames follows them in one step.
+func (m *Manifest) RecordMove(from, to, name, description string) {
+	if m.Moves == nil {
+		m.Moves = make(map[string]Move)
+	}
+	delete(m.Moves, to) // the path is in use again
+	delete(m.Removed, to)
+	mv := Move{Path: to, Name: name, Description: description, MovedAt: time.Now()}
+	if host, err := os.Hostname(); err == nil {
+		mv.MovedBy = host
+	}
+	for old, prev := range m.Moves {
+		if prev.Path == from {
+			m.Moves[old] = mv
+		}
+	}
+	m.Moves[from] = mv
+
+	if meta, ok := m.Meta[from]; ok {
+		delete(m.Meta, from)
+		m.Meta[to] = meta
+	}
+}
+
+// Retire leaves a tombstone for an entry path whose repo content has been
+// removed. version is the highest version it reached.
+func (m *Manifest) Retire(path string, version int) {
+	if m.Removed == nil {
+		m.Removed = make(map[string]Tombstone)
+	}
+	t := Tombstone{Version: version, RemovedAt: time.Now()}
+	if host, err := os.Hostname(); err == nil {
+		t.RemovedBy = host
+	}
+	m.Removed[path] = t
+	delete(m.Meta, path)
+}
+
+// Revive removes the tombstone for an entry path that is being backed up
+// again. Returns true if there was one.
+func (m *Manifest) Revive(path string) bool {
+	if _, ok := m.Removed[path]; !ok {
+		return false
+	}
+	delete(m.Removed, path)
+	return true
+}
+
+// SetMeta records e's definition. An unchanged definition only brings
+// e.MetaRevision up to date. A changed one is recorded as a new revision,
+// unless another device changed it since e last saw it — ApplyMeta takes
+// that one first. Returns true if the manifest changed.
+func (m *Manifest) SetMeta(e *config.Entry) bool {
+	if m.Meta == nil {
+		m.Meta = make(map[string]EntryMeta)
+	}
+	cur, ok := m.Meta[e.Path]
+	next := metaOf(*e)
+	if ok && sameMeta(cur, next) {
+		e.MetaRevision = cur.Revision
+		return false
+	}
+	if ok && cur.Revision > e.MetaRevision {
+		return false
+	}
+	next.Revision = cur.Revision + 1
+	if host, err := os.Hostname(); err == nil {
+		next.UpdatedBy = host
+	}
+	m.Meta[e.Path] = next
+	e.MetaRevision = next.Revision
+	return true
+}
+
+// ApplyMeta updates e from a definition another device recorded since e
+// last saw it. Returns true if e changed.
+// Hooks are commands anyone with write access to the repo could have put
+// there, so changed ones only become e.PendingHooks; they run once the user
+// accepts them (Entry.AcceptHooks).
+func (m *Manifest) ApplyMeta(e *config.Entry) bool {
+	meta, ok := m.Meta[e.Path]
+	if !ok || meta.Revision <= e.MetaRevision {
+		return false
+	}
+	e.Name = meta.Name
+	e.Description = meta.Description
+	e.IsDir = meta.IsDir
+	if meta.Hooks == e.Hooks {
+		e.PendingHooks = nil
+	} else {
+		h := meta.Hooks
+		e.PendingHooks = &h
+	}
+	e.Limits = meta.Limits
+	e.MetaRevision = meta.Revision
+	return true
+}
+
 // GetVersion returns the repo version for an entry path (0 if never backed up).
 func (m *Manifest) GetVersion(entryPath string) int {
 	return m.Entries[entryPath].Version
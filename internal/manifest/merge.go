@@ -0,0 +1,145 @@
+package manifest
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Merge combines two manifests that diverged from base — the remote's and
+// this device's after concurrent backups — key by key:
+//
+//   - a key changed on one side only takes that side's value, including
+//     removal;
+//   - a key changed on both sides takes the highest version, or the one
+//     written last;
+//   - if both sides wrote different content, that copy still wins but its
+//     version is bumped past both so every device sees a change, and the
+//     entry is flagged with Conflict.
+//
+// Moves and tombstones keep the most recent record; entry definitions the
+// highest revision. base may be empty when there is no common ancestor.
+// Returns the merged manifest and the flagged keys, sorted.
+func Merge(base, ours, theirs *Manifest) (*Manifest, []string) {
+	var conflicts []string
+	out := &Manifest{
+		Entries: mergeMap(base.Entries, ours.Entries, theirs.Entries, sameVersion,
+			func(key string, a, b EntryVersion) EntryVersion {
+				win, lose := newerVersion(a, b)
+				if a.ContentHash == b.ContentHash {
+					return win
+				}
+				win.Conflict = fmt.Sprintf("v%d by %s replaced v%d by %s",
+					win.Version, hostOr(win.UpdatedBy), lose.Version, hostOr(lose.UpdatedBy))
+				win.LostHash = lose.ContentHash
+				win.Version = max(a.Version, b.Version) + 1
+				conflicts = append(conflicts, key)
+				return win
+			}),
+		Moves: mergeMap(base.Moves, ours.Moves, theirs.Moves,
+			func(a, b Move) bool { return a.Path == b.Path && a.MovedAt.Equal(b.MovedAt) },
+			func(_ string, a, b Move) Move {
+				if b.MovedAt.After(a.MovedAt) {
+					return b
+				}
+				return a
+			}),
+		Removed: mergeMap(base.Removed, ours.Removed, theirs.Removed,
+			func(a, b Tombstone) bool { return a.Version == b.Version && a.RemovedAt.Equal(b.RemovedAt) },
+			func(_ string, a, b Tombstone) Tombstone {
+				if b.RemovedAt.After(a.RemovedAt) {
+					return b
+				}
+				return a
+			}),
+		Meta: mergeMap(base.Meta, ours.Meta, theirs.Meta,
+			func(a, b EntryMeta) bool { return a.Revision == b.Revision && sameMeta(a, b) },
+			func(_ string, a, b EntryMeta) EntryMeta {
+				switch {
+				case a.Revision > b.Revision:
+					return a
+				case b.Revision > a.Revision:
+					return b
+				}
+				// Same revision edited on two devices: keep one and move the
+				// revision on so both devices take it.
+				win := a
+				if b.UpdatedBy > a.UpdatedBy {
+					win = b
+				}
+				win.Revision++
+				return win
+			}),
+	}
+	if out.Entries == nil {
+		out.Entries = make(map[string]EntryVersion)
+	}
+	sort.Strings(conflicts)
+	return out, conflicts
+}
+
+// mergeMap merges one section of the manifest. pick resolves keys changed
+// differently on both sides. Returns nil for an empty result so omitempty
+// sections stay out of the file.
+func mergeMap[V any](base, ours, theirs map[string]V, same func(a, b V) bool, pick func(key string, a, b V) V) map[string]V {
+	out := make(map[string]V)
+	keys := make(map[string]bool)
+	for k := range ours {
+		keys[k] = true
+	}
+	for k := range theirs {
+		keys[k] = true
+	}
+	for k := range keys {
+		a, inOurs := ours[k]
+		b, inTheirs := theirs[k]
+		o, inBase := base[k]
+		switch {
+		case inOurs && inTheirs:
+			switch {
+			case same(a, b):
+				out[k] = a
+			case inBase && same(o, a):
+				out[k] = b
+			case inBase && same(o, b):
+				out[k] = a
+			default:
+				out[k] = pick(k, a, b)
+			}
+		case inOurs:
+			if !inBase || !same(o, a) {
+				out[k] = a // added here, or changed here and removed there
+			}
+		case inTheirs:
+			if !inBase || !same(o, b) {
+				out[k] = b
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func sameVersion(a, b EntryVersion) bool {
+	return a.Version == b.Version && a.ContentHash == b.ContentHash &&
+		a.UpdatedAt.Equal(b.UpdatedAt) && a.UpdatedBy == b.UpdatedBy &&
+		slices.Equal(a.Tags, b.Tags) && a.Conflict == b.Conflict && a.LostHash == b.LostHash
+}
+
+// newerVersion orders two versions of an entry: the higher version, then
+// the later write, wins.
+func newerVersion(a, b EntryVersion) (win, lose EntryVersion) {
+	if b.Version > a.Version || (b.Version == a.Version && b.UpdatedAt.After(a.UpdatedAt)) {
+		return b, a
+	}
+	return a, b
+}
+
+func hostOr(host string) string {
+	if host == "" {
+		return "another device"
+	}
+	return host
+}
@@ -0,0 +1,121 @@
+package manifest
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMergeEntries(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	v := func(version int, hash, by string, at int) EntryVersion {
+		return EntryVersion{Version: version, ContentHash: hash, UpdatedBy: by, UpdatedAt: t0.Add(time.Duration(at) * time.Minute)}
+	}
+	base := v(1, "h1", "laptop", 0)
+
+	for _, tc := range []struct {
+		name               string
+		base, ours, theirs *EntryVersion
+		want               *EntryVersion
+		conflict           bool
+	}{
+		{"unchanged", &base, &base, &base, &base, false},
+		{"changed on our side", &base, ptr(v(2, "h2", "laptop", 5)), &base, ptr(v(2, "h2", "laptop", 5)), false},
+		{"changed on their side", &base, &base, ptr(v(2, "h2", "desktop", 5)), ptr(v(2, "h2", "desktop", 5)), false},
+		{"added on one side", nil, nil, ptr(v(1, "h1", "desktop", 0)), ptr(v(1, "h1", "desktop", 0)), false},
+		{"removed on one side", &base, &base, nil, nil, false},
+		{"changed here, removed there", &base, ptr(v(2, "h2", "laptop", 5)), nil, ptr(v(2, "h2", "laptop", 5)), false},
+		{"same content from both", &base, ptr(v(2, "h2", "laptop", 5)), ptr(v(2, "h2", "desktop", 7)), ptr(v(2, "h2", "desktop", 7)), false},
+		{
+			"higher version wins and is bumped past both",
+			&base, ptr(v(3, "h3", "laptop", 5)), ptr(v(2, "h2", "desktop", 9)),
+			&EntryVersion{Version: 4, ContentHash: "h3", UpdatedBy: "laptop", UpdatedAt: t0.Add(5 * time.Minute),
+				Conflict: "v3 by laptop replaced v2 by desktop", LostHash: "h2"},
+			true,
+		},
+		{
+			"same version, later write wins",
+			&base, ptr(v(2, "h2", "laptop", 5)), ptr(v(2, "h2b", "desktop", 9)),
+			&EntryVersion{Version: 3, ContentHash: "h2b", UpdatedBy: "desktop", UpdatedAt: t0.Add(9 * time.Minute),
+				Conflict: "v2 by desktop replaced v2 by laptop", LostHash: "h2"},
+			true,
+		},
+		{
+			"added on both sides without a base",
+			nil, ptr(v(1, "a", "", 5)), ptr(v(1, "b", "desktop", 1)),
+			&EntryVersion{Version: 2, ContentHash: "a", UpdatedAt: t0.Add(5 * time.Minute),
+				Conflict: "v1 by another device replaced v1 by desktop", LostHash: "b"},
+			true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			side := func(e *EntryVersion) *Manifest {
+				m := &Manifest{Entries: map[string]EntryVersion{}}
+				if e != nil {
+					m.Entries["shared/~/.zshrc"] = *e
+				}
+				return m
+			}
+			got, conflicts := Merge(side(tc.base), side(tc.ours), side(tc.theirs))
+			e, ok := got.Entries["shared/~/.zshrc"]
+			switch {
+			case tc.want == nil && ok:
+				t.Errorf("entry = %+v, want it removed", e)
+			case tc.want != nil && (!ok || !sameVersion(e, *tc.want)):
+				t.Errorf("entry = %+v, want %+v", e, *tc.want)
+			}
+			if want := tc.conflict; slices.Contains(conflicts, "shared/~/.zshrc") != want {
+				t.Errorf("conflicts = %v, want flagged %t", conflicts, want)
+			}
+		})
+	}
+}
+
+// Versions and definitions come out the same whichever side is ours, so
+// both devices settle on them.
+func TestMergeIsSymmetric(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	base := &Manifest{Entries: map[string]EntryVersion{"shared/~/.vimrc": {Version: 1, ContentHash: "h1"}}}
+	a := &Manifest{
+		Entries: map[string]EntryVersion{"shared/~/.vimrc": {Version: 2, ContentHash: "a", UpdatedBy: "laptop", UpdatedAt: t0}},
+		Meta:    map[string]EntryMeta{"~/.vimrc": {Name: "vim", Revision: 2, UpdatedBy: "laptop"}},
+	}
+	b := &Manifest{
+		Entries: map[string]EntryVersion{"shared/~/.vimrc": {Version: 2, ContentHash: "b", UpdatedBy: "desktop", UpdatedAt: t0}},
+		Meta:    map[string]EntryMeta{"~/.vimrc": {Name: "Vim", Revision: 2, UpdatedBy: "desktop"}},
+	}
+	ab, _ := Merge(base, a, b)
+	ba, _ := Merge(base, b, a)
+	if x, y := ab.Entries["shared/~/.vimrc"], ba.Entries["shared/~/.vimrc"]; x.Version != 3 || x.Version != y.Version {
+		t.Errorf("versions %d and %d, want both 3", x.Version, y.Version)
+	}
+	if x, y := ab.Meta["~/.vimrc"], ba.Meta["~/.vimrc"]; x != y || x.Revision != 3 || x.Name != "vim" {
+		t.Errorf("definitions %+v and %+v, want laptop's at revision 3 from both", x, y)
+	}
+}
+
+func TestMergeMeta(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		ours, theirs EntryMeta
+		want         EntryMeta
+	}{
+		{"higher revision wins", EntryMeta{Name: "a", Revision: 3}, EntryMeta{Name: "b", Revision: 2}, EntryMeta{Name: "a", Revision: 3}},
+		{"theirs higher", EntryMeta{Name: "a", Revision: 2}, EntryMeta{Name: "b", Revision: 4}, EntryMeta{Name: "b", Revision: 4}},
+		{
+			"same revision edited twice is bumped",
+			EntryMeta{Name: "a", Revision: 2, UpdatedBy: "desktop"}, EntryMeta{Name: "b", Revision: 2, UpdatedBy: "laptop"},
+			EntryMeta{Name: "b", Revision: 3, UpdatedBy: "laptop"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			base := &Manifest{Meta: map[string]EntryMeta{"~/.x": {Name: "x", Revision: 1}}}
+			got, _ := Merge(base, &Manifest{Meta: map[string]EntryMeta{"~/.x": tc.ours}}, &Manifest{Meta: map[string]EntryMeta{"~/.x": tc.theirs}})
+			if m := got.Meta["~/.x"]; m != tc.want {
+				t.Errorf("definition = %+v, want %+v", m, tc.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
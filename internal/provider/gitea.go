@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Gitea talks to the REST API (v1) of a Gitea or Forgejo server. The token
+// comes from GITEA_TOKEN or git's credential helper.
+type Gitea struct {
+	BaseURL string // e.g. https://gitea.example.com
+	Token   string
+	Client  *http.Client
+}
+
+type giteaRepo struct {
+	Private  bool   `json:"private"`
+	CloneURL string `json:"clone_url"`
+}
+
+func (g *Gitea) Name() string { return "Gitea" }
+
+func (g *Gitea) api(method, path string, body, out any) error {
+	auth := ""
+	if g.Token != "" {
+		auth = "token " + g.Token
+	}
+	return apiCall(g.Client, method, g.BaseURL+"/api/v1"+path, [2]string{"Authorization", auth}, body, out)
+}
+
+func (g *Gitea) CheckAuth() error {
+	if g.Token == "" {
+		return fmt.Errorf("no Gitea token: set GITEA_TOKEN to an access token with repository write access for %s", g.BaseURL)
+	}
+	if err := g.api("GET", "/user", nil, nil); err != nil {
+		return fmt.Errorf("checking Gitea token: %w", err)
+	}
+	return nil
+}
+
+func (g *Gitea) CreateRepo(name string) (string, error) {
+	var r giteaRepo
+	body := map[string]any{"name": name, "private": true}
+	if err := g.api("POST", "/user/repos", body, &r); err != nil {
+		return "", fmt.Errorf("creating Gitea repo: %w", err)
+	}
+	return r.CloneURL, nil
+}
+
+func (g *Gitea) CloneURL(name string) (string, error) {
+	if !strings.Contains(name, "/") {
+		var user struct {
+			Login string `json:"login"`
+		}
+		if err := g.api("GET", "/user", nil, &user); err != nil {
+			return "", fmt.Errorf("looking up Gitea user: %w", err)
+		}
+		name = user.Login + "/" + name
+	}
+	var r giteaRepo
+	err := g.api("GET", "/repos/"+name, nil, &r)
+	if errors.Is(err, errNotFound) {
+		return "", fmt.Errorf("Gitea repo %s not found", name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return r.CloneURL, nil
+}
+
+func (g *Gitea) IsPublic(repoURL string) (bool, error) {
+	var r giteaRepo
+	err := g.api("GET", "/repos/"+repoPath(repoURL), nil, &r)
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !r.Private, nil
+}
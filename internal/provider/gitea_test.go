@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// giteaServer is a stand-in for the Gitea v1 API: one user, bob, who owns
+// the repos in repos, keyed by "owner/name".
+type giteaServer struct {
+	*httptest.Server
+	token string
+	repos map[string]map[string]any
+}
+
+func newGiteaServer(t *testing.T) *giteaServer {
+	t.Helper()
+	s := &giteaServer{token: "gitea-secret", repos: make(map[string]map[string]any)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/user", func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(w, r) {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"login": "bob"})
+	})
+	mux.HandleFunc("POST /api/v1/user/repos", func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(w, r) {
+			return
+		}
+		var body struct {
+			Name    string `json:"name"`
+			Private bool   `json:"private"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"message": err.Error()})
+			return
+		}
+		if _, ok := s.repos["bob/"+body.Name]; ok {
+			writeJSON(w, http.StatusConflict, map[string]any{"message": "The repository with the same name already exists."})
+			return
+		}
+		writeJSON(w, http.StatusCreated, s.repo("bob/"+body.Name, body.Private))
+	})
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{name}", func(w http.ResponseWriter, r *http.Request) {
+		repo, ok := s.repos[r.PathValue("owner")+"/"+r.PathValue("name")]
+		// Private repos are hidden from requests without the token.
+		if !ok || (repo["private"] == true && r.Header.Get("Authorization") != "token "+s.token) {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "Not Found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, repo)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *giteaServer) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") != "token "+s.token {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"message": "token is required"})
+		return false
+	}
+	return true
+}
+
+func (s *giteaServer) repo(path string, private bool) map[string]any {
+	repo := map[string]any{"private": private, "clone_url": s.URL + "/" + path + ".git"}
+	s.repos[path] = repo
+	return repo
+}
+
+func TestGiteaCheckAuth(t *testing.T) {
+	s := newGiteaServer(t)
+
+	if err := (&Gitea{BaseURL: s.URL, Token: s.token}).CheckAuth(); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+	err := (&Gitea{BaseURL: s.URL, Token: "wrong"}).CheckAuth()
+	if err == nil || !strings.Contains(err.Error(), "token is required") {
+		t.Fatalf("wrong token: got %v, want the API's message", err)
+	}
+	err = (&Gitea{BaseURL: s.URL}).CheckAuth()
+	if err == nil || !strings.Contains(err.Error(), "GITEA_TOKEN") {
+		t.Fatalf("no token: got %v, want it to mention GITEA_TOKEN", err)
+	}
+}
+
+func TestGiteaCreateRepo(t *testing.T) {
+	s := newGiteaServer(t)
+	g := &Gitea{BaseURL: s.URL, Token: s.token, Client: s.Client()}
+
+	url, err := g.CreateRepo("dotfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := s.URL + "/bob/dotfiles.git"; url != want {
+		t.Errorf("clone URL = %q, want %q", url, want)
+	}
+	if s.repos["bob/dotfiles"]["private"] != true {
+		t.Error("created a public repo, want private")
+	}
+	if _, err := g.CreateRepo("dotfiles"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("creating it again: got %v, want the API's message", err)
+	}
+}
+
+func TestGiteaCloneURL(t *testing.T) {
+	s := newGiteaServer(t)
+	s.repo("bob/dotfiles", true)
+	s.repo("team/shared-dots", false)
+	g := &Gitea{BaseURL: s.URL, Token: s.token}
+
+	for name, want := range map[string]string{
+		"dotfiles":         s.URL + "/bob/dotfiles.git",
+		"team/shared-dots": s.URL + "/team/shared-dots.git",
+	} {
+		got, err := g.CloneURL(name)
+		if err != nil {
+			t.Errorf("CloneURL(%q): %v", name, err)
+		} else if got != want {
+			t.Errorf("CloneURL(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := g.CloneURL("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("CloneURL(missing): got %v, want not found", err)
+	}
+}
+
+func TestGiteaIsPublic(t *testing.T) {
+	s := newGiteaServer(t)
+	s.repo("bob/public-dots", false)
+	s.repo("bob/dotfiles", true)
+	g := &Gitea{BaseURL: s.URL, Token: s.token}
+
+	for _, tc := range []struct {
+		url  string
+		want bool
+	}{
+		{s.URL + "/bob/public-dots.git", true},
+		{s.URL + "/bob/dotfiles.git", false},
+		{s.URL + "/bob/missing.git", false},
+	} {
+		got, err := g.IsPublic(tc.url)
+		if err != nil {
+			t.Errorf("IsPublic(%q): %v", tc.url, err)
+		} else if got != tc.want {
+			t.Errorf("IsPublic(%q) = %v, want %v", tc.url, got, tc.want)
+		}
+	}
+}
+
+// Setup warns about a public repo through ForURL, which finds a
+// self-hosted server by the configured kind and base URL.
+func TestGiteaPublicWarning(t *testing.T) {
+	s := newGiteaServer(t)
+	s.repo("bob/public-dots", false)
+	t.Setenv("GITEA_TOKEN", s.token)
+
+	p := ForURL(s.URL+"/bob/public-dots.git", "gitea", s.URL)
+	if p == nil {
+		t.Fatal("ForURL found no provider for the configured server")
+	}
+	if public, err := p.IsPublic(s.URL + "/bob/public-dots.git"); err != nil || !public {
+		t.Errorf("IsPublic = %v, %v; want true", public, err)
+	}
+	if _, err := New("gitea", ""); err == nil {
+		t.Error("New(gitea) without a server URL succeeded")
+	}
+}
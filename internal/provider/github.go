@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// GitHub creates repos through the GitHub CLI, which also handles
+// authentication. Visibility is read from the public REST API.
+type GitHub struct {
+	APIURL string // REST API root, https://api.github.com
+	Client *http.Client
+}
+
+func (g *GitHub) Name() string { return "GitHub" }
+
+func (g *GitHub) CheckAuth() error {
+	switch gsync.CheckGh() {
+	case gsync.GhNotInstalled:
+		return errors.New("the GitHub CLI (gh) is not installed: https://cli.github.com")
+	case gsync.GhNotAuthenticated:
+		return errors.New("the GitHub CLI is not logged in: run 'gh auth login'")
+	}
+	return nil
+}
+
+func (g *GitHub) CreateRepo(name string) (string, error) {
+	return gsync.CreateGitHubRepo(name)
+}
+
+func (g *GitHub) CloneURL(name string) (string, error) {
+	return gsync.GitHubCloneURL(name)
+}
+
+func (g *GitHub) IsPublic(repoURL string) (bool, error) {
+	var repo struct {
+		Private bool `json:"private"`
+	}
+	err := apiCall(g.Client, "GET", g.APIURL+"/repos/"+repoPath(repoURL), [2]string{}, nil, &repo)
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !repo.Private, nil
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitLab talks to the REST API (v4) of gitlab.com or a self-hosted
+// instance. The token comes from GITLAB_TOKEN or git's credential helper.
+type GitLab struct {
+	BaseURL string // e.g. https://gitlab.com
+	Token   string
+	Client  *http.Client
+}
+
+type gitlabProject struct {
+	Visibility string `json:"visibility"`
+	HTTPURL    string `json:"http_url_to_repo"`
+}
+
+func (g *GitLab) Name() string { return "GitLab" }
+
+func (g *GitLab) api(method, path string, body, out any) error {
+	return apiCall(g.Client, method, g.BaseURL+"/api/v4"+path, [2]string{"PRIVATE-TOKEN", g.Token}, body, out)
+}
+
+func (g *GitLab) CheckAuth() error {
+	if g.Token == "" {
+		return fmt.Errorf("no GitLab token: set GITLAB_TOKEN to a personal access token with the api scope for %s", g.BaseURL)
+	}
+	if err := g.api("GET", "/user", nil, nil); err != nil {
+		return fmt.Errorf("checking GitLab token: %w", err)
+	}
+	return nil
+}
+
+func (g *GitLab) CreateRepo(name string) (string, error) {
+	var p gitlabProject
+	body := map[string]any{"name": name, "path": name, "visibility": "private"}
+	if err := g.api("POST", "/projects", body, &p); err != nil {
+		return "", fmt.Errorf("creating GitLab project: %w", err)
+	}
+	return p.HTTPURL, nil
+}
+
+func (g *GitLab) CloneURL(name string) (string, error) {
+	if !strings.Contains(name, "/") {
+		var user struct {
+			Username string `json:"username"`
+		}
+		if err := g.api("GET", "/user", nil, &user); err != nil {
+			return "", fmt.Errorf("looking up GitLab user: %w", err)
+		}
+		name = user.Username + "/" + name
+	}
+	p, err := g.project(name)
+	if err != nil {
+		return "", err
+	}
+	return p.HTTPURL, nil
+}
+
+func (g *GitLab) project(path string) (gitlabProject, error) {
+	var p gitlabProject
+	err := g.api("GET", "/projects/"+url.PathEscape(path), nil, &p)
+	if errors.Is(err, errNotFound) {
+		return p, fmt.Errorf("GitLab project %s not found", path)
+	}
+	return p, err
+}
+
+func (g *GitLab) IsPublic(repoURL string) (bool, error) {
+	var p gitlabProject
+	err := g.api("GET", "/projects/"+url.PathEscape(repoPath(repoURL)), nil, &p)
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return p.Visibility == "public", nil
+}
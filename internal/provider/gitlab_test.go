@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gitlabServer is a stand-in for the GitLab v4 API: one user, alice, who
+// owns the projects in projects, keyed by "owner/name".
+type gitlabServer struct {
+	*httptest.Server
+	token    string
+	projects map[string]map[string]any
+}
+
+func newGitLabServer(t *testing.T) *gitlabServer {
+	t.Helper()
+	s := &gitlabServer{token: "glpat-secret", projects: make(map[string]map[string]any)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(w, r) {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"username": "alice"})
+	})
+	mux.HandleFunc("POST /api/v4/projects", func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(w, r) {
+			return
+		}
+		var body struct{ Name, Path, Visibility string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": err.Error()})
+			return
+		}
+		if _, ok := s.projects["alice/"+body.Path]; ok {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"message": map[string]any{"path": []string{"has already been taken"}}})
+			return
+		}
+		p := s.project("alice/"+body.Path, body.Visibility)
+		writeJSON(w, http.StatusCreated, p)
+	})
+	mux.HandleFunc("GET /api/v4/projects/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.projects[r.PathValue("id")]
+		// Private projects are hidden from requests without the token.
+		if !ok || (p["visibility"] != "public" && r.Header.Get("PRIVATE-TOKEN") != s.token) {
+			writeJSON(w, http.StatusNotFound, map[string]any{"message": "404 Project Not Found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *gitlabServer) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("PRIVATE-TOKEN") != s.token {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"message": "401 Unauthorized"})
+		return false
+	}
+	return true
+}
+
+func (s *gitlabServer) project(path, visibility string) map[string]any {
+	p := map[string]any{"visibility": visibility, "http_url_to_repo": s.URL + "/" + path + ".git"}
+	s.projects[path] = p
+	return p
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestGitLabCheckAuth(t *testing.T) {
+	s := newGitLabServer(t)
+
+	if err := (&GitLab{BaseURL: s.URL, Token: s.token}).CheckAuth(); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+	err := (&GitLab{BaseURL: s.URL, Token: "wrong"}).CheckAuth()
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("wrong token: got %v, want a 401 error", err)
+	}
+	err = (&GitLab{BaseURL: s.URL}).CheckAuth()
+	if err == nil || !strings.Contains(err.Error(), "GITLAB_TOKEN") {
+		t.Fatalf("no token: got %v, want it to mention GITLAB_TOKEN", err)
+	}
+}
+
+func TestGitLabCreateRepo(t *testing.T) {
+	s := newGitLabServer(t)
+	g := &GitLab{BaseURL: s.URL, Token: s.token, Client: s.Client()}
+
+	url, err := g.CreateRepo("dotfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := s.URL + "/alice/dotfiles.git"; url != want {
+		t.Errorf("clone URL = %q, want %q", url, want)
+	}
+	if v := s.projects["alice/dotfiles"]["visibility"]; v != "private" {
+		t.Errorf("created with visibility %v, want private", v)
+	}
+	if _, err := g.CreateRepo("dotfiles"); err == nil || !strings.Contains(err.Error(), "already been taken") {
+		t.Errorf("creating it again: got %v, want the API's message", err)
+	}
+}
+
+func TestGitLabCloneURL(t *testing.T) {
+	s := newGitLabServer(t)
+	s.project("alice/dotfiles", "private")
+	s.project("team/shared-dots", "internal")
+	g := &GitLab{BaseURL: s.URL, Token: s.token}
+
+	for name, want := range map[string]string{
+		"dotfiles":         s.URL + "/alice/dotfiles.git",
+		"team/shared-dots": s.URL + "/team/shared-dots.git",
+	} {
+		got, err := g.CloneURL(name)
+		if err != nil {
+			t.Errorf("CloneURL(%q): %v", name, err)
+		} else if got != want {
+			t.Errorf("CloneURL(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := g.CloneURL("missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("CloneURL(missing): got %v, want not found", err)
+	}
+}
+
+func TestGitLabIsPublic(t *testing.T) {
+	s := newGitLabServer(t)
+	s.project("alice/public-dots", "public")
+	s.project("alice/dotfiles", "private")
+	s.project("alice/internal-dots", "internal")
+	g := &GitLab{BaseURL: s.URL, Token: s.token}
+
+	for _, tc := range []struct {
+		url  string
+		want bool
+	}{
+		{s.URL + "/alice/public-dots.git", true},
+		{s.URL + "/alice/dotfiles.git", false},
+		{s.URL + "/alice/internal-dots.git", false},
+		{s.URL + "/alice/missing.git", false},
+	} {
+		got, err := g.IsPublic(tc.url)
+		if err != nil {
+			t.Errorf("IsPublic(%q): %v", tc.url, err)
+		} else if got != tc.want {
+			t.Errorf("IsPublic(%q) = %v, want %v", tc.url, got, tc.want)
+		}
+	}
+}
+
+// Setup warns about a public repo through ForURL, which finds a
+// self-hosted server by the configured kind and base URL.
+func TestGitLabPublicWarning(t *testing.T) {
+	s := newGitLabServer(t)
+	s.project("alice/public-dots", "public")
+	t.Setenv("GITLAB_TOKEN", s.token)
+
+	p := ForURL(s.URL+"/alice/public-dots.git", "gitlab", s.URL)
+	if p == nil {
+		t.Fatal("ForURL found no provider for the configured server")
+	}
+	if public, err := p.IsPublic(s.URL + "/alice/public-dots.git"); err != nil || !public {
+		t.Errorf("IsPublic = %v, %v; want true", public, err)
+	}
+	if p := ForURL("https://git.example.com/alice/public-dots.git", "gitlab", s.URL); p != nil {
+		t.Errorf("ForURL matched another host: %s", p.Name())
+	}
+}
@@ -0,0 +1,191 @@
+// Package provider creates and inspects dotfile repos on hosting services
+// (GitHub, GitLab, Gitea). Plain git remotes need no provider.
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// Provider is a hosting service dfc can create repos on.
+type Provider interface {
+	// Name is the provider's display name.
+	Name() string
+	// CheckAuth verifies dfc can act as the user, returning an error that
+	// says how to log in if not.
+	CheckAuth() error
+	// CreateRepo creates a private repo and returns its clone URL.
+	CreateRepo(name string) (string, error)
+	// CloneURL returns the clone URL of an existing repo, given as "name"
+	// (owned by the user) or "owner/name".
+	CloneURL(name string) (string, error)
+	// IsPublic reports whether the repo at a clone URL can be read by
+	// anyone. A repo that is private or not found is not public.
+	IsPublic(repoURL string) (bool, error)
+}
+
+// Kinds lists the providers setup offers, in order.
+var Kinds = []string{"github", "gitlab", "gitea"}
+
+// New returns the provider of the given kind. baseURL is the web address of
+// a self-hosted GitLab or Gitea; empty means gitlab.com for GitLab, and is
+// required for Gitea.
+func New(kind, baseURL string) (Provider, error) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	switch kind {
+	case "github", "":
+		return &GitHub{APIURL: "https://api.github.com"}, nil
+	case "gitlab":
+		if baseURL == "" {
+			baseURL = "https://gitlab.com"
+		}
+		return &GitLab{BaseURL: baseURL, Token: token("GITLAB_TOKEN", baseURL)}, nil
+	case "gitea":
+		if baseURL == "" {
+			return nil, errors.New("Gitea needs the server's URL, e.g. https://gitea.example.com")
+		}
+		return &Gitea{BaseURL: baseURL, Token: token("GITEA_TOKEN", baseURL)}, nil
+	}
+	return nil, fmt.Errorf("unknown provider %q", kind)
+}
+
+// ForURL returns the provider hosting repoURL: GitHub and gitlab.com are
+// recognised by host, a self-hosted server by the configured kind and base
+// URL. Returns nil for any other remote.
+func ForURL(repoURL, kind, baseURL string) Provider {
+	host := hostOf(repoURL)
+	switch {
+	case host == "":
+		return nil
+	case host == "github.com":
+		p, _ := New("github", "")
+		return p
+	case host == "gitlab.com":
+		p, _ := New("gitlab", "")
+		return p
+	case kind != "" && baseURL != "" && host == hostOf(baseURL):
+		p, _ := New(kind, baseURL)
+		return p
+	}
+	return nil
+}
+
+// hostOf returns the lower-case host of a remote URL, or "" for a local path
+// or a store.
+func hostOf(repoURL string) string {
+	if gsync.IsLocalRemote(repoURL) || gsync.IsStoreURL(repoURL) {
+		return ""
+	}
+	host, _, _ := strings.Cut(gsync.NormalizeURL(repoURL), "/")
+	return host
+}
+
+// repoPath returns the owner/name path of a remote URL.
+func repoPath(repoURL string) string {
+	_, path, _ := strings.Cut(gsync.NormalizeURL(repoURL), "/")
+	return path
+}
+
+// token finds an API token for baseURL: the named environment variable,
+// else the password git's credential helper stores for the host.
+func token(env, baseURL string) string {
+	if t := os.Getenv(env); t != "" {
+		return t
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\n\n", u.Scheme, u.Host))
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if p, ok := strings.CutPrefix(line, "password="); ok {
+			return p
+		}
+	}
+	return ""
+}
+
+var httpClient = &http.Client{Timeout: 20 * time.Second}
+
+// errNotFound is returned by apiCall for a 404, which hosting APIs also
+// answer for private repos the caller can't see.
+var errNotFound = errors.New("not found")
+
+// apiCall sends a JSON request and decodes the JSON response into out.
+// header is the auth header name and value, if any.
+func apiCall(client *http.Client, method, endpoint string, header [2]string, body, out any) error {
+	var rd io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = strings.NewReader(string(data))
+	}
+	req, err := http.NewRequest(method, endpoint, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if header[1] != "" {
+		req.Header.Set(header[0], header[1])
+	}
+	if client == nil {
+		client = httpClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, endpoint, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("%s %s: %s: %s", method, endpoint, resp.Status, apiMessage(data))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding %s response: %w", endpoint, err)
+	}
+	return nil
+}
+
+// apiMessage extracts the error message from a JSON error body.
+func apiMessage(data []byte) string {
+	var e struct {
+		Message any `json:"message"`
+		Error   any `json:"error"`
+	}
+	if json.Unmarshal(data, &e) == nil {
+		if e.Message != nil {
+			return fmt.Sprint(e.Message)
+		}
+		if e.Error != nil {
+			return fmt.Sprint(e.Error)
+		}
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,41 @@
+package restore
+
+import (
+	"time"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+)
+
+// Record updates LocalVersion and LastHash from the repo manifest for
+// successfully restored entries and saves the config, noting the restore
+// time. The repo is left alone: the next backup carries the new versions
+// and the restore time into the device registry, so restoring works on
+// machines that can't push.
+func Record(cfg *config.Config, results []Progress) error {
+	mf, err := manifest.Load(cfg.RepoPath)
+	if err != nil {
+		return err
+	}
+
+	restored := 0
+	for _, p := range results {
+		if !p.Done || p.Err != nil {
+			continue
+		}
+		for j := range cfg.Entries {
+			if cfg.Entries[j].Path == p.Entry.Path {
+				mkey := storage.ManifestKey(cfg.Entries[j], cfg.DeviceProfile)
+				cfg.Entries[j].LocalVersion = mf.GetVersion(mkey)
+				cfg.Entries[j].LastHash = mf.Entries[mkey].ContentHash
+				restored++
+				break
+			}
+		}
+	}
+	if restored > 0 {
+		cfg.RestoredAt = time.Now()
+	}
+	return cfg.Save()
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/hooks"
 	"github.com/solarisjon/dfc/internal/storage"
 )
 
@@ -21,13 +22,18 @@ type Progress struct {
 	Err         error
 	BytesCopied int64
 	BytesTotal  int64
-	Skipped     int      // number of files skipped due to errors
-	SkipReasons []string // why each file was skipped
+	Skipped     int            // number of files skipped due to errors
+	SkipReasons []string       // why each file was skipped
+	Hooks       []hooks.Result // hook commands run for this entry
 }
 
 // Run restores entries from the repo to the filesystem.
 // The profile parameter determines where profile-specific entries are read from.
-func Run(entries []config.Entry, repoPath string, profile string) <-chan Progress {
+// When the profile inherits from other layers, each file comes from the most
+// specific layer that has it.
+// Global hooks run before the first entry and after the last, mirroring
+// backup.Run; with no entries neither runs.
+func Run(entries []config.Entry, repoPath string, profile string, global config.Hooks) <-chan Progress {
 	ch := make(chan Progress)
 
 	go func() {
@@ -35,19 +41,43 @@ func Run(entries []config.Entry, repoPath string, profile string) <-chan Progres
 
 		repoPath = expandHome(repoPath)
 		total := len(entries)
+		if total == 0 {
+			return
+		}
+
+		globalPre, hasGlobalPre := hooks.Run(global, hooks.PreRestore, config.Entry{}, true)
+		skipAll := hasGlobalPre && globalPre.Failed() && global.SkipOnFailure
 
 		for i, entry := range entries {
 			p := Progress{Entry: entry, Index: i, Total: total}
+			if i == 0 && hasGlobalPre {
+				p.Hooks = append(p.Hooks, globalPre)
+			}
+			if skipAll {
+				p.Done = true
+				p.Err = fmt.Errorf("skipped: global pre-restore hook failed")
+				sendWithPostHooks(ch, p, global, i == total-1)
+				continue
+			}
 
-			// Use storage paths: shared/ or profiles/<profile>/
-			relPath := storage.RepoDir(entry, profile)
-			srcPath := filepath.Join(repoPath, relPath)
+			if r, ok := hooks.Run(entry.Hooks, hooks.PreRestore, entry, false); ok {
+				p.Hooks = append(p.Hooks, r)
+				if r.Failed() && entry.Hooks.SkipOnFailure {
+					p.Done = true
+					p.Err = fmt.Errorf("skipped: %v", r.Err)
+					sendWithPostHooks(ch, p, global, i == total-1)
+					continue
+				}
+			}
+
+			// Use storage paths: shared/ or profiles/<profile>/ (and its parents)
+			srcDirs := storage.SourceDirs(repoPath, entry, profile)
 			dstPath := expandHome(entry.Path)
 
 			// Check source exists in repo before attempting restore.
 			// For directory entries not yet in the repo, create the destination
 			// directory on disk so the path exists ready for future use.
-			if _, err := os.Stat(srcPath); os.IsNotExist(err) {
+			if len(srcDirs) == 0 {
 				if entry.IsDir {
 					if mkErr := os.MkdirAll(dstPath, 0755); mkErr != nil {
 						p.Done = true
@@ -55,37 +85,60 @@ func Run(entries []config.Entry, repoPath string, profile string) <-chan Progres
 					} else {
 						p.Done = true
 					}
-					ch <- p
+					sendWithPostHooks(ch, p, global, i == total-1)
 					continue
 				}
 				p.Done = true
 				p.Err = fmt.Errorf("not found in repo (run Backup on source machine first)")
-				ch <- p
+				sendWithPostHooks(ch, p, global, i == total-1)
 				continue
 			}
 
 			var err error
 			if entry.IsDir {
-				err = copyDir(srcPath, dstPath, &p)
+				// Least specific layer first so more specific files win.
+				for j := len(srcDirs) - 1; j >= 0 && err == nil; j-- {
+					err = copyDir(filepath.Join(repoPath, srcDirs[j]), dstPath, &p)
+				}
 			} else {
-				err = copyFile(srcPath, dstPath, &p)
+				err = copyFile(filepath.Join(repoPath, srcDirs[0]), dstPath, &p)
 			}
 
 			p.Done = true
 			p.Err = err
-			ch <- p
+			if err == nil {
+				if r, ok := hooks.Run(entry.Hooks, hooks.PostRestore, entry, false); ok {
+					p.Hooks = append(p.Hooks, r)
+				}
+			}
+			sendWithPostHooks(ch, p, global, i == total-1)
 		}
 	}()
 
 	return ch
 }
 
+// sendWithPostHooks sends p, first running the global post-restore hook if
+// this is the last entry so its result is reported alongside it.
+func sendWithPostHooks(ch chan<- Progress, p Progress, global config.Hooks, last bool) {
+	if last {
+		if r, ok := hooks.Run(global, hooks.PostRestore, config.Entry{}, true); ok {
+			p.Hooks = append(p.Hooks, r)
+		}
+	}
+	ch <- p
+}
+
 func copyFile(src, dst string, p *Progress) error {
 	info, err := os.Stat(src)
 	if err != nil {
 		return fmt.Errorf("stat %s: %w", src, err)
 	}
 	p.BytesTotal = info.Size()
+	if lfsPointer(src, info.Size()) {
+		skipFile(p, src, filepath.Dir(src), lfsSkip)
+		return fmt.Errorf("skipped: %s", lfsSkip)
+	}
 
 	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
 		return err
@@ -131,7 +184,7 @@ func copyDir(src, dst string, p *Progress) error {
 		totalBytes += info.Size()
 		return nil
 	})
-	p.BytesTotal = totalBytes
+	p.BytesTotal += totalBytes
 
 	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -184,6 +237,10 @@ func copyDir(src, dst string, p *Progress) error {
 			skipFile(p, path, src, fmt.Sprintf("stat error: %v", err))
 			return nil
 		}
+		if lfsPointer(path, info.Size()) {
+			skipFile(p, path, src, lfsSkip)
+			return nil
+		}
 
 		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
 			skipFile(p, path, src, fmt.Sprintf("mkdir error: %v", err))
@@ -215,6 +272,19 @@ func copyDir(src, dst string, p *Progress) error {
 	})
 }
 
+// lfsSkip is why a Git LFS pointer isn't restored.
+const lfsSkip = "stored in Git LFS — install git-lfs and sync to restore it"
+
+// lfsPointer reports whether the repo file at path is a Git LFS pointer,
+// which a clone without git-lfs has in place of the file's content.
+func lfsPointer(path string, size int64) bool {
+	if size > 1024 {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && strings.HasPrefix(string(data), "version https://git-lfs.github.com/spec/")
+}
+
 func skipFile(p *Progress, path, base, reason string) {
 	rel, err := filepath.Rel(base, path)
 	if err != nil {
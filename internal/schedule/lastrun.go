@@ -0,0 +1,68 @@
+package schedule
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// LastRun records the outcome of the most recent scheduled run.
+// Stored as last-run.yaml next to the config.
+type LastRun struct {
+	Mode       Mode      `yaml:"mode"`
+	StartedAt  time.Time `yaml:"started_at"`
+	FinishedAt time.Time `yaml:"finished_at"`
+	OK         bool      `yaml:"ok"`
+	Summary    string    `yaml:"summary,omitempty"`
+	Error      string    `yaml:"error,omitempty"`
+}
+
+const lastRunFile = "last-run.yaml"
+
+func lastRunPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, lastRunFile), nil
+}
+
+// LoadLastRun reads the last scheduled run. Returns nil if none recorded.
+func LoadLastRun() (*LastRun, error) {
+	path, err := lastRunPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var r LastRun
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// SaveLastRun writes r as the most recent scheduled run.
+func SaveLastRun(r LastRun) error {
+	path, err := lastRunPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
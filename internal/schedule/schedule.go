@@ -0,0 +1,342 @@
+package schedule
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Mode is the non-interactive command a schedule runs.
+type Mode string
+
+const (
+	ModeBackup Mode = "backup" // `dfc backup --scheduled`
+	ModePull   Mode = "pull"   // `dfc pull --scheduled`: sync and report, no restore
+)
+
+// Modes lists every schedulable mode.
+var Modes = []Mode{ModeBackup, ModePull}
+
+// Valid reports whether m is a known mode.
+func (m Mode) Valid() bool {
+	return m == ModeBackup || m == ModePull
+}
+
+// Options describes a schedule to install.
+type Options struct {
+	Mode     Mode
+	Interval time.Duration
+	Binary   string // absolute path to dfc; defaults to the running executable
+	Cron     bool   // install a crontab line instead of systemd units
+}
+
+// Installed describes one schedule found on this machine.
+type Installed struct {
+	Mode   Mode
+	Kind   string // "systemd" or "cron"
+	Detail string // timer state or the crontab line
+}
+
+const cronMarker = "# dfc:"
+
+func unitName(m Mode) string { return "dfc-" + string(m) }
+
+func unitDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "systemd", "user"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "systemd", "user"), nil
+}
+
+// HasSystemd reports whether a systemd user manager is reachable.
+func HasSystemd() bool {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return false
+	}
+	return exec.Command("systemctl", "--user", "show-environment").Run() == nil
+}
+
+func (o *Options) fill() error {
+	if !o.Mode.Valid() {
+		return fmt.Errorf("unknown mode %q (want backup or pull)", o.Mode)
+	}
+	if o.Interval < time.Minute {
+		return fmt.Errorf("interval must be at least 1m")
+	}
+	if o.Binary == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("locating dfc binary: %w", err)
+		}
+		o.Binary = exe
+	}
+	return nil
+}
+
+// ServiceUnit renders the systemd .service unit for opts.
+func ServiceUnit(opts Options) string {
+	return fmt.Sprintf(`[Unit]
+Description=dfc scheduled %[1]s
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%[2]s %[1]s --scheduled
+`, opts.Mode, systemdQuote(opts.Binary))
+}
+
+// TimerUnit renders the systemd .timer unit for opts.
+func TimerUnit(opts Options) string {
+	return fmt.Sprintf(`[Unit]
+Description=Run dfc %[1]s every %[2]s
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=%[2]s
+Unit=%[3]s.service
+
+[Install]
+WantedBy=timers.target
+`, opts.Mode, systemdDuration(opts.Interval), unitName(opts.Mode))
+}
+
+// CronLine renders the crontab line for opts. Cron can only express
+// intervals that divide evenly into an hour or a day.
+func CronLine(opts Options) (string, error) {
+	var spec string
+	switch d := opts.Interval; {
+	case d == 24*time.Hour:
+		spec = "0 0 * * *"
+	case d < time.Hour && d%time.Minute == 0 && 60%int(d.Minutes()) == 0:
+		spec = fmt.Sprintf("*/%d * * * *", int(d.Minutes()))
+	case d >= time.Hour && d < 24*time.Hour && d%time.Hour == 0 && 24%int(d.Hours()) == 0:
+		spec = fmt.Sprintf("0 */%d * * *", int(d.Hours()))
+	default:
+		return "", fmt.Errorf("cron cannot run every %s — use a divisor of 1h or 24h", opts.Interval)
+	}
+	if strings.ContainsAny(opts.Binary, "\r\n") {
+		return "", fmt.Errorf("cron cannot run %q: its path has a line break", opts.Binary)
+	}
+	return fmt.Sprintf("%s %s %s --scheduled >/dev/null 2>&1 %s%s",
+		spec, cronQuote(opts.Binary), opts.Mode, cronMarker, opts.Mode), nil
+}
+
+// cronQuote quotes s as one shell word in a crontab command. Cron turns
+// an unescaped % into a line break before the shell sees it.
+func cronQuote(s string) string {
+	s = "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	return strings.ReplaceAll(s, "%", `\%`)
+}
+
+// systemdQuote quotes s as one word of a unit's ExecStart=, escaping what
+// systemd would otherwise expand: specifiers (%), variables ($) and
+// backslash escapes.
+func systemdQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$")
+	return `"` + r.Replace(s) + `"`
+}
+
+// Install writes and enables a schedule, replacing any existing one for the
+// same mode. Returns a short description of what was installed.
+func Install(opts Options) (string, error) {
+	if err := opts.fill(); err != nil {
+		return "", err
+	}
+	if opts.Cron {
+		line, err := CronLine(opts)
+		if err != nil {
+			return "", err
+		}
+		lines, err := readCrontab()
+		if err != nil {
+			return "", err
+		}
+		lines = append(withoutMode(lines, opts.Mode), line)
+		if err := writeCrontab(lines); err != nil {
+			return "", err
+		}
+		return "crontab: " + line, nil
+	}
+
+	if !HasSystemd() {
+		return "", fmt.Errorf("systemd user manager not available — use --cron instead")
+	}
+	dir, err := unitDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := unitName(opts.Mode)
+	if err := os.WriteFile(filepath.Join(dir, name+".service"), []byte(ServiceUnit(opts)), 0644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".timer"), []byte(TimerUnit(opts)), 0644); err != nil {
+		return "", err
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return "", err
+	}
+	if err := systemctl("enable", "--now", name+".timer"); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("systemd: %s.timer every %s", name, systemdDuration(opts.Interval)), nil
+}
+
+// Remove disables and deletes schedules for mode, or for every mode if
+// mode is empty. Returns descriptions of what was removed.
+func Remove(mode Mode) ([]string, error) {
+	modes := Modes
+	if mode != "" {
+		modes = []Mode{mode}
+	}
+
+	var removed []string
+	if dir, err := unitDir(); err == nil {
+		for _, m := range modes {
+			name := unitName(m)
+			timer := filepath.Join(dir, name+".timer")
+			if _, err := os.Stat(timer); err != nil {
+				continue
+			}
+			if HasSystemd() {
+				_ = systemctl("disable", "--now", name+".timer")
+			}
+			os.Remove(timer)
+			os.Remove(filepath.Join(dir, name+".service"))
+			removed = append(removed, "systemd: "+name+".timer")
+		}
+		if len(removed) > 0 && HasSystemd() {
+			_ = systemctl("daemon-reload")
+		}
+	}
+
+	if _, err := exec.LookPath("crontab"); err == nil {
+		lines, err := readCrontab()
+		if err != nil {
+			return removed, err
+		}
+		kept := lines
+		for _, m := range modes {
+			before := len(kept)
+			kept = withoutMode(kept, m)
+			if len(kept) != before {
+				removed = append(removed, "crontab: "+string(m))
+			}
+		}
+		if len(kept) != len(lines) {
+			if err := writeCrontab(kept); err != nil {
+				return removed, err
+			}
+		}
+	}
+	return removed, nil
+}
+
+// Status lists the schedules installed on this machine.
+func Status() ([]Installed, error) {
+	var found []Installed
+	if dir, err := unitDir(); err == nil {
+		for _, m := range Modes {
+			name := unitName(m)
+			if _, err := os.Stat(filepath.Join(dir, name+".timer")); err != nil {
+				continue
+			}
+			state := "installed"
+			if HasSystemd() {
+				out, _ := exec.Command("systemctl", "--user", "is-active", name+".timer").Output()
+				state = strings.TrimSpace(string(out))
+			}
+			found = append(found, Installed{Mode: m, Kind: "systemd", Detail: name + ".timer " + state})
+		}
+	}
+	if _, err := exec.LookPath("crontab"); err == nil {
+		lines, err := readCrontab()
+		if err != nil {
+			return found, err
+		}
+		for _, line := range lines {
+			idx := strings.Index(line, cronMarker)
+			if idx < 0 {
+				continue
+			}
+			found = append(found, Installed{
+				Mode:   Mode(strings.TrimSpace(line[idx+len(cronMarker):])),
+				Kind:   "cron",
+				Detail: strings.TrimSpace(line[:idx]),
+			})
+		}
+	}
+	return found, nil
+}
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", append([]string{"--user"}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %s: %w", args[0], strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// readCrontab returns the user's crontab lines (none if no crontab exists).
+func readCrontab() ([]string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("crontab", "-l")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(stderr.String(), "no crontab") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("crontab -l: %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+	text := strings.TrimRight(string(out), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+func writeCrontab(lines []string) error {
+	cmd := exec.Command("crontab", "-")
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("crontab: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+func withoutMode(lines []string, m Mode) []string {
+	var kept []string
+	for _, line := range lines {
+		if strings.HasSuffix(strings.TrimSpace(line), cronMarker+string(m)) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+// systemdDuration formats d as a systemd time span, e.g. "1h30min".
+func systemdDuration(d time.Duration) string {
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	switch {
+	case h > 0 && m > 0:
+		return fmt.Sprintf("%dh%dmin", h, m)
+	case h > 0:
+		return fmt.Sprintf("%dh", h)
+	default:
+		return fmt.Sprintf("%dmin", m)
+	}
+}
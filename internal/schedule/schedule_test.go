@@ -0,0 +1,106 @@
+package schedule
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cronShell runs the command part of a crontab line the way cron does: %
+// signs it doesn't find escaped end the command, then sh runs it.
+func cronShell(t *testing.T, command string) string {
+	t.Helper()
+	var b strings.Builder
+	for i := 0; i < len(command); i++ {
+		switch {
+		case command[i] == '\\' && i+1 < len(command) && command[i+1] == '%':
+			b.WriteByte('%')
+			i++
+		case command[i] == '%':
+			t.Fatalf("unescaped %% in %q", command)
+		default:
+			b.WriteByte(command[i])
+		}
+	}
+	cmd := exec.Command("sh", "-c", b.String())
+	cmd.Dir = t.TempDir()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("sh -c %q: %v\n%s", b.String(), err, out)
+	}
+	return string(out)
+}
+
+func TestCronLineQuotesBinary(t *testing.T) {
+	for _, bin := range []string{
+		"/usr/local/bin/dfc",
+		"/home/me/My Apps/dfc",
+		"/home/o'brien/bin/dfc",
+		"/opt/100%/dfc",
+		`/tmp/$(touch pwned)/"dfc"\`,
+		"/tmp/a;b&c|d`e`/dfc",
+	} {
+		t.Run(bin, func(t *testing.T) {
+			line, err := CronLine(Options{Mode: ModeBackup, Interval: 15 * time.Minute, Binary: bin})
+			if err != nil {
+				t.Fatal(err)
+			}
+			spec, rest, ok := strings.Cut(line, " * * * * ")
+			if !ok || spec != "*/15" {
+				t.Fatalf("unexpected schedule in %q", line)
+			}
+			word, _, ok := strings.Cut(rest, " backup --scheduled >/dev/null 2>&1 "+cronMarker+"backup")
+			if !ok {
+				t.Fatalf("unexpected command in %q", line)
+			}
+			if got := cronShell(t, `printf '\%s' `+word); got != bin {
+				t.Errorf("cron runs %q, want %q", got, bin)
+			}
+			if kept := withoutMode([]string{"0 * * * * other", line}, ModeBackup); len(kept) != 1 {
+				t.Errorf("withoutMode kept %q", kept)
+			}
+		})
+	}
+
+	if _, err := CronLine(Options{Mode: ModePull, Interval: time.Hour, Binary: "/tmp/a\n* * * * * evil"}); err == nil {
+		t.Error("CronLine accepted a path with a line break")
+	}
+}
+
+func TestCronLineSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		every time.Duration
+		spec  string // "" when cron cannot express it
+	}{
+		{time.Minute, "*/1 * * * *"},
+		{15 * time.Minute, "*/15 * * * *"},
+		{time.Hour, "0 */1 * * *"},
+		{6 * time.Hour, "0 */6 * * *"},
+		{24 * time.Hour, "0 0 * * *"},
+		{7 * time.Minute, ""},
+		{90 * time.Minute, ""},
+		{5 * time.Hour, ""},
+		{48 * time.Hour, ""},
+	} {
+		line, err := CronLine(Options{Mode: ModePull, Interval: tc.every, Binary: "/bin/dfc"})
+		switch {
+		case tc.spec == "" && err == nil:
+			t.Errorf("every %s: got %q, want an error", tc.every, line)
+		case tc.spec != "" && !strings.HasPrefix(line, tc.spec+" '/bin/dfc' pull"):
+			t.Errorf("every %s: got %q, %v; want schedule %q", tc.every, line, err, tc.spec)
+		}
+	}
+}
+
+func TestServiceUnitQuotesBinary(t *testing.T) {
+	for bin, want := range map[string]string{
+		"/usr/bin/dfc":           `ExecStart="/usr/bin/dfc" pull --scheduled`,
+		"/home/me/My Apps/dfc":   `ExecStart="/home/me/My Apps/dfc" pull --scheduled`,
+		`/opt/50%/$HOME/"x"\dfc`: `ExecStart="/opt/50%%/$$HOME/\"x\"\\dfc" pull --scheduled`,
+	} {
+		if unit := ServiceUnit(Options{Mode: ModePull, Binary: bin}); !strings.Contains(unit, "\n"+want+"\n") {
+			t.Errorf("unit for %q lacks %s:\n%s", bin, want, unit)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Profiles declares which layers each device profile inherits from.
+// Stored as .dfc-profiles.yaml in the repo root so every device resolves
+// layers the same way:
+//
+//	profiles:
+//	  work:
+//	    parents: [base]
+//	  home:
+//	    parents: [base]
+type Profiles struct {
+	Profiles map[string]ProfileDef `yaml:"profiles"`
+}
+
+// ProfileDef describes a single profile.
+type ProfileDef struct {
+	Parents []string `yaml:"parents,omitempty"` // most specific first
+}
+
+// ProfilesFile is the profile definitions file in the repo root.
+const ProfilesFile = ".dfc-profiles.yaml"
+
+// LoadProfiles reads the profile definitions from the repo. Returns empty
+// definitions if the file does not exist.
+func LoadProfiles(repoPath string) (*Profiles, error) {
+	path := filepath.Join(expandHome(repoPath), ProfilesFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Profiles{Profiles: make(map[string]ProfileDef)}, nil
+		}
+		return nil, fmt.Errorf("reading profiles: %w", err)
+	}
+
+	var p Profiles
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing profiles: %w", err)
+	}
+	if p.Profiles == nil {
+		p.Profiles = make(map[string]ProfileDef)
+	}
+	return &p, nil
+}
+
+// Save writes the profile definitions to the repo.
+func (p *Profiles) Save(repoPath string) error {
+	path := filepath.Join(expandHome(repoPath), ProfilesFile)
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("marshaling profiles: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// SetParents replaces the parents of profile. An empty list removes the
+// profile's definition.
+func (p *Profiles) SetParents(profile string, parents []string) {
+	profile = strings.ToLower(profile)
+	var clean []string
+	for _, parent := range parents {
+		parent = strings.ToLower(strings.TrimSpace(parent))
+		if parent != "" && parent != profile {
+			clean = append(clean, parent)
+		}
+	}
+	if len(clean) == 0 {
+		delete(p.Profiles, profile)
+		return
+	}
+	p.Profiles[profile] = ProfileDef{Parents: clean}
+}
+
+// Layers returns profile followed by its ancestors, most specific first.
+// Parents are expanded depth-first in declaration order; cycles and repeats
+// are ignored.
+func (p *Profiles) Layers(profile string) []string {
+	profile = strings.ToLower(profile)
+	if profile == "" {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var layers []string
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		layers = append(layers, name)
+		for _, parent := range p.Profiles[name].Parents {
+			visit(strings.ToLower(parent))
+		}
+	}
+	visit(profile)
+	return layers
+}
+
+// Names returns every profile that is declared or used as a parent, sorted.
+func (p *Profiles) Names() []string {
+	seen := make(map[string]bool)
+	for name, def := range p.Profiles {
+		seen[strings.ToLower(name)] = true
+		for _, parent := range def.Parents {
+			seen[strings.ToLower(parent)] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EntryLayers returns the layers a profile-specific entry is resolved
+// through on a device with the given profile, most specific first.
+// Returns nil for shared entries, when no profile is set, or when a host or
+// OS variant is in effect (variants are complete copies, not layered).
+func EntryLayers(repoPath string, entry config.Entry, profile string) []string {
+	if !entry.ProfileSpecific || profile == "" || entry.Variant != "" {
+		return nil
+	}
+	p, err := LoadProfiles(repoPath)
+	if err != nil {
+		return []string{strings.ToLower(profile)}
+	}
+	return p.Layers(profile)
+}
+
+// LayerDir returns the repo-relative directory of an entry in one layer.
+func LayerDir(entry config.Entry, layer string) string {
+	return filepath.Join("profiles", strings.ToLower(layer), homeRelative(entry.Path))
+}
+
+// LayerKey returns the manifest key of an entry in one layer.
+func LayerKey(entry config.Entry, layer string) string {
+	return "profiles/" + strings.ToLower(layer) + "/" + entry.Path
+}
+
+// ExistingLayers returns the layers, most specific first, that hold a copy
+// of entry in the repo.
+func ExistingLayers(repoPath string, entry config.Entry, layers []string) []string {
+	repoPath = expandHome(repoPath)
+	var found []string
+	for _, l := range layers {
+		if _, err := os.Lstat(filepath.Join(repoPath, LayerDir(entry, l))); err == nil {
+			found = append(found, l)
+		}
+	}
+	return found
+}
+
+// SourceDirs returns the repo-relative directories an entry is restored
+// from, most specific first. Shared entries and entries without inherited
+// layers have at most one; layered entries have one per layer that holds
+// a copy. Returns nil if the entry is not in the repo.
+func SourceDirs(repoPath string, entry config.Entry, profile string) []string {
+	layers := EntryLayers(repoPath, entry, profile)
+	if len(layers) <= 1 {
+		rel := RepoDir(entry, profile)
+		if _, err := os.Lstat(filepath.Join(expandHome(repoPath), rel)); err != nil {
+			return nil
+		}
+		return []string{rel}
+	}
+	var dirs []string
+	for _, l := range ExistingLayers(repoPath, entry, layers) {
+		dirs = append(dirs, LayerDir(entry, l))
+	}
+	return dirs
+}
+
+// Overlay maps every file of a layered directory entry, relative to the
+// entry root, to the most specific layer that contains it. Directories and
+// .git are not included; symlinks are.
+func Overlay(repoPath string, entry config.Entry, layers []string) map[string]string {
+	repoPath = expandHome(repoPath)
+	files := make(map[string]string)
+	for _, l := range layers {
+		root := filepath.Join(repoPath, LayerDir(entry, l))
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return nil
+			}
+			if _, ok := files[rel]; !ok {
+				files[rel] = l
+			}
+			return nil
+		})
+	}
+	return files
+}
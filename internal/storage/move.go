@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+// MoveTargetExists reports whether the repo already has content for the
+// default copy of to, other than the content of from itself.
+func MoveTargetExists(repoPath string, from, to config.Entry, profile string) bool {
+	src := VariantRepoDir(from, profile, "")
+	dst := VariantRepoDir(to, profile, "")
+	if src == dst {
+		return false
+	}
+	_, err := os.Lstat(filepath.Join(expandHome(repoPath), dst))
+	return err == nil
+}
+
+// MoveEntry moves an entry's repo content and manifest records from where
+// from is stored to where to is stored — e.g. between shared/ and
+// profiles/<p>/, or to a new path. The default copy and every host/OS
+// variant move together, keeping their versions.
+//
+// If the target already has content, keepTarget decides which copy wins:
+// true keeps the target and discards the moved content; false replaces the
+// target and bumps its version past both so every device sees the change.
+// Returns true if anything was moved. The caller saves the manifest.
+func MoveEntry(repoPath string, mf *manifest.Manifest, from, to config.Entry, profile string, keepTarget bool) (bool, error) {
+	repoPath = expandHome(repoPath)
+	moved := false
+
+	variants := append([]string{""}, ListVariants(repoPath, from, profile)...)
+	for _, v := range variants {
+		srcRel := VariantRepoDir(from, profile, v)
+		dstRel := VariantRepoDir(to, profile, v)
+		srcKey := VariantKey(from, profile, v)
+		dstKey := VariantKey(to, profile, v)
+		if srcRel == dstRel && srcKey == dstKey {
+			continue
+		}
+		src := filepath.Join(repoPath, srcRel)
+		dst := filepath.Join(repoPath, dstRel)
+
+		_, srcErr := os.Lstat(src)
+		srcEv, hasKey := mf.Entries[srcKey]
+		if srcErr != nil && !hasKey {
+			continue // nothing stored here
+		}
+		_, dstErr := os.Lstat(dst)
+		dstEv, dstHasKey := mf.Entries[dstKey]
+		targetExists := dstErr == nil || dstHasKey
+
+		if targetExists && keepTarget {
+			if err := os.RemoveAll(src); err != nil {
+				return moved, err
+			}
+			delete(mf.Entries, srcKey)
+			removeEmptyParents(filepath.Dir(src), topDir(repoPath, srcRel))
+			moved = true
+			continue
+		}
+
+		if srcErr == nil {
+			if err := os.RemoveAll(dst); err != nil {
+				return moved, err
+			}
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return moved, err
+			}
+			if err := os.Rename(src, dst); err != nil {
+				return moved, fmt.Errorf("moving %s to %s: %w", srcRel, dstRel, err)
+			}
+			removeEmptyParents(filepath.Dir(src), topDir(repoPath, srcRel))
+		}
+
+		if hasKey {
+			if targetExists {
+				srcEv.Version = max(srcEv.Version, dstEv.Version) + 1
+				srcEv.UpdatedAt = time.Now()
+				if host, err := os.Hostname(); err == nil {
+					srcEv.UpdatedBy = host
+				}
+			}
+			mf.Entries[dstKey] = srcEv
+			delete(mf.Entries, srcKey)
+		}
+		moved = true
+	}
+	return moved, nil
+}
+
+// topDir returns the absolute path of the first component of rel.
+func topDir(repoPath, rel string) string {
+	return filepath.Join(repoPath, strings.SplitN(rel, string(filepath.Separator), 2)[0])
+}
+
+// RelocateTargetExists reports whether the repo already holds content at
+// to's path in shared/ or any profile.
+func RelocateTargetExists(repoPath string, from, to config.Entry) bool {
+	for _, loc := range entryLocations(repoPath) {
+		f, t := from, to
+		f.ProfileSpecific, t.ProfileSpecific = loc != "", loc != ""
+		if MoveTargetExists(repoPath, f, t, loc) {
+			return true
+		}
+	}
+	return false
+}
+
+// RelocateEntry moves every stored copy of an entry — shared/, each
+// profiles/<p>/ and their variants — from from.Path to to.Path, and records
+// the move in the manifest so other devices follow it. keepTarget works as
+// for MoveEntry. The caller saves the manifest.
+func RelocateEntry(repoPath string, mf *manifest.Manifest, from, to config.Entry, keepTarget bool) (bool, error) {
+	moved := false
+	for _, loc := range entryLocations(repoPath) {
+		f, t := from, to
+		f.ProfileSpecific, t.ProfileSpecific = loc != "", loc != ""
+		ok, err := MoveEntry(repoPath, mf, f, t, loc, keepTarget)
+		if err != nil {
+			return moved, err
+		}
+		moved = moved || ok
+	}
+	if from.Path != to.Path {
+		mf.RecordMove(from.Path, to.Path, to.Name, to.Description)
+	}
+	return moved, nil
+}
+
+// entryLocations returns "" for shared/ followed by every profile that has
+// a directory in the repo.
+func entryLocations(repoPath string) []string {
+	locs := []string{""}
+	dirs, err := os.ReadDir(filepath.Join(expandHome(repoPath), "profiles"))
+	if err != nil {
+		return locs
+	}
+	for _, d := range dirs {
+		if d.IsDir() {
+			locs = append(locs, d.Name())
+		}
+	}
+	return locs
+}
+
+// FollowMoves renames local entries that another device moved, taking the
+// new name and description from the move record. If the new path is already
+// tracked, the old entry is dropped. An entry whose new path is missing
+// locally is marked unsynced so Restore offers it. Returns the renamed
+// paths, old → new; the caller saves the config.
+func FollowMoves(cfg *config.Config, mf *manifest.Manifest) map[string]string {
+	renamed := make(map[string]string)
+	for i := 0; i < len(cfg.Entries); i++ {
+		e := &cfg.Entries[i]
+		mv, ok := mf.Moves[e.Path]
+		if !ok || mv.Path == e.Path {
+			continue
+		}
+		renamed[e.Path] = mv.Path
+
+		if tracked(cfg.Entries, mv.Path) {
+			cfg.Entries = append(cfg.Entries[:i], cfg.Entries[i+1:]...)
+			i--
+			continue
+		}
+		e.Path = mv.Path
+		if mv.Name != "" {
+			e.Name = mv.Name
+		}
+		e.Description = mv.Description
+		if _, err := os.Lstat(expandHome(e.Path)); err != nil {
+			e.LocalVersion = 0
+			e.LastHash = ""
+		}
+	}
+	return renamed
+}
+
+func tracked(entries []config.Entry, path string) bool {
+	for _, e := range entries {
+		if e.Path == path {
+			return true
+		}
+	}
+	return false
+}
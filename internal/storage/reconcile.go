@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+// Reconciled reports what Reconcile changed in the config.
+type Reconciled struct {
+	Moved     map[string]string // renamed entries, old → new path
+	Untracked []config.Entry    // entries another device retired
+	Contests  []Contest         // entries this device and another backed up at the same time
+	Hooks     []config.Entry    // entries with hooks from another device awaiting confirmation
+	Changed   bool              // the config needs saving
+}
+
+// Reconcile brings the local entry list up to date with the repo after a
+// sync: it follows renames, untracks retired entries, applies definitions
+// edited on other devices (holding back their hooks until accepted),
+// resolves host/OS variants and rechecks entries backed up concurrently
+// with another device. The caller saves the config when Changed is set.
+func Reconcile(cfg *config.Config, mf *manifest.Manifest) Reconciled {
+	r := Reconciled{
+		Moved:     FollowMoves(cfg, mf),
+		Untracked: UntrackRetired(cfg, mf),
+	}
+	r.Changed = len(r.Moved) > 0 || len(r.Untracked) > 0
+	for i := range cfg.Entries {
+		if mf.ApplyMeta(&cfg.Entries[i]) {
+			r.Changed = true
+			if cfg.Entries[i].PendingHooks != nil {
+				r.Hooks = append(r.Hooks, cfg.Entries[i])
+			}
+		}
+	}
+	if ResolveVariants(cfg) {
+		r.Changed = true
+	}
+	if r.Contests = Recheck(cfg, mf); len(r.Contests) > 0 {
+		r.Changed = true
+	}
+	return r
+}
+
+// Contest is an entry this device backed up while another device backed up
+// different content for it. The manifest merge kept one of the two copies.
+type Contest struct {
+	Entry    config.Entry
+	Kept     bool   // this device's copy is the one in the repo
+	Conflict string // the manifest's note, e.g. "v3 by desk replaced v3 by laptop"
+}
+
+// Recheck finds entries whose latest backup on this device took part in a
+// manifest merge with another device's concurrent backup. If this device's
+// copy was kept, the entry takes the bumped version. If it lost, LastHash is
+// cleared so Restore reports a conflict instead of silently replacing the
+// local file with the other copy. The caller saves the config.
+func Recheck(cfg *config.Config, mf *manifest.Manifest) []Contest {
+	var contests []Contest
+	for i := range cfg.Entries {
+		e := &cfg.Entries[i]
+		ev := mf.GetEntry(ManifestKey(*e, cfg.DeviceProfile))
+		if ev.Conflict == "" || e.LastHash == "" || e.LocalVersion >= ev.Version {
+			continue
+		}
+		var c Contest
+		switch e.LastHash {
+		case ev.ContentHash:
+			c.Kept = true
+			e.LocalVersion = ev.Version
+		case ev.LostHash:
+			e.LastHash = ""
+		default:
+			continue // not one of the two copies
+		}
+		c.Entry, c.Conflict = *e, ev.Conflict
+		contests = append(contests, c)
+	}
+	return contests
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+// RetireEntry removes every stored copy of an entry — shared/, each
+// profiles/<p>/ and their variants — with their manifest keys, and leaves a
+// tombstone so other devices untrack it. The caller saves the manifest.
+func RetireEntry(repoPath string, mf *manifest.Manifest, entry config.Entry) error {
+	repoPath = expandHome(repoPath)
+	version := 0
+	for _, loc := range entryLocations(repoPath) {
+		e := entry
+		e.ProfileSpecific = loc != ""
+		for _, v := range append([]string{""}, ListVariants(repoPath, e, loc)...) {
+			rel := VariantRepoDir(e, loc, v)
+			key := VariantKey(e, loc, v)
+			version = max(version, mf.GetVersion(key))
+			if err := os.RemoveAll(filepath.Join(repoPath, rel)); err != nil {
+				return err
+			}
+			removeEmptyParents(filepath.Dir(filepath.Join(repoPath, rel)), topDir(repoPath, rel))
+			delete(mf.Entries, key)
+		}
+	}
+	mf.Retire(entry.Path, version)
+	return nil
+}
+
+// UntrackRetired removes local entries that another device retired. Only
+// entries this device has synced before are removed, so an entry that was
+// added again here is backed up and revives the path instead. Local files
+// are not touched. Returns the removed entries; the caller saves the config.
+func UntrackRetired(cfg *config.Config, mf *manifest.Manifest) []config.Entry {
+	var removed []config.Entry
+	kept := cfg.Entries[:0]
+	for _, e := range cfg.Entries {
+		if _, ok := mf.Removed[e.Path]; ok && e.LocalVersion > 0 {
+			removed = append(removed, e)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	cfg.Entries = kept
+	return removed
+}
+
+// Orphans lists repo content and manifest keys that don't match each other.
+type Orphans struct {
+	Paths []string // repo-relative paths under shared/, profiles/ or variants/ with no manifest key
+	Keys  []string // manifest keys with no content in the repo
+}
+
+// Empty reports whether there is nothing to prune.
+func (o Orphans) Empty() bool {
+	return len(o.Paths) == 0 && len(o.Keys) == 0
+}
+
+// FindOrphans compares the repo content with the manifest. A directory with
+// no manifest key inside it is reported once rather than file by file.
+func FindOrphans(repoPath string, mf *manifest.Manifest) Orphans {
+	repoPath = expandHome(repoPath)
+	var o Orphans
+
+	owned := make(map[string]bool)     // repo dirs of manifest keys
+	ancestors := make(map[string]bool) // their parent dirs
+	for key := range mf.Entries {
+		rel, ok := KeyDir(key)
+		if !ok {
+			continue // legacy key, left to MigrateLegacyLayout
+		}
+		owned[rel] = true
+		for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+			ancestors[dir] = true
+		}
+		if _, err := os.Lstat(filepath.Join(repoPath, rel)); err != nil {
+			o.Keys = append(o.Keys, key)
+		}
+	}
+
+	var visit func(rel string)
+	visit = func(rel string) {
+		if owned[rel] {
+			return
+		}
+		if !ancestors[rel] {
+			o.Paths = append(o.Paths, rel)
+			return
+		}
+		children, err := os.ReadDir(filepath.Join(repoPath, rel))
+		if err != nil {
+			return
+		}
+		for _, c := range children {
+			visit(filepath.Join(rel, c.Name()))
+		}
+	}
+	for _, top := range []string{"shared", "profiles", "variants"} {
+		if _, err := os.Lstat(filepath.Join(repoPath, top)); err == nil {
+			visit(top)
+		}
+	}
+
+	sort.Strings(o.Paths)
+	sort.Strings(o.Keys)
+	return o
+}
+
+// RemoveOrphans deletes orphaned repo paths and manifest keys. The caller
+// saves the manifest.
+func RemoveOrphans(repoPath string, mf *manifest.Manifest, o Orphans) error {
+	repoPath = expandHome(repoPath)
+	for _, rel := range o.Paths {
+		abs := filepath.Join(repoPath, rel)
+		if err := os.RemoveAll(abs); err != nil {
+			return err
+		}
+		removeEmptyParents(filepath.Dir(abs), topDir(repoPath, rel))
+	}
+	for _, key := range o.Keys {
+		delete(mf.Entries, key)
+	}
+	return nil
+}
+
+// KeyDir returns the repo-relative directory of a manifest key. Returns
+// false for keys outside shared/, profiles/ and variants/, and for keys
+// whose directory would resolve outside them.
+func KeyDir(key string) (string, bool) {
+	e, profile, ok := ParseKey(key)
+	if !ok {
+		return "", false
+	}
+	return RepoDir(e, profile), true
+}
+
+// ParseKey is the inverse of ManifestKey and VariantKey: it returns the
+// entry a key stores, with its path, ProfileSpecific and Variant set, and
+// the profile it is stored under. Returns false for keys outside shared/,
+// profiles/ and variants/, for keys such as "shared/~/../x" or
+// "shared//etc/passwd" whose directory would resolve outside them, and for
+// paths that are neither ~/... nor absolute: keys come from manifests and
+// bundles other machines wrote.
+func ParseKey(key string) (config.Entry, string, bool) {
+	var variant string
+	if rest, ok := strings.CutPrefix(key, "variants/"); ok {
+		v, base, found := strings.Cut(rest, "/")
+		if !found || v == "" {
+			return config.Entry{}, "", false
+		}
+		variant, key = v, base
+	}
+
+	e := config.Entry{Variant: variant}
+	var profile string
+	switch {
+	case strings.HasPrefix(key, "shared/"):
+		e.Path = strings.TrimPrefix(key, "shared/")
+	case strings.HasPrefix(key, "profiles/"):
+		p, path, found := strings.Cut(strings.TrimPrefix(key, "profiles/"), "/")
+		if !found {
+			return config.Entry{}, "", false
+		}
+		profile, e.Path, e.ProfileSpecific = p, path, true
+	default:
+		return config.Entry{}, "", false
+	}
+	if !isName(variant, e.Variant != "") || !isName(profile, e.ProfileSpecific) {
+		return config.Entry{}, "", false
+	}
+	if !strings.HasPrefix(e.Path, "~/") && !filepath.IsAbs(e.Path) {
+		return config.Entry{}, "", false // entry paths are ~/... or absolute
+	}
+	if rel := homeRelative(e.Path); rel == "." || !filepath.IsLocal(rel) {
+		return config.Entry{}, "", false
+	}
+	return e, profile, true
+}
+
+// isName reports whether s is a single path component, as variant and
+// profile names in a key must be; an empty s is fine unless required.
+func isName(s string, required bool) bool {
+	if s == "" {
+		return !required
+	}
+	return filepath.IsLocal(s) && s != "." && !strings.ContainsAny(s, `/\`)
+}
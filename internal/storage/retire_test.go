@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+func TestParseKey(t *testing.T) {
+	for _, tc := range []struct {
+		key     string
+		entry   config.Entry
+		profile string
+		ok      bool
+	}{
+		{"shared/~/.zshrc", config.Entry{Path: "~/.zshrc"}, "", true},
+		{"shared/~/.config/nvim", config.Entry{Path: "~/.config/nvim"}, "", true},
+		{"profiles/work/~/.gitconfig", config.Entry{Path: "~/.gitconfig", ProfileSpecific: true}, "work", true},
+		{"variants/linux/shared/~/.config/i3", config.Entry{Path: "~/.config/i3", Variant: "linux"}, "", true},
+		{"variants/laptop/profiles/work/~/.ssh/config", config.Entry{Path: "~/.ssh/config", ProfileSpecific: true, Variant: "laptop"}, "work", true},
+
+		// Keys come from other machines' manifests and bundles: nothing may
+		// resolve outside the repo layout.
+		{"shared/~/../../etc/passwd", config.Entry{}, "", false},
+		{"shared//etc/passwd", config.Entry{}, "", false},
+		{"shared/~", config.Entry{}, "", false},
+		{"shared/~/", config.Entry{}, "", false},
+		{"shared/", config.Entry{}, "", false},
+		{"profiles/work", config.Entry{}, "", false},
+		{"profiles/../~/.zshrc", config.Entry{}, "", false},
+		{"profiles//~/.zshrc", config.Entry{}, "", false},
+		{"variants/linux", config.Entry{}, "", false},
+		{"variants/../shared/~/.zshrc", config.Entry{}, "", false},
+		{"variants//shared/~/.zshrc", config.Entry{}, "", false},
+		{"variants/linux/variants/mac/shared/~/.zshrc", config.Entry{}, "", false},
+		{"~/.zshrc", config.Entry{}, "", false},
+		{"other/~/.zshrc", config.Entry{}, "", false},
+	} {
+		t.Run(tc.key, func(t *testing.T) {
+			e, profile, ok := ParseKey(tc.key)
+			if ok != tc.ok {
+				t.Fatalf("ok = %t, want %t (entry %+v)", ok, tc.ok, e)
+			}
+			if !ok {
+				return
+			}
+			if e.Path != tc.entry.Path || e.ProfileSpecific != tc.entry.ProfileSpecific || e.Variant != tc.entry.Variant || profile != tc.profile {
+				t.Errorf("got %+v in profile %q, want %+v in %q", e, profile, tc.entry, tc.profile)
+			}
+			if back := VariantKey(e, profile, e.Variant); back != tc.key {
+				t.Errorf("key round-trips to %q", back)
+			}
+		})
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	repo := t.TempDir()
+	for _, p := range []string{
+		"shared/.zshrc",
+		"shared/.config/nvim/init.lua",
+		"shared/.config/old/x.conf", // no key: reported as one directory
+		"shared/.bashrc",            // no key
+		"profiles/work/.gitconfig",
+		"profiles/home/.gitconfig", // no key, nor any under profiles/home
+		"variants/linux/shared/.config/i3/config",
+	} {
+		path := filepath.Join(repo, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mf := &manifest.Manifest{Entries: map[string]manifest.EntryVersion{
+		"shared/~/.zshrc":                    {Version: 1},
+		"shared/~/.config/nvim":              {Version: 1},
+		"profiles/work/~/.gitconfig":         {Version: 1},
+		"variants/linux/shared/~/.config/i3": {Version: 1},
+		"shared/~/.vimrc":                    {Version: 2}, // content missing
+		"profiles/work/~/.ssh":               {Version: 1}, // content missing
+		"shared/~/../escape":                 {Version: 1}, // not a valid key
+	}}
+
+	o := FindOrphans(repo, mf)
+	wantPaths := []string{
+		filepath.FromSlash("profiles/home"),
+		filepath.FromSlash("shared/.bashrc"),
+		filepath.FromSlash("shared/.config/old"),
+	}
+	if !slices.Equal(o.Paths, wantPaths) {
+		t.Errorf("Paths = %v, want %v", o.Paths, wantPaths)
+	}
+	if wantKeys := []string{"profiles/work/~/.ssh", "shared/~/.vimrc"}; !slices.Equal(o.Keys, wantKeys) {
+		t.Errorf("Keys = %v, want %v", o.Keys, wantKeys)
+	}
+
+	if err := RemoveOrphans(repo, mf, o); err != nil {
+		t.Fatal(err)
+	}
+	if again := FindOrphans(repo, mf); !again.Empty() {
+		t.Errorf("orphans left after RemoveOrphans: %+v", again)
+	}
+	for _, p := range []string{"shared/.zshrc", "shared/.config/nvim/init.lua", "profiles/work/.gitconfig", "variants/linux/shared/.config/i3/config"} {
+		if _, err := os.Stat(filepath.Join(repo, filepath.FromSlash(p))); err != nil {
+			t.Errorf("owned content removed: %v", err)
+		}
+	}
+}
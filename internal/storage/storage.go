@@ -3,6 +3,7 @@ package storage
 import (
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/solarisjon/dfc/internal/config"
@@ -17,9 +18,12 @@ type RepoEntry struct {
 }
 
 // ListRepoEntries reads the manifest and returns all entries stored in the repo.
-// Entries already tracked in existing are excluded.
-// For profile-specific entries, only those matching currentProfile are returned (all if empty).
-func ListRepoEntries(repoPath, currentProfile string, existing []config.Entry) ([]RepoEntry, error) {
+// Entries already tracked in existing are excluded. An entry stored only as
+// host/OS variants is returned once, by its base path.
+// For profile-specific entries, only those in currentProfile or a layer it
+// inherits from are returned (all if empty), the most specific layer first.
+// Tagged entries are only returned when config.TagsMatch(tags, deviceTags).
+func ListRepoEntries(repoPath, currentProfile string, deviceTags []string, existing []config.Entry) ([]RepoEntry, error) {
 	repoPath = expandHome(repoPath)
 	m, err := manifest.Load(repoPath)
 	if err != nil {
@@ -31,11 +35,39 @@ func ListRepoEntries(repoPath, currentProfile string, existing []config.Entry) (
 		existingPaths[e.Path] = true
 	}
 
+	// Visit keys in layer order so an entry stored in several layers is
+	// reported once, from the most specific one.
+	var layers []string
+	if currentProfile != "" {
+		if p, err := LoadProfiles(repoPath); err == nil {
+			layers = p.Layers(currentProfile)
+		} else {
+			layers = []string{strings.ToLower(currentProfile)}
+		}
+	}
+	keys := make([]string, 0, len(m.Entries))
+	for key := range m.Entries {
+		keys = append(keys, key)
+	}
+	// Variants come after the default copies they stand in for.
+	rank := func(key string) int {
+		if rest, ok := strings.CutPrefix(key, "variants/"); ok {
+			_, base, _ := strings.Cut(rest, "/")
+			return 2*layerRank(base, layers) + 1
+		}
+		return 2 * layerRank(key, layers)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return rank(keys[i]) < rank(keys[j])
+	})
+
 	var result []RepoEntry
-	for key, ev := range m.Entries {
+	for _, key := range keys {
+		ev := m.Entries[key]
 		var entryPath string
 		var profileSpecific bool
 		var profileName string
+		var variantDir string
 
 		if strings.HasPrefix(key, "shared/") {
 			rest := strings.TrimPrefix(key, "shared/")
@@ -51,7 +83,7 @@ func ListRepoEntries(repoPath, currentProfile string, existing []config.Entry) (
 			}
 			profileName = without[:slash]
 			rest := without[slash+1:]
-			if currentProfile != "" && !strings.EqualFold(profileName, currentProfile) {
+			if currentProfile != "" && layerRank(key, layers) == len(layers) {
 				continue
 			}
 			if !strings.HasPrefix(rest, "~/") {
@@ -59,13 +91,21 @@ func ListRepoEntries(repoPath, currentProfile string, existing []config.Entry) (
 			}
 			entryPath = rest
 			profileSpecific = true
+		} else if e, profile, ok := ParseKey(key); ok && e.Variant != "" {
+			// Offered by its base path; the variant in effect is resolved
+			// once the entry is tracked.
+			if profile != "" && currentProfile != "" && layerRank(LayerKey(e, profile), layers) == len(layers) {
+				continue
+			}
+			entryPath, profileSpecific, profileName, variantDir = e.Path, e.ProfileSpecific, profile, RepoDir(e, profile)
 		} else {
 			continue
 		}
 
-		if existingPaths[entryPath] {
+		if existingPaths[entryPath] || !config.TagsMatch(ev.Tags, deviceTags) {
 			continue
 		}
+		existingPaths[entryPath] = true // skip the same entry in less specific layers and variants
 
 		// Stat the actual repo path to determine if it's a directory
 		cleanPath := entryPath
@@ -78,41 +118,73 @@ func ListRepoEntries(repoPath, currentProfile string, existing []config.Entry) (
 		} else {
 			repoRelPath = filepath.Join("shared", cleanPath)
 		}
+		if variantDir != "" {
+			repoRelPath = variantDir
+		}
 		fullPath := filepath.Join(repoPath, repoRelPath)
 		info, statErr := os.Stat(fullPath)
+		if statErr != nil && profileSpecific {
+			// Only a parent layer may hold the content so far
+			e := config.Entry{Path: entryPath}
+			if found := ExistingLayers(repoPath, e, layers); len(found) > 0 {
+				info, statErr = os.Stat(filepath.Join(repoPath, LayerDir(e, found[0])))
+			}
+		}
 		isDir := statErr == nil && info.IsDir()
 
-		result = append(result, RepoEntry{
-			Entry: config.Entry{
-				Path:            entryPath,
-				Name:            entry.FriendlyName(entryPath),
-				IsDir:           isDir,
-				ProfileSpecific: profileSpecific,
-			},
-			Version: ev.Version,
-		})
+		e := config.Entry{
+			Path:            entryPath,
+			Name:            entry.FriendlyName(entryPath),
+			IsDir:           isDir,
+			ProfileSpecific: profileSpecific,
+			Tags:            ev.Tags,
+		}
+		// Entries backed up since definitions were recorded come back exactly.
+		m.ApplyMeta(&e)
+		result = append(result, RepoEntry{Entry: e, Version: ev.Version})
 	}
 	return result, nil
 }
 
+// layerRank orders manifest keys by layer: profile keys by their position in
+// layers, then anything else (shared keys and other profiles).
+func layerRank(key string, layers []string) int {
+	for i, l := range layers {
+		if strings.HasPrefix(key, "profiles/"+l+"/") {
+			return i
+		}
+	}
+	return len(layers)
+}
+
 // RepoDir computes the destination directory inside the repo for an entry.
 // Shared entries:  repo/shared/<homeRelPath>
 // Profile entries: repo/profiles/<profile>/<homeRelPath>
+// Either is prefixed with variants/<variant>/ when a variant is in effect.
 func RepoDir(entry config.Entry, profile string) string {
 	rel := homeRelative(entry.Path)
+	dir := filepath.Join("shared", rel)
 	if entry.ProfileSpecific && profile != "" {
-		return filepath.Join("profiles", strings.ToLower(profile), rel)
+		dir = filepath.Join("profiles", strings.ToLower(profile), rel)
 	}
-	return filepath.Join("shared", rel)
+	if entry.Variant != "" {
+		return filepath.Join("variants", entry.Variant, dir)
+	}
+	return dir
 }
 
 // ManifestKey returns the manifest map key for an entry.
-// Format: "shared/<path>" or "profiles/<profile>/<path>"
+// Format: "shared/<path>" or "profiles/<profile>/<path>", prefixed with
+// "variants/<variant>/" when a variant is in effect.
 func ManifestKey(entry config.Entry, profile string) string {
+	key := "shared/" + entry.Path
 	if entry.ProfileSpecific && profile != "" {
-		return "profiles/" + strings.ToLower(profile) + "/" + entry.Path
+		key = "profiles/" + strings.ToLower(profile) + "/" + entry.Path
+	}
+	if entry.Variant != "" {
+		return "variants/" + entry.Variant + "/" + key
 	}
-	return "shared/" + entry.Path
+	return key
 }
 
 // LegacyRepoDir returns the old-style repo path (directly under repo root).
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+// testRepo writes a manifest with keys and creates each key's directory
+// (dirs) or file (the rest) in a new repo.
+func testRepo(t *testing.T, keys map[string]manifest.EntryVersion, dirs ...string) string {
+	t.Helper()
+	repo := t.TempDir()
+	isDir := make(map[string]bool)
+	for _, k := range dirs {
+		isDir[k] = true
+	}
+	for key := range keys {
+		rel, ok := KeyDir(key)
+		if !ok {
+			continue
+		}
+		path := filepath.Join(repo, rel)
+		if isDir[key] {
+			path = filepath.Join(path, "config")
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(key), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := (&manifest.Manifest{Entries: keys}).Save(repo); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestListRepoEntriesOffersVariantOnlyEntries(t *testing.T) {
+	repo := testRepo(t, map[string]manifest.EntryVersion{
+		"shared/~/.zshrc":                          {Version: 3},
+		"variants/linux/shared/~/.config/i3":       {Version: 2},
+		"variants/darwin/shared/~/.config/i3":      {Version: 1},
+		"variants/linux/shared/~/.zshrc":           {Version: 1},
+		"variants/laptop/profiles/work/~/.ssh":     {Version: 4},
+		"variants/laptop/profiles/home/~/.netrc":   {Version: 1},
+		"variants/linux/shared/~/.config/hyprland": {Version: 1, Tags: []string{"wayland"}},
+	}, "variants/linux/shared/~/.config/i3", "variants/darwin/shared/~/.config/i3", "variants/laptop/profiles/work/~/.ssh")
+
+	got, err := ListRepoEntries(repo, "work", []string{"work", "linux"}, []config.Entry{{Path: "~/.tracked"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath := make(map[string]RepoEntry)
+	for _, re := range got {
+		if _, dup := byPath[re.Entry.Path]; dup {
+			t.Errorf("%s offered twice", re.Entry.Path)
+		}
+		byPath[re.Entry.Path] = re
+	}
+
+	for _, tc := range []struct {
+		path           string
+		isDir, profile bool
+		version        int
+	}{
+		{"~/.zshrc", false, false, 3}, // the default copy, not its variant
+		{"~/.config/i3", true, false, 0},
+		{"~/.ssh", true, true, 4},
+	} {
+		re, ok := byPath[tc.path]
+		if !ok {
+			t.Errorf("%s not offered", tc.path)
+			continue
+		}
+		if re.Entry.IsDir != tc.isDir || re.Entry.ProfileSpecific != tc.profile || re.Entry.Variant != "" {
+			t.Errorf("%s offered as %+v", tc.path, re.Entry)
+		}
+		if tc.version > 0 && re.Version != tc.version {
+			t.Errorf("%s offered at v%d, want v%d", tc.path, re.Version, tc.version)
+		}
+	}
+	for _, path := range []string{"~/.netrc", "~/.config/hyprland"} {
+		if _, ok := byPath[path]; ok {
+			t.Errorf("%s offered, but belongs to another profile or its tags don't match", path)
+		}
+	}
+}
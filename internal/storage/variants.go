@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+// Variants are alternative copies of an entry for particular machines,
+// stored beside the default copy:
+//
+//	variants/host-<hostname>/<repo dir>   one machine
+//	variants/os-<goos>-<goarch>/<repo dir> one OS and architecture
+//	variants/os-<goos>/<repo dir>          one OS
+//
+// where <repo dir> is the entry's usual shared/ or profiles/<p>/ path.
+// A device uses the most specific variant that exists, else the default.
+
+// DeviceVariants returns the variants that apply to this machine, most
+// specific first.
+func DeviceVariants() []string {
+	var variants []string
+	if host, err := os.Hostname(); err == nil && host != "" {
+		variants = append(variants, "host-"+sanitizeVariant(host))
+	}
+	return append(variants,
+		"os-"+runtime.GOOS+"-"+runtime.GOARCH,
+		"os-"+runtime.GOOS,
+	)
+}
+
+func sanitizeVariant(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, strings.ToLower(s))
+}
+
+// VariantRepoDir returns the repo-relative directory of one variant of an
+// entry. An empty variant is the default copy.
+func VariantRepoDir(entry config.Entry, profile, variant string) string {
+	entry.Variant = variant
+	return RepoDir(entry, profile)
+}
+
+// VariantKey returns the manifest key of one variant of an entry.
+func VariantKey(entry config.Entry, profile, variant string) string {
+	entry.Variant = variant
+	return ManifestKey(entry, profile)
+}
+
+// ListVariants returns the variants of an entry that exist in the repo,
+// in directory order.
+func ListVariants(repoPath string, entry config.Entry, profile string) []string {
+	repoPath = expandHome(repoPath)
+	dirs, err := os.ReadDir(filepath.Join(repoPath, "variants"))
+	if err != nil {
+		return nil
+	}
+	var found []string
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(repoPath, VariantRepoDir(entry, profile, d.Name()))); err == nil {
+			found = append(found, d.Name())
+		}
+	}
+	return found
+}
+
+// ResolveVariant returns the most specific variant of entry for this machine
+// that exists in the repo, or "" to use the default copy.
+func ResolveVariant(repoPath string, entry config.Entry, profile string) string {
+	repoPath = expandHome(repoPath)
+	for _, v := range DeviceVariants() {
+		if _, err := os.Lstat(filepath.Join(repoPath, VariantRepoDir(entry, profile, v))); err == nil {
+			return v
+		}
+	}
+	return ""
+}
+
+// ResolveVariants updates the variant in effect for every entry from the
+// repo's current contents. Call it after syncing the repo. Returns true if
+// any entry changed; the caller saves the config.
+func ResolveVariants(cfg *config.Config) bool {
+	changed := false
+	for i := range cfg.Entries {
+		v := ResolveVariant(cfg.RepoPath, cfg.Entries[i], cfg.DeviceProfile)
+		if v != cfg.Entries[i].Variant {
+			cfg.Entries[i].Variant = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// PromoteVariant makes a variant the entry's default copy: the variant's
+// content replaces the default in the repo and the default's version is
+// bumped. The variant is removed. The caller saves the manifest.
+func PromoteVariant(repoPath string, mf *manifest.Manifest, entry config.Entry, profile, variant string) error {
+	repoPath = expandHome(repoPath)
+	src := filepath.Join(repoPath, VariantRepoDir(entry, profile, variant))
+	dst := filepath.Join(repoPath, VariantRepoDir(entry, profile, ""))
+	if _, err := os.Lstat(src); err != nil {
+		return fmt.Errorf("variant %s not found: %w", variant, err)
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("promoting variant: %w", err)
+	}
+	removeEmptyParents(filepath.Dir(src), filepath.Join(repoPath, "variants"))
+
+	vkey := VariantKey(entry, profile, variant)
+	dkey := VariantKey(entry, profile, "")
+	ev := mf.GetEntry(vkey)
+	// Keep the default's version moving forward so devices see an update.
+	def := mf.GetEntry(dkey)
+	if def.Version < ev.Version {
+		def.Version = ev.Version
+		mf.Entries[dkey] = def
+	}
+	mf.BumpVersion(dkey, ev.ContentHash)
+	delete(mf.Entries, vkey)
+	return nil
+}
+
+// DeleteVariant removes a variant of an entry from the repo and manifest.
+// The caller saves the manifest.
+func DeleteVariant(repoPath string, mf *manifest.Manifest, entry config.Entry, profile, variant string) error {
+	repoPath = expandHome(repoPath)
+	dir := filepath.Join(repoPath, VariantRepoDir(entry, profile, variant))
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	removeEmptyParents(filepath.Dir(dir), filepath.Join(repoPath, "variants"))
+	delete(mf.Entries, VariantKey(entry, profile, variant))
+	return nil
+}
+
+// removeEmptyParents removes empty directories from dir up to and
+// including stop.
+func removeEmptyParents(dir, stop string) {
+	for strings.HasPrefix(dir, stop) {
+		if err := os.Remove(dir); err != nil {
+			return // not empty
+		}
+		if dir == stop {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Git backends, selected with config.GitBackend.
+const (
+	BackendAuto    = ""        // the git binary if installed, else builtin
+	BackendExec    = "git"     // run the git binary
+	BackendBuiltin = "builtin" // in-process git (go-git); works without git installed
+)
+
+// gitBackend is the git plumbing the sync functions are built on. Paths are
+// expanded; "upstream" is the current branch's remote tracking branch.
+type gitBackend interface {
+	clone(url, dest string) error // an empty remote leaves a clone without commits
+	initRepo(dir string) error
+	initBare(dir string) error
+	lsRemote(url string) error
+	remoteURL(dir string) string // "" without an origin remote
+	setRemoteURL(dir, url string) error
+	hasHead(dir string) bool
+	hasUpstream(dir string) bool
+	changed(dir string, paths ...string) (bool, error) // uncommitted changes, optionally limited to paths
+	commitAll(dir, message string) (bool, error)       // stage everything and commit; false if nothing to commit
+	pushUpstream(dir string) error                     // push a new clone's first commit as main, tracking it
+	push(dir string, force bool) error
+	fetch(dir string) error
+	aheadBehind(dir string) (ahead, behind int, err error)
+	fastForward(dir string) error
+	rebase(dir string, ahead int) error // replay local commits onto the upstream (see integrate)
+	resetHard(dir string) error         // to the upstream
+	show(dir, rev, path string) ([]byte, error)
+	checkoutHead(dir, path string) error
+	upstreamTime(dir string) (time.Time, error)
+	localWork(dir string) (unpushed, stashes, dirty int, err error)
+	identity() GitIdentity
+	setIdentity(name, email string) error
+}
+
+var backend gitBackend = execGit{}
+
+// SetBackend selects how dfc runs git: BackendExec, BackendBuiltin, or
+// BackendAuto to use the git binary when it is installed.
+func SetBackend(name string) error {
+	switch name {
+	case BackendAuto:
+		if _, err := exec.LookPath("git"); err != nil {
+			backend = goGit{}
+		} else {
+			backend = execGit{}
+		}
+	case BackendExec:
+		backend = execGit{}
+	case BackendBuiltin:
+		backend = goGit{}
+	default:
+		return fmt.Errorf("unknown git backend %q (want %q or %q)", name, BackendExec, BackendBuiltin)
+	}
+	return nil
+}
+
+// GitError is a failed git operation. Output is what the git binary
+// printed; the built-in backend leaves it empty and wraps go-git's error,
+// e.g. transport.ErrAuthenticationRequired, for errors.Is.
+type GitError struct {
+	Op     string // git subcommand, e.g. "push"
+	Output string
+	Err    error
+}
+
+func (e *GitError) Error() string {
+	if e.Output != "" {
+		return fmt.Sprintf("git %s: %s: %v", e.Op, e.Output, e.Err)
+	}
+	return fmt.Sprintf("git %s: %v", e.Op, e.Err)
+}
+
+func (e *GitError) Unwrap() error { return e.Err }
@@ -0,0 +1,512 @@
+package sync
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dedupPrefix marks a repo URL as a deduplicating store in a directory,
+// e.g. dedup:/mnt/nas/dotfiles.
+const dedupPrefix = "dedup:"
+
+// dedupFormat is the format: of a deduplicating store's .dfc-store.yaml.
+const dedupFormat = "dedup"
+
+// chunksDir holds a deduplicating store's content, one gzipped chunk per
+// file, named by the SHA-256 of the uncompressed chunk.
+const chunksDir = ".dfc-chunks"
+
+// IsDedupStore reports whether url names a deduplicating store.
+func IsDedupStore(url string) bool {
+	return strings.HasPrefix(strings.TrimSpace(url), dedupPrefix)
+}
+
+// DedupStorePath returns the absolute directory a dedup: URL names.
+func DedupStorePath(url string) string {
+	return cleanPath(strings.TrimPrefix(strings.TrimSpace(url), dedupPrefix))
+}
+
+// dedupStore keeps the repo layout content-addressed: files are split into
+// chunks stored once by hash however many profiles, variants and snapshots
+// hold them, and each sync writes a tree under .dfc-snapshots listing the
+// chunks of every file. The newest tree is the store's state, so writes
+// only become visible when snapshot writes it; chunks a failed sync left
+// behind are reclaimed by PruneStore.
+type dedupStore struct {
+	dir dirStore // the directory, its lock and its settings
+
+	tree map[string]dedupFile // the newest snapshot's files, loaded on first use
+}
+
+// dedupSnapshot is a tree under .dfc-snapshots.
+type dedupSnapshot struct {
+	Time    time.Time            `yaml:"time"`
+	Message string               `yaml:"message,omitempty"`
+	Files   map[string]dedupFile `yaml:"files"`
+}
+
+// dedupFile is a file in a tree: its chunks in order.
+type dedupFile struct {
+	Mode   string   `yaml:"mode"` // octal fs.FileMode
+	Size   int64    `yaml:"size"`
+	Chunks []string `yaml:"chunks"`
+}
+
+func (s *dedupStore) String() string { return s.dir.root }
+
+func (s *dedupStore) check() error {
+	if _, err := os.Stat(s.dir.root); err != nil {
+		return fmt.Errorf("%s not found — is the drive mounted?", s.dir.root)
+	}
+	if _, err := os.Stat(s.dir.path(storeConfigFile)); err != nil || s.dir.config().Format != dedupFormat {
+		return fmt.Errorf("%s is not a deduplicating dfc store", s.dir.root)
+	}
+	return nil
+}
+
+func (s *dedupStore) lock(owner string) (func(), error) {
+	return s.dir.lock(owner)
+}
+
+// snapshots returns the names of the trees, oldest first.
+func (s *dedupStore) snapshots() ([]string, error) {
+	entries, err := os.ReadDir(s.dir.path(snapshotsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".yaml"); ok && !e.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *dedupStore) loadSnapshot(name string) (*dedupSnapshot, error) {
+	data, err := os.ReadFile(s.dir.path(snapshotsDir + "/" + name + ".yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var snap dedupSnapshot
+	if err := yaml.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", name, err)
+	}
+	return &snap, nil
+}
+
+// load reads the newest tree, once the store is locked.
+func (s *dedupStore) load() error {
+	if s.tree != nil {
+		return nil
+	}
+	names, err := s.snapshots()
+	if err != nil {
+		return err
+	}
+	s.tree = make(map[string]dedupFile)
+	if len(names) == 0 {
+		return nil
+	}
+	snap, err := s.loadSnapshot(names[len(names)-1])
+	if err != nil {
+		s.tree = nil
+		return err
+	}
+	for p, f := range snap.Files {
+		s.tree[p] = f
+	}
+	return nil
+}
+
+func (s *dedupStore) list() ([]string, error) {
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(s.tree))
+	for p := range s.tree {
+		files = append(files, p)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (s *dedupStore) read(p string) ([]byte, fs.FileMode, error) {
+	if err := s.load(); err != nil {
+		return nil, 0, err
+	}
+	f, ok := s.tree[p]
+	if !ok {
+		return nil, 0, &fs.PathError{Op: "read", Path: p, Err: fs.ErrNotExist}
+	}
+	var data []byte
+	for _, id := range f.Chunks {
+		chunk, err := s.readChunk(id)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", p, err)
+		}
+		data = append(data, chunk...)
+	}
+	mode, err := strconv.ParseUint(f.Mode, 8, 32)
+	if err != nil {
+		mode = 0644
+	}
+	return data, fs.FileMode(mode), nil
+}
+
+func (s *dedupStore) write(p string, data []byte, mode fs.FileMode) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	var ids []string
+	for _, chunk := range splitChunks(data) {
+		id, err := s.putChunk(chunk)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+	}
+	s.tree[p] = dedupFile{Mode: strconv.FormatUint(uint64(mode), 8), Size: int64(len(data)), Chunks: ids}
+	return nil
+}
+
+func (s *dedupStore) remove(p string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	delete(s.tree, p)
+	return nil
+}
+
+// putManifest stages the manifest like any other file. The lock keeps other
+// devices out, so prev is only checked against the newest tree.
+func (s *dedupStore) putManifest(data, prev []byte) error {
+	current, _, err := s.read(manifestFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if !bytes.Equal(current, prev) {
+		return errStoreChanged
+	}
+	return s.write(manifestFile, data, 0644)
+}
+
+// snapshot writes the staged tree as the newest, then drops the trees the
+// retention policy doesn't keep. The newest is always kept, as it is the
+// store's state.
+func (s *dedupStore) snapshot(message string) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	names, err := s.snapshots()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	name := snapshotName(now)
+	if len(names) > 0 && names[len(names)-1] >= name {
+		name = names[len(names)-1] + "-1" // two syncs in a second, or a clock behind
+	}
+	data, err := yaml.Marshal(dedupSnapshot{Time: now, Message: message, Files: s.tree})
+	if err != nil {
+		return err
+	}
+	if err := s.dir.write(snapshotsDir+"/"+name+".yaml", data, 0644); err != nil {
+		return err
+	}
+
+	keep := s.dir.config().Snapshots
+	keep.KeepLast = max(keep.KeepLast, 1)
+	for _, old := range keep.expired(append(names, name)) {
+		if err := os.Remove(s.dir.path(snapshotsDir + "/" + old + ".yaml")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wipe removes the content and snapshots, keeping the store's settings.
+func (s *dedupStore) wipe() error {
+	s.tree = nil
+	return s.dir.wipe()
+}
+
+func chunkPath(id string) string {
+	return chunksDir + "/" + id[:2] + "/" + id
+}
+
+// putChunk stores a chunk unless the store has it, and returns its ID.
+func (s *dedupStore) putChunk(chunk []byte) (string, error) {
+	sum := sha256.Sum256(chunk)
+	id := hex.EncodeToString(sum[:])
+	if _, err := os.Stat(s.dir.path(chunkPath(id))); err == nil {
+		return id, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(chunk); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return id, s.dir.write(chunkPath(id), buf.Bytes(), 0644)
+}
+
+// readChunk returns a chunk's content, checking it against its ID.
+func (s *dedupStore) readChunk(id string) ([]byte, error) {
+	if len(id) != sha256.Size*2 {
+		return nil, fmt.Errorf("bad chunk ID %q", id)
+	}
+	f, err := os.Open(s.dir.path(chunkPath(id)))
+	if err != nil {
+		return nil, fmt.Errorf("chunk %.12s: %w", id, err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %.12s: %w", id, err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %.12s: %w", id, err)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != id {
+		return nil, fmt.Errorf("chunk %.12s is corrupt", id)
+	}
+	return data, nil
+}
+
+// chunkIDs returns the IDs of the chunks in the store, with their sizes.
+func (s *dedupStore) chunkIDs() (map[string]int64, error) {
+	ids := make(map[string]int64)
+	err := filepath.WalkDir(s.dir.path(chunksDir), func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || d.IsDir() || strings.HasSuffix(path, tmpSuffix) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ids[d.Name()] = info.Size()
+		return nil
+	})
+	return ids, err
+}
+
+// Content-defined chunking: a gear hash over the data cuts a chunk where
+// its low bits are zero, so an edit only changes the chunks around it and
+// the rest are shared with the previous version. Most dotfiles are below
+// chunkMin and stay whole.
+const (
+	chunkMin  = 512 << 10
+	chunkMax  = 8 << 20
+	chunkMask = 1<<20 - 1 // about 1 MiB on average
+)
+
+// gear maps each byte to a fixed pseudo-random value. It must never
+// change, or the same content would chunk differently and be stored twice.
+var gear = func() (t [256]uint64) {
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range t {
+		// splitmix64
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		t[i] = z ^ z>>31
+	}
+	return t
+}()
+
+// splitChunks cuts data into content-defined chunks.
+func splitChunks(data []byte) [][]byte {
+	if len(data) == 0 {
+		return [][]byte{data}
+	}
+	var chunks [][]byte
+	for len(data) > 0 {
+		n := len(data)
+		if n > chunkMin {
+			var h uint64
+			n = min(len(data), chunkMax)
+			for i := chunkMin; i < n; i++ {
+				h = h<<1 + gear[data[i]]
+				if h&chunkMask == 0 {
+					n = i + 1
+					break
+				}
+			}
+		}
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+	return chunks
+}
+
+// StoreReport describes a deduplicating store, as checked by CheckStore.
+type StoreReport struct {
+	Snapshots int
+	Files     int   // in the newest snapshot
+	FileSize  int64 // of the files in the newest snapshot
+	Chunks    int
+	ChunkSize int64 // of all chunks, compressed
+	Unused    int   // chunks no snapshot uses, which PruneStore removes
+	Problems  []string
+}
+
+// CheckStore verifies a deduplicating store: every snapshot can be read,
+// every chunk a snapshot lists is present, and every chunk's content
+// matches its hash.
+func CheckStore(url string) (*StoreReport, error) {
+	s, err := openDedupStore(url)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockStore(s)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	ids, err := s.chunkIDs()
+	if err != nil {
+		return nil, err
+	}
+	used, report, err := s.usedChunks(ids, false)
+	if err != nil {
+		return nil, err
+	}
+	report.Chunks = len(ids)
+	for id, size := range ids {
+		report.ChunkSize += size
+		if !used[id] {
+			report.Unused++
+		}
+		if _, err := s.readChunk(id); err != nil {
+			report.Problems = append(report.Problems, err.Error())
+		}
+	}
+	sort.Strings(report.Problems)
+	return report, nil
+}
+
+// PruneStore removes the chunks no snapshot uses, such as those only
+// expired snapshots or a failed sync needed, and returns how many and
+// their size. It refuses while any snapshot can't be read, as the chunks
+// it lists would look unused.
+func PruneStore(url string) (int, int64, error) {
+	s, err := openDedupStore(url)
+	if err != nil {
+		return 0, 0, err
+	}
+	unlock, err := lockStore(s)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer unlock()
+
+	ids, err := s.chunkIDs()
+	if err != nil {
+		return 0, 0, err
+	}
+	used, _, err := s.usedChunks(ids, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	var removed int
+	var freed int64
+	for id, size := range ids {
+		if used[id] {
+			continue
+		}
+		if err := s.dir.remove(chunkPath(id)); err != nil {
+			return removed, freed, err
+		}
+		removed++
+		freed += size
+	}
+	_ = filepath.WalkDir(s.dir.path(chunksDir), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, tmpSuffix) {
+			_ = os.Remove(path) // left by an interrupted write
+		}
+		return nil
+	})
+	return removed, freed, nil
+}
+
+// usedChunks reads every snapshot and returns the chunks they use, with a
+// report of the snapshots and any chunks missing from ids. A snapshot that
+// can't be read is a problem in the report, or an error if strict.
+func (s *dedupStore) usedChunks(ids map[string]int64, strict bool) (map[string]bool, *StoreReport, error) {
+	names, err := s.snapshots()
+	if err != nil {
+		return nil, nil, err
+	}
+	report := &StoreReport{Snapshots: len(names)}
+	used := make(map[string]bool)
+	for i, name := range names {
+		snap, err := s.loadSnapshot(name)
+		if err != nil && strict {
+			return nil, nil, err
+		}
+		if err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("snapshot %s: %v", name, err))
+			continue
+		}
+		for p, f := range snap.Files {
+			for _, id := range f.Chunks {
+				used[id] = true
+				if _, ok := ids[id]; !ok {
+					report.Problems = append(report.Problems, fmt.Sprintf("snapshot %s: %s needs missing chunk %.12s", name, p, id))
+				}
+			}
+			if i == len(names)-1 {
+				report.Files++
+				report.FileSize += f.Size
+			}
+		}
+	}
+	return used, report, nil
+}
+
+func openDedupStore(url string) (*dedupStore, error) {
+	if !IsDedupStore(url) {
+		return nil, fmt.Errorf("%s is not a deduplicating store (%s<path>)", url, dedupPrefix)
+	}
+	s := &dedupStore{dir: dirStore{root: DedupStorePath(url)}}
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// initDedupStore sets up a directory as a deduplicating store with the
+// default settings.
+func initDedupStore(root string) error {
+	cfg := defaultStoreConfig
+	cfg.Format = dedupFormat
+	header := "# dfc store: dotfiles synced by dfc (Dot File Commander), deduplicated.\n" +
+		"# Snapshots keep the newest keep_last syncs plus the newest of each of\n" +
+		"# the last keep_daily days; the newest is always kept. Run dfc prune\n" +
+		"# to reclaim the space of expired ones.\n"
+	return writeStoreConfig(root, cfg, header)
+}
@@ -0,0 +1,426 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dirPrefix marks a repo URL as a plain directory store, e.g.
+// dir:/media/usb/dotfiles.
+const dirPrefix = "dir:"
+
+// IsDirStore reports whether url names a directory store.
+func IsDirStore(url string) bool {
+	return strings.HasPrefix(strings.TrimSpace(url), dirPrefix)
+}
+
+// DirStorePath returns the absolute directory a dir: URL names.
+func DirStorePath(url string) string {
+	return cleanPath(strings.TrimPrefix(strings.TrimSpace(url), dirPrefix))
+}
+
+// Files in a directory store's root besides the repo layout.
+const (
+	storeConfigFile = ".dfc-store.yaml" // marks the directory as a store; holds its settings
+	storeLockFile   = ".dfc-lock"
+	snapshotsDir    = ".dfc-snapshots"
+	snapshotInfo    = ".dfc-snapshot.yaml" // in each snapshot
+	tmpSuffix       = ".dfc-tmp"
+)
+
+// lockStale is how old a lock must be before another device takes it over,
+// assuming the device that took it died mid-sync.
+const lockStale = 30 * time.Minute
+
+// lockRefresh is how often a directory store's holder touches its lock, so
+// a long sync never looks stale. A variable so tests can shorten it.
+var lockRefresh = lockStale / 6
+
+// dirStore keeps the repo layout in a directory, such as on a removable
+// drive carried between air-gapped machines. Files are replaced by rename,
+// so a reader never sees half a file, and every sync that changes the store
+// keeps a dated snapshot of the result under .dfc-snapshots. Snapshots
+// hard-link unchanged files where the filesystem allows.
+type dirStore struct {
+	root string
+}
+
+// storeConfig is a store's .dfc-store.yaml.
+type storeConfig struct {
+	Format    string    `yaml:"format,omitempty"` // "" for plain files, or dedupFormat
+	Snapshots retention `yaml:"snapshots"`
+}
+
+// retention decides which snapshots to keep: the newest KeepLast, plus the
+// newest of each of the last KeepDaily days that have one. Both zero turns
+// snapshots off.
+type retention struct {
+	KeepLast  int `yaml:"keep_last"`
+	KeepDaily int `yaml:"keep_daily"`
+}
+
+var defaultStoreConfig = storeConfig{Snapshots: retention{KeepLast: 10, KeepDaily: 30}}
+
+func (s dirStore) String() string { return s.root }
+
+func (s dirStore) path(p string) string {
+	return filepath.Join(s.root, filepath.FromSlash(p))
+}
+
+func (s dirStore) check() error {
+	if _, err := os.Stat(s.root); err != nil {
+		return fmt.Errorf("%s not found — is the drive mounted?", s.root)
+	}
+	if _, err := os.Stat(s.path(storeConfigFile)); err != nil {
+		return fmt.Errorf("%s is not a dfc store", s.root)
+	}
+	if s.config().Format == dedupFormat {
+		return fmt.Errorf("%s is a deduplicating store — use %s%s", s.root, dedupPrefix, s.root)
+	}
+	return nil
+}
+
+func (s dirStore) config() storeConfig {
+	cfg := defaultStoreConfig
+	if data, err := os.ReadFile(s.path(storeConfigFile)); err == nil {
+		_ = yaml.Unmarshal(data, &cfg)
+	}
+	return cfg
+}
+
+// lockInfo is the content of the lock file.
+type lockInfo struct {
+	Host  string    `yaml:"host"`
+	PID   int       `yaml:"pid"`
+	Since time.Time `yaml:"since"`
+}
+
+func (s dirStore) lock(owner string) (func(), error) {
+	path := s.path(storeLockFile)
+	data, _ := yaml.Marshal(lockInfo{Host: owner, PID: os.Getpid(), Since: time.Now()})
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(path)
+				return nil, fmt.Errorf("locking %s: %w", s.root, err)
+			}
+			done := make(chan struct{})
+			go refreshLock(path, data, lockRefresh, done)
+			return func() {
+				close(done)
+				_ = os.Remove(path)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("locking %s: %w", s.root, err)
+		}
+
+		// The holder refreshes the lock's mtime while it syncs, so that is
+		// what ages; Since only tells the user when it was taken.
+		var held lockInfo
+		info, statErr := os.Stat(path)
+		if raw, err := os.ReadFile(path); err == nil {
+			_ = yaml.Unmarshal(raw, &held)
+		}
+		if held.Since.IsZero() && statErr == nil {
+			held.Since = info.ModTime()
+		}
+		if statErr != nil || time.Since(info.ModTime()) < lockStale {
+			return nil, &LockedError{Host: held.Host, Since: held.Since}
+		}
+		_ = os.Remove(path) // stale
+	}
+}
+
+// refreshLock touches the lock file at path every interval until done is
+// closed. It stops early if the file no longer holds data, i.e. another
+// device took the lock over.
+func refreshLock(path string, data []byte, interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			if raw, err := os.ReadFile(path); err != nil || !bytes.Equal(raw, data) {
+				return
+			}
+			now := time.Now()
+			_ = os.Chtimes(path, now, now)
+		}
+	}
+}
+
+func (s dirStore) list() ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		switch {
+		case d.IsDir():
+			if rel != "." && !strings.Contains(rel, "/") && !isContent(rel) {
+				return filepath.SkipDir // snapshots, or not the store's
+			}
+			return nil
+		case rel == storeConfigFile, rel == storeLockFile, strings.HasSuffix(rel, tmpSuffix), !inLayout(rel):
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// inLayout reports whether a file in a store is part of the repo layout:
+// entry content or one of the repo's root files. A store may share its
+// directory with other files, which it leaves alone.
+func inLayout(rel string) bool {
+	if isContent(rel) {
+		return true
+	}
+	if strings.Contains(rel, "/") {
+		return false
+	}
+	return rel == "README.md" || rel == attributesFile || strings.HasPrefix(rel, ".dfc-")
+}
+
+func (s dirStore) read(p string) ([]byte, fs.FileMode, error) {
+	return readFileMode(s.path(p))
+}
+
+// write replaces a file by renaming a complete copy over it.
+func (s dirStore) write(p string, data []byte, mode fs.FileMode) error {
+	path := s.path(p)
+	tmp := path + tmpSuffix
+	if err := writeFile(tmp, data, mode); err != nil {
+		return err
+	}
+	if mode&fs.ModeSymlink == 0 {
+		if err := syncFile(tmp); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s dirStore) remove(p string) error {
+	path := s.path(p)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	pruneEmptyDirs(s.root, filepath.Dir(path))
+	return nil
+}
+
+// putManifest writes the manifest by rename. The lock keeps other devices
+// out, so prev is only checked against what is there.
+func (s dirStore) putManifest(data, prev []byte) error {
+	current, err := os.ReadFile(s.path(manifestFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !bytes.Equal(current, prev) {
+		return errStoreChanged
+	}
+	return s.write(manifestFile, data, 0644)
+}
+
+// snapshot copies the store's current state to a dated directory under
+// .dfc-snapshots, then drops snapshots the retention policy doesn't keep.
+func (s dirStore) snapshot(message string) error {
+	keep := s.config().Snapshots
+	if keep.KeepLast <= 0 && keep.KeepDaily <= 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	name := snapshotName(now)
+	dir := filepath.Join(s.root, snapshotsDir, name)
+	if _, err := os.Stat(dir); err == nil {
+		name += fmt.Sprintf("-%d", now.Nanosecond()) // two syncs in a second
+		dir = filepath.Join(s.root, snapshotsDir, name)
+	}
+	tmp := dir + tmpSuffix
+	files, err := s.list()
+	if err != nil {
+		return err
+	}
+	for _, p := range files {
+		if err := linkOrCopy(s.path(p), filepath.Join(tmp, filepath.FromSlash(p))); err != nil {
+			_ = os.RemoveAll(tmp)
+			return err
+		}
+	}
+	info, _ := yaml.Marshal(map[string]any{"time": now, "message": message})
+	if err := os.WriteFile(filepath.Join(tmp, snapshotInfo), info, 0644); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	return s.prune(keep)
+}
+
+// linkOrCopy hard-links src to dst, copying it on filesystems without hard
+// links such as FAT. Files in a store are only ever replaced, never
+// rewritten in place, so a link keeps the snapshot's version.
+func linkOrCopy(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if os.Link(src, dst) == nil {
+		return nil
+	}
+	data, mode, err := readFileMode(src)
+	if err != nil {
+		return err
+	}
+	return writeFile(dst, data, mode)
+}
+
+// prune removes the snapshots keep doesn't cover.
+func (s dirStore) prune(keep retention) error {
+	entries, err := os.ReadDir(filepath.Join(s.root, snapshotsDir))
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasSuffix(e.Name(), tmpSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	for _, name := range keep.expired(names) {
+		if err := os.RemoveAll(filepath.Join(s.root, snapshotsDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expired returns the snapshots, named by snapshotName, that the policy
+// doesn't keep.
+func (keep retention) expired(names []string) []string {
+	names = slices.Clone(names)
+	sort.Sort(sort.Reverse(sort.StringSlice(names))) // newest first
+
+	var drop []string
+	days := make(map[string]bool)
+	for i, name := range names {
+		day := name[:min(len(name), len("2006-01-02"))]
+		switch {
+		case i < keep.KeepLast:
+			days[day] = true
+		case !days[day] && len(days) < keep.KeepDaily:
+			days[day] = true
+		default:
+			drop = append(drop, name)
+		}
+	}
+	return drop
+}
+
+// snapshotName names a snapshot taken at t so names sort by time.
+func snapshotName(t time.Time) string {
+	return t.UTC().Format("2006-01-02T150405Z")
+}
+
+// wipe removes the content and snapshots, keeping the store's settings
+// and any files in the directory that aren't the store's.
+func (s dirStore) wipe() error {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, e := range entries {
+		name := e.Name()
+		switch {
+		case name == storeConfigFile, name == storeLockFile:
+			continue
+		case e.IsDir() && !isContent(name) && name != snapshotsDir && name != chunksDir:
+			continue
+		case !e.IsDir() && !inLayout(name) && !strings.HasSuffix(name, tmpSuffix):
+			continue
+		}
+		errs = append(errs, os.RemoveAll(filepath.Join(s.root, name)))
+	}
+	return errors.Join(errs...)
+}
+
+// initDirStore sets up a directory as a store with the default settings.
+// The directory may hold other files; the store only uses the repo layout
+// and its own dotfiles, and leaves the rest alone.
+func initDirStore(root string) error {
+	header := "# dfc store: dotfiles synced by dfc (Dot File Commander).\n" +
+		"# Snapshots keep the newest keep_last syncs plus the newest of each of\n" +
+		"# the last keep_daily days; set both to 0 to keep none.\n"
+	return writeStoreConfig(root, defaultStoreConfig, header)
+}
+
+// writeStoreConfig creates root and its .dfc-store.yaml, unless there is
+// one already.
+func writeStoreConfig(root string, cfg storeConfig, header string) error {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("creating %s: %w", root, err)
+	}
+	path := filepath.Join(root, storeConfigFile)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	// The store would take over files that look like its own.
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if inLayout(e.Name()) {
+			return fmt.Errorf("%s already holds %s — set the store up in an empty directory", root, e.Name())
+		}
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(header), data...), 0644)
+}
@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A lock is stale once its file has gone unrefreshed for lockStale, however
+// long ago it was taken.
+func TestDirStoreLockStaleness(t *testing.T) {
+	leave := func(s dirStore, since, touched time.Time) {
+		t.Helper()
+		data, _ := yaml.Marshal(lockInfo{Host: "crashed", PID: 1, Since: since})
+		if err := os.WriteFile(s.path(storeLockFile), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(s.path(storeLockFile), touched, touched); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	for _, tc := range []struct {
+		name           string
+		since, touched time.Time
+		stale          bool
+	}{
+		{"recent", now.Add(-lockStale / 2), now.Add(-lockStale / 2), false},
+		{"long sync, still refreshed", now.Add(-3 * lockStale), now.Add(-lockRefresh), false},
+		{"abandoned", now.Add(-3 * lockStale), now.Add(-2 * lockStale), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := dirStore{root: t.TempDir()}
+			leave(s, tc.since, tc.touched)
+			unlock, err := s.lock("laptop")
+			var locked *LockedError
+			switch {
+			case tc.stale && err != nil:
+				t.Fatalf("lock over a stale lock: %v", err)
+			case !tc.stale && (!errors.As(err, &locked) || locked.Host != "crashed"):
+				t.Fatalf("lock over a live lock: got %v, want LockedError by crashed", err)
+			}
+			if unlock != nil {
+				unlock()
+			}
+		})
+	}
+}
+
+func TestDirStoreLockRefreshed(t *testing.T) {
+	defer func(d time.Duration) { lockRefresh = d }(lockRefresh)
+	lockRefresh = 10 * time.Millisecond
+
+	s := dirStore{root: t.TempDir()}
+	unlock, err := s.lock("laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * lockStale)
+	if err := os.Chtimes(s.path(storeLockFile), old, old); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	var locked *LockedError
+	if _, err := s.lock("desktop"); !errors.As(err, &locked) || locked.Host != "laptop" {
+		t.Fatalf("lock during a long sync: got %v, want LockedError by laptop", err)
+	}
+	unlock()
+	if _, err := os.Stat(s.path(storeLockFile)); !os.IsNotExist(err) {
+		t.Errorf("lock file left after unlocking: %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// execGit runs the git binary.
+type execGit struct{}
+
+func (execGit) clone(url, dest string) error {
+	args := append(append([]string{"clone"}, cloneArgs()...), url, dest)
+	cmd := exec.Command("git", args...)
+	// Use a known-good CWD so clone works even if the process CWD was deleted
+	cmd.Dir = os.TempDir()
+	cmd.Env = gitEnv(cmd.Dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return &GitError{Op: "clone", Output: string(out), Err: err}
+	}
+	return nil
+}
+
+func (execGit) initRepo(dir string) error {
+	if err := gitCmd(dir, "init"); err != nil {
+		return err
+	}
+	return gitCmd(dir, "symbolic-ref", "HEAD", "refs/heads/main")
+}
+
+func (execGit) initBare(dir string) error {
+	if err := gitCmd(dir, "init", "--bare"); err != nil {
+		return err
+	}
+	return gitCmd(dir, "symbolic-ref", "HEAD", "refs/heads/main")
+}
+
+func (execGit) lsRemote(url string) error {
+	cmd := exec.Command("git", "ls-remote", "--heads", url)
+	cmd.Dir = os.TempDir()
+	cmd.Env = gitEnv(cmd.Dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return &GitError{Op: "ls-remote", Output: strings.TrimSpace(string(out)), Err: err}
+	}
+	return nil
+}
+
+func (execGit) remoteURL(dir string) string {
+	out, _ := gitOutput(dir, "remote", "get-url", "origin")
+	return strings.TrimSpace(out)
+}
+
+func (g execGit) setRemoteURL(dir, url string) error {
+	if g.remoteURL(dir) == "" {
+		return gitCmd(dir, "remote", "add", "origin", url)
+	}
+	return gitCmd(dir, "remote", "set-url", "origin", url)
+}
+
+func (execGit) hasHead(dir string) bool {
+	return gitCmd(dir, "rev-parse", "HEAD") == nil
+}
+
+func (execGit) hasUpstream(dir string) bool {
+	_, err := gitOutput(dir, "rev-parse", "--abbrev-ref", "@{u}")
+	return err == nil
+}
+
+func (execGit) changed(dir string, paths ...string) (bool, error) {
+	out, err := gitOutput(dir, append([]string{"status", "--porcelain", "--"}, paths...)...)
+	if err != nil {
+		return false, fmt.Errorf("git status: %w", err)
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+func (g execGit) commitAll(dir, message string) (bool, error) {
+	add := []string{"add", "-A"}
+	if isSparse(dir) {
+		// Also stage files written outside the sparse set; files it leaves
+		// out of the checkout are still not taken as deleted.
+		add = append(add, "--sparse")
+	}
+	if err := gitCmd(dir, add...); err != nil {
+		return false, fmt.Errorf("git add: %w", err)
+	}
+	// Check if there's anything to commit
+	if changed, err := g.changed(dir); err != nil || !changed {
+		return false, err
+	}
+	if err := gitCmd(dir, "commit", "-m", message); err != nil {
+		return false, fmt.Errorf("git commit: %w", err)
+	}
+	return true, nil
+}
+
+func (execGit) pushUpstream(dir string) error {
+	if err := gitCmd(dir, "branch", "-M", "main"); err != nil {
+		return err
+	}
+	return gitCmd(dir, "push", "-u", "origin", "main")
+}
+
+func (execGit) push(dir string, force bool) error {
+	if force {
+		return gitCmd(dir, "push", "--force")
+	}
+	err := gitCmd(dir, "push")
+	// "! [rejected] main -> main (fetch first)": the remote has commits
+	// this clone lacks. A hook or protected branch says "remote rejected".
+	var gitErr *GitError
+	if errors.As(err, &gitErr) && strings.Contains(gitErr.Output, "[rejected]") &&
+		(strings.Contains(gitErr.Output, "(fetch first)") || strings.Contains(gitErr.Output, "(non-fast-forward)")) {
+		gitErr.Err = fmt.Errorf("%w: %v", git.ErrNonFastForwardUpdate, gitErr.Err)
+	}
+	return err
+}
+
+func (execGit) fetch(dir string) error {
+	return gitCmd(dir, "fetch")
+}
+
+func (execGit) aheadBehind(dir string) (ahead, behind int, err error) {
+	out, err := gitOutput(dir, "rev-list", "--left-right", "--count", "HEAD...@{u}")
+	if err != nil {
+		return 0, 0, &GitError{Op: "rev-list", Err: err}
+	}
+	_, err = fmt.Sscanf(out, "%d %d", &ahead, &behind)
+	return ahead, behind, err
+}
+
+func (execGit) fastForward(dir string) error {
+	return gitCmd(dir, "merge", "--ff-only", "@{u}")
+}
+
+func (execGit) rebase(dir string, ahead int) error {
+	local, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	local = strings.TrimSpace(local)
+	if err := gitCmd(dir, "rebase", "--autostash", "@{u}"); err != nil {
+		if err := resolveRebase(dir, ahead); err != nil {
+			_ = gitCmd(dir, "rebase", "--abort")
+			return err
+		}
+	}
+	return settleContested(dir, local)
+}
+
+func (execGit) resetHard(dir string) error {
+	return gitCmd(dir, "reset", "--hard", "@{u}")
+}
+
+func (execGit) show(dir, rev, path string) ([]byte, error) {
+	out, err := gitOutput(dir, "show", rev+":"+path)
+	return []byte(out), err
+}
+
+func (execGit) checkoutHead(dir, path string) error {
+	return gitCmd(dir, "checkout", "HEAD", "--", path)
+}
+
+func (execGit) upstreamTime(dir string) (time.Time, error) {
+	out, err := gitOutput(dir, "log", "-1", "--format=%ct", "@{u}")
+	if err != nil {
+		return time.Time{}, err
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(secs, 0), nil
+}
+
+func (execGit) localWork(dir string) (unpushed, stashes, dirty int, err error) {
+	if out, err := gitOutput(dir, "rev-list", "--count", "HEAD", "--not", "--remotes"); err == nil {
+		unpushed, _ = strconv.Atoi(strings.TrimSpace(out))
+	}
+	if out, _ := gitOutput(dir, "stash", "list"); strings.TrimSpace(out) != "" {
+		stashes = len(strings.Split(strings.TrimSpace(out), "\n"))
+	}
+	out, err := gitOutput(dir, "status", "--porcelain")
+	if err != nil {
+		return unpushed, stashes, 0, err
+	}
+	if strings.TrimSpace(out) != "" {
+		dirty = len(strings.Split(strings.TrimSpace(out), "\n"))
+	}
+	return unpushed, stashes, dirty, nil
+}
+
+func (execGit) identity() GitIdentity {
+	name, _ := gitOutput("", "config", "--global", "user.name")
+	email, _ := gitOutput("", "config", "--global", "user.email")
+	return GitIdentity{
+		Name:  strings.TrimSpace(name),
+		Email: strings.TrimSpace(email),
+	}
+}
+
+func (execGit) setIdentity(name, email string) error {
+	if err := gitCmd("", "config", "--global", "user.name", name); err != nil {
+		return fmt.Errorf("setting user.name: %w", err)
+	}
+	if err := gitCmd("", "config", "--global", "user.email", email); err != nil {
+		return fmt.Errorf("setting user.email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package sync
+
+import (
+	"os/exec"
+	"slices"
+	"testing"
+)
+
+const batchSSH = "GIT_SSH_COMMAND=ssh -o BatchMode=yes"
+
+func TestGitEnvKeepsCustomSSH(t *testing.T) {
+	repo := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		env       map[string]string
+		sshConfig string // core.sshCommand in the repo
+		wantBatch bool
+	}{
+		{name: "default ssh", wantBatch: true},
+		{name: "GIT_SSH_COMMAND", env: map[string]string{"GIT_SSH_COMMAND": "ssh -i ~/.ssh/dots"}},
+		{name: "GIT_SSH", env: map[string]string{"GIT_SSH": "/usr/bin/plink"}},
+		{name: "core.sshCommand", sshConfig: "ssh -J bastion"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+			t.Setenv("GIT_SSH_COMMAND", "")
+			t.Setenv("GIT_SSH", "")
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			args := []string{"-C", repo, "config", "--unset-all", "core.sshCommand"}
+			if tc.sshConfig != "" {
+				args = []string{"-C", repo, "config", "core.sshCommand", tc.sshConfig}
+			}
+			_ = exec.Command("git", args...).Run()
+
+			env := gitEnv(repo)
+			// Setting it would override the user's own choice.
+			if got := slices.Contains(env, batchSSH); got != tc.wantBatch {
+				t.Errorf("BatchMode ssh set = %v, want %v", got, tc.wantBatch)
+			}
+			if !slices.Contains(env, "GIT_TERMINAL_PROMPT=0") {
+				t.Error("GIT_TERMINAL_PROMPT=0 missing")
+			}
+		})
+	}
+}
@@ -0,0 +1,653 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// goGit is the built-in backend: git in-process with go-git, so dfc works
+// where git is missing, old or configured in ways that break scripted use
+// (hooks, signing, pull.rebase). Errors are go-git's, wrapped in GitError.
+type goGit struct{}
+
+var mainBranch = plumbing.NewBranchReferenceName("main")
+
+func init() {
+	// go-git reaches local repos by running git-upload-pack and
+	// git-receive-pack; serve them in-process instead.
+	client.InstallProtocol("file", localServer{server.NewClient(server.DefaultLoader)})
+}
+
+// localServer is go-git's in-process server, except a fetch may offer
+// commits the remote doesn't have — as a clone with unpushed backups does.
+// go-git's server fails on those instead of ignoring them.
+type localServer struct {
+	transport.Transport
+}
+
+func (t localServer) NewUploadPackSession(ep *transport.Endpoint, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	s, err := t.Transport.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+	st, err := server.DefaultLoader.Load(ep)
+	if err != nil {
+		return nil, err
+	}
+	return knownHaves{s, st}, nil
+}
+
+type knownHaves struct {
+	transport.UploadPackSession
+	st storer.EncodedObjectStorer
+}
+
+func (s knownHaves) UploadPack(ctx context.Context, req *packp.UploadPackRequest) (*packp.UploadPackResponse, error) {
+	haves := req.Haves[:0]
+	for _, h := range req.Haves {
+		if s.st.HasEncodedObject(h) == nil {
+			haves = append(haves, h)
+		}
+	}
+	req.Haves = haves
+	return s.UploadPackSession.UploadPack(ctx, req)
+}
+
+func (goGit) clone(url, dest string) error {
+	_, err := git.PlainClone(dest, false, &git.CloneOptions{URL: url, Auth: authFor(url)})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		// Like git, leave a clone without commits for the caller to seed.
+		r, err := git.PlainInitWithOptions(dest, &git.PlainInitOptions{InitOptions: git.InitOptions{DefaultBranch: mainBranch}})
+		if err != nil {
+			return &GitError{Op: "clone", Err: err}
+		}
+		_, err = r.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{url}})
+		return wrapGoGit("clone", err)
+	}
+	return wrapGoGit("clone", err)
+}
+
+func (goGit) initRepo(dir string) error {
+	_, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{InitOptions: git.InitOptions{DefaultBranch: mainBranch}})
+	return wrapGoGit("init", err)
+}
+
+func (goGit) initBare(dir string) error {
+	_, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{Bare: true, InitOptions: git.InitOptions{DefaultBranch: mainBranch}})
+	return wrapGoGit("init", err)
+}
+
+func (goGit) lsRemote(url string) error {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{Name: "origin", URLs: []string{url}})
+	_, err := remote.List(&git.ListOptions{Auth: authFor(url)})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return nil
+	}
+	return wrapGoGit("ls-remote", err)
+}
+
+func (goGit) remoteURL(dir string) string {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return ""
+	}
+	return originURL(r)
+}
+
+func (goGit) setRemoteURL(dir, url string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: "remote", Err: err}
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return &GitError{Op: "remote", Err: err}
+	}
+	if rc, ok := cfg.Remotes["origin"]; ok {
+		rc.URLs = []string{url}
+		return wrapGoGit("remote", r.SetConfig(cfg))
+	}
+	_, err = r.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{url}})
+	return wrapGoGit("remote", err)
+}
+
+func (goGit) hasHead(dir string) bool {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return false
+	}
+	_, err = r.Head()
+	return err == nil
+}
+
+func (goGit) hasUpstream(dir string) bool {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return false
+	}
+	_, err = upstream(r)
+	return err == nil
+}
+
+func (goGit) changed(dir string, paths ...string) (bool, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return false, &GitError{Op: "status", Err: err}
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return false, &GitError{Op: "status", Err: err}
+	}
+	status, err := w.Status()
+	if err != nil {
+		return false, &GitError{Op: "status", Err: err}
+	}
+	if len(paths) == 0 {
+		return !status.IsClean(), nil
+	}
+	for _, p := range paths {
+		if fs, ok := status[filepath.ToSlash(p)]; ok && (fs.Staging != git.Unmodified || fs.Worktree != git.Unmodified) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (g goGit) commitAll(dir, message string) (bool, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return false, &GitError{Op: "commit", Err: err}
+	}
+	return commitWorktree(r, message, nil)
+}
+
+// commitWorktree stages every change in the worktree, deletions included,
+// and commits it. author nil means the configured identity.
+func commitWorktree(r *git.Repository, message string, author *object.Signature) (bool, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return false, &GitError{Op: "add", Err: err}
+	}
+	if err := w.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		return false, &GitError{Op: "add", Err: err}
+	}
+	status, err := w.Status()
+	if err != nil {
+		return false, &GitError{Op: "status", Err: err}
+	}
+	if status.IsClean() {
+		return false, nil // nothing to commit
+	}
+	opts := &git.CommitOptions{Author: author}
+	if author != nil {
+		opts.Committer = committer(r, author)
+	}
+	if _, err := w.Commit(message, opts); err != nil {
+		return false, &GitError{Op: "commit", Err: err}
+	}
+	return true, nil
+}
+
+// committer is the configured identity committing now, falling back to
+// author when none is configured.
+func committer(r *git.Repository, author *object.Signature) *object.Signature {
+	if cfg, err := r.ConfigScoped(gitconfig.SystemScope); err == nil && cfg.User.Name != "" && cfg.User.Email != "" {
+		return &object.Signature{Name: cfg.User.Name, Email: cfg.User.Email, When: time.Now()}
+	}
+	return &object.Signature{Name: author.Name, Email: author.Email, When: time.Now()}
+}
+
+func (goGit) pushUpstream(dir string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: "push", Err: err}
+	}
+	head, err := r.Head()
+	if err != nil {
+		return &GitError{Op: "push", Err: err}
+	}
+	if head.Name() != mainBranch {
+		if err := r.Storer.SetReference(plumbing.NewHashReference(mainBranch, head.Hash())); err != nil {
+			return &GitError{Op: "branch", Err: err}
+		}
+		if err := r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, mainBranch)); err != nil {
+			return &GitError{Op: "branch", Err: err}
+		}
+		_ = r.Storer.RemoveReference(head.Name())
+	}
+	err = r.Push(&git.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(mainBranch + ":" + mainBranch)},
+		Auth:       authFor(originURL(r)),
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return &GitError{Op: "push", Err: err}
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return &GitError{Op: "branch", Err: err}
+	}
+	cfg.Branches["main"] = &gitconfig.Branch{Name: "main", Remote: "origin", Merge: mainBranch}
+	return wrapGoGit("branch", r.SetConfig(cfg))
+}
+
+func (goGit) push(dir string, force bool) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: "push", Err: err}
+	}
+	head, err := r.Head()
+	if err != nil {
+		return &GitError{Op: "push", Err: err}
+	}
+	b, err := r.Branch(head.Name().Short())
+	if err != nil {
+		return &GitError{Op: "push", Err: fmt.Errorf("%s has no upstream branch: %w", head.Name().Short(), err)}
+	}
+	err = r.Push(&git.PushOptions{
+		RemoteName: b.Remote,
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(head.Name() + ":" + b.Merge)},
+		Force:      force,
+		Auth:       authFor(originURL(r)),
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	if err != nil && strings.HasPrefix(err.Error(), "non-fast-forward update") {
+		// go-git words it like git.ErrNonFastForwardUpdate but doesn't
+		// wrap it.
+		err = fmt.Errorf("%w: %s", git.ErrNonFastForwardUpdate, strings.TrimPrefix(err.Error(), "non-fast-forward update: "))
+	}
+	return wrapGoGit("push", err)
+}
+
+func (goGit) fetch(dir string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: "fetch", Err: err}
+	}
+	err = r.Fetch(&git.FetchOptions{RemoteName: "origin", Auth: authFor(originURL(r)), Force: true})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return wrapGoGit("fetch", err)
+}
+
+func (goGit) aheadBehind(dir string) (ahead, behind int, err error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return 0, 0, &GitError{Op: "rev-list", Err: err}
+	}
+	head, err := r.Head()
+	if err != nil {
+		return 0, 0, &GitError{Op: "rev-list", Err: err}
+	}
+	up, err := upstream(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	mine, err := reachable(r, head.Hash())
+	if err != nil {
+		return 0, 0, &GitError{Op: "rev-list", Err: err}
+	}
+	theirs, err := reachable(r, up.Hash())
+	if err != nil {
+		return 0, 0, &GitError{Op: "rev-list", Err: err}
+	}
+	for h := range mine {
+		if !theirs[h] {
+			ahead++
+		}
+	}
+	for h := range theirs {
+		if !mine[h] {
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// fastForward moves the branch to its upstream, refusing if the branch has
+// commits the upstream doesn't, as git merge --ff-only does.
+func (goGit) fastForward(dir string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: "merge", Err: err}
+	}
+	head, err := resolveCommit(r, "HEAD")
+	if err != nil {
+		return err
+	}
+	up, err := resolveCommit(r, "@{u}")
+	if err != nil {
+		return err
+	}
+	ff, err := head.IsAncestor(up)
+	if err != nil {
+		return &GitError{Op: "merge", Err: err}
+	}
+	if !ff {
+		return &GitError{Op: "merge", Err: fmt.Errorf("not possible to fast-forward %s to %s", head.Hash.String()[:7], up.Hash.String()[:7])}
+	}
+	return resetTo(dir, "merge", git.MergeReset)
+}
+
+func (goGit) rebase(dir string, _ int) error {
+	return replayCommits(dir)
+}
+
+func (goGit) resetHard(dir string) error {
+	return resetTo(dir, "reset", git.HardReset)
+}
+
+// resetTo moves the current branch to its upstream.
+func resetTo(dir, op string, mode git.ResetMode) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: op, Err: err}
+	}
+	up, err := upstream(r)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return &GitError{Op: op, Err: err}
+	}
+	return wrapGoGit(op, w.Reset(&git.ResetOptions{Commit: up.Hash(), Mode: mode}))
+}
+
+func (goGit) show(dir, rev, path string) ([]byte, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, &GitError{Op: "show", Err: err}
+	}
+	c, err := resolveCommit(r, rev)
+	if err != nil {
+		return nil, err
+	}
+	return fileAt(c, path)
+}
+
+func (g goGit) checkoutHead(dir, path string) error {
+	data, err := g.show(dir, "HEAD", path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, path), data, 0644); err != nil {
+		return err
+	}
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: "checkout", Err: err}
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return &GitError{Op: "checkout", Err: err}
+	}
+	_, err = w.Add(filepath.ToSlash(path))
+	return wrapGoGit("checkout", err)
+}
+
+func (goGit) upstreamTime(dir string) (time.Time, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return time.Time{}, &GitError{Op: "log", Err: err}
+	}
+	c, err := resolveCommit(r, "@{u}")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.Committer.When, nil
+}
+
+func (goGit) localWork(dir string) (unpushed, stashes, dirty int, err error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return 0, 0, 0, &GitError{Op: "status", Err: err}
+	}
+	if head, err := r.Head(); err == nil {
+		pushed := make(map[plumbing.Hash]bool)
+		refs, _ := r.References()
+		_ = refs.ForEach(func(ref *plumbing.Reference) error {
+			if ref.Name().IsRemote() && ref.Type() == plumbing.HashReference {
+				seen, _ := reachable(r, ref.Hash())
+				for h := range seen {
+					pushed[h] = true
+				}
+			}
+			return nil
+		})
+		mine, _ := reachable(r, head.Hash())
+		for h := range mine {
+			if !pushed[h] {
+				unpushed++
+			}
+		}
+	}
+	// go-git doesn't read reflogs; the stash reflog has one line per stash.
+	if data, err := os.ReadFile(filepath.Join(dir, ".git", "logs", "refs", "stash")); err == nil {
+		stashes = strings.Count(string(data), "\n")
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return unpushed, stashes, 0, &GitError{Op: "status", Err: err}
+	}
+	status, err := w.Status()
+	if err != nil {
+		return unpushed, stashes, 0, &GitError{Op: "status", Err: err}
+	}
+	for _, fs := range status {
+		if fs.Staging != git.Unmodified || fs.Worktree != git.Unmodified {
+			dirty++
+		}
+	}
+	return unpushed, stashes, dirty, nil
+}
+
+func (goGit) identity() GitIdentity {
+	cfg, err := gitconfig.LoadConfig(gitconfig.GlobalScope)
+	if err != nil {
+		return GitIdentity{}
+	}
+	return GitIdentity{Name: cfg.User.Name, Email: cfg.User.Email}
+}
+
+// setIdentity edits the user section of ~/.gitconfig in place, keeping
+// everything else in the file as it is.
+func (goGit) setIdentity(name, email string) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(home, ".gitconfig")
+	raw := config.New()
+	if data, err := os.ReadFile(path); err == nil {
+		if err := config.NewDecoder(bytes.NewReader(data)).Decode(raw); err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	raw.Section("user").SetOption("name", name).SetOption("email", email)
+	var buf bytes.Buffer
+	if err := config.NewEncoder(&buf).Encode(raw); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// wrapGoGit wraps a go-git error, passing nil through.
+func wrapGoGit(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &GitError{Op: op, Err: err}
+}
+
+func originURL(r *git.Repository) string {
+	remote, err := r.Remote("origin")
+	if err != nil || len(remote.Config().URLs) == 0 {
+		return ""
+	}
+	return remote.Config().URLs[0]
+}
+
+// upstream returns the remote tracking branch of the current branch.
+func upstream(r *git.Repository) (*plumbing.Reference, error) {
+	head, err := r.Head()
+	if err != nil {
+		return nil, &GitError{Op: "rev-parse", Err: err}
+	}
+	b, err := r.Branch(head.Name().Short())
+	if err != nil {
+		return nil, &GitError{Op: "rev-parse", Err: fmt.Errorf("%s has no upstream branch: %w", head.Name().Short(), err)}
+	}
+	name := plumbing.NewRemoteReferenceName(b.Remote, b.Merge.Short())
+	ref, err := r.Reference(name, true)
+	if err != nil {
+		return nil, &GitError{Op: "rev-parse", Err: fmt.Errorf("%s: %w", name.Short(), err)}
+	}
+	return ref, nil
+}
+
+// resolveCommit resolves "HEAD", "@{u}" or a commit hash.
+func resolveCommit(r *git.Repository, rev string) (*object.Commit, error) {
+	var hash plumbing.Hash
+	switch rev {
+	case "@{u}":
+		ref, err := upstream(r)
+		if err != nil {
+			return nil, err
+		}
+		hash = ref.Hash()
+	default:
+		h, err := r.ResolveRevision(plumbing.Revision(rev))
+		if err != nil {
+			return nil, &GitError{Op: "rev-parse", Err: fmt.Errorf("%s: %w", rev, err)}
+		}
+		hash = *h
+	}
+	c, err := r.CommitObject(hash)
+	if err != nil {
+		return nil, &GitError{Op: "rev-parse", Err: err}
+	}
+	return c, nil
+}
+
+// fileAt reads a file from a commit's tree.
+func fileAt(c *object.Commit, path string) ([]byte, error) {
+	f, err := c.File(filepath.ToSlash(path))
+	if err != nil {
+		return nil, &GitError{Op: "show", Err: fmt.Errorf("%s:%s: %w", c.Hash.String()[:7], path, err)}
+	}
+	s, err := f.Contents()
+	if err != nil {
+		return nil, &GitError{Op: "show", Err: err}
+	}
+	return []byte(s), nil
+}
+
+// reachable returns every commit reachable from hash.
+func reachable(r *git.Repository, hash plumbing.Hash) (map[plumbing.Hash]bool, error) {
+	seen := make(map[plumbing.Hash]bool)
+	queue := []plumbing.Hash{hash}
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		if seen[h] {
+			continue
+		}
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return seen, err
+		}
+		seen[h] = true
+		queue = append(queue, c.ParentHashes...)
+	}
+	return seen, nil
+}
+
+// authFor picks credentials for a remote URL. SSH uses the agent, or else
+// an unencrypted default key in ~/.ssh. HTTPS uses $DFC_GIT_TOKEN, or the
+// password git's credential helper stores for the host when git is
+// installed. Local paths and URLs with embedded credentials need none.
+func authFor(remote string) transport.AuthMethod {
+	if remote == "" || IsLocalRemote(remote) {
+		return nil
+	}
+	ep, err := transport.NewEndpoint(remote)
+	if err != nil {
+		return nil
+	}
+	switch ep.Protocol {
+	case "ssh":
+		if os.Getenv("SSH_AUTH_SOCK") != "" {
+			return nil // go-git uses the agent by default
+		}
+		home, _ := os.UserHomeDir()
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			if keys, err := gitssh.NewPublicKeysFromFile(ep.User, filepath.Join(home, ".ssh", name), ""); err == nil {
+				return keys
+			}
+		}
+	case "http", "https":
+		if ep.Password != "" {
+			return nil
+		}
+		user := ep.User
+		if user == "" {
+			user = "dfc" // hosts ignore the user name for token auth
+		}
+		if token := os.Getenv("DFC_GIT_TOKEN"); token != "" {
+			return &githttp.BasicAuth{Username: user, Password: token}
+		}
+		if u, p := storedCredentials(ep.Protocol, ep.Host); p != "" {
+			if u == "" {
+				u = user
+			}
+			return &githttp.BasicAuth{Username: u, Password: p}
+		}
+	}
+	return nil
+}
+
+// storedCredentials asks git's credential helper for a host's login,
+// without prompting. Empty if git isn't installed or nothing is stored.
+func storedCredentials(protocol, host string) (user, password string) {
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("protocol=%s\nhost=%s\n\n", protocol, host))
+	out, err := cmd.Output()
+	if err != nil {
+		return "", ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if v, ok := strings.CutPrefix(line, "username="); ok {
+			user = v
+		}
+		if v, ok := strings.CutPrefix(line, "password="); ok {
+			password = v
+		}
+	}
+	return user, password
+}
@@ -0,0 +1,203 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LFSSupport says whether a backup can route files through Git LFS.
+type LFSSupport int
+
+const (
+	LFSMissing  LFSSupport = iota // git-lfs or the git binary isn't installed
+	LFSReady                      // files can be stored through Git LFS
+	LFSUnneeded                   // the repo syncs to a store, which holds large files as they are
+)
+
+const attributesFile = ".gitattributes"
+
+// The block of .gitattributes dfc manages. Lines outside it are the user's.
+const (
+	lfsBegin = "# BEGIN dfc: files stored through Git LFS (managed by dfc, edits are lost)"
+	lfsEnd   = "# END dfc"
+	lfsAttrs = "filter=lfs diff=lfs merge=lfs -text"
+)
+
+// LFS reports whether files in the repo at localPath can go through Git LFS:
+// it needs the git binary backend and git-lfs. A store mirror doesn't need it.
+func LFS(localPath string) LFSSupport {
+	if isMirror(expandHome(localPath)) {
+		return LFSUnneeded
+	}
+	if _, ok := backend.(execGit); !ok {
+		return LFSMissing
+	}
+	if _, err := exec.LookPath("git-lfs"); err != nil {
+		return LFSMissing
+	}
+	return LFSReady
+}
+
+// TrackLFS adds paths (relative to the repo, with forward slashes) to the
+// Git LFS files in the repo's .gitattributes, drops files no longer in the
+// repo, and sets up the LFS filter in the clone so the next commit stores
+// them as LFS objects.
+func TrackLFS(localPath string, paths []string) error {
+	localPath = expandHome(localPath)
+	before, rest, after, err := readAttributes(localPath)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	for _, p := range append(rest, paths...) {
+		if _, err := os.Lstat(filepath.Join(localPath, filepath.FromSlash(p))); err == nil {
+			set[p] = true
+		}
+	}
+	tracked := make([]string, 0, len(set))
+	for p := range set {
+		tracked = append(tracked, p)
+	}
+	sort.Strings(tracked)
+	if err := writeAttributes(localPath, before, tracked, after); err != nil {
+		return err
+	}
+	return setupLFS(localPath)
+}
+
+// LFSTracked returns the files dfc stores through Git LFS in the repo.
+func LFSTracked(localPath string) []string {
+	_, tracked, _, _ := readAttributes(expandHome(localPath))
+	return tracked
+}
+
+// readAttributes splits the repo's .gitattributes into the lines before
+// dfc's block, the paths in it, and the lines after it.
+func readAttributes(dir string) (before []string, tracked []string, after []string, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, attributesFile))
+	if os.IsNotExist(err) {
+		return nil, nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	state := 0 // 0 before the block, 1 in it, 2 after
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		switch {
+		case state == 0 && line == lfsBegin:
+			state = 1
+		case state == 1 && line == lfsEnd:
+			state = 2
+		case state == 1:
+			if pattern, ok := strings.CutSuffix(line, " "+lfsAttrs); ok {
+				tracked = append(tracked, unescapePattern(pattern))
+			}
+		case state == 0:
+			before = append(before, line)
+		default:
+			after = append(after, line)
+		}
+	}
+	return before, tracked, after, nil
+}
+
+func writeAttributes(dir string, before, tracked, after []string) error {
+	var b strings.Builder
+	for _, line := range before {
+		b.WriteString(line + "\n")
+	}
+	if len(tracked) > 0 {
+		b.WriteString(lfsBegin + "\n")
+		for _, p := range tracked {
+			b.WriteString(escapePattern(p) + " " + lfsAttrs + "\n")
+		}
+		b.WriteString(lfsEnd + "\n")
+	}
+	for _, line := range after {
+		b.WriteString(line + "\n")
+	}
+	path := filepath.Join(dir, attributesFile)
+	if strings.TrimSpace(b.String()) == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// escapePattern turns a repo path into a .gitattributes pattern matching
+// only that file.
+func escapePattern(path string) string {
+	var b strings.Builder
+	b.WriteString("/")
+	for _, r := range path {
+		switch r {
+		case ' ':
+			b.WriteString("[[:space:]]")
+		case '\\', '*', '?', '[', '!', '#':
+			b.WriteString(`\` + string(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func unescapePattern(pattern string) string {
+	pattern = strings.TrimPrefix(pattern, "/")
+	pattern = strings.ReplaceAll(pattern, "[[:space:]]", " ")
+	var b strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// usesLFS reports whether the repo stores files through Git LFS.
+func usesLFS(dir string) bool {
+	return len(LFSTracked(dir)) > 0
+}
+
+// setupLFS installs the LFS filter in the clone, if it isn't already.
+func setupLFS(dir string) error {
+	if LFS(dir) != LFSReady {
+		return nil
+	}
+	if out, _ := gitOutput(dir, "config", "--get", "filter.lfs.clean"); strings.TrimSpace(out) != "" {
+		return nil
+	}
+	if err := gitCmd(dir, "lfs", "install", "--local"); err != nil {
+		return fmt.Errorf("git lfs install: %w", err)
+	}
+	return nil
+}
+
+// ensureLFS fetches the content of a clone's LFS files, which a clone or
+// pull without the LFS filter leaves as pointers. Without git-lfs the
+// pointers stay, and restore skips them.
+func ensureLFS(dir string) error {
+	if !usesLFS(dir) || LFS(dir) != LFSReady {
+		return nil
+	}
+	if out, _ := gitOutput(dir, "config", "--get", "filter.lfs.clean"); strings.TrimSpace(out) != "" {
+		return nil // installed: checkouts already fetch LFS content
+	}
+	if err := setupLFS(dir); err != nil {
+		return err
+	}
+	if err := gitCmd(dir, "lfs", "pull"); err != nil {
+		return offline(dir, err)
+	}
+	return nil
+}
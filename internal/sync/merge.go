@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+const manifestFile = ".dfc-manifest.yaml"
+
+// mergeDriver is the git merge driver that merges dfc's bookkeeping files
+// record by record instead of line by line (see manifest.Merge and
+// devices.Merge). It runs `dfc merge-file %O %A %B %P`.
+const mergeDriver = "dfc"
+
+// mergedFiles are the repo files merged with mergeDriver.
+var mergedFiles = []string{manifestFile, ".dfc-devices.yaml"}
+
+// installMergeDriver registers the merge driver in the clone's local git
+// config and info/attributes, so nothing is committed to the repo. The
+// driver path is refreshed each time in case dfc moved.
+func installMergeDriver(dir string) {
+	if _, ok := backend.(execGit); !ok {
+		return // only the git binary runs merge drivers
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+	_ = gitCmd(dir, "config", "merge."+mergeDriver+".name", "dfc record merge")
+	_ = gitCmd(dir, "config", "merge."+mergeDriver+".driver", shellQuote(exe)+" merge-file %O %A %B %P")
+
+	attrs := filepath.Join(dir, ".git", "info", "attributes")
+	data, _ := os.ReadFile(attrs)
+	text := string(data)
+	for _, name := range mergedFiles {
+		line := name + " merge=" + mergeDriver
+		if strings.Contains(text, line) {
+			continue
+		}
+		if text != "" && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		text += line + "\n"
+	}
+	if text == string(data) {
+		return
+	}
+	_ = os.MkdirAll(filepath.Dir(attrs), 0755)
+	_ = os.WriteFile(attrs, []byte(text), 0644)
+}
+
+// mergePending merges manifest changes that were uncommitted before a pull
+// (pending, based on base) into the manifest that was pulled.
+func mergePending(dir string, base, pending []byte) error {
+	path := filepath.Join(dir, manifestFile)
+	ours, err := manifest.Parse(pending)
+	if err != nil {
+		return nil // unreadable leftovers; keep what was pulled
+	}
+	b, err := manifest.Parse(base)
+	if err != nil {
+		b = &manifest.Manifest{}
+	}
+	theirs, err := manifest.LoadFile(path)
+	if err != nil {
+		return err
+	}
+	merged, _ := manifest.Merge(b, ours, theirs)
+	return merged.SaveFile(path)
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
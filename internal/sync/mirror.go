@@ -0,0 +1,648 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/devices"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+)
+
+// A store is a remote that holds the repo layout as plain files instead of
+// git history — shared/, profiles/, variants/ and the bookkeeping files in
+// the root. The local repo is then a mirror of it: a directory with the
+// same layout and a mirrorDir where git would keep .git.
+type store interface {
+	String() string
+	check() error                                 // reachable and set up for dfc
+	lock(owner string) (unlock func(), err error) // exclusive until unlock; a held lock is a *LockedError
+	list() ([]string, error)                      // every file, as slash-separated repo paths
+	read(path string) ([]byte, fs.FileMode, error)
+	write(path string, data []byte, mode fs.FileMode) error
+	remove(path string) error
+	putManifest(data, prev []byte) error // atomically; errStoreChanged if the manifest is no longer prev
+	snapshot(message string) error       // keep the current state as history
+	wipe() error                         // remove all content and history
+}
+
+// errStoreChanged means the store's manifest changed while it was being
+// updated.
+var errStoreChanged = errors.New("the store was updated by another device")
+
+// LockedError means another device is writing to the store.
+type LockedError struct {
+	Host  string
+	Since time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("the store is locked by %s since %s", e.Host, e.Since.Local().Format(time.DateTime))
+}
+
+// IsStoreURL reports whether url names a store rather than a git remote.
+func IsStoreURL(url string) bool {
+	_, ok := storeFor(url)
+	return ok
+}
+
+func storeFor(url string) (store, bool) {
+	if IsDirStore(url) {
+		return dirStore{root: DirStorePath(url)}, true
+	}
+	if IsDedupStore(url) {
+		return &dedupStore{dir: dirStore{root: DedupStorePath(url)}}, true
+	}
+	if IsS3Store(url) {
+		s, err := newS3Store(url)
+		if err != nil {
+			return &s3Store{url: url, err: err}, true
+		}
+		return s, true
+	}
+	return nil, false
+}
+
+// mirrorDir holds a mirror's sync state:
+//
+//	remote   the store URL
+//	base/    the root files as of the last sync, the base for merges
+//	pending  messages of local changes the store hasn't received
+//	fetched  touched after every sync
+const mirrorDir = ".dfc-sync"
+
+func isMirror(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, mirrorDir, "remote"))
+	return err == nil
+}
+
+func mirrorRemote(dir string) string {
+	data, _ := os.ReadFile(filepath.Join(dir, mirrorDir, "remote"))
+	return strings.TrimSpace(string(data))
+}
+
+func mirrorStore(dir string) (store, error) {
+	s, ok := storeFor(mirrorRemote(dir))
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown store %q", filepath.Join(dir, mirrorDir), mirrorRemote(dir))
+	}
+	return s, nil
+}
+
+func initMirror(dir, url string) error {
+	if err := os.MkdirAll(filepath.Join(dir, mirrorDir, "base"), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, mirrorDir, "remote"), []byte(url+"\n"), 0644)
+}
+
+// ensureMirror is EnsureRepo for a store: set up the local mirror if there
+// is none, then sync it.
+func ensureMirror(url, localPath string) error {
+	s, _ := storeFor(url)
+	if !isMirror(localPath) || !SameRemote(mirrorRemote(localPath), url) {
+		if err := s.check(); err != nil {
+			return err
+		}
+		if _, err := RemoveClone(localPath); err != nil {
+			return err
+		}
+		if err := initMirror(localPath, url); err != nil {
+			return err
+		}
+	} else if mirrorRemote(localPath) != url {
+		if err := os.WriteFile(filepath.Join(localPath, mirrorDir, "remote"), []byte(url+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+	return syncMirror(localPath)
+}
+
+// mirrorPending returns the messages of local changes not yet synced.
+func mirrorPending(dir string) []string {
+	data, _ := os.ReadFile(filepath.Join(dir, mirrorDir, "pending"))
+	return strings.FieldsFunc(string(data), func(r rune) bool { return r == '\n' })
+}
+
+// commitMirror is Commit for a mirror: local changes to the root files are
+// queued for the next sync.
+func commitMirror(dir, message string) (bool, error) {
+	ours, err := localRoot(dir)
+	if err != nil {
+		return false, err
+	}
+	base, err := baseRoot(dir)
+	if err != nil {
+		return false, err
+	}
+	if sameFiles(ours, base) {
+		return false, nil
+	}
+	f, err := os.OpenFile(filepath.Join(dir, mirrorDir, "pending"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, strings.ReplaceAll(message, "\n", " "))
+	return true, err
+}
+
+// syncMirror brings the mirror and its store up to date with each other.
+// Entries only one side changed take that side's content; the manifest and
+// device registry merge record by record as in a git rebase, and an entry
+// both sides changed takes the content of the version the merged manifest
+// kept. The store is locked throughout, and its manifest is written last.
+func syncMirror(dir string) error {
+	s, err := mirrorStore(dir)
+	if err != nil {
+		return err
+	}
+	if err := s.check(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOffline, err)
+	}
+	unlock, err := lockStore(s)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	remoteFiles, err := s.list()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOffline, err)
+	}
+	theirs := make(map[string]*repoFile)
+	for _, p := range remoteFiles {
+		if strings.Contains(p, "/") {
+			continue
+		}
+		data, mode, err := s.read(p)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrOffline, err)
+		}
+		theirs[p] = &repoFile{data: data, mode: mode}
+	}
+	ours, err := localRoot(dir)
+	if err != nil {
+		return err
+	}
+	base, err := baseRoot(dir)
+	if err != nil {
+		return err
+	}
+	// Root files changed since the last sync but not committed, such as a
+	// manifest a restore just recorded, count as changes too.
+	pending := mirrorPending(dir)
+	changed := len(pending) > 0 || !sameFiles(ours, base)
+
+	baseMf, oursMf, theirsMf := rootManifest(base), rootManifest(ours), rootManifest(theirs)
+	merged := theirsMf
+	if changed {
+		if fileData(theirs[manifestFile]) != nil && !bytes.Equal(fileData(theirs[manifestFile]), fileData(base[manifestFile])) {
+			merged, _ = manifest.Merge(baseMf, theirsMf, oursMf)
+		} else {
+			merged = oursMf
+		}
+	}
+
+	// Decide entry by entry which side's content goes where.
+	var upload, download, owned []string
+	for key, ev := range merged.Entries {
+		keyDir, ok := storage.KeyDir(key)
+		if !ok {
+			continue
+		}
+		keyDir = filepath.ToSlash(keyDir)
+		owned = append(owned, keyDir)
+		o, inOurs := oursMf.Entries[key]
+		b, inBase := baseMf.Entries[key]
+		t, inTheirs := theirsMf.Entries[key]
+		switch {
+		case changed && inOurs && !sameContent(o, inOurs, b, inBase) && ev.ContentHash == o.ContentHash:
+			upload = append(upload, keyDir)
+		case !sameContent(t, inTheirs, b, inBase):
+			download = append(download, keyDir)
+		}
+	}
+
+	// Write the store: content first, then the root files, the manifest
+	// last so no device reads a manifest ahead of its content.
+	wrote := false
+	if changed {
+		for _, p := range remoteFiles {
+			if isContent(p) && (!within(p, owned) || within(p, upload)) {
+				if err := s.remove(p); err != nil {
+					return err
+				}
+				wrote = true
+			}
+		}
+		for _, keyDir := range upload {
+			files, err := localFiles(dir, keyDir)
+			if err != nil {
+				return err
+			}
+			for _, p := range files {
+				data, mode, err := readFileMode(filepath.Join(dir, filepath.FromSlash(p)))
+				if err != nil {
+					return err
+				}
+				if err := s.write(p, data, mode); err != nil {
+					return err
+				}
+				wrote = true
+			}
+		}
+	}
+
+	final := make(map[string]*repoFile)
+	for _, name := range rootNames(base, ours, theirs) {
+		switch {
+		case name == manifestFile:
+			continue
+		case name == devices.FileName && changed:
+			reg := devices.Merge(rootRegistry(base), rootRegistry(theirs), rootRegistry(ours))
+			if err := reg.SaveFile(filepath.Join(dir, devices.FileName)); err != nil {
+				return err
+			}
+			data, err := os.ReadFile(filepath.Join(dir, devices.FileName))
+			if err != nil {
+				return err
+			}
+			final[name] = &repoFile{data: data, mode: 0644}
+		case changed && !sameFile(ours[name], base[name]):
+			final[name] = ours[name]
+		default:
+			final[name] = theirs[name]
+		}
+		if !changed || sameFile(final[name], theirs[name]) {
+			continue
+		}
+		if final[name] == nil {
+			err = s.remove(name)
+		} else {
+			err = s.write(name, final[name].data, final[name].mode)
+		}
+		if err != nil {
+			return err
+		}
+		wrote = true
+	}
+
+	if changed || fileData(theirs[manifestFile]) != nil {
+		if err := merged.SaveFile(filepath.Join(dir, manifestFile)); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+		if err != nil {
+			return err
+		}
+		final[manifestFile] = &repoFile{data: data, mode: 0644}
+	}
+	if changed && !sameFile(final[manifestFile], theirs[manifestFile]) {
+		if err := s.putManifest(final[manifestFile].data, fileData(theirs[manifestFile])); err != nil {
+			return err
+		}
+		wrote = true
+	}
+	if wrote {
+		if err := s.snapshot(strings.Join(pending, "\n")); err != nil {
+			return fmt.Errorf("keeping a snapshot: %w", err)
+		}
+	}
+
+	// Then the mirror: the store's content where it is newer, and nothing
+	// the manifest doesn't own.
+	local, err := localFiles(dir, "")
+	if err != nil {
+		return err
+	}
+	for _, p := range local {
+		if isContent(p) && (!within(p, owned) || within(p, download)) {
+			full := filepath.Join(dir, filepath.FromSlash(p))
+			if err := os.Remove(full); err != nil {
+				return err
+			}
+			pruneEmptyDirs(dir, filepath.Dir(full))
+		}
+	}
+	for _, p := range remoteFiles {
+		if !within(p, download) {
+			continue
+		}
+		data, mode, err := s.read(p)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrOffline, err)
+		}
+		if err := writeFile(filepath.Join(dir, filepath.FromSlash(p)), data, mode); err != nil {
+			return err
+		}
+	}
+	for name, f := range final {
+		full := filepath.Join(dir, name)
+		if f == nil {
+			_ = os.Remove(full)
+		} else if err := writeFile(full, f.data, f.mode); err != nil {
+			return err
+		}
+	}
+	return saveBase(dir, final)
+}
+
+// lockStore takes the store's lock, waiting a little for another device
+// to finish.
+func lockStore(s store) (func(), error) {
+	for attempt := 0; ; attempt++ {
+		unlock, err := s.lock(devices.Hostname())
+		var locked *LockedError
+		if !errors.As(err, &locked) || attempt == 10 {
+			return unlock, err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// saveBase records the root files as synced and clears the pending queue.
+func saveBase(dir string, files map[string]*repoFile) error {
+	baseDir := filepath.Join(dir, mirrorDir, "base")
+	if err := os.RemoveAll(baseDir); err != nil {
+		return err
+	}
+	for name, f := range files {
+		if f == nil {
+			continue
+		}
+		if err := writeFile(filepath.Join(baseDir, name), f.data, f.mode); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, mirrorDir, "pending")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, mirrorDir, "fetched"), nil, 0644)
+}
+
+// discardMirror is DiscardUnpushed for a mirror: drop queued changes and
+// take the store's state.
+func discardMirror(dir string) error {
+	s, err := mirrorStore(dir)
+	if err != nil {
+		return err
+	}
+	if err := s.check(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOffline, err)
+	}
+	if err := clearMirror(dir); err != nil {
+		return err
+	}
+	return syncMirror(dir)
+}
+
+// clearMirror removes everything from the mirror but its store URL, so the
+// next sync fetches the store's state afresh.
+func clearMirror(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() != mirrorDir {
+			if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range []string{"base", "pending", "fetched"} {
+		if err := os.RemoveAll(filepath.Join(dir, mirrorDir, name)); err != nil {
+			return err
+		}
+	}
+	return os.MkdirAll(filepath.Join(dir, mirrorDir, "base"), 0755)
+}
+
+// nukeMirror is NukeRepo for a mirror: empty the store and its history,
+// then sync the README left in the mirror.
+func nukeMirror(dir string, readme []byte) error {
+	s, err := mirrorStore(dir)
+	if err != nil {
+		return err
+	}
+	if err := s.check(); err != nil {
+		return err
+	}
+	unlock, err := lockStore(s)
+	if err != nil {
+		return err
+	}
+	err = s.wipe()
+	unlock()
+	if err != nil {
+		return fmt.Errorf("wiping %s: %w", s, err)
+	}
+	if err := clearMirror(dir); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), readme, 0644); err != nil {
+		return err
+	}
+	if _, err := commitMirror(dir, "Reset repo — wiped by dfc"); err != nil {
+		return err
+	}
+	return syncMirror(dir)
+}
+
+// mirrorFetched is LastFetched for a mirror.
+func mirrorFetched(dir string) time.Time {
+	info, err := os.Stat(filepath.Join(dir, mirrorDir, "fetched"))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// sameContent reports whether two manifest records, present or not, are
+// for the same content.
+func sameContent(a manifest.EntryVersion, aok bool, b manifest.EntryVersion, bok bool) bool {
+	return aok == bok && a.Version == b.Version && a.ContentHash == b.ContentHash
+}
+
+// isContent reports whether a repo path is entry content, as opposed to a
+// file in the repo root.
+func isContent(p string) bool {
+	top, _, _ := strings.Cut(p, "/")
+	return top == "shared" || top == "profiles" || top == "variants"
+}
+
+// within reports whether p is one of dirs or inside one.
+func within(p string, dirs []string) bool {
+	for _, d := range dirs {
+		if p == d || strings.HasPrefix(p, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// localFiles lists the files in the mirror under rel ("" for all), as
+// slash-separated repo paths, leaving out the sync state.
+func localFiles(dir, rel string) ([]string, error) {
+	var files []string
+	root := filepath.Join(dir, filepath.FromSlash(rel))
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != root && (d.Name() == mirrorDir || d.Name() == ".git") && filepath.Dir(path) == dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		p, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(p))
+		return nil
+	})
+	return files, err
+}
+
+// localRoot reads the files in the mirror's root.
+func localRoot(dir string) (map[string]*repoFile, error) {
+	return readRoot(dir)
+}
+
+// baseRoot reads the root files as of the last sync.
+func baseRoot(dir string) (map[string]*repoFile, error) {
+	return readRoot(filepath.Join(dir, mirrorDir, "base"))
+}
+
+func readRoot(dir string) (map[string]*repoFile, error) {
+	files := make(map[string]*repoFile)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, mode, err := readFileMode(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[e.Name()] = &repoFile{data: data, mode: mode}
+	}
+	return files, nil
+}
+
+func rootNames(sets ...map[string]*repoFile) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, set := range sets {
+		for name := range set {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func rootManifest(files map[string]*repoFile) *manifest.Manifest {
+	mf, err := manifest.Parse(fileData(files[manifestFile]))
+	if err != nil {
+		return &manifest.Manifest{Entries: make(map[string]manifest.EntryVersion)}
+	}
+	return mf
+}
+
+func rootRegistry(files map[string]*repoFile) *devices.Registry {
+	reg, err := devices.Parse(fileData(files[devices.FileName]))
+	if err != nil {
+		return &devices.Registry{Devices: make(map[string]*devices.Device)}
+	}
+	return reg
+}
+
+func fileData(f *repoFile) []byte {
+	if f == nil {
+		return nil
+	}
+	return f.data
+}
+
+func sameFile(a, b *repoFile) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return bytes.Equal(a.data, b.data) && a.mode.Type() == b.mode.Type()
+}
+
+func sameFiles(a, b map[string]*repoFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, f := range a {
+		if !sameFile(f, b[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// repoFile is a file's content and mode. The content of a symlink is its
+// target.
+type repoFile struct {
+	data []byte
+	mode fs.FileMode
+}
+
+// readFileMode reads a file, or the target of a symlink.
+func readFileMode(path string) ([]byte, fs.FileMode, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		return []byte(target), info.Mode(), err
+	}
+	data, err := os.ReadFile(path)
+	return data, info.Mode(), err
+}
+
+// writeFile writes a file, or a symlink to data, creating parent
+// directories and replacing what was there.
+func writeFile(path string, data []byte, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	_ = os.Remove(path)
+	if mode&fs.ModeSymlink != 0 {
+		return os.Symlink(string(data), path)
+	}
+	perm := fs.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	return os.WriteFile(path, data, perm)
+}
@@ -0,0 +1,178 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+// testMirrors sets up a directory store and n synced mirrors of it.
+func testMirrors(t *testing.T, n int) (store string, mirrors []string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	store = filepath.Join(t.TempDir(), "usb")
+	if err := initDirStore(store); err != nil {
+		t.Fatal(err)
+	}
+	for i := range n {
+		dir := filepath.Join(t.TempDir(), string(rune('a'+i)))
+		if err := initMirror(dir, dirPrefix+store); err != nil {
+			t.Fatal(err)
+		}
+		syncT(t, dir)
+		mirrors = append(mirrors, dir)
+	}
+	return store, mirrors
+}
+
+func syncT(t *testing.T, dir string) {
+	t.Helper()
+	if err := syncMirror(dir); err != nil {
+		t.Fatalf("sync %s: %v", filepath.Base(dir), err)
+	}
+}
+
+// backUpT records a backup of key in a mirror the way backup does: files
+// (repo path → content, "" to delete) are written, the manifest records
+// version, and the change is committed for the next sync. A nil
+// manifest.EntryVersion pointer retires key instead.
+func backUpT(t *testing.T, dir, key string, ev *manifest.EntryVersion, files map[string]string) {
+	t.Helper()
+	mf, err := manifest.LoadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev == nil {
+		delete(mf.Entries, key)
+	} else {
+		mf.Entries[key] = *ev
+	}
+	if err := mf.SaveFile(filepath.Join(dir, manifestFile)); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if content == "" {
+			if err := os.RemoveAll(path); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		writeT(t, dir, map[string]string{name: content})
+	}
+	if _, err := commitMirror(dir, "backup "+key); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wantFiles checks which of paths exist under root.
+func wantFiles(t *testing.T, root string, want map[string]bool) {
+	t.Helper()
+	for p, exists := range want {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(p)))
+		if exists != (err == nil) {
+			t.Errorf("%s in %s: exists %t, want %t", p, filepath.Base(root), err == nil, exists)
+		}
+	}
+}
+
+func TestSyncMirrorDeletes(t *testing.T) {
+	const zshrc, vimrc, nvim = "shared/~/.zshrc", "shared/~/.vimrc", "shared/~/.config/nvim"
+	v := func(version int, hash string) *manifest.EntryVersion {
+		return &manifest.EntryVersion{Version: version, ContentHash: hash}
+	}
+
+	for _, tc := range []struct {
+		name string
+		run  func(t *testing.T, store string, a, b string)
+		// files that must (true) or must not (false) be in the store and,
+		// after it syncs, in mirror b
+		store, mirror map[string]bool
+	}{
+		{
+			name: "another device's new entry survives a stale mirror's sync",
+			run: func(t *testing.T, store, a, b string) {
+				backUpT(t, a, zshrc, v(1, "z1"), map[string]string{"shared/.zshrc": "a\n"})
+				syncT(t, a)
+				backUpT(t, b, vimrc, v(1, "v1"), map[string]string{"shared/.vimrc": "b\n"})
+				syncT(t, b)
+			},
+			store:  map[string]bool{"shared/.zshrc": true, "shared/.vimrc": true},
+			mirror: map[string]bool{"shared/.zshrc": true, "shared/.vimrc": true},
+		},
+		{
+			name: "a retired entry goes from the store and other mirrors",
+			run: func(t *testing.T, store, a, b string) {
+				backUpT(t, a, zshrc, v(1, "z1"), map[string]string{"shared/.zshrc": "a\n"})
+				backUpT(t, a, vimrc, v(1, "v1"), map[string]string{"shared/.vimrc": "a\n"})
+				syncT(t, a)
+				syncT(t, b)
+				backUpT(t, a, vimrc, nil, map[string]string{"shared/.vimrc": ""})
+				syncT(t, a)
+				syncT(t, b)
+			},
+			store:  map[string]bool{"shared/.zshrc": true, "shared/.vimrc": false},
+			mirror: map[string]bool{"shared/.zshrc": true, "shared/.vimrc": false},
+		},
+		{
+			name: "an entry changed here and retired there is kept",
+			run: func(t *testing.T, store, a, b string) {
+				backUpT(t, a, vimrc, v(1, "v1"), map[string]string{"shared/.vimrc": "a\n"})
+				syncT(t, a)
+				syncT(t, b)
+				backUpT(t, a, vimrc, nil, map[string]string{"shared/.vimrc": ""})
+				syncT(t, a)
+				backUpT(t, b, vimrc, v(2, "v2"), map[string]string{"shared/.vimrc": "b\n"})
+				syncT(t, b)
+			},
+			store:  map[string]bool{"shared/.vimrc": true},
+			mirror: map[string]bool{"shared/.vimrc": true},
+		},
+		{
+			name: "files dropped from an uploaded directory go",
+			run: func(t *testing.T, store, a, b string) {
+				backUpT(t, a, nvim, v(1, "n1"), map[string]string{
+					"shared/.config/nvim/init.lua": "1\n", "shared/.config/nvim/lua/plugins.lua": "1\n",
+				})
+				syncT(t, a)
+				syncT(t, b)
+				backUpT(t, a, nvim, v(2, "n2"), map[string]string{
+					"shared/.config/nvim/init.lua": "2\n", "shared/.config/nvim/lua": "",
+				})
+				syncT(t, a)
+				syncT(t, b)
+			},
+			store:  map[string]bool{"shared/.config/nvim/init.lua": true, "shared/.config/nvim/lua/plugins.lua": false, "shared/.config/nvim/lua": false},
+			mirror: map[string]bool{"shared/.config/nvim/init.lua": true, "shared/.config/nvim/lua/plugins.lua": false},
+		},
+		{
+			name: "content no manifest owns goes, files outside the layout stay",
+			run: func(t *testing.T, store, a, b string) {
+				writeT(t, store, map[string]string{
+					"shared/.stray":       "left by a crash\n",
+					"photos/cat.jpg":      "meow",
+					"shared-notes.txt":    "mine",
+					"profiles.bak/x.yaml": "mine",
+				})
+				backUpT(t, a, zshrc, v(1, "z1"), map[string]string{"shared/.zshrc": "a\n"})
+				syncT(t, a)
+				syncT(t, b)
+			},
+			store: map[string]bool{
+				"shared/.zshrc": true, "shared/.stray": false,
+				"photos/cat.jpg": true, "shared-notes.txt": true, "profiles.bak/x.yaml": true,
+			},
+			mirror: map[string]bool{"shared/.zshrc": true, "shared/.stray": false, "photos/cat.jpg": false},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store, m := testMirrors(t, 2)
+			tc.run(t, store, m[0], m[1])
+			wantFiles(t, store, tc.store)
+			syncT(t, m[1])
+			wantFiles(t, m[1], tc.mirror)
+		})
+	}
+}
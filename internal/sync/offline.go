@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/solarisjon/dfc/internal/config"
+)
+
+// ErrOffline wraps failures to reach the remote of an existing clone.
+// Backup and restore carry on against the local clone: backups are
+// committed locally and pushed on the next successful sync.
+var ErrOffline = errors.New("remote unreachable")
+
+// offline wraps a failed push or fetch in ErrOffline if the remote could
+// not be reached at all. A remote that answered and refused — bad
+// credentials, a protected branch, a hook declining the push — won't let
+// the work through later either, so that error is returned as it is.
+func offline(dir string, err error) error {
+	if unreachable(dir, err) {
+		return fmt.Errorf("%w: %v", ErrOffline, err)
+	}
+	return err
+}
+
+// unreachableOutput is what git prints (in the C locale, see gitEnv) when
+// it can't reach a remote, over HTTP or SSH.
+var unreachableOutput = []string{
+	"Could not resolve host",
+	"Could not resolve hostname",
+	"Temporary failure in name resolution",
+	"Failed to connect to",
+	"Connection refused",
+	"Connection timed out",
+	"Connection reset by peer",
+	"Operation timed out",
+	"Network is unreachable",
+	"No route to host",
+	"The requested URL returned error: 502",
+	"The requested URL returned error: 503",
+	"The requested URL returned error: 504",
+}
+
+// unreachable reports whether err is a failure to reach the remote of the
+// clone at dir: a network or server outage, or a local remote whose drive
+// isn't mounted.
+func unreachable(dir string, err error) bool {
+	if url := backend.remoteURL(dir); url != "" && IsLocalRemote(url) {
+		if _, statErr := os.Stat(LocalRemotePath(url)); statErr != nil {
+			return true
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// go-git reports HTTP errors other than 401, 403 and 404 this way.
+	var unexpected *plumbing.UnexpectedError
+	if errors.As(err, &unexpected) {
+		var httpErr *githttp.Err
+		if errors.As(unexpected.Err, &httpErr) && httpErr.StatusCode() >= 500 {
+			return true
+		}
+	}
+	var gitErr *GitError
+	if errors.As(err, &gitErr) {
+		for _, s := range unreachableOutput {
+			if strings.Contains(gitErr.Output, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TrackUnpushed records in cfg whether the clone has commits the remote
+// lacks, saving the config when that changes. Returns true if it does.
+func TrackUnpushed(cfg *config.Config) bool {
+	pending := HasUnpushed(cfg.RepoPath)
+	switch {
+	case pending && cfg.UnpushedSince.IsZero():
+		cfg.UnpushedSince = time.Now()
+	case !pending && !cfg.UnpushedSince.IsZero():
+		cfg.UnpushedSince = time.Time{}
+	default:
+		return pending
+	}
+	_ = cfg.Save()
+	return pending
+}
+
+// fetchedMarker is touched after every successful fetch. git's own
+// FETCH_HEAD is rewritten by failed fetches too.
+const fetchedMarker = "dfc-fetched"
+
+func markFetched(dir string) {
+	_ = os.WriteFile(filepath.Join(dir, ".git", fetchedMarker), nil, 0644)
+}
+
+// LastFetched returns when the clone last heard from the remote: the last
+// successful fetch, or failing that the time of the newest remote commit it
+// has. Zero if unknown.
+func LastFetched(localPath string) time.Time {
+	localPath = expandHome(localPath)
+	if isMirror(localPath) {
+		return mirrorFetched(localPath)
+	}
+	if info, err := os.Stat(filepath.Join(localPath, ".git", fetchedMarker)); err == nil {
+		return info.ModTime()
+	}
+	t, _ := backend.upstreamTime(localPath)
+	return t
+}
@@ -0,0 +1,196 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+)
+
+// pushAttempts bounds how often a rejected push is rebased and retried
+// while other devices keep pushing.
+const pushAttempts = 3
+
+// DivergedError means local commits could not be rebased onto the remote
+// because files outside any manifest entry conflict. The commits stay
+// local until the user resolves it.
+type DivergedError struct {
+	Files []string // repo paths that conflict
+}
+
+func (e *DivergedError) Error() string {
+	return "local commits conflict with the remote in " + strings.Join(e.Files, ", ")
+}
+
+// pushRebasing pushes the current branch. If the remote rejects the push
+// because another device pushed first, the local commits are rebased onto
+// the remote and the push is retried. Both backends report that as
+// git.ErrNonFastForwardUpdate.
+func pushRebasing(dir string) error {
+	var err error
+	for range pushAttempts {
+		if err = backend.push(dir, false); err == nil {
+			return nil
+		}
+		if !errors.Is(err, git.ErrNonFastForwardUpdate) {
+			return offline(dir, err)
+		}
+		if err := integrate(dir); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("git push: the remote kept changing, gave up after %d attempts: %w", pushAttempts, err)
+}
+
+// integrate brings the local branch up to date with its upstream: a
+// fast-forward when only the remote moved, a rebase of local commits when
+// both did. The manifest and device registry merge record by record (the
+// dfc merge driver, or replayCommits for the built-in backend); entry
+// content both sides changed goes to the copy the merged manifest kept.
+func integrate(dir string) error {
+	if err := backend.fetch(dir); err != nil {
+		return offline(dir, err)
+	}
+	markFetched(dir)
+	ahead, behind, err := backend.aheadBehind(dir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case behind == 0:
+		return nil
+	case ahead == 0:
+		return backend.fastForward(dir)
+	}
+	return backend.rebase(dir, ahead)
+}
+
+// resolveRebase continues a rebase that stopped on conflicting entry
+// content. Each conflicting file takes the side whose version the merged
+// manifest kept. commits bounds the number of stops, one per local commit.
+func resolveRebase(dir string, commits int) error {
+	for range commits {
+		out, _ := gitOutput(dir, "diff", "--name-only", "--diff-filter=U")
+		files := strings.Fields(out)
+		if len(files) == 0 {
+			return fmt.Errorf("rebasing onto the remote failed")
+		}
+		merged, err := manifest.LoadFile(filepath.Join(dir, manifestFile))
+		if err != nil {
+			return &DivergedError{Files: files}
+		}
+		replayed := revManifest(dir, "REBASE_HEAD")
+
+		var unresolved []string
+		for _, f := range files {
+			key, ok := keyFor(merged, f)
+			if !ok {
+				unresolved = append(unresolved, f)
+				continue
+			}
+			// During a rebase --ours is the remote, --theirs the local commit.
+			side := "--ours"
+			if merged.Entries[key].ContentHash == replayed.Entries[key].ContentHash {
+				side = "--theirs"
+			}
+			if err := gitCmd(dir, "checkout", side, "--", f); err != nil {
+				_ = gitCmd(dir, "rm", "-q", "--", f) // deleted on that side
+				continue
+			}
+			_ = gitCmd(dir, "add", "--", f)
+		}
+		if len(unresolved) > 0 {
+			return &DivergedError{Files: unresolved}
+		}
+		if err := gitCmd(dir, "-c", "core.editor=true", "rebase", "--continue"); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("rebasing onto the remote failed")
+}
+
+// settleContested makes the content of every entry that both sides backed
+// up match the copy the merged manifest kept. git merges the two copies
+// file by file, which for a directory can leave a mix of both. local is
+// the branch head before the rebase. Any fix is folded into the last
+// rebased commit.
+func settleContested(dir, local string) error {
+	merged, err := manifest.LoadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return err
+	}
+	remote := revManifest(dir, "@{u}")
+	mine := revManifest(dir, local)
+
+	for key, ev := range merged.Entries {
+		if ev.Conflict == "" || ev.Conflict == remote.Entries[key].Conflict {
+			continue // not contested in this rebase
+		}
+		keyDir, ok := storage.KeyDir(key)
+		if !ok {
+			continue
+		}
+		rev := "@{u}"
+		if ev.ContentHash == mine.Entries[key].ContentHash {
+			rev = local
+		}
+		_ = gitCmd(dir, "rm", "-r", "-q", "--ignore-unmatch", "--", keyDir)
+		_ = os.RemoveAll(filepath.Join(dir, keyDir))
+		_ = gitCmd(dir, "checkout", rev, "--", keyDir)
+	}
+	if err := gitCmd(dir, "diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+	return gitCmd(dir, "commit", "-q", "--amend", "--no-edit")
+}
+
+// keyFor returns the manifest key whose repo content contains file.
+func keyFor(mf *manifest.Manifest, file string) (string, bool) {
+	var best, bestDir string
+	for key := range mf.Entries {
+		d, ok := storage.KeyDir(key)
+		if !ok {
+			continue
+		}
+		d = filepath.ToSlash(d)
+		if (file == d || strings.HasPrefix(file, d+"/")) && len(d) > len(bestDir) {
+			best, bestDir = key, d
+		}
+	}
+	return best, best != ""
+}
+
+// revManifest reads the manifest as of a revision. Missing or unreadable
+// manifests are empty.
+func revManifest(dir, rev string) *manifest.Manifest {
+	out, err := backend.show(dir, rev, manifestFile)
+	if err != nil {
+		return &manifest.Manifest{Entries: make(map[string]manifest.EntryVersion)}
+	}
+	mf, err := manifest.Parse(out)
+	if err != nil {
+		return &manifest.Manifest{Entries: make(map[string]manifest.EntryVersion)}
+	}
+	return mf
+}
+
+// DiscardUnpushed drops local commits that are not on the remote, resetting
+// the clone to the remote's state. Files outside the repo are untouched.
+func DiscardUnpushed(localPath string) error {
+	localPath = expandHome(localPath)
+	if isMirror(localPath) {
+		return discardMirror(localPath)
+	}
+	if err := backend.fetch(localPath); err != nil {
+		return offline(localPath, err)
+	}
+	if err := backend.resetHard(localPath); err != nil {
+		return fmt.Errorf("git reset: %w", err)
+	}
+	return nil
+}
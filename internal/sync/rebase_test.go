@@ -0,0 +1,288 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/manifest"
+	"gopkg.in/yaml.v3"
+)
+
+// TestMain lets the test binary stand in for dfc as the merge driver
+// installMergeDriver registers, which runs os.Executable().
+func TestMain(m *testing.M) {
+	if len(os.Args) == 6 && os.Args[1] == "merge-file" {
+		if err := mergeManifestFile(os.Args[2], os.Args[3], os.Args[4]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// mergeManifestFile does what dfc merge-file does for the manifest.
+func mergeManifestFile(base, ours, theirs string) error {
+	var mfs [3]*manifest.Manifest
+	for i, path := range []string{base, ours, theirs} {
+		mf, err := manifest.LoadFile(path)
+		if err != nil {
+			return err
+		}
+		mfs[i] = mf
+	}
+	merged, _ := manifest.Merge(mfs[0], mfs[1], mfs[2])
+	return merged.SaveFile(ours)
+}
+
+// gitT runs git in dir and returns its trimmed output, failing the test on
+// error.
+func gitT(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeT writes files (repo path → content) into dir.
+func writeT(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// commitT writes files into dir and commits them.
+func commitT(t *testing.T, dir, message string, files map[string]string) {
+	t.Helper()
+	writeT(t, dir, files)
+	gitT(t, dir, "add", "-A")
+	gitT(t, dir, "commit", "-q", "-m", message)
+}
+
+// testClones makes a bare remote holding files and n clones of it, with
+// git isolated from the user's configuration.
+func testClones(t *testing.T, n int, files map[string]string) []string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(k, "dfc test")
+	}
+	for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "dfc@example.com")
+	}
+
+	remote := filepath.Join(home, "remote.git")
+	gitT(t, home, "init", "-q", "--bare", "-b", "main", remote)
+	seed := filepath.Join(home, "seed")
+	gitT(t, home, "clone", "-q", remote, seed)
+	gitT(t, seed, "checkout", "-q", "-b", "main")
+	commitT(t, seed, "seed", files)
+	gitT(t, seed, "push", "-q", "-u", "origin", "main")
+
+	clones := make([]string, n)
+	for i := range clones {
+		clones[i] = filepath.Join(home, string(rune('a'+i)))
+		gitT(t, home, "clone", "-q", remote, clones[i])
+	}
+	return clones
+}
+
+func TestFastForwardRefusesDiverged(t *testing.T) {
+	for name, b := range map[string]gitBackend{"git": execGit{}, "builtin": goGit{}} {
+		t.Run(name, func(t *testing.T) {
+			c := testClones(t, 3, map[string]string{"shared/.zshrc": "v1\n"})
+			a, diverged, behind := c[0], c[1], c[2]
+			commitT(t, a, "remote change", map[string]string{"shared/.zshrc": "v2\n"})
+			gitT(t, a, "push", "-q")
+			commitT(t, diverged, "local change", map[string]string{"shared/.vimrc": "set nu\n"})
+			gitT(t, diverged, "fetch", "-q")
+			gitT(t, behind, "fetch", "-q")
+
+			head := gitT(t, diverged, "rev-parse", "HEAD")
+			if err := b.fastForward(diverged); err == nil {
+				t.Error("fast-forwarded a branch with local commits")
+			}
+			if got := gitT(t, diverged, "rev-parse", "HEAD"); got != head {
+				t.Errorf("HEAD moved from %s to %s", head, got)
+			}
+
+			if err := b.fastForward(behind); err != nil {
+				t.Fatalf("fast-forward: %v", err)
+			}
+			if got, want := gitT(t, behind, "rev-parse", "HEAD"), gitT(t, behind, "rev-parse", "@{u}"); got != want {
+				t.Errorf("HEAD = %s, want the upstream %s", got, want)
+			}
+			if data, _ := os.ReadFile(filepath.Join(behind, "shared/.zshrc")); string(data) != "v2\n" {
+				t.Errorf("worktree has %q, want the upstream's", data)
+			}
+		})
+	}
+}
+
+// backedUp commits files as a backup of key by host at minute at, recording
+// hash as its content in the manifest.
+func backedUp(t *testing.T, dir, key, hash, host string, version, at int, files map[string]string) {
+	t.Helper()
+	mf, err := manifest.LoadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf.Entries[key] = manifest.EntryVersion{Version: version, ContentHash: hash, UpdatedBy: host,
+		UpdatedAt: time.Date(2026, 1, 1, 0, at, 0, 0, time.UTC)}
+	if err := mf.SaveFile(filepath.Join(dir, manifestFile)); err != nil {
+		t.Fatal(err)
+	}
+	commitT(t, dir, "backup on "+host, files)
+}
+
+// rebaseClones seeds a remote with the manifest and files, and returns a
+// clone that pushed a backup by desktop and one with a local backup by
+// laptop, fetched but not yet rebased, using the git binary and dfc's
+// merge driver.
+func rebaseClones(t *testing.T, key string, files map[string]string, remote, local func(dir string)) (pushed, rebasing string) {
+	t.Helper()
+	old := backend
+	backend = execGit{}
+	t.Cleanup(func() { backend = old })
+
+	seed := map[string]string{}
+	for name, content := range files {
+		seed[name] = content
+	}
+	mf := &manifest.Manifest{Entries: map[string]manifest.EntryVersion{key: {Version: 1, ContentHash: "h1"}}}
+	data, err := yaml.Marshal(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed[manifestFile] = string(data)
+
+	c := testClones(t, 2, seed)
+	pushed, rebasing = c[0], c[1]
+	installMergeDriver(rebasing)
+	remote(pushed)
+	gitT(t, pushed, "push", "-q")
+	local(rebasing)
+	gitT(t, rebasing, "fetch", "-q")
+	return pushed, rebasing
+}
+
+func TestRebaseKeepsTheMergedManifestsCopy(t *testing.T) {
+	const key = "shared/~/.zshrc"
+	for _, tc := range []struct {
+		name          string
+		remoteAt      int // minute of the remote's backup; the later one wins
+		want, version string
+	}{
+		{"local copy is newer", 1, "laptop\n", "h-laptop"},
+		{"remote copy is newer", 9, "desktop\n", "h-desktop"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, dir := rebaseClones(t, key, map[string]string{"shared/.zshrc": "seed\n"},
+				func(dir string) {
+					backedUp(t, dir, key, "h-desktop", "desktop", 2, tc.remoteAt, map[string]string{"shared/.zshrc": "desktop\n"})
+				},
+				func(dir string) {
+					backedUp(t, dir, key, "h-laptop", "laptop", 2, 5, map[string]string{"shared/.zshrc": "laptop\n"})
+				})
+
+			if err := backend.rebase(dir, 1); err != nil {
+				t.Fatalf("rebase: %v", err)
+			}
+			if got := gitT(t, dir, "status", "--porcelain"); got != "" {
+				t.Errorf("worktree not clean after the rebase:\n%s", got)
+			}
+			if got := gitT(t, dir, "rev-list", "--count", "@{u}..HEAD"); got != "1" {
+				t.Errorf("%s local commits on top of the remote, want 1", got)
+			}
+			if data, _ := os.ReadFile(filepath.Join(dir, "shared/.zshrc")); string(data) != tc.want {
+				t.Errorf("content is %q, want %q", data, tc.want)
+			}
+			mf, err := manifest.LoadFile(filepath.Join(dir, manifestFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev := mf.Entries[key]; ev.ContentHash != tc.version || ev.Version != 3 || ev.Conflict == "" {
+				t.Errorf("manifest has %+v, want %s as a flagged v3", ev, tc.version)
+			}
+		})
+	}
+}
+
+// git merges a directory entry file by file; the rebase must leave only the
+// winning copy, not a mix of both.
+func TestRebaseDoesNotMixDirectoryCopies(t *testing.T) {
+	const key = "shared/~/.config/nvim"
+	seed := map[string]string{"shared/.config/nvim/init.lua": "seed\n", "shared/.config/nvim/plugins.lua": "seed\n"}
+	for _, tc := range []struct {
+		name     string
+		remoteAt int
+		want     map[string]string
+	}{
+		{"local copy is newer", 1, map[string]string{"init.lua": "seed\n", "plugins.lua": "laptop\n"}},
+		{"remote copy is newer", 9, map[string]string{"init.lua": "desktop\n", "plugins.lua": "seed\n"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, dir := rebaseClones(t, key, seed,
+				func(dir string) {
+					backedUp(t, dir, key, "h-desktop", "desktop", 2, tc.remoteAt, map[string]string{"shared/.config/nvim/init.lua": "desktop\n"})
+				},
+				func(dir string) {
+					backedUp(t, dir, key, "h-laptop", "laptop", 2, 5, map[string]string{"shared/.config/nvim/plugins.lua": "laptop\n"})
+				})
+
+			if err := backend.rebase(dir, 1); err != nil {
+				t.Fatalf("rebase: %v", err)
+			}
+			for name, want := range tc.want {
+				if data, _ := os.ReadFile(filepath.Join(dir, "shared/.config/nvim", name)); string(data) != want {
+					t.Errorf("%s is %q, want %q", name, data, want)
+				}
+				committed := gitT(t, dir, "show", "HEAD:shared/.config/nvim/"+name)
+				if committed+"\n" != want {
+					t.Errorf("%s committed as %q, want %q", name, committed, want)
+				}
+			}
+		})
+	}
+}
+
+// Conflicts outside any entry are left for the user, with the local commits
+// untouched.
+func TestRebaseStopsOnFilesOutsideEntries(t *testing.T) {
+	const key = "shared/~/.zshrc"
+	_, dir := rebaseClones(t, key, map[string]string{"shared/.zshrc": "seed\n", "README.md": "seed\n"},
+		func(dir string) { commitT(t, dir, "edit readme", map[string]string{"README.md": "desktop\n"}) },
+		func(dir string) { commitT(t, dir, "edit readme", map[string]string{"README.md": "laptop\n"}) })
+	head := gitT(t, dir, "rev-parse", "HEAD")
+
+	err := backend.rebase(dir, 1)
+	var diverged *DivergedError
+	if !errors.As(err, &diverged) || len(diverged.Files) != 1 || diverged.Files[0] != "README.md" {
+		t.Fatalf("rebase: got %v, want a DivergedError for README.md", err)
+	}
+	if got := gitT(t, dir, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD moved from %s to %s", head, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git", "rebase-merge")); !os.IsNotExist(err) {
+		t.Error("rebase left in progress")
+	}
+}
@@ -0,0 +1,210 @@
+package sync
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// NormalizeURL reduces a git remote URL to a canonical form for comparison,
+// so the SSH and HTTPS forms of a repo, a trailing ".git" or slash, and a
+// user name in the URL don't make it a different remote. Local paths and
+// file:// URLs become clean absolute paths.
+func NormalizeURL(raw string) string {
+	u := strings.TrimRight(strings.TrimSpace(raw), "/")
+	switch {
+	case IsDirStore(u):
+		return dirPrefix + DirStorePath(u)
+	case IsDedupStore(u):
+		return dedupPrefix + DedupStorePath(u)
+	case IsS3Store(u):
+		scheme, rest, _ := strings.Cut(u, "://")
+		host, path, _ := strings.Cut(rest, "/")
+		return scheme + "://" + strings.ToLower(host) + "/" + strings.Trim(path, "/")
+	case strings.HasPrefix(u, "file://"):
+		return cleanPath(strings.TrimPrefix(u, "file://"))
+	case strings.Contains(u, "://"):
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return u
+		}
+		return strings.ToLower(parsed.Hostname()) + "/" + trimRepoPath(parsed.Path)
+	case isSCPLike(u):
+		host, path, _ := strings.Cut(u, ":")
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+		return strings.ToLower(host) + "/" + trimRepoPath(path)
+	default:
+		return cleanPath(u)
+	}
+}
+
+// SameRemote reports whether two remote URLs name the same repo.
+func SameRemote(a, b string) bool {
+	return NormalizeURL(a) == NormalizeURL(b)
+}
+
+// isSCPLike reports whether u is git's scp-like syntax, [user@]host:path.
+// As in git, a colon after the first slash makes it a local path, and so
+// does a single letter before it (a Windows drive).
+func isSCPLike(u string) bool {
+	colon := strings.Index(u, ":")
+	slash := strings.Index(u, "/")
+	return colon > 1 && (slash < 0 || colon < slash)
+}
+
+// IsGitHubURL reports whether a remote URL points at github.com, where the
+// GitHub CLI can handle authentication.
+func IsGitHubURL(u string) bool {
+	return !IsLocalRemote(u) && strings.HasPrefix(NormalizeURL(u), "github.com/")
+}
+
+// IsLocalRemote reports whether a remote URL is a path on this machine
+// (including a mounted NAS share) or a file:// URL.
+func IsLocalRemote(u string) bool {
+	u = strings.TrimSpace(u)
+	return strings.HasPrefix(u, "file://") || (!strings.Contains(u, "://") && !isSCPLike(u))
+}
+
+// LocalRemotePath returns the absolute directory a local remote URL names.
+func LocalRemotePath(u string) string {
+	return cleanPath(strings.TrimPrefix(strings.TrimSpace(u), "file://"))
+}
+
+// CheckRemote verifies that url is a git repo this machine can read, like
+// git ls-remote. Credential prompts are disabled so an HTTPS remote without
+// stored credentials fails instead of waiting on the terminal. A store URL
+// must name a reachable store that was set up for dfc.
+func CheckRemote(url string) error {
+	if s, ok := storeFor(url); ok {
+		return s.check()
+	}
+	return backend.lsRemote(url)
+}
+
+// CanInitBare reports whether url is a local path where InitBareRepo can
+// create a remote: it doesn't exist yet or is an empty directory. A dir:
+// or dedup: store can be set up in any directory without repo files of its
+// own, and an S3 store in any bucket the credentials can create or write.
+func CanInitBare(url string) bool {
+	if IsS3Store(url) {
+		return true
+	}
+	if IsDirStore(url) || IsDedupStore(url) {
+		// Any existing directory, or a new one on an existing parent.
+		path := DirStorePath(url)
+		if IsDedupStore(url) {
+			path = DedupStorePath(url)
+		}
+		_, err := os.Stat(filepath.Dir(path))
+		return err == nil
+	}
+	if !IsLocalRemote(url) {
+		return false
+	}
+	entries, err := os.ReadDir(LocalRemotePath(url))
+	return os.IsNotExist(err) || (err == nil && len(entries) == 0)
+}
+
+// InitBareRepo creates an empty bare repo at a local remote URL, with main
+// as its default branch, for use as the dfc remote. For a dir:, dedup: or
+// S3 URL it sets up a store instead.
+func InitBareRepo(url string) error {
+	if IsDedupStore(url) {
+		return initDedupStore(DedupStorePath(url))
+	}
+	if IsS3Store(url) {
+		return initS3Store(url)
+	}
+	if IsDirStore(url) {
+		return initDirStore(DirStorePath(url))
+	}
+	path := LocalRemotePath(url)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	return backend.initBare(path)
+}
+
+func trimRepoPath(p string) string {
+	return strings.TrimSuffix(strings.Trim(p, "/"), ".git")
+}
+
+func cleanPath(p string) string {
+	p = expandHome(p)
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	return filepath.Clean(p)
+}
+
+// LocalWork describes what the clone holds that the remote doesn't:
+// unpushed commits, stashes and uncommitted files. Empty if the clone can
+// be deleted without losing anything.
+func LocalWork(localPath string) []string {
+	localPath = expandHome(localPath)
+	if _, err := os.Stat(localPath); os.IsNotExist(err) {
+		return nil
+	}
+	if isMirror(localPath) {
+		if n := len(mirrorPending(localPath)); n > 0 {
+			return []string{plural(n, "unsynced change")}
+		}
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(localPath, ".git")); err != nil {
+		entries, _ := os.ReadDir(localPath)
+		if len(entries) == 0 {
+			return nil
+		}
+		return []string{"files that are not in a git clone"}
+	}
+
+	var work []string
+	unpushed, stashes, dirty, err := backend.localWork(localPath)
+	if unpushed > 0 {
+		work = append(work, plural(unpushed, "unpushed commit"))
+	}
+	if stashes > 0 {
+		work = append(work, plural(stashes, "stash"))
+	}
+	switch {
+	case err != nil:
+		work = append(work, "a clone git can't read")
+	case dirty > 0:
+		work = append(work, plural(dirty, "uncommitted file"))
+	}
+	return work
+}
+
+func plural(n int, noun string) string {
+	switch {
+	case n == 1:
+		return "1 " + noun
+	case strings.HasSuffix(noun, "sh"):
+		return fmt.Sprintf("%d %ses", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// RemoveClone deletes the local clone, unless it holds work that exists
+// nowhere else (see LocalWork). Such a clone is moved aside to a dated
+// sibling directory instead, whose path is returned.
+func RemoveClone(localPath string) (string, error) {
+	localPath = expandHome(localPath)
+	if len(LocalWork(localPath)) == 0 {
+		if err := os.RemoveAll(localPath); err != nil {
+			return "", fmt.Errorf("removing %s: %w", localPath, err)
+		}
+		return "", nil
+	}
+	aside := localPath + ".old-" + time.Now().Format("20060102-150405")
+	if err := os.Rename(localPath, aside); err != nil {
+		return "", fmt.Errorf("moving %s aside: %w", localPath, err)
+	}
+	return aside, nil
+}
@@ -0,0 +1,397 @@
+package sync
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/solarisjon/dfc/internal/devices"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+)
+
+// replayCommits is the built-in backend's rebase: go-git has none. Local
+// commits are replayed one by one onto the upstream with the same rules
+// the git backend applies through its merge driver and resolveRebase —
+// the manifest and device registry merge record by record, and entry
+// content both sides changed goes to the copy the merged manifest kept.
+// Any other conflicting file leaves the branch as it was and returns a
+// DivergedError.
+func replayCommits(dir string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	head, err := r.Head()
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	up, err := upstream(r)
+	if err != nil {
+		return err
+	}
+	local, err := localCommits(r, head.Hash(), up.Hash())
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	stash, err := stashWorktree(w, dir)
+	if err != nil {
+		return err
+	}
+	cur, err := r.CommitObject(up.Hash())
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: cur.Hash, Mode: git.HardReset}); err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	curTree, err := cur.Tree()
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	stash.clear(dir, curTree)
+
+	for _, c := range local {
+		if err := replayCommit(r, dir, cur, c); err != nil {
+			_ = w.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset})
+			stash.restore(dir)
+			return err
+		}
+		committed, err := commitWorktree(r, c.Message, &c.Author)
+		if err != nil {
+			_ = w.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset})
+			stash.restore(dir)
+			return err
+		}
+		if !committed {
+			continue // the upstream already has this change
+		}
+		ref, err := r.Head()
+		if err != nil {
+			return &GitError{Op: "rebase", Err: err}
+		}
+		if cur, err = r.CommitObject(ref.Hash()); err != nil {
+			return &GitError{Op: "rebase", Err: err}
+		}
+	}
+	stash.restore(dir)
+	return nil
+}
+
+// localCommits lists the commits on head's first-parent line that upstream
+// lacks, oldest first.
+func localCommits(r *git.Repository, head, upstream plumbing.Hash) ([]*object.Commit, error) {
+	onUpstream, err := reachable(r, upstream)
+	if err != nil {
+		return nil, &GitError{Op: "rebase", Err: err}
+	}
+	var local []*object.Commit
+	for h := head; !onUpstream[h]; {
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return nil, &GitError{Op: "rebase", Err: err}
+		}
+		if c.NumParents() == 0 {
+			return nil, &GitError{Op: "rebase", Err: errors.New("the local branch shares no history with the remote")}
+		}
+		local = append(local, c)
+		h = c.ParentHashes[0]
+	}
+	for i, j := 0, len(local)-1; i < j; i, j = i+1, j-1 {
+		local[i], local[j] = local[j], local[i]
+	}
+	return local, nil
+}
+
+// replayCommit applies the changes c made to its parent onto the worktree,
+// which holds cur.
+func replayCommit(r *git.Repository, dir string, cur, c *object.Commit) error {
+	parent, err := c.Parent(0)
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+	trees, err := commitTrees(parent, c, cur)
+	if err != nil {
+		return err
+	}
+	pTree, cTree, curTree := trees[0], trees[1], trees[2]
+	changes, err := object.DiffTree(pTree, cTree)
+	if err != nil {
+		return &GitError{Op: "rebase", Err: err}
+	}
+
+	var contested []string
+	for _, ch := range changes {
+		path := ch.To.Name
+		if path == "" {
+			path = ch.From.Name
+		}
+		pe, ce, he := treeEntry(pTree, path), treeEntry(cTree, path), treeEntry(curTree, path)
+		switch {
+		case sameEntry(he, pe): // only c changed it
+			if err := checkoutEntry(r, dir, path, ce); err != nil {
+				return err
+			}
+		case sameEntry(he, ce): // both made the same change
+		default:
+			contested = append(contested, path)
+		}
+	}
+
+	// Merge the bookkeeping files first: which side wins contested entry
+	// content depends on the merged manifest.
+	var unresolved []string
+	for _, path := range contested {
+		switch path {
+		case manifestFile:
+			var mfs [3]*manifest.Manifest
+			for i, t := range trees {
+				mfs[i] = treeManifest(t)
+			}
+			merged, _ := manifest.Merge(mfs[0], mfs[2], mfs[1])
+			if err := merged.SaveFile(filepath.Join(dir, manifestFile)); err != nil {
+				return err
+			}
+		case devices.FileName:
+			var regs [3]*devices.Registry
+			for i, t := range trees {
+				regs[i] = treeRegistry(t)
+			}
+			if err := devices.Merge(regs[0], regs[2], regs[1]).SaveFile(filepath.Join(dir, devices.FileName)); err != nil {
+				return err
+			}
+		}
+	}
+	merged, err := manifest.LoadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		merged = &manifest.Manifest{Entries: make(map[string]manifest.EntryVersion)}
+	}
+	mine, remote := treeManifest(cTree), treeManifest(curTree)
+	for _, path := range contested {
+		if path == manifestFile || path == devices.FileName {
+			continue
+		}
+		key, ok := keyFor(merged, path)
+		if !ok {
+			unresolved = append(unresolved, path)
+			continue
+		}
+		if merged.Entries[key].ContentHash == mine.Entries[key].ContentHash {
+			if err := checkoutEntry(r, dir, path, treeEntry(cTree, path)); err != nil {
+				return err
+			}
+		}
+	}
+	if len(unresolved) > 0 {
+		return &DivergedError{Files: unresolved}
+	}
+
+	// Entry content both sides backed up goes whole to the kept copy, not
+	// a file-by-file mix of the two.
+	for key, ev := range merged.Entries {
+		if ev.Conflict == "" || ev.Conflict == remote.Entries[key].Conflict {
+			continue // not contested in this commit
+		}
+		keyDir, ok := storage.KeyDir(key)
+		if !ok {
+			continue
+		}
+		from := curTree
+		if ev.ContentHash == mine.Entries[key].ContentHash {
+			from = cTree
+		}
+		if err := checkoutDir(r, dir, from, filepath.ToSlash(keyDir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func commitTrees(commits ...*object.Commit) ([]*object.Tree, error) {
+	trees := make([]*object.Tree, len(commits))
+	for i, c := range commits {
+		t, err := c.Tree()
+		if err != nil {
+			return nil, &GitError{Op: "rebase", Err: err}
+		}
+		trees[i] = t
+	}
+	return trees, nil
+}
+
+// treeEntry looks up a file in a tree; nil if it isn't there.
+func treeEntry(t *object.Tree, path string) *object.TreeEntry {
+	e, err := t.FindEntry(path)
+	if err != nil {
+		return nil
+	}
+	return e
+}
+
+func sameEntry(a, b *object.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+// checkoutEntry writes a tree entry to the worktree, or removes the file
+// when e is nil.
+func checkoutEntry(r *git.Repository, dir, path string, e *object.TreeEntry) error {
+	full := filepath.Join(dir, filepath.FromSlash(path))
+	if e == nil {
+		if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		pruneEmptyDirs(dir, filepath.Dir(full))
+		return nil
+	}
+	blob, err := r.BlobObject(e.Hash)
+	if err != nil {
+		return &GitError{Op: "checkout", Err: err}
+	}
+	rd, err := blob.Reader()
+	if err != nil {
+		return &GitError{Op: "checkout", Err: err}
+	}
+	defer rd.Close()
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return &GitError{Op: "checkout", Err: err}
+	}
+	return writeWorktreeFile(full, data, e.Mode)
+}
+
+// checkoutDir replaces a file or directory in the worktree with its
+// version in t.
+func checkoutDir(r *git.Repository, dir string, t *object.Tree, path string) error {
+	full := filepath.Join(dir, filepath.FromSlash(path))
+	if err := os.RemoveAll(full); err != nil {
+		return err
+	}
+	return t.Files().ForEach(func(f *object.File) error {
+		if f.Name != path && !strings.HasPrefix(f.Name, path+"/") {
+			return nil
+		}
+		return checkoutEntry(r, dir, f.Name, &object.TreeEntry{Name: f.Name, Mode: f.Mode, Hash: f.Hash})
+	})
+}
+
+func writeWorktreeFile(full string, data []byte, mode filemode.FileMode) error {
+	switch mode {
+	case filemode.Symlink:
+		return writeFile(full, data, fs.ModeSymlink)
+	case filemode.Executable:
+		return writeFile(full, data, 0755)
+	}
+	return writeFile(full, data, 0644)
+}
+
+// pruneEmptyDirs removes empty directories from d up to, not including,
+// the repo root, as git does when a directory's last file goes.
+func pruneEmptyDirs(root, d string) {
+	for d != root && strings.HasPrefix(d, root) {
+		if os.Remove(d) != nil {
+			return
+		}
+		d = filepath.Dir(d)
+	}
+}
+
+// treeManifest reads the manifest in a tree. Missing or unreadable
+// manifests are empty.
+func treeManifest(t *object.Tree) *manifest.Manifest {
+	mf, err := manifest.Parse(treeFile(t, manifestFile))
+	if err != nil {
+		return &manifest.Manifest{Entries: make(map[string]manifest.EntryVersion)}
+	}
+	return mf
+}
+
+// treeRegistry reads the device registry in a tree. Missing or unreadable
+// registries are empty.
+func treeRegistry(t *object.Tree) *devices.Registry {
+	reg, err := devices.Parse(treeFile(t, devices.FileName))
+	if err != nil {
+		return &devices.Registry{Devices: make(map[string]*devices.Device)}
+	}
+	return reg
+}
+
+func treeFile(t *object.Tree, path string) []byte {
+	f, err := t.File(path)
+	if err != nil {
+		return nil
+	}
+	s, err := f.Contents()
+	if err != nil {
+		return nil
+	}
+	return []byte(s)
+}
+
+// worktreeStash holds uncommitted changes set aside while commits are
+// replayed. A nil entry is a deleted file.
+type worktreeStash map[string]*repoFile
+
+func stashWorktree(w *git.Worktree, dir string) (worktreeStash, error) {
+	status, err := w.Status()
+	if err != nil {
+		return nil, &GitError{Op: "stash", Err: err}
+	}
+	stash := make(worktreeStash)
+	for path, s := range status {
+		if s.Staging == git.Unmodified && s.Worktree == git.Unmodified {
+			continue
+		}
+		data, mode, err := readFileMode(filepath.Join(dir, filepath.FromSlash(path)))
+		switch {
+		case os.IsNotExist(err):
+			stash[path] = nil
+		case err != nil:
+			return nil, err
+		default:
+			stash[path] = &repoFile{data: data, mode: mode}
+		}
+	}
+	return stash, nil
+}
+
+// clear removes stashed files the reset to t left behind because t doesn't
+// track them, so they aren't committed with the replayed changes.
+func (s worktreeStash) clear(dir string, t *object.Tree) {
+	for path := range s {
+		if treeEntry(t, path) != nil {
+			continue // the reset restored it
+		}
+		full := filepath.Join(dir, filepath.FromSlash(path))
+		if _, err := os.Lstat(full); err == nil {
+			_ = os.Remove(full)
+			pruneEmptyDirs(dir, filepath.Dir(full))
+		}
+	}
+}
+
+// restore puts the stashed changes back over the worktree.
+func (s worktreeStash) restore(dir string) {
+	for path, f := range s {
+		full := filepath.Join(dir, filepath.FromSlash(path))
+		if f == nil {
+			_ = os.Remove(full)
+			pruneEmptyDirs(dir, filepath.Dir(full))
+			continue
+		}
+		_ = writeFile(full, f.data, f.mode)
+	}
+}
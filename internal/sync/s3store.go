@@ -0,0 +1,405 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"gopkg.in/yaml.v3"
+)
+
+// s3Prefixes mark a repo URL as a bucket in S3-compatible object storage:
+//
+//	s3://bucket/prefix                   Amazon S3
+//	s3+https://host[:port]/bucket/prefix another service, such as MinIO
+//	s3+http://host[:port]/bucket/prefix  the same without TLS
+var s3Prefixes = []string{"s3://", "s3+https://", "s3+http://"}
+
+// IsS3Store reports whether url names an S3 store.
+func IsS3Store(url string) bool {
+	url = strings.TrimSpace(url)
+	for _, p := range s3Prefixes {
+		if strings.HasPrefix(url, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// s3Timeout bounds each request, so an unreachable endpoint reads as
+// offline rather than hanging.
+const s3Timeout = 30 * time.Second
+
+// s3Store keeps the repo layout as objects under a prefix in a bucket.
+// Bucket versioning keeps every object's history; each sync that changes
+// the store also writes an index of the versions it left under
+// .dfc-snapshots, pruned by the same retention policy as a directory
+// store. The manifest and the lock are written with conditional requests,
+// so two devices can't overwrite each other's manifest.
+type s3Store struct {
+	url    string
+	client *minio.Client
+	bucket string
+	prefix string // "" or ending in "/"
+
+	etags map[string]string // of the objects read, for conditional writes
+	err   error             // connecting, reported by check
+}
+
+// parseS3URL splits an S3 store URL into its endpoint, bucket and prefix.
+func parseS3URL(raw string) (endpoint string, secure bool, bucket, prefix string, err error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", false, "", "", err
+	}
+	p := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "s3":
+		endpoint, secure, bucket = "s3.amazonaws.com", true, u.Host
+	case "s3+https", "s3+http":
+		endpoint, secure = u.Host, u.Scheme == "s3+https"
+		bucket, p, _ = strings.Cut(p, "/")
+	default:
+		return "", false, "", "", fmt.Errorf("%s is not an S3 URL", raw)
+	}
+	if endpoint == "" || bucket == "" {
+		return "", false, "", "", fmt.Errorf("%s: no bucket", raw)
+	}
+	if p != "" {
+		p += "/"
+	}
+	return endpoint, secure, bucket, p, nil
+}
+
+// newS3Store connects to the store url names. Credentials come from the
+// AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY environment, ~/.aws/credentials
+// (honouring AWS_PROFILE) or MINIO_ROOT_USER/MINIO_ROOT_PASSWORD, in that
+// order.
+func newS3Store(raw string) (*s3Store, error) {
+	endpoint, secure, bucket, prefix, err := parseS3URL(raw)
+	if err != nil {
+		return nil, err
+	}
+	opts := &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.EnvMinio{},
+		}),
+		Secure: secure,
+		Region: os.Getenv("AWS_REGION"),
+	}
+	if !strings.HasPrefix(strings.TrimSpace(raw), "s3://") {
+		opts.BucketLookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{url: raw, client: client, bucket: bucket, prefix: prefix, etags: make(map[string]string)}, nil
+}
+
+func (s *s3Store) String() string { return s.url }
+
+func (s *s3Store) key(p string) string { return s.prefix + p }
+
+func s3Context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s3Timeout)
+}
+
+func s3Code(err error) string {
+	return minio.ToErrorResponse(err).Code
+}
+
+func (s *s3Store) check() error {
+	if s.err != nil {
+		return s.err
+	}
+	ctx, cancel := s3Context()
+	defer cancel()
+	if _, err := s.client.StatObject(ctx, s.bucket, s.key(storeConfigFile), minio.StatObjectOptions{}); err != nil {
+		switch s3Code(err) {
+		case "NoSuchKey", "NoSuchBucket":
+			return fmt.Errorf("%s is not a dfc store", s.url)
+		}
+		return fmt.Errorf("%s: %w", s.url, err)
+	}
+	return nil
+}
+
+func (s *s3Store) config() storeConfig {
+	cfg := defaultStoreConfig
+	if data, _, err := s.read(storeConfigFile); err == nil {
+		_ = yaml.Unmarshal(data, &cfg)
+	}
+	return cfg
+}
+
+// lock creates the lock object only if there is none. A stale lock is
+// removed by version, so a lock another device takes meanwhile stays.
+func (s *s3Store) lock(owner string) (func(), error) {
+	data, _ := yaml.Marshal(lockInfo{Host: owner, PID: os.Getpid(), Since: time.Now()})
+	for {
+		opts := minio.PutObjectOptions{}
+		opts.SetMatchETagExcept("*")
+		info, err := s.put(storeLockFile, data, 0644, opts)
+		if err == nil {
+			// Removing the version written rather than the key keeps a
+			// versioned bucket from collecting a lock version and a delete
+			// marker every sync.
+			return func() {
+				ctx, cancel := s3Context()
+				defer cancel()
+				_ = s.client.RemoveObject(ctx, s.bucket, s.key(storeLockFile), minio.RemoveObjectOptions{VersionID: info.VersionID})
+			}, nil
+		}
+		if s3Code(err) != "PreconditionFailed" {
+			return nil, fmt.Errorf("locking %s: %w", s.url, err)
+		}
+
+		held, version, err := s.heldLock()
+		if s3Code(err) == "NoSuchKey" {
+			continue // just released
+		}
+		if err != nil || time.Since(held.Since) < lockStale {
+			return nil, &LockedError{Host: held.Host, Since: held.Since}
+		}
+		ctx, cancel := s3Context()
+		err = s.client.RemoveObject(ctx, s.bucket, s.key(storeLockFile), minio.RemoveObjectOptions{VersionID: version}) // stale
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("locking %s: %w", s.url, err)
+		}
+	}
+}
+
+// heldLock reads the current lock and its version.
+func (s *s3Store) heldLock() (lockInfo, string, error) {
+	var held lockInfo
+	ctx, cancel := s3Context()
+	defer cancel()
+	obj, err := s.client.GetObject(ctx, s.bucket, s.key(storeLockFile), minio.GetObjectOptions{})
+	if err != nil {
+		return held, "", err
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		return held, "", err
+	}
+	if raw, err := io.ReadAll(obj); err == nil {
+		_ = yaml.Unmarshal(raw, &held)
+	}
+	if held.Since.IsZero() {
+		held.Since = info.LastModified
+	}
+	return held, info.VersionID, nil
+}
+
+func (s *s3Store) list() ([]string, error) {
+	ctx, cancel := s3Context()
+	defer cancel()
+	var files []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		rel := strings.TrimPrefix(obj.Key, s.prefix)
+		if rel == storeConfigFile || rel == storeLockFile || strings.HasPrefix(rel, snapshotsDir+"/") {
+			continue
+		}
+		files = append(files, rel)
+	}
+	return files, nil
+}
+
+func (s *s3Store) read(p string) ([]byte, fs.FileMode, error) {
+	ctx, cancel := s3Context()
+	defer cancel()
+	obj, err := s.client.GetObject(ctx, s.bucket, s.key(p), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, 0, err
+	}
+	s.etags[p] = info.ETag
+	mode := fs.FileMode(0644)
+	if m, err := strconv.ParseUint(info.UserMetadata["Mode"], 8, 32); err == nil {
+		mode = fs.FileMode(m)
+	}
+	return data, mode, nil
+}
+
+// write stores the file mode as object metadata; a symlink's data is its
+// target, as in the repo.
+func (s *s3Store) write(p string, data []byte, mode fs.FileMode) error {
+	_, err := s.put(p, data, mode, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *s3Store) put(p string, data []byte, mode fs.FileMode, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	ctx, cancel := s3Context()
+	defer cancel()
+	opts.UserMetadata = map[string]string{"Mode": strconv.FormatUint(uint64(mode), 8)}
+	opts.ContentType = "application/octet-stream"
+	return s.client.PutObject(ctx, s.bucket, s.key(p), bytes.NewReader(data), int64(len(data)), opts)
+}
+
+// remove leaves a delete marker in a versioned bucket, so the content stays
+// in the history.
+func (s *s3Store) remove(p string) error {
+	ctx, cancel := s3Context()
+	defer cancel()
+	err := s.client.RemoveObject(ctx, s.bucket, s.key(p), minio.RemoveObjectOptions{})
+	if s3Code(err) == "NoSuchKey" {
+		return nil
+	}
+	return err
+}
+
+// putManifest writes the manifest only if it is still the version read at
+// the start of the sync, or still absent if there was none, so a device
+// that got around the lock can't be overwritten.
+func (s *s3Store) putManifest(data, prev []byte) error {
+	opts := minio.PutObjectOptions{}
+	if etag, ok := s.etags[manifestFile]; ok && prev != nil {
+		opts.SetMatchETag(etag)
+	} else {
+		opts.SetMatchETagExcept("*")
+	}
+	if _, err := s.put(manifestFile, data, 0644, opts); err != nil {
+		if s3Code(err) == "PreconditionFailed" {
+			return errStoreChanged
+		}
+		return err
+	}
+	return nil
+}
+
+// s3Snapshot is a snapshot index under .dfc-snapshots.
+type s3Snapshot struct {
+	Time     time.Time         `yaml:"time"`
+	Message  string            `yaml:"message,omitempty"`
+	Versions map[string]string `yaml:"versions"` // path -> object version ID
+}
+
+// snapshot records which version of each object the store holds now, then
+// drops the indexes the retention policy doesn't keep. Without bucket
+// versioning the index is kept but older versions are gone; lifecycle
+// rules on the bucket decide when noncurrent versions expire.
+func (s *s3Store) snapshot(message string) error {
+	keep := s.config().Snapshots
+	if keep.KeepLast <= 0 && keep.KeepDaily <= 0 {
+		return nil
+	}
+	ctx, cancel := s3Context()
+	defer cancel()
+	snap := s3Snapshot{Time: time.Now().UTC(), Message: message, Versions: make(map[string]string)}
+	var names []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true, WithVersions: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		rel := strings.TrimPrefix(obj.Key, s.prefix)
+		switch {
+		case strings.HasPrefix(rel, snapshotsDir+"/"):
+			if obj.IsLatest && !obj.IsDeleteMarker {
+				names = append(names, strings.TrimSuffix(path.Base(rel), ".yaml"))
+			}
+		case rel == storeConfigFile, rel == storeLockFile:
+		case obj.IsLatest && !obj.IsDeleteMarker:
+			snap.Versions[rel] = obj.VersionID
+		}
+	}
+	name := snapshotName(snap.Time)
+	for _, n := range names {
+		if n == name {
+			name += fmt.Sprintf("-%d", snap.Time.Nanosecond()) // two syncs in a second
+		}
+	}
+	data, err := yaml.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := s.write(snapshotsDir+"/"+name+".yaml", data, 0644); err != nil {
+		return err
+	}
+	for _, n := range keep.expired(append(names, name)) {
+		if err := s.remove(snapshotsDir + "/" + n + ".yaml"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wipe removes every version of the content and snapshots, keeping the
+// store's settings.
+func (s *s3Store) wipe() error {
+	ctx, cancel := s3Context()
+	defer cancel()
+	var errs []error
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix, Recursive: true, WithVersions: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		rel := strings.TrimPrefix(obj.Key, s.prefix)
+		if rel == storeConfigFile || rel == storeLockFile {
+			continue
+		}
+		errs = append(errs, s.client.RemoveObject(ctx, s.bucket, obj.Key, minio.RemoveObjectOptions{VersionID: obj.VersionID}))
+	}
+	return errors.Join(errs...)
+}
+
+// initS3Store sets up a bucket as a store: it creates the bucket if there
+// is none, turns on versioning and writes the default settings.
+func initS3Store(raw string) error {
+	s, err := newS3Store(raw)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := s3Context()
+	defer cancel()
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("checking bucket %s: %w", s.bucket, err)
+	}
+	if !exists {
+		if err := s.client.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{Region: os.Getenv("AWS_REGION")}); err != nil {
+			return fmt.Errorf("creating bucket %s: %w", s.bucket, err)
+		}
+	}
+	if err := s.client.EnableVersioning(ctx, s.bucket); err != nil {
+		return fmt.Errorf("turning on versioning for %s: %w", s.bucket, err)
+	}
+	if s.check() == nil {
+		return nil
+	}
+	data, err := yaml.Marshal(defaultStoreConfig)
+	if err != nil {
+		return err
+	}
+	header := "# dfc store: dotfiles synced by dfc (Dot File Commander).\n" +
+		"# Snapshots index the object versions of the newest keep_last syncs plus\n" +
+		"# the newest of each of the last keep_daily days; set both to 0 to keep\n" +
+		"# none. Old versions expire by the bucket's lifecycle rules.\n"
+	return s.write(storeConfigFile, append([]byte(header), data...), 0644)
+}
@@ -0,0 +1,390 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fakeS3 is a stand-in for an S3-compatible endpoint such as MinIO, with
+// what the store uses: path-style buckets, versioning, listing, and
+// conditional PUTs (If-Match, If-None-Match: *).
+type fakeS3 struct {
+	mu      gosync.Mutex
+	buckets map[string]*fakeBucket
+	seq     int
+}
+
+type fakeBucket struct {
+	versioning bool
+	objects    map[string][]*fakeVersion // oldest first
+}
+
+type fakeVersion struct {
+	id      string
+	data    []byte
+	meta    http.Header
+	etag    string
+	deleted bool
+	mod     time.Time
+}
+
+func (f *fakeS3) latest(b *fakeBucket, key string) *fakeVersion {
+	if vs := b.objects[key]; len(vs) > 0 {
+		return vs[len(vs)-1]
+	}
+	return nil
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+	b := f.buckets[name]
+	if key == "" {
+		f.serveBucket(w, r, name, b)
+		return
+	}
+	if b == nil {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	cur := f.latest(b, key)
+	exists := cur != nil && !cur.deleted
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		v := cur
+		if id := q.Get("versionId"); id != "" {
+			v = nil
+			for _, x := range b.objects[key] {
+				if x.id == id {
+					v = x
+				}
+			}
+		}
+		if v == nil || v.deleted {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		for k, vals := range v.meta {
+			w.Header()[k] = vals
+		}
+		w.Header().Set("ETag", `"`+v.etag+`"`)
+		w.Header().Set("Last-Modified", v.mod.UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(v.data)))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("x-amz-version-id", v.id)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(v.data)
+		}
+
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			s3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		if m := strings.Trim(r.Header.Get("If-Match"), `"`); m != "" && (!exists || m != cur.etag) {
+			s3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		var data []byte
+		if strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING") {
+			data = decodeAWSChunked(r.Body)
+		} else {
+			data, _ = io.ReadAll(r.Body)
+		}
+		meta := http.Header{}
+		for k, v := range r.Header {
+			if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+				meta[k] = v
+			}
+		}
+		sum := md5.Sum(data)
+		v := &fakeVersion{id: "null", data: data, meta: meta, etag: hex.EncodeToString(sum[:]), mod: time.Now()}
+		if b.versioning {
+			f.seq++
+			v.id = fmt.Sprintf("v%06d", f.seq)
+			b.objects[key] = append(b.objects[key], v)
+		} else {
+			b.objects[key] = []*fakeVersion{v}
+		}
+		w.Header().Set("ETag", `"`+v.etag+`"`)
+		w.Header().Set("x-amz-version-id", v.id)
+
+	case http.MethodDelete:
+		switch id := q.Get("versionId"); {
+		case id != "":
+			var keep []*fakeVersion
+			for _, x := range b.objects[key] {
+				if x.id != id {
+					keep = append(keep, x)
+				}
+			}
+			b.objects[key] = keep
+		case b.versioning:
+			f.seq++
+			b.objects[key] = append(b.objects[key], &fakeVersion{id: fmt.Sprintf("v%06d", f.seq), deleted: true, mod: time.Now()})
+		default:
+			delete(b.objects, key)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) serveBucket(w http.ResponseWriter, r *http.Request, name string, b *fakeBucket) {
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPut && q.Has("versioning"):
+		if b == nil {
+			s3Error(w, http.StatusNotFound, "NoSuchBucket")
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		b.versioning = bytes.Contains(body, []byte("Enabled"))
+		return
+	case r.Method == http.MethodPut:
+		if b == nil {
+			f.buckets[name] = &fakeBucket{objects: make(map[string][]*fakeVersion)}
+		}
+		return
+	case r.Method == http.MethodHead:
+		if b == nil {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	case q.Has("location"):
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></LocationConstraint>`)
+		return
+	case b == nil:
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	var keys []string
+	for k := range b.objects {
+		if strings.HasPrefix(k, q.Get("prefix")) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var out strings.Builder
+	if q.Has("versions") {
+		out.WriteString(`<?xml version="1.0" encoding="UTF-8"?><ListVersionsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>` + name + `</Name><IsTruncated>false</IsTruncated>`)
+		for _, k := range keys {
+			vs := b.objects[k]
+			for i := len(vs) - 1; i >= 0; i-- {
+				tag := "Version"
+				if vs[i].deleted {
+					tag = "DeleteMarker"
+				}
+				fmt.Fprintf(&out, "<%s><Key>%s</Key><VersionId>%s</VersionId><IsLatest>%v</IsLatest><LastModified>%s</LastModified><ETag>&quot;%s&quot;</ETag><Size>%d</Size></%s>",
+					tag, xmlText(k), vs[i].id, i == len(vs)-1, vs[i].mod.UTC().Format(time.RFC3339), vs[i].etag, len(vs[i].data), tag)
+			}
+		}
+		out.WriteString("</ListVersionsResult>")
+	} else {
+		out.WriteString(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Name>` + name + `</Name><IsTruncated>false</IsTruncated>`)
+		for _, k := range keys {
+			if v := f.latest(b, k); v != nil && !v.deleted {
+				fmt.Fprintf(&out, "<Contents><Key>%s</Key><LastModified>%s</LastModified><ETag>&quot;%s&quot;</ETag><Size>%d</Size></Contents>",
+					xmlText(k), v.mod.UTC().Format(time.RFC3339), v.etag, len(v.data))
+			}
+		}
+		out.WriteString("</ListBucketResult>")
+	}
+	fmt.Fprint(w, out.String())
+}
+
+// decodeAWSChunked reads a body sent with a streaming signature: hex size
+// lines, each followed by that many bytes.
+func decodeAWSChunked(r io.Reader) []byte {
+	br := bufio.NewReader(r)
+	var out []byte
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return out
+		}
+		size, _ := strconv.ParseInt(strings.SplitN(strings.TrimSpace(line), ";", 2)[0], 16, 64)
+		if size == 0 {
+			return out
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return out
+		}
+		out = append(out, chunk...)
+		_, _ = br.ReadString('\n')
+	}
+}
+
+func xmlText(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+// newFakeS3Store sets up a store on a fresh stand-in endpoint and returns
+// its URL, for opening it as several devices with newS3Store.
+func newFakeS3Store(t *testing.T) (string, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{buckets: make(map[string]*fakeBucket)}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "testsecret")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	url := "s3+http://" + strings.TrimPrefix(srv.URL, "http://") + "/dots/me"
+	if err := initS3Store(url); err != nil {
+		t.Fatalf("initS3Store: %v", err)
+	}
+	return url, fake
+}
+
+func openS3Store(t *testing.T, url string) *s3Store {
+	t.Helper()
+	s, err := newS3Store(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	return s
+}
+
+// Two devices sync at once: each read the manifest, and only the first to
+// write it succeeds. The other must re-read before writing.
+func TestS3PutManifestConcurrent(t *testing.T) {
+	url, _ := newFakeS3Store(t)
+	a, b := openS3Store(t, url), openS3Store(t, url)
+
+	// Neither saw a manifest: the first write creates it, the second must
+	// not replace it.
+	if err := a.putManifest([]byte("a1"), nil); err != nil {
+		t.Fatalf("first manifest: %v", err)
+	}
+	if err := b.putManifest([]byte("b1"), nil); !errors.Is(err, errStoreChanged) {
+		t.Fatalf("second first manifest: got %v, want errStoreChanged", err)
+	}
+
+	// Both read it; a writes first.
+	prevA, _, err := a.read(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevB, _, err := b.read(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.putManifest([]byte("a2"), prevA); err != nil {
+		t.Fatalf("a's update: %v", err)
+	}
+	if err := b.putManifest([]byte("b2"), prevB); !errors.Is(err, errStoreChanged) {
+		t.Fatalf("b's update over a's: got %v, want errStoreChanged", err)
+	}
+
+	// After reading again b can write.
+	prevB, _, err = b.read(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(prevB) != "a2" {
+		t.Fatalf("b read %q, want a's manifest", prevB)
+	}
+	if err := b.putManifest([]byte("b3"), prevB); err != nil {
+		t.Fatalf("b's update after re-reading: %v", err)
+	}
+	if data, _, _ := a.read(manifestFile); string(data) != "b3" {
+		t.Errorf("manifest is %q, want b3", data)
+	}
+}
+
+func TestS3Lock(t *testing.T) {
+	url, _ := newFakeS3Store(t)
+	a, b := openS3Store(t, url), openS3Store(t, url)
+
+	unlock, err := a.lock("laptop")
+	if err != nil {
+		t.Fatalf("a's lock: %v", err)
+	}
+	var locked *LockedError
+	if _, err := b.lock("desktop"); !errors.As(err, &locked) || locked.Host != "laptop" {
+		t.Fatalf("b's lock while a holds it: got %v, want LockedError by laptop", err)
+	}
+
+	unlock()
+	unlockB, err := b.lock("desktop")
+	if err != nil {
+		t.Fatalf("b's lock after a released it: %v", err)
+	}
+	unlockB()
+	if files, _ := a.list(); len(files) != 0 {
+		t.Errorf("store lists %v after unlocking, want nothing", files)
+	}
+}
+
+// A lock left by a device that died mid-sync is taken over once it is
+// older than lockStale; a recent one is not.
+func TestS3StaleLock(t *testing.T) {
+	leave := func(s *s3Store, since time.Time) {
+		t.Helper()
+		data, _ := yaml.Marshal(lockInfo{Host: "crashed", PID: 1, Since: since})
+		if err := s.write(storeLockFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	url, _ := newFakeS3Store(t)
+	s := openS3Store(t, url)
+	leave(s, time.Now().Add(-lockStale/2))
+	var locked *LockedError
+	if _, err := s.lock("laptop"); !errors.As(err, &locked) || locked.Host != "crashed" {
+		t.Fatalf("lock over a recent lock: got %v, want LockedError by crashed", err)
+	}
+
+	url, fake := newFakeS3Store(t)
+	s = openS3Store(t, url)
+	leave(s, time.Now().Add(-2*lockStale))
+	unlock, err := s.lock("laptop")
+	if err != nil {
+		t.Fatalf("lock over a stale lock: %v", err)
+	}
+	held, _, err := s.heldLock()
+	if err != nil || held.Host != "laptop" {
+		t.Fatalf("held lock is %+v, %v; want laptop's", held, err)
+	}
+	unlock()
+
+	// Both the stale lock and ours were removed by version, leaving no
+	// versions or delete markers behind in the versioned bucket.
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if vs := fake.buckets["dots"].objects["me/"+storeLockFile]; len(vs) != 0 {
+		t.Errorf("the lock has %d versions left, want none", len(vs))
+	}
+}
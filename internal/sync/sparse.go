@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gitconfig "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/storage"
+)
+
+// checkout is what clones hold, set with SetCheckout.
+var checkout struct {
+	sparse  bool   // check out only this device's content
+	partial bool   // clone without file contents, fetching them as needed
+	profile string // the device profile whose layers are checked out
+}
+
+// SetCheckout takes what clones hold from the config: with
+// sparse_checkout, only this device's content; with partial_clone, new
+// clones skip the file contents they don't check out. Call it again when
+// the device profile changes, then UpdateSparse.
+func SetCheckout(cfg *config.Config) {
+	checkout.sparse = cfg.SparseCheckout
+	checkout.partial = cfg.PartialClone
+	checkout.profile = cfg.DeviceProfile
+}
+
+// cloneArgs returns the git clone flags for the checkout settings.
+func cloneArgs() []string {
+	var args []string
+	if checkout.partial {
+		args = append(args, "--filter=blob:none")
+	}
+	if checkout.sparse {
+		args = append(args, "--sparse")
+	}
+	return args
+}
+
+// UpdateSparse narrows a clone to this device's content: everything except
+// profiles/ and variants/, plus the device profile's layers in each. Other
+// profiles' content stays in the repo but not on disk. It also widens a
+// sparse clone again once sparse_checkout is off. Needs the git binary.
+func UpdateSparse(localPath string) error {
+	localPath = expandHome(localPath)
+	if _, err := os.Stat(filepath.Join(localPath, ".git")); err != nil || isMirror(localPath) {
+		return nil // not cloned yet, or a store mirror
+	}
+	sparse := isSparse(localPath)
+	if _, ok := backend.(execGit); !ok {
+		if sparse {
+			return fmt.Errorf("%s is a sparse checkout, which needs the git binary — set git_backend to git", localPath)
+		}
+		return nil
+	}
+	if !checkout.sparse {
+		if sparse {
+			return gitCmd(localPath, "sparse-checkout", "disable")
+		}
+		return nil
+	}
+
+	dirs := sparseDirs(localPath)
+	if sparse {
+		out, _ := gitOutput(localPath, "sparse-checkout", "list")
+		current := lines(out)
+		sort.Strings(current)
+		if strings.Join(current, "\n") == strings.Join(dirs, "\n") {
+			return nil
+		}
+	}
+	return gitCmd(localPath, append([]string{"sparse-checkout", "set", "--cone"}, dirs...)...)
+}
+
+// CheckoutAll checks out every file of a sparse clone, for work on every
+// profile's content such as renaming or retiring an entry. The next sync
+// narrows the clone again. A partial clone fetches the missing contents.
+func CheckoutAll(localPath string) error {
+	localPath = expandHome(localPath)
+	if !isSparse(localPath) {
+		return nil
+	}
+	if _, ok := backend.(execGit); !ok {
+		return fmt.Errorf("%s is a sparse checkout, which needs the git binary — set git_backend to git", localPath)
+	}
+	return gitCmd(localPath, "sparse-checkout", "disable")
+}
+
+// sparseDirs returns the directories a sparse clone checks out, sorted:
+// every top-level directory except profiles/ and variants/, and in those
+// the device profile's layers — including in every variant, and in this
+// machine's variants that don't exist yet so backups can create them.
+func sparseDirs(dir string) []string {
+	var layers []string
+	if checkout.profile != "" {
+		layers = []string{strings.ToLower(checkout.profile)}
+		if p, err := storage.LoadProfiles(dir); err == nil {
+			layers = p.Layers(checkout.profile)
+		}
+	}
+
+	set := map[string]bool{"shared": true}
+	for _, top := range treeDirs(dir, "") {
+		if top != "profiles" && top != "variants" {
+			set[top] = true
+		}
+	}
+	for _, l := range layers {
+		set["profiles/"+l] = true
+	}
+	variants := treeDirs(dir, "variants/")
+	for _, v := range storage.DeviceVariants() {
+		variants = append(variants, "variants/"+v)
+	}
+	for _, v := range variants {
+		set[v+"/shared"] = true
+		for _, l := range layers {
+			set[v+"/profiles/"+l] = true
+		}
+	}
+
+	dirs := make([]string, 0, len(set))
+	for d := range set {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// treeDirs lists the directories at prefix (e.g. "variants/") in HEAD.
+func treeDirs(dir, prefix string) []string {
+	args := []string{"ls-tree", "-d", "-z", "--name-only", "HEAD"}
+	if prefix != "" {
+		args = append(args, prefix)
+	}
+	out, err := gitOutput(dir, args...)
+	if err != nil || out == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+}
+
+func lines(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// isSparse reports whether the clone at dir is a sparse checkout. It reads
+// the clone's config itself, so it works without the git binary; git keeps
+// the setting in config.worktree when worktree config is enabled.
+func isSparse(dir string) bool {
+	for _, name := range []string{"config.worktree", "config"} {
+		data, err := os.ReadFile(filepath.Join(dir, ".git", name))
+		if err != nil {
+			continue
+		}
+		raw := gitconfig.New()
+		if err := gitconfig.NewDecoder(bytes.NewReader(data)).Decode(raw); err != nil {
+			continue
+		}
+		if core := raw.Section("core"); core.HasOption("sparseCheckout") {
+			return strings.EqualFold(core.Option("sparseCheckout"), "true")
+		}
+	}
+	return false
+}
@@ -74,52 +74,114 @@ func SetupGitCredentialHelper() error {
 	return exec.Command(getGhBin(), "auth", "setup-git").Run()
 }
 
-// EnsureRepo clones the repo if it doesn't exist locally, or pulls latest.
+// EnsureRepo clones the repo if it doesn't exist locally, or pulls latest
+// and pushes any local commits, fetching Git LFS content when git-lfs is
+// installed. A sparse clone (see SetCheckout) is narrowed to this device's
+// content. Errors reaching the remote of an existing clone wrap
+// ErrOffline. For a store (see IsStoreURL) the local repo is a
+// mirror of it, synced both ways.
 func EnsureRepo(repoURL, localPath string) error {
 	localPath = expandHome(localPath)
+	if IsStoreURL(repoURL) {
+		return ensureMirror(repoURL, localPath)
+	}
 
 	if _, err := os.Stat(filepath.Join(localPath, ".git")); os.IsNotExist(err) {
-		// Remove empty directory if it exists (left from a failed clone)
-		os.RemoveAll(localPath)
-		return clone(repoURL, localPath)
+		// Clear a directory left from a failed clone; anything else in the
+		// way is moved aside.
+		if _, err := RemoveClone(localPath); err != nil {
+			return err
+		}
+		if err := clone(repoURL, localPath); err != nil {
+			return err
+		}
+		if err := UpdateSparse(localPath); err != nil {
+			return err
+		}
+		return ensureLFS(localPath)
 	}
 
-	// Verify the existing clone points to the correct remote URL.
-	// If the user changed their repo URL in settings, re-clone.
-	currentURL, _ := gitOutput(localPath, "remote", "get-url", "origin")
-	currentURL = strings.TrimSpace(currentURL)
+	// Verify the existing clone points to the correct remote URL. The same
+	// repo spelled differently (SSH vs HTTPS, a trailing .git) keeps the
+	// clone. If the user pointed dfc at another repo, re-clone — moving the
+	// old clone aside if it has work the old remote doesn't.
+	currentURL := backend.remoteURL(localPath)
 	if currentURL != "" && currentURL != repoURL {
-		os.RemoveAll(localPath)
-		return clone(repoURL, localPath)
+		if SameRemote(currentURL, repoURL) {
+			if err := backend.setRemoteURL(localPath, repoURL); err != nil {
+				return err
+			}
+		} else {
+			if _, err := RemoveClone(localPath); err != nil {
+				return err
+			}
+			if err := clone(repoURL, localPath); err != nil {
+				return err
+			}
+			if err := UpdateSparse(localPath); err != nil {
+				return err
+			}
+			return ensureLFS(localPath)
+		}
 	}
 
-	return pull(localPath)
+	if err := pull(localPath); err != nil {
+		return err
+	}
+	if err := UpdateSparse(localPath); err != nil {
+		return err
+	}
+	if err := ensureLFS(localPath); err != nil {
+		return err
+	}
+	// Push backups committed while the remote was unreachable.
+	if HasUnpushed(localPath) {
+		return pushRebasing(localPath)
+	}
+	return nil
 }
 
 // CommitAndPush stages all changes, commits, and pushes.
 func CommitAndPush(localPath, message string) error {
 	localPath = expandHome(localPath)
-
-	if err := gitCmd(localPath, "add", "-A"); err != nil {
-		return fmt.Errorf("git add: %w", err)
+	committed, err := Commit(localPath, message)
+	if err != nil || !committed {
+		return err
 	}
+	return Push(localPath)
+}
 
-	// Check if there's anything to commit
-	out, err := gitOutput(localPath, "status", "--porcelain")
-	if err != nil {
-		return fmt.Errorf("git status: %w", err)
-	}
-	if strings.TrimSpace(out) == "" {
-		return nil // nothing to commit
+// Commit stages all changes and commits them without pushing, as when the
+// remote is known to be unreachable. Returns false if there was nothing to
+// commit.
+func Commit(localPath, message string) (bool, error) {
+	localPath = expandHome(localPath)
+	if isMirror(localPath) {
+		return commitMirror(localPath, message)
 	}
+	return backend.commitAll(localPath, message)
+}
 
-	if err := gitCmd(localPath, "commit", "-m", message); err != nil {
-		return fmt.Errorf("git commit: %w", err)
+// Push pushes local commits to the remote. Used to retry a push that failed
+// after its commit was already made.
+func Push(localPath string) error {
+	localPath = expandHome(localPath)
+	if isMirror(localPath) {
+		return syncMirror(localPath)
 	}
-	if err := gitCmd(localPath, "push"); err != nil {
-		return fmt.Errorf("git push: %w", err)
+	return pushRebasing(localPath)
+}
+
+// HasUnpushed reports whether the local branch has commits that are not on
+// its upstream tracking branch, or for a mirror, changes its store hasn't
+// received.
+func HasUnpushed(localPath string) bool {
+	localPath = expandHome(localPath)
+	if isMirror(localPath) {
+		return len(mirrorPending(localPath)) > 0
 	}
-	return nil
+	ahead, _, err := backend.aheadBehind(localPath)
+	return err == nil && ahead > 0
 }
 
 // CreateGitHubRepo creates a new private GitHub repo via the gh CLI
@@ -151,13 +213,23 @@ func CreateGitHubRepo(name string) (string, error) {
 	return fmt.Sprintf("https://github.com/%s.git", name), nil
 }
 
+// GitHubCloneURL returns the HTTPS clone URL of an existing GitHub repo,
+// given as "name" (owned by the gh user) or "owner/name".
+func GitHubCloneURL(name string) (string, error) {
+	out, err := exec.Command(getGhBin(), "repo", "view", name, "--json", "url", "-q", ".url").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("gh repo view: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return strings.TrimSpace(string(out)) + ".git", nil
+}
+
 // InitRepo initializes a new git repo at the given path with an initial commit.
 func InitRepo(localPath string) error {
 	localPath = expandHome(localPath)
 	if err := os.MkdirAll(localPath, 0755); err != nil {
 		return err
 	}
-	if err := gitCmd(localPath, "init"); err != nil {
+	if err := backend.initRepo(localPath); err != nil {
 		return err
 	}
 	// Create a README so we have something to commit
@@ -165,78 +237,100 @@ func InitRepo(localPath string) error {
 	if err := os.WriteFile(readme, []byte("# Dotfiles\n\nManaged by [dfc](https://github.com/solarisjon/dfc) (Dot File Commander).\n"), 0644); err != nil {
 		return err
 	}
-	if err := gitCmd(localPath, "add", "-A"); err != nil {
-		return err
-	}
-	if err := gitCmd(localPath, "commit", "-m", "Initial commit from dfc"); err != nil {
-		return err
-	}
-	return gitCmd(localPath, "branch", "-M", "main")
+	_, err := backend.commitAll(localPath, "Initial commit from dfc")
+	return err
 }
 
 // AddRemoteAndPush adds a remote and pushes the initial commit.
 func AddRemoteAndPush(localPath, url string) error {
 	localPath = expandHome(localPath)
-	if err := gitCmd(localPath, "remote", "add", "origin", url); err != nil {
+	if err := backend.setRemoteURL(localPath, url); err != nil {
 		return fmt.Errorf("adding remote: %w", err)
 	}
-	if err := gitCmd(localPath, "push", "-u", "origin", "main"); err != nil {
+	if err := backend.pushUpstream(localPath); err != nil {
 		return fmt.Errorf("initial push: %w", err)
 	}
 	return nil
 }
 
 func clone(url, dest string) error {
-	cmd := exec.Command("git", "clone", url, dest)
-	// Use a known-good CWD so clone works even if the process CWD was deleted
-	cmd.Dir = os.TempDir()
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("git clone: %s: %w", string(out), err)
+	if err := backend.clone(url, dest); err != nil {
+		return err
 	}
 	// If the repo is empty, create an initial commit
-	gitDir := filepath.Join(dest, ".git")
-	if _, statErr := os.Stat(gitDir); statErr == nil {
-		// Check if HEAD exists (empty repo won't have one)
-		headCmd := exec.Command("git", "rev-parse", "HEAD")
-		headCmd.Dir = dest
-		if headErr := headCmd.Run(); headErr != nil {
+	if _, statErr := os.Stat(filepath.Join(dest, ".git")); statErr == nil {
+		if !backend.hasHead(dest) {
 			// Empty repo — seed it
 			readme := filepath.Join(dest, "README.md")
 			_ = os.WriteFile(readme, []byte("# Dotfiles\n\nManaged by dfc (Dot File Commander).\n"), 0644)
-			_ = gitCmd(dest, "add", "-A")
-			_ = gitCmd(dest, "commit", "-m", "Initial commit from dfc")
-			_ = gitCmd(dest, "branch", "-M", "main")
-			_ = gitCmd(dest, "push", "-u", "origin", "main")
+			_, _ = backend.commitAll(dest, "Initial commit from dfc")
+			_ = backend.pushUpstream(dest)
 		}
+		installMergeDriver(dest)
+		markFetched(dest)
 	}
 	return nil
 }
 
 func pull(dir string) error {
-	// Only pull if there's a remote and commits exist
-	out, err := gitOutput(dir, "remote")
-	if err != nil || strings.TrimSpace(out) == "" {
+	// Only pull if there's a remote, commits exist and an upstream
+	// tracking branch is configured
+	if backend.remoteURL(dir) == "" || !backend.hasHead(dir) || !backend.hasUpstream(dir) {
 		return nil
 	}
-	// Check if there are any commits
-	if err := gitCmd(dir, "rev-parse", "HEAD"); err != nil {
-		return nil // no commits yet, nothing to pull
-	}
-	// Check if upstream is configured
-	_, err = gitOutput(dir, "rev-parse", "--abbrev-ref", "@{u}")
-	if err != nil {
-		return nil // no upstream tracking branch
+	installMergeDriver(dir)
+
+	// Set uncommitted manifest changes aside and merge them back in once
+	// the remote's changes are in, rather than discarding them.
+	var base, pending []byte
+	if changed, _ := backend.changed(dir, manifestFile); changed {
+		pending, _ = os.ReadFile(filepath.Join(dir, manifestFile))
+		if committed, err := backend.show(dir, "HEAD", manifestFile); err == nil {
+			base = committed
+			_ = backend.checkoutHead(dir, manifestFile)
+		} else {
+			_ = os.Remove(filepath.Join(dir, manifestFile))
+		}
 	}
-	// Discard any uncommitted manifest changes before pulling.
-	// The manifest is regenerated on the next backup/restore, so this is safe.
-	// Using stash/pop risks YAML merge conflict markers which break parsing.
-	statusOut, _ := gitOutput(dir, "status", "--porcelain", ".dfc-manifest.yaml")
-	if strings.TrimSpace(statusOut) != "" {
-		_ = gitCmd(dir, "checkout", "HEAD", "--", ".dfc-manifest.yaml")
+
+	err := integrate(dir)
+	if pending != nil {
+		if mergeErr := mergePending(dir, base, pending); err == nil {
+			err = mergeErr
+		}
 	}
+	return err
+}
 
-	return gitCmd(dir, "pull", "--ff-only")
+// gitEnv is the environment git runs in, from dir. Its messages are kept
+// in English whatever the user's locale, as dfc reads some of them (see
+// unreachable). Git never prompts for credentials: dfc often runs
+// unattended, from watch mode or a timer, where a prompt would hang the
+// run instead of failing it. That covers every command, as a partial clone
+// fetches missing files from the remote on checkout too. Unless the user
+// chose their own SSH command, ssh doesn't prompt for passphrases either.
+func gitEnv(dir string) []string {
+	env := append(os.Environ(), "LC_ALL=C", "GIT_TERMINAL_PROMPT=0")
+	if !customSSH(dir) {
+		env = append(env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	return env
+}
+
+// customSSH reports whether the user set how git runs ssh, through
+// GIT_SSH_COMMAND, GIT_SSH or core.sshCommand in dir's repo or globally.
+// dfc leaves such a setup alone.
+func customSSH(dir string) bool {
+	if os.Getenv("GIT_SSH_COMMAND") != "" || os.Getenv("GIT_SSH") != "" {
+		return true
+	}
+	if info, err := os.Stat(dir); dir == "" || err != nil || !info.IsDir() {
+		dir = os.TempDir()
+	}
+	cmd := exec.Command("git", "config", "--get", "core.sshCommand")
+	cmd.Dir = dir
+	out, _ := cmd.Output()
+	return strings.TrimSpace(string(out)) != ""
 }
 
 func gitCmd(dir string, args ...string) error {
@@ -244,9 +338,10 @@ func gitCmd(dir string, args ...string) error {
 	if dir != "" {
 		cmd.Dir = dir
 	}
+	cmd.Env = gitEnv(dir)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("git %s: %s: %w", args[0], string(out), err)
+		return &GitError{Op: args[0], Output: string(out), Err: err}
 	}
 	return nil
 }
@@ -256,6 +351,7 @@ func gitOutput(dir string, args ...string) (string, error) {
 	if dir != "" {
 		cmd.Dir = dir
 	}
+	cmd.Env = gitEnv(dir)
 	out, err := cmd.Output()
 	return string(out), err
 }
@@ -265,8 +361,15 @@ func gitOutput(dir string, args ...string) (string, error) {
 // all remote history and data.
 func NukeRepo(localPath string) error {
 	localPath = expandHome(localPath)
+	readme := []byte("# Dotfiles\n\nManaged by [dfc](https://github.com/solarisjon/DotFileCommander) (Dot File Commander).\n")
+	if isMirror(localPath) {
+		return nukeMirror(localPath, readme)
+	}
 
 	// Remove everything except .git
+	if err := CheckoutAll(localPath); err != nil {
+		return err
+	}
 	entries, err := os.ReadDir(localPath)
 	if err != nil {
 		return fmt.Errorf("reading repo dir: %w", err)
@@ -281,20 +384,16 @@ func NukeRepo(localPath string) error {
 	}
 
 	// Create a fresh README
-	readme := filepath.Join(localPath, "README.md")
-	if err := os.WriteFile(readme, []byte("# Dotfiles\n\nManaged by [dfc](https://github.com/solarisjon/DotFileCommander) (Dot File Commander).\n"), 0644); err != nil {
+	if err := os.WriteFile(filepath.Join(localPath, "README.md"), readme, 0644); err != nil {
 		return fmt.Errorf("writing README: %w", err)
 	}
 
 	// Stage, commit, and force push
-	if err := gitCmd(localPath, "add", "-A"); err != nil {
-		return fmt.Errorf("git add: %w", err)
-	}
-	if err := gitCmd(localPath, "commit", "-m", "Reset repo — wiped by dfc"); err != nil {
-		return fmt.Errorf("git commit: %w", err)
+	if _, err := backend.commitAll(localPath, "Reset repo — wiped by dfc"); err != nil {
+		return err
 	}
 	// Force push to overwrite remote history
-	if err := gitCmd(localPath, "push", "--force"); err != nil {
+	if err := backend.push(localPath, true); err != nil {
 		return fmt.Errorf("git push --force: %w", err)
 	}
 	return nil
@@ -308,23 +407,12 @@ type GitIdentity struct {
 
 // CheckGitIdentity reads git's global user.name and user.email.
 func CheckGitIdentity() GitIdentity {
-	name, _ := gitOutput("", "config", "--global", "user.name")
-	email, _ := gitOutput("", "config", "--global", "user.email")
-	return GitIdentity{
-		Name:  strings.TrimSpace(name),
-		Email: strings.TrimSpace(email),
-	}
+	return backend.identity()
 }
 
 // SetGitIdentity sets git's global user.name and user.email.
 func SetGitIdentity(name, email string) error {
-	if err := gitCmd("", "config", "--global", "user.name", name); err != nil {
-		return fmt.Errorf("setting user.name: %w", err)
-	}
-	if err := gitCmd("", "config", "--global", "user.email", email); err != nil {
-		return fmt.Errorf("setting user.email: %w", err)
-	}
-	return nil
+	return backend.setIdentity(name, email)
 }
 
 func expandHome(path string) string {
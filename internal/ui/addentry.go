@@ -11,7 +11,7 @@ import (
 )
 
 // buildAddForm creates a huh form for adding a new entry.
-// Phase 1 (addStep==0): path only. Phase 2 (addStep==1): name + profile toggle.
+// Phase 1 (addStep==0): path only. Phase 2 (addStep==1): name, profile toggle and tags.
 func (m *Model) buildAddForm() tea.Cmd {
 	if m.addStep == 0 {
 		m.addForm = huh.NewForm(
@@ -30,7 +30,7 @@ func (m *Model) buildAddForm() tea.Cmd {
 		return m.addForm.Init()
 	}
 
-	// Phase 2: name + profile-specific
+	// Phase 2: name + profile-specific + tags
 	m.addForm = huh.NewForm(
 		huh.NewGroup(
 			huh.NewInput().
@@ -45,6 +45,12 @@ func (m *Model) buildAddForm() tea.Cmd {
 				Affirmative("Yes").
 				Negative("No").
 				Value(&m.addProfileSpecific),
+			huh.NewInput().
+				Key("tags").
+				Title("Tags").
+				Description("Only restore on devices with one of these tags (blank = all)").
+				Placeholder("work, linux").
+				Value(&m.addTags),
 		),
 	).WithWidth(m.contentWidth()).
 		WithShowHelp(false).
@@ -89,6 +95,7 @@ func (m Model) updateAddEntry(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.addIsDir = entry.IsDir(path)
 			m.addName = entry.FriendlyName(path)
 			m.addProfileSpecific = false
+			m.addTags = ""
 			m.addStep = 1
 			initCmd := m.buildAddForm()
 			return m, initCmd
@@ -103,6 +110,7 @@ func (m Model) updateAddEntry(msg tea.Msg) (tea.Model, tea.Cmd) {
 			Name:            name,
 			IsDir:           m.addIsDir,
 			ProfileSpecific: m.addProfileSpecific,
+			Tags:            config.ParseTags(m.addTags),
 		}
 
 		if err := m.cfg.AddEntry(e); err != nil {
@@ -0,0 +1,103 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/solarisjon/dfc/internal/storage"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// divergedBackup is a backup commit that could not be rebased onto the
+// remote because files outside any entry conflict. It stays committed in
+// the local clone until it is pushed or discarded.
+type divergedBackup struct {
+	files []string // conflicting repo paths
+	keys  []string // manifest keys the commit bumped (empty if from an earlier run)
+}
+
+func (m Model) updateBackupDiverged(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	d := m.backupDiverged
+	switch msg.String() {
+	case "r":
+		// Try again — another device may have resolved it meanwhile.
+		var diverged *gsync.DivergedError
+		err := gsync.Push(m.cfg.RepoPath)
+		switch {
+		case errors.As(err, &diverged):
+			d.files = diverged.Files
+			m.errMsg = ""
+		case err != nil:
+			m.errMsg = fmt.Sprintf("Push failed: %v", err)
+		default:
+			m.backupDiverged = nil
+			m.errMsg = ""
+			m.recheckContests()
+			m.statusMsg = "Backup pushed."
+		}
+	case "x":
+		if err := gsync.DiscardUnpushed(m.cfg.RepoPath); err != nil {
+			m.errMsg = fmt.Sprintf("Discard failed: %v", err)
+			return m, nil
+		}
+		m.forgetBackedUp(d.keys)
+		m.backupDiverged = nil
+		m.errMsg = ""
+		m.statusMsg = "Local backup discarded — the clone matches the remote. Your files are untouched."
+	case "esc", "q", "enter":
+		m.backupDiverged = nil
+		m.currentView = viewMainMenu
+		m.errMsg = ""
+		m.statusMsg = ""
+		m.backupCh = nil
+		m.backupConflicts = nil
+		m.backupConfirmed = false
+		m.backupSizeOK = false
+	}
+	return m, nil
+}
+
+// forgetBackedUp clears the sync state of entries whose backup commit was
+// discarded, so the next backup or restore compares them with the repo
+// afresh rather than trusting versions that never reached it.
+func (m *Model) forgetBackedUp(keys []string) {
+	for i := range m.cfg.Entries {
+		e := &m.cfg.Entries[i]
+		key := storage.ManifestKey(*e, m.cfg.DeviceProfile)
+		for _, k := range keys {
+			if k == key {
+				e.LocalVersion = 0
+				e.LastHash = ""
+				break
+			}
+		}
+	}
+	_ = m.cfg.Save()
+}
+
+func (m Model) viewBackupDiverged() string {
+	var b strings.Builder
+
+	b.WriteString(sectionHeader("⬆", "Backup"))
+	b.WriteString("\n\n")
+	b.WriteString(errorStyle.Render("⚠  BACKUP NOT PUSHED"))
+	b.WriteString("\n\n")
+	b.WriteString(normalStyle.Render("Another device pushed changes that conflict with this backup in:"))
+	b.WriteString("\n\n")
+	for _, f := range m.backupDiverged.files {
+		b.WriteString(warningStyle.Render("  ⚡ " + f))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render("The backup is committed in " + m.cfg.RepoPath + " but not on the remote."))
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render("Resolve it there with git and retry, or discard it and back up again."))
+	if m.errMsg != "" {
+		b.WriteString("\n\n")
+		b.WriteString(errorStyle.Render("✗ " + m.errMsg))
+	}
+	b.WriteString(statusBar("r retry push • x discard local backup • esc leave it"))
+	return m.box().Render(b.String())
+}
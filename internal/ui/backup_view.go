@@ -1,12 +1,15 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/solarisjon/dfc/internal/backup"
+	"github.com/solarisjon/dfc/internal/config"
 	"github.com/solarisjon/dfc/internal/manifest"
 	"github.com/solarisjon/dfc/internal/storage"
 	gsync "github.com/solarisjon/dfc/internal/sync"
@@ -17,7 +20,8 @@ type backupProgressMsg backup.Progress
 // repoSyncDoneMsg signals that EnsureRepo completed (with optional error).
 type repoSyncDoneMsg struct{ err error }
 
-func (m Model) startBackup() tea.Cmd {
+func (m *Model) startBackup() tea.Cmd {
+	m.offline = false
 	return func() tea.Msg {
 		err := gsync.EnsureRepo(m.cfg.RepoURL, m.cfg.RepoPath)
 		return repoSyncDoneMsg{err: err}
@@ -57,6 +61,59 @@ func (m *Model) checkBackupConflicts() []string {
 	return conflicts
 }
 
+// layerQuestion asks which layer a layered entry's new files belong in.
+type layerQuestion struct {
+	index  int // index in cfg.Entries
+	layers []string
+	files  []string // new files, relative to the entry
+	choice int      // index in layers
+}
+
+// beginBackup first asks which layer new files go to for any layered entry
+// where that is ambiguous, then runs the backup.
+func (m *Model) beginBackup() tea.Cmd {
+	m.backupLayerAsk = nil
+	for i, e := range m.cfg.Entries {
+		layers := storage.EntryLayers(m.cfg.RepoPath, e, m.cfg.DeviceProfile)
+		if len(layers) < 2 || strings.EqualFold(backup.NewFileLayer(e, layers), e.Layer) {
+			continue
+		}
+		if files := backup.NewFiles(e, m.cfg.RepoPath, layers); len(files) > 0 {
+			m.backupLayerAsk = append(m.backupLayerAsk, layerQuestion{index: i, layers: layers, files: files})
+		}
+	}
+	if len(m.backupLayerAsk) > 0 {
+		return nil // show layer prompt, wait for user input
+	}
+	return m.planBackup()
+}
+
+// backupPlanMsg carries what the backup would add to the repo.
+type backupPlanMsg struct{ results []backup.Progress }
+
+// planBackup works out what the backup adds to the repo first, so a large
+// one can be confirmed before it is committed for good.
+func (m *Model) planBackup() tea.Cmd {
+	if m.backupSizeOK || m.cfg.Limits.ConfirmSize() < 0 {
+		return m.runBackup()
+	}
+	m.backupPlanning = true
+	m.progressItems = nil
+	entries, repoPath, profile, limits := m.cfg.Entries, m.cfg.RepoPath, m.cfg.DeviceProfile, m.cfg.Limits
+	return func() tea.Msg {
+		return backupPlanMsg{results: backup.Plan(entries, repoPath, profile, limits)}
+	}
+}
+
+func (m Model) handleBackupPlan(msg backupPlanMsg) (tea.Model, tea.Cmd) {
+	m.backupPlanning = false
+	if backup.SizeImpact(msg.results).Bytes > m.cfg.Limits.ConfirmSize() {
+		m.backupPlan = msg.results
+		return m, nil // show the size, wait for user input
+	}
+	return m, m.runBackup()
+}
+
 func (m *Model) runBackup() tea.Cmd {
 	m.progressItems = make([]progressItem, len(m.cfg.Entries))
 	for i, e := range m.cfg.Entries {
@@ -68,7 +125,7 @@ func (m *Model) runBackup() tea.Cmd {
 	}
 	m.progressDone = false
 
-	ch := backup.Run(m.cfg.Entries, m.cfg.RepoPath, m.cfg.DeviceProfile)
+	ch := backup.Run(m.cfg.Entries, m.cfg.RepoPath, m.cfg.DeviceProfile, m.cfg.Hooks, m.cfg.Limits)
 	m.backupCh = ch
 
 	return waitForBackupProgress(ch)
@@ -85,8 +142,15 @@ func waitForBackupProgress(ch <-chan backup.Progress) tea.Cmd {
 }
 
 func (m Model) handleRepoSyncDone(msg repoSyncDoneMsg) (tea.Model, tea.Cmd) {
-	if msg.err != nil {
-		m.errMsg = fmt.Sprintf("Repo sync failed: %v", msg.err)
+	var diverged *gsync.DivergedError
+	if errors.As(msg.err, &diverged) {
+		// An earlier backup commit is still waiting to be resolved.
+		m.backupDiverged = &divergedBackup{files: diverged.Files}
+		m.progressDone = true
+		return m, nil
+	}
+	if err := m.noteSync(msg.err); err != nil {
+		m.errMsg = fmt.Sprintf("Repo sync failed: %v", err)
 		m.progressDone = true
 		return m, nil
 	}
@@ -98,13 +162,18 @@ func (m Model) handleRepoSyncDone(msg repoSyncDoneMsg) (tea.Model, tea.Cmd) {
 	if migrated, err := storage.MigrateLegacyLayout(m.cfg, mf); err == nil && migrated > 0 {
 		_ = mf.Save(m.cfg.RepoPath)
 	}
+	rec := storage.Reconcile(m.cfg, mf)
+	m.backupContests = rec.Contests
+	if rec.Changed {
+		_ = m.cfg.Save()
+	}
 	// Check if repo was modified by another device
 	conflicts := m.checkBackupConflicts()
 	if len(conflicts) > 0 && !m.backupConfirmed {
 		m.backupConflicts = conflicts
 		return m, nil // show conflict warning, wait for user input
 	}
-	return m, m.runBackup()
+	return m, m.beginBackup()
 }
 
 func (m Model) handleBackupProgress(msg backupProgressMsg) (tea.Model, tea.Cmd) {
@@ -116,6 +185,12 @@ func (m Model) handleBackupProgress(msg backupProgressMsg) (tea.Model, tea.Cmd)
 		item.skipped = msg.Skipped
 		item.skipReasons = msg.SkipReasons
 		item.warning = msg.Warning
+		item.hooks = msg.Hooks
+		item.layers = msg.Layers
+		item.repoFiles = msg.RepoFiles
+		item.repoNew = msg.RepoNew
+		item.repoBytes = msg.RepoBytes
+		item.lfsBytes = msg.LFSBytes
 		if msg.BytesTotal > 0 {
 			item.percent = float64(msg.BytesCopied) / float64(msg.BytesTotal)
 		} else if msg.Done {
@@ -136,33 +211,53 @@ func (m Model) handleBackupProgress(msg backupProgressMsg) (tea.Model, tea.Cmd)
 		m.progressDone = true
 
 		// Bump manifest versions for successfully backed-up entries
-		mf, err := manifest.Load(m.cfg.RepoPath)
-		if err != nil {
-			mf = &manifest.Manifest{Entries: make(map[string]manifest.EntryVersion)}
-		}
-		changed := 0
+		var results []backup.Progress
 		for i, item := range m.progressItems {
-			if item.done && item.err == nil && i < len(m.cfg.Entries) {
-				e := &m.cfg.Entries[i]
-				mkey := storage.ManifestKey(*e, m.cfg.DeviceProfile)
-				bumped := mf.BumpVersion(mkey, item.contentHash)
-				e.LocalVersion = mf.GetVersion(mkey)
-				e.LastHash = item.contentHash
-				if bumped {
-					changed++
-				}
+			if i < len(m.cfg.Entries) {
+				results = append(results, backup.Progress{
+					Entry:       m.cfg.Entries[i],
+					Index:       i,
+					Done:        item.done,
+					Err:         item.err,
+					ContentHash: item.contentHash,
+					Layers:      item.layers,
+					RepoFiles:   item.repoFiles,
+					RepoNew:     item.repoNew,
+					RepoBytes:   item.repoBytes,
+					LFSBytes:    item.lfsBytes,
+				})
 			}
 		}
-		_ = m.cfg.Save()
+		bumped, retagged, _ := backup.Record(m.cfg, results)
+		changed := backupChanges(len(bumped), len(retagged))
+		added := ""
+		if im := backup.SizeImpact(results); im.Files > 0 {
+			added = fmt.Sprintf(" Added to the repo: %s.", im)
+		}
 
 		// Commit and push (only if something actually changed)
-		if changed > 0 {
-			_ = mf.Save(m.cfg.RepoPath)
-			if err := gsync.CommitAndPush(m.cfg.RepoPath, "dfc: backup dotfiles"); err != nil {
-				m.errMsg = fmt.Sprintf("Push failed: %v", err)
+		if changed != "" {
+			var diverged *gsync.DivergedError
+			var err error
+			message := backup.CommitMessage("dfc: backup", m.cfg, results, bumped, retagged)
+			if m.offline {
+				_, err = gsync.Commit(m.cfg.RepoPath, message)
 			} else {
-				m.statusMsg = fmt.Sprintf("Backup complete! %d %s updated.", changed, pluralize2(changed))
+				err = gsync.CommitAndPush(m.cfg.RepoPath, message)
 			}
+			switch {
+			case errors.As(err, &diverged):
+				m.backupDiverged = &divergedBackup{files: diverged.Files, keys: bumped}
+			case m.offline && err == nil, errors.Is(err, gsync.ErrOffline):
+				m.offline = true
+				m.statusMsg = fmt.Sprintf("Backup committed locally — %s.%s It will be pushed on the next sync.", changed, added)
+			case err != nil:
+				m.errMsg = fmt.Sprintf("Push failed: %v", err)
+			default:
+				m.recheckContests()
+				m.statusMsg = fmt.Sprintf("Backup complete! %s.%s", changed, added)
+			}
+			gsync.TrackUnpushed(m.cfg)
 		} else {
 			m.statusMsg = "Backup complete — all entries already up to date."
 		}
@@ -176,16 +271,52 @@ func (m Model) handleBackupProgress(msg backupProgressMsg) (tea.Model, tea.Cmd)
 	return m, nil
 }
 
+// backupChanges describes what a backup recorded, telling new versions
+// apart from entries whose tags or definition alone changed. Empty when
+// nothing changed.
+func backupChanges(bumped, retagged int) string {
+	var parts []string
+	if bumped > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s updated", bumped, pluralize2(bumped)))
+	}
+	if retagged > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s with only tags or definition changed", retagged, pluralize2(retagged)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// recheckContests picks up entries a rebase during push merged with another
+// device's concurrent backup.
+func (m *Model) recheckContests() {
+	mf, err := manifest.Load(m.cfg.RepoPath)
+	if err != nil {
+		return
+	}
+	if contests := storage.Recheck(m.cfg, mf); len(contests) > 0 {
+		m.backupContests = append(m.backupContests, contests...)
+		_ = m.cfg.Save()
+	}
+}
+
 func (m Model) updateBackupView(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if len(m.backupLayerAsk) > 0 {
+			return m.updateBackupLayerAsk(msg)
+		}
+		if m.backupDiverged != nil {
+			return m.updateBackupDiverged(msg)
+		}
+		if m.backupPlan != nil {
+			return m.updateBackupPlan(msg)
+		}
 		switch msg.String() {
 		case "y", "Y":
 			// Confirm backup despite conflicts
 			if len(m.backupConflicts) > 0 && !m.backupConfirmed {
 				m.backupConfirmed = true
 				m.backupConflicts = nil
-				return m, m.runBackup()
+				return m, m.beginBackup()
 			}
 		case "esc", "q":
 			if len(m.backupConflicts) > 0 && !m.backupConfirmed {
@@ -203,6 +334,8 @@ func (m Model) updateBackupView(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.backupCh = nil
 				m.backupConflicts = nil
 				m.backupConfirmed = false
+				m.backupSizeOK = false
+				m.backupContests = nil
 				return m, nil
 			}
 		case "enter":
@@ -213,6 +346,8 @@ func (m Model) updateBackupView(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.backupCh = nil
 				m.backupConflicts = nil
 				m.backupConfirmed = false
+				m.backupSizeOK = false
+				m.backupContests = nil
 				return m, nil
 			}
 		}
@@ -223,12 +358,145 @@ func (m Model) updateBackupView(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// updateBackupLayerAsk handles the layer prompt for the first pending
+// question. The answer is saved as the entry's Layer so it is only asked once.
+func (m Model) updateBackupLayerAsk(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	q := &m.backupLayerAsk[0]
+	switch msg.String() {
+	case "left", "h", "up", "k":
+		if q.choice > 0 {
+			q.choice--
+		}
+	case "right", "l", "down", "j", "tab":
+		if q.choice < len(q.layers)-1 {
+			q.choice++
+		}
+	case "enter":
+		m.cfg.Entries[q.index].Layer = q.layers[q.choice]
+		_ = m.cfg.Save()
+		m.backupLayerAsk = m.backupLayerAsk[1:]
+		if len(m.backupLayerAsk) == 0 {
+			return m, m.planBackup()
+		}
+	case "esc", "q":
+		m.backupLayerAsk = nil
+		m.backupConfirmed = false
+		m.currentView = viewMainMenu
+		m.errMsg = ""
+	}
+	return m, nil
+}
+
+// updateBackupPlan handles the confirmation of a backup over the confirm
+// size.
+func (m Model) updateBackupPlan(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "y", "Y", "enter":
+		m.backupPlan = nil
+		m.backupSizeOK = true
+		return m, m.runBackup()
+	case "esc", "q", "n", "N":
+		m.backupPlan = nil
+		m.backupConfirmed = false
+		m.currentView = viewMainMenu
+		m.errMsg = ""
+	}
+	return m, nil
+}
+
+// viewBackupPlan shows what a large backup adds to the repo, biggest
+// entries first.
+func (m Model) viewBackupPlan() string {
+	var b strings.Builder
+	b.WriteString(sectionHeader("⬆", "Backup"))
+	b.WriteString("\n\n")
+	b.WriteString(warningStyle.Render(fmt.Sprintf("This backup adds %s to the repo", backup.SizeImpact(m.backupPlan))))
+	b.WriteString("\n\n")
+
+	var items []backup.Progress
+	for _, p := range m.backupPlan {
+		if p.RepoBytes > 0 || p.Skipped > 0 {
+			items = append(items, p)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].RepoBytes > items[j].RepoBytes })
+	const maxItems = 8
+	for i, p := range items {
+		if i == maxItems {
+			b.WriteString(helpStyle.Render(fmt.Sprintf("  … and %d more", len(items)-maxItems)))
+			b.WriteString("\n")
+			break
+		}
+		line := fmt.Sprintf("  %10s  %s", config.FormatSize(p.RepoBytes), p.Entry.Path)
+		if p.LFSBytes > 0 {
+			line += fmt.Sprintf(" (%s through Git LFS)", config.FormatSize(p.LFSBytes))
+		}
+		b.WriteString(normalStyle.Render(line))
+		b.WriteString("\n")
+		for _, reason := range p.SkipReasons {
+			b.WriteString(helpStyle.Render("              · skipped " + reason))
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render("Everything committed stays in the repo's history. Limit large files with max_file_size, binary or lfs_over in the config."))
+	b.WriteString(statusBar("y back up • esc cancel"))
+	return m.box().Render(b.String())
+}
+
 func (m Model) viewBackupProgress() string {
 	var b strings.Builder
 
 	b.WriteString(sectionHeader("⬆", "Backup"))
 	b.WriteString("\n\n")
 
+	if len(m.backupLayerAsk) > 0 {
+		q := m.backupLayerAsk[0]
+		e := m.cfg.Entries[q.index]
+		b.WriteString(warningStyle.Render("Which layer should new files go to?"))
+		b.WriteString("\n\n")
+		b.WriteString(normalStyle.Render(fmt.Sprintf("%s (%s) has files that are in none of its layers:", e.Name, e.Path)))
+		b.WriteString("\n\n")
+		const maxFiles = 5
+		for i, f := range q.files {
+			if i == maxFiles {
+				b.WriteString(helpStyle.Render(fmt.Sprintf("  … and %d more", len(q.files)-maxFiles)))
+				b.WriteString("\n")
+				break
+			}
+			b.WriteString(helpStyle.Render("  + " + f))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+		for i, l := range q.layers {
+			label := " " + l + " "
+			if i == 0 {
+				label = " " + l + " (this device) "
+			}
+			if i == q.choice {
+				b.WriteString(selectedStyle.Render("▸" + label))
+			} else {
+				b.WriteString(dimStyle.Render(" " + label))
+			}
+			b.WriteString("  ")
+		}
+		b.WriteString("\n\n")
+		b.WriteString(dimStyle.Render("Existing files stay in the layer they came from. Your choice is remembered for this entry."))
+		b.WriteString(statusBar("←/→ choose layer • enter confirm • esc cancel"))
+		return m.box().Render(b.String())
+	}
+
+	if m.backupDiverged != nil {
+		return m.viewBackupDiverged()
+	}
+	if m.backupPlan != nil {
+		return m.viewBackupPlan()
+	}
+	if notice := m.offlineNotice(); notice != "" {
+		b.WriteString(notice)
+		b.WriteString("\n\n")
+	}
+
 	// Show backup conflict warning if detected
 	if len(m.backupConflicts) > 0 && !m.backupConfirmed {
 		b.WriteString(errorStyle.Render("⚠  CONFLICT DETECTED"))
@@ -247,7 +515,11 @@ func (m Model) viewBackupProgress() string {
 
 	if len(m.progressItems) == 0 && !m.progressDone {
 		b.WriteString(lipgloss.NewStyle().Foreground(accentColor).Render("⟳ "))
-		b.WriteString(normalStyle.Render("Syncing repository..."))
+		if m.backupPlanning {
+			b.WriteString(normalStyle.Render("Checking what the backup adds to the repo..."))
+		} else {
+			b.WriteString(normalStyle.Render("Syncing repository..."))
+		}
 		if m.errMsg != "" {
 			b.WriteString("\n\n")
 			b.WriteString(errorStyle.Render("✗ " + m.errMsg))
@@ -274,6 +546,9 @@ func (m Model) viewBackupProgress() string {
 			bar := renderGradientBar(item.percent, barW)
 			line := fmt.Sprintf(" %s  %s %s", status, name, bar)
 			b.WriteString(line)
+			if len(item.layers) > 0 {
+				b.WriteString(" " + dimStyle.Render("→ "+strings.Join(item.layers, ", ")))
+			}
 
 			if item.err != nil {
 				b.WriteString(" " + errorStyle.Render(item.err.Error()))
@@ -285,6 +560,7 @@ func (m Model) viewBackupProgress() string {
 					b.WriteString("\n      " + helpStyle.Render("  · "+reason))
 				}
 			}
+			b.WriteString(renderHookResults(item.hooks))
 			b.WriteString("\n")
 		}
 	}
@@ -293,6 +569,15 @@ func (m Model) viewBackupProgress() string {
 		b.WriteString("\n")
 		b.WriteString(successStyle.Render("✓ " + m.statusMsg))
 	}
+	for _, c := range m.backupContests {
+		b.WriteString("\n")
+		if c.Kept {
+			b.WriteString(warningStyle.Render("⚡ " + c.Entry.Path + " was also backed up on another device — your copy was kept"))
+		} else {
+			b.WriteString(errorStyle.Render("⚡ " + c.Entry.Path + " was also backed up on another device — the repo kept theirs"))
+			b.WriteString("\n" + helpStyle.Render("   Your copy is in the repo history and on disk. Review it in Restore."))
+		}
+	}
 	if m.errMsg != "" && len(m.progressItems) > 0 {
 		b.WriteString("\n")
 		b.WriteString(errorStyle.Render("✗ " + m.errMsg))
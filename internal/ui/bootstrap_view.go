@@ -50,7 +50,7 @@ func (m *Model) updateBootstrapView(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.bootstrapStep = bootstrapStepSelect
 			return m, nil
 		}
-		repoEntries, err := storage.ListRepoEntries(m.cfg.RepoPath, m.cfg.DeviceProfile, m.cfg.Entries)
+		repoEntries, err := storage.ListRepoEntries(m.cfg.RepoPath, m.cfg.DeviceProfile, m.cfg.DeviceTagSet(), m.cfg.Entries)
 		if err != nil {
 			m.errMsg = "Failed to read repo: " + err.Error()
 			m.bootstrapStep = bootstrapStepSelect
@@ -77,6 +77,7 @@ func (m *Model) updateBootstrapView(msg tea.Msg) (tea.Model, tea.Cmd) {
 				pi.err = p.Err
 				pi.skipped = p.Skipped
 				pi.skipReasons = p.SkipReasons
+				pi.hooks = p.Hooks
 			}
 		}
 		if !p.Done {
@@ -88,6 +89,13 @@ func (m *Model) updateBootstrapView(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 		m.progressDone = true
+		var imported []config.Entry
+		for _, bi := range m.bootstrapEntries {
+			if bi.selected {
+				imported = append(imported, bi.entry.Entry)
+			}
+		}
+		m.recordRestore(imported)
 		return m, nil
 
 	case tea.KeyMsg:
@@ -148,13 +156,14 @@ func (m *Model) startBootstrapRestore() tea.Cmd {
 	for _, bi := range selected {
 		m.cfg.Entries = append(m.cfg.Entries, bi.entry.Entry)
 	}
+	storage.ResolveVariants(m.cfg)
 	_ = m.cfg.Save()
 
 	// Build progress items
 	entries := make([]config.Entry, len(selected))
+	copy(entries, m.cfg.Entries[len(m.cfg.Entries)-len(selected):])
 	m.progressItems = make([]progressItem, len(selected))
 	for i, bi := range selected {
-		entries[i] = bi.entry.Entry
 		name := bi.entry.Entry.Name
 		if name == "" {
 			name = bi.entry.Entry.Path
@@ -164,7 +173,7 @@ func (m *Model) startBootstrapRestore() tea.Cmd {
 	m.progressDone = false
 	m.bootstrapStep = bootstrapStepRunning
 
-	ch := restore.Run(entries, m.cfg.RepoPath, m.cfg.DeviceProfile)
+	ch := restore.Run(entries, m.cfg.RepoPath, m.cfg.DeviceProfile, m.cfg.Hooks)
 	m.bootstrapCh = ch
 	return m.waitBootstrapProgress()
 }
@@ -275,6 +284,7 @@ func (m Model) viewBootstrap() string {
 					b.WriteString("\n      " + helpStyle.Render("  · "+reason))
 				}
 			}
+			b.WriteString(renderHookResults(item.hooks))
 			b.WriteString("\n")
 		}
 
@@ -292,6 +302,10 @@ func (m Model) viewBootstrap() string {
 				b.WriteString(errorStyle.Render("  ✗ Some entries failed"))
 			}
 			b.WriteString("\n")
+			if m.errMsg != "" {
+				b.WriteString(errorStyle.Render("  ✗ " + m.errMsg))
+				b.WriteString("\n")
+			}
 			b.WriteString(statusBar("enter/esc back to menu"))
 		} else {
 			b.WriteString(statusBar("importing..."))
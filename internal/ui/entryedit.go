@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/solarisjon/dfc/internal/entry"
+)
+
+// Fields of the edit-entry modal.
+const (
+	editFieldPath = iota
+	editFieldName
+	editFieldDesc
+	editFieldCount
+)
+
+// beginEditEntry opens the edit modal for an entry's path, name and
+// description.
+func (m *Model) beginEditEntry(sel entryItem) tea.Cmd {
+	e := m.cfg.Entries[sel.index]
+	values := []string{e.Path, e.Name, e.Description}
+	placeholders := []string{"~/.config/app/config", "Name", "Optional description"}
+	m.editInputs = make([]textinput.Model, editFieldCount)
+	for i := range m.editInputs {
+		ti := textinput.New()
+		ti.Placeholder = placeholders[i]
+		ti.CharLimit = 200
+		ti.Width = 40
+		ti.SetValue(values[i])
+		m.editInputs[i] = ti
+	}
+	m.editEntry = &sel
+	m.editField = editFieldPath
+	m.errMsg = ""
+	m.statusMsg = ""
+	return m.editInputs[m.editField].Focus()
+}
+
+func (m Model) updateEditEntry(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.editEntry = nil
+		m.errMsg = ""
+		return m, nil
+	case "tab", "shift+tab":
+		m.editInputs[m.editField].Blur()
+		if msg.String() == "tab" {
+			m.editField = (m.editField + 1) % editFieldCount
+		} else {
+			m.editField = (m.editField + editFieldCount - 1) % editFieldCount
+		}
+		return m, m.editInputs[m.editField].Focus()
+	case "enter":
+		return m.saveEditEntry()
+	}
+	var cmd tea.Cmd
+	m.editInputs[m.editField], cmd = m.editInputs[m.editField].Update(msg)
+	return m, cmd
+}
+
+// saveEditEntry applies the edit. Name and description only change the
+// config; a new path moves the entry's repo content via startEntryMove.
+func (m Model) saveEditEntry() (tea.Model, tea.Cmd) {
+	index := m.editEntry.index
+	e := m.cfg.Entries[index]
+	path := strings.TrimSpace(m.editInputs[editFieldPath].Value())
+	if path == "" {
+		m.errMsg = "Path cannot be empty"
+		return m, nil
+	}
+	for i, other := range m.cfg.Entries {
+		if i != index && other.Path == path {
+			m.errMsg = path + " is already tracked"
+			return m, nil
+		}
+	}
+
+	to := e
+	to.Path = path
+	to.Name = strings.TrimSpace(m.editInputs[editFieldName].Value())
+	if to.Name == "" {
+		to.Name = entry.FriendlyName(path)
+	}
+	to.Description = strings.TrimSpace(m.editInputs[editFieldDesc].Value())
+	if entry.Exists(path) {
+		to.IsDir = entry.IsDir(path)
+	}
+	m.editEntry = nil
+	m.errMsg = ""
+
+	if to.Path == e.Path {
+		m.cfg.Entries[index] = to
+		_ = m.cfg.Save()
+		m.buildEntryList()
+		return m, nil
+	}
+	return m, m.startEntryMove(index, to)
+}
+
+func (m Model) viewEditEntry() string {
+	var b strings.Builder
+
+	b.WriteString(sectionHeader("✎", "Edit Entry"))
+	b.WriteString("\n\n")
+	labels := []string{"Path:", "Name:", "Description:"}
+	for i, in := range m.editInputs {
+		b.WriteString(labels[i] + "\n\n")
+		b.WriteString(in.View())
+		b.WriteString("\n\n")
+	}
+	b.WriteString(helpStyle.Render("A new path moves the entry's copy in the repo and keeps its version.\nOther devices follow the rename after their next sync; name and\ndescription reach them with your next backup.\nYour files are not moved — move them yourself first."))
+
+	if m.errMsg != "" {
+		b.WriteString("\n\n")
+		b.WriteString(errorStyle.Render("✗ " + m.errMsg))
+	}
+	b.WriteString(statusBar("tab switch field • enter save • esc cancel"))
+	return m.box().Render(b.String())
+}
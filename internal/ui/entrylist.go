@@ -8,6 +8,7 @@ import (
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/solarisjon/dfc/internal/config"
 	"github.com/solarisjon/dfc/internal/entry"
 	"github.com/solarisjon/dfc/internal/manifest"
 	"github.com/solarisjon/dfc/internal/storage"
@@ -20,12 +21,23 @@ type entryItem struct {
 	path            string
 	isDir           bool
 	profileSpecific bool
+	tags            []string
+	variant         string // host/OS variant in effect
+	pendingHooks    bool   // hooks shared by another device await review
 	verInfo         string // pre-rendered version info
 }
 
 func (i entryItem) Title() string       { return i.name }
 func (i entryItem) Description() string { return i.path }
-func (i entryItem) FilterValue() string { return i.name + " " + i.path }
+func (i entryItem) FilterValue() string { return i.name + " " + i.path + " " + tagLabel(i.tags) }
+
+// tagLabel renders tags as "#work #linux".
+func tagLabel(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "#" + strings.Join(tags, " #")
+}
 
 // entryDelegate renders entries with icons and version info.
 type entryDelegate struct {
@@ -75,7 +87,17 @@ func (d entryDelegate) Render(w io.Writer, m list.Model, index int, listItem lis
 		icon = "👤"
 	}
 
-	name := padRight(i.name, nameW)
+	label := i.name
+	if i.variant != "" {
+		label += " @" + i.variant
+	}
+	if len(i.tags) > 0 {
+		label += " " + tagLabel(i.tags)
+	}
+	if i.pendingHooks {
+		label += " ⚠ hooks"
+	}
+	name := padRight(label, nameW)
 	path := padRight(i.path, pathW)
 	ver := padRight(i.verInfo, verW)
 
@@ -140,6 +162,9 @@ func (m *Model) buildEntryList() {
 			path:            e.Path,
 			isDir:           e.IsDir,
 			profileSpecific: e.ProfileSpecific,
+			tags:            e.Tags,
+			variant:         e.Variant,
+			pendingHooks:    e.PendingHooks != nil,
 			verInfo:         verInfo,
 		}
 	}
@@ -162,20 +187,61 @@ func (m *Model) buildEntryList() {
 
 func (m Model) updateEntryList(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case entryMoveSyncMsg:
+		m.handleEntryMoveSync(msg)
+		return m, nil
+	case entryRetireSyncMsg:
+		m.finishRetireEntry(msg)
+		return m, nil
 	case tea.KeyMsg:
+		if m.entryMove != nil {
+			return m.updateEntryMove(msg)
+		}
+		if m.editEntry != nil {
+			return m.updateEditEntry(msg)
+		}
+
 		// If a delete confirmation is pending, handle y/n before anything else
 		if m.deleteConfirmEntry != nil {
+			if m.deleteRetiring {
+				return m, nil
+			}
 			switch msg.String() {
 			case "y", "Y":
 				_ = m.cfg.RemoveEntry(m.deleteConfirmEntry.index)
 				m.deleteConfirmEntry = nil
 				m.buildEntryList()
+			case "r", "R":
+				if m.cfg.RepoURL != "" {
+					return m, m.startRetireEntry()
+				}
 			case "n", "N", "esc":
 				m.deleteConfirmEntry = nil
 			}
 			return m, nil
 		}
 
+		if m.hookReviewEntry != nil {
+			return m.updateHookReview(msg)
+		}
+
+		if m.tagEditEntry != nil {
+			switch msg.String() {
+			case "enter":
+				m.cfg.Entries[m.tagEditEntry.index].Tags = config.ParseTags(m.tagInput.Value())
+				_ = m.cfg.Save()
+				m.tagEditEntry = nil
+				m.buildEntryList()
+				return m, nil
+			case "esc":
+				m.tagEditEntry = nil
+				return m, nil
+			}
+			var cmd tea.Cmd
+			m.tagInput, cmd = m.tagInput.Update(msg)
+			return m, cmd
+		}
+
 		// Don't intercept keys when filtering
 		if m.entryList != nil && m.entryList.FilterState() == list.Filtering {
 			break
@@ -187,6 +253,7 @@ func (m Model) updateEntryList(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.addPath = ""
 			m.addName = ""
 			m.addProfileSpecific = false
+			m.addTags = ""
 			m.errMsg = ""
 			cmd := m.buildAddForm()
 			return m, cmd
@@ -198,6 +265,40 @@ func (m Model) updateEntryList(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 			return m, nil
+		case "e":
+			if m.entryList != nil {
+				if sel, ok := m.entryList.SelectedItem().(entryItem); ok {
+					return m, m.beginEditEntry(sel)
+				}
+			}
+			return m, nil
+		case "t":
+			if m.entryList != nil {
+				if sel, ok := m.entryList.SelectedItem().(entryItem); ok {
+					copy := sel
+					m.tagEditEntry = &copy
+					m.tagInput.SetValue(strings.Join(sel.tags, ", "))
+					m.tagInput.CursorEnd()
+					return m, m.tagInput.Focus()
+				}
+			}
+			return m, nil
+		case "h":
+			if m.entryList != nil {
+				if sel, ok := m.entryList.SelectedItem().(entryItem); ok && sel.pendingHooks {
+					copy := sel
+					m.hookReviewEntry = &copy
+				}
+			}
+			return m, nil
+		case "v":
+			if m.entryList != nil {
+				if sel, ok := m.entryList.SelectedItem().(entryItem); ok {
+					m.currentView = viewVariants
+					return m, m.initVariantsView(sel.index)
+				}
+			}
+			return m, nil
 		case "b":
 			m.browserCursor = 0
 			m.currentView = viewConfigBrowser
@@ -206,9 +307,9 @@ func (m Model) updateEntryList(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "p":
 			if m.entryList != nil {
 				if sel, ok := m.entryList.SelectedItem().(entryItem); ok {
-					m.cfg.Entries[sel.index].ProfileSpecific = !m.cfg.Entries[sel.index].ProfileSpecific
-					_ = m.cfg.Save()
-					m.buildEntryList()
+					to := m.cfg.Entries[sel.index]
+					to.ProfileSpecific = !to.ProfileSpecific
+					return m, m.startEntryMove(sel.index, to)
 				}
 			}
 			return m, nil
@@ -243,9 +344,43 @@ func (m Model) viewEntryList() string {
 		b.WriteString("\n")
 		b.WriteString(normalStyle.Render("  Path:  " + m.deleteConfirmEntry.path))
 		b.WriteString("\n\n")
-		b.WriteString(dimStyle.Render("  This removes the entry from dfc. Your actual dotfiles are not touched."))
+		if m.deleteRetiring {
+			b.WriteString(lipgloss.NewStyle().Foreground(accentColor).Render("  ⟳ "))
+			b.WriteString(normalStyle.Render("Removing from the repo..."))
+			b.WriteString(statusBar("please wait"))
+			return m.box().Render(b.String())
+		}
+		b.WriteString(dimStyle.Render("  y  stop tracking it on this device\n  r  retire it everywhere: remove it from the repo and untrack it on other devices\n\n  Your actual dotfiles are not touched."))
 		b.WriteString("\n")
-		b.WriteString(statusBar("y confirm • n/esc cancel"))
+		b.WriteString(statusBar("y this device • r retire everywhere • n/esc cancel"))
+		return m.box().Render(b.String())
+	}
+
+	if m.entryMove != nil && (m.entryMove.syncing || m.entryMove.conflict) {
+		return m.viewEntryMove()
+	}
+
+	if m.editEntry != nil {
+		return m.viewEditEntry()
+	}
+
+	if m.hookReviewEntry != nil {
+		return m.viewHookReview()
+	}
+
+	if m.tagEditEntry != nil {
+		b.WriteString(sectionHeader("🔖", "Entry Tags"))
+		b.WriteString("\n\n")
+		b.WriteString(normalStyle.Render("  Name:  " + m.tagEditEntry.name))
+		b.WriteString("\n")
+		b.WriteString(normalStyle.Render("  Path:  " + m.tagEditEntry.path))
+		b.WriteString("\n\n")
+		b.WriteString("Restore only on devices with one of these tags:\n\n")
+		b.WriteString(m.tagInput.View())
+		b.WriteString("\n\n")
+		b.WriteString(dimStyle.Render("  Leave blank for all devices. A device's profile and OS count as tags.\n  Other devices see the change after your next backup."))
+		b.WriteString("\n")
+		b.WriteString(statusBar("enter save • esc cancel"))
 		return m.box().Render(b.String())
 	}
 
@@ -283,7 +418,15 @@ func (m Model) viewEntryList() string {
 	b.WriteString("\n")
 
 	b.WriteString(m.entryList.View())
-	b.WriteString(statusBar("a add • b browse • d delete • p profile • / filter • esc back"))
+	if m.statusMsg != "" {
+		b.WriteString("\n")
+		b.WriteString(successStyle.Render("✓ " + m.statusMsg))
+	}
+	if m.errMsg != "" {
+		b.WriteString("\n")
+		b.WriteString(errorStyle.Render("✗ " + m.errMsg))
+	}
+	b.WriteString(statusBar("a add • b browse • e edit • d del • p profile • t tags • h hooks • v variants • / filter • esc back"))
 
 	return m.box().Render(b.String())
 }
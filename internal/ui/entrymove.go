@@ -0,0 +1,236 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// entryMoveSyncMsg signals the repo sync before moving an entry's content.
+type entryMoveSyncMsg struct{ err error }
+
+// entryMove tracks moving an entry's repo content: between shared/ and
+// profiles/<p>/ when toggling profile-specific, or to a new path when the
+// entry is renamed.
+type entryMove struct {
+	index    int          // in cfg.Entries
+	to       config.Entry // the entry after the change
+	syncing  bool
+	conflict bool // the target already has content
+	target   manifest.EntryVersion
+}
+
+func (mv *entryMove) rename(from config.Entry) bool { return from.Path != mv.to.Path }
+
+// startEntryMove syncs the repo before migrating the entry's content.
+// Without a repo there is nothing to move, so only the config changes.
+func (m *Model) startEntryMove(index int, to config.Entry) tea.Cmd {
+	m.errMsg = ""
+	m.statusMsg = ""
+	from := m.cfg.Entries[index]
+	// Without a profile both settings store in shared/.
+	sameDir := from.Path == to.Path && m.cfg.DeviceProfile == ""
+	if m.cfg.RepoURL == "" || sameDir {
+		m.cfg.Entries[index] = to
+		_ = m.cfg.Save()
+		m.buildEntryList()
+		return nil
+	}
+
+	m.entryMove = &entryMove{index: index, to: to, syncing: true}
+	rename := m.entryMove.rename(from)
+	return func() tea.Msg {
+		err := gsync.EnsureRepo(m.cfg.RepoURL, m.cfg.RepoPath)
+		if err == nil && rename {
+			// A rename moves every profile's copy.
+			err = gsync.CheckoutAll(m.cfg.RepoPath)
+		}
+		return entryMoveSyncMsg{err: err}
+	}
+}
+
+func (m *Model) handleEntryMoveSync(msg entryMoveSyncMsg) {
+	mv := m.entryMove
+	if mv == nil {
+		return
+	}
+	mv.syncing = false
+	if msg.err != nil {
+		m.entryMove = nil
+		m.errMsg = fmt.Sprintf("Repo sync failed: %v", msg.err)
+		return
+	}
+	from := m.cfg.Entries[mv.index]
+	profile := m.cfg.DeviceProfile
+
+	var exists bool
+	if mv.rename(from) {
+		exists = storage.RelocateTargetExists(m.cfg.RepoPath, from, mv.to)
+	} else {
+		exists = storage.MoveTargetExists(m.cfg.RepoPath, from, mv.to, profile) &&
+			len(storage.SourceDirs(m.cfg.RepoPath, withoutVariant(from), profile)) > 0
+	}
+	if exists {
+		mf, err := manifest.Load(m.cfg.RepoPath)
+		if err != nil {
+			m.entryMove = nil
+			m.errMsg = err.Error()
+			return
+		}
+		mv.conflict = true
+		mv.target = mf.GetEntry(storage.VariantKey(mv.to, profile, ""))
+		return
+	}
+	m.finishEntryMove(false)
+}
+
+func withoutVariant(e config.Entry) config.Entry {
+	e.Variant = ""
+	return e
+}
+
+// finishEntryMove moves the repo content and manifest records, saves the
+// changed entry and commits. keepTarget keeps content already at the target.
+func (m *Model) finishEntryMove(keepTarget bool) {
+	mv := m.entryMove
+	m.entryMove = nil
+	e := &m.cfg.Entries[mv.index]
+	from := *e
+	profile := m.cfg.DeviceProfile
+	rename := mv.rename(from)
+
+	mf, err := manifest.Load(m.cfg.RepoPath)
+	if err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	oldVer := mf.GetVersion(storage.ManifestKey(from, profile))
+	var moved bool
+	if rename {
+		moved, err = storage.RelocateEntry(m.cfg.RepoPath, mf, from, mv.to, keepTarget)
+	} else {
+		moved, err = storage.MoveEntry(m.cfg.RepoPath, mf, from, mv.to, profile, keepTarget)
+	}
+	if err != nil {
+		m.errMsg = fmt.Sprintf("Move failed: %v", err)
+		return
+	}
+
+	*e = mv.to
+	e.Variant = storage.ResolveVariant(m.cfg.RepoPath, *e, profile)
+	if rename {
+		mf.SetMeta(e)
+	}
+	newVer := mf.GetVersion(storage.ManifestKey(*e, profile))
+	switch {
+	case keepTarget && moved:
+		// The kept copy may differ from local; let Restore offer it.
+		e.LocalVersion = 0
+	case e.LocalVersion == oldVer:
+		e.LocalVersion = newVer
+	}
+	_ = m.cfg.Save()
+	m.buildEntryList()
+
+	if !moved && !rename {
+		m.statusMsg = fmt.Sprintf("%s now stored in %s", e.Path, profileDir(*e, profile))
+		return
+	}
+	if err := mf.Save(m.cfg.RepoPath); err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	var msg string
+	switch {
+	case rename:
+		msg = fmt.Sprintf("dfc: rename %s to %s", from.Path, e.Path)
+	case keepTarget:
+		msg = fmt.Sprintf("dfc: drop %s copy of %s, keep %s", profileDir(from, profile), e.Path, profileDir(*e, profile))
+	default:
+		msg = fmt.Sprintf("dfc: move %s from %s to %s", e.Path, profileDir(from, profile), profileDir(*e, profile))
+	}
+	if err := gsync.CommitAndPush(m.cfg.RepoPath, msg); err != nil {
+		m.errMsg = fmt.Sprintf("Push failed: %v", err)
+		return
+	}
+	if rename {
+		m.statusMsg = fmt.Sprintf("Renamed %s to %s", from.Path, e.Path)
+	} else {
+		m.statusMsg = fmt.Sprintf("Moved %s to %s", e.Path, profileDir(*e, profile))
+	}
+}
+
+// profileDir returns "shared/" or "profiles/<p>/" for messages.
+func profileDir(e config.Entry, profile string) string {
+	if e.ProfileSpecific && profile != "" {
+		return "profiles/" + strings.ToLower(profile) + "/"
+	}
+	return "shared/"
+}
+
+func (m Model) updateEntryMove(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.entryMove.syncing {
+		return m, nil
+	}
+	switch msg.String() {
+	case "r":
+		m.finishEntryMove(false)
+	case "k":
+		m.finishEntryMove(true)
+	case "esc", "n":
+		m.entryMove = nil
+	}
+	return m, nil
+}
+
+func (m Model) viewEntryMove() string {
+	var b strings.Builder
+	mv := m.entryMove
+	from := m.cfg.Entries[mv.index]
+	profile := m.cfg.DeviceProfile
+
+	title := "Move Entry"
+	if mv.rename(from) {
+		title = "Rename Entry"
+	}
+	b.WriteString(sectionHeader("👤", title))
+	b.WriteString("\n\n")
+	if mv.syncing {
+		b.WriteString(lipgloss.NewStyle().Foreground(accentColor).Render("⟳ "))
+		b.WriteString(normalStyle.Render("Syncing repository..."))
+		b.WriteString("\n")
+		b.WriteString(statusBar("please wait"))
+		return m.box().Render(b.String())
+	}
+
+	src, dst := profileDir(from, profile), profileDir(mv.to, profile)
+	if mv.rename(from) {
+		src, dst = from.Path, mv.to.Path
+		b.WriteString(normalStyle.Render("  Rename:  " + src + " → " + dst))
+	} else {
+		b.WriteString(normalStyle.Render("  Path:  " + from.Path))
+		b.WriteString("\n")
+		b.WriteString(normalStyle.Render("  Move:  " + src + " → " + dst))
+	}
+	b.WriteString("\n\n")
+	target := dst + " already has a copy in the repo"
+	if mv.target.Version > 0 {
+		target += fmt.Sprintf(" (v%d", mv.target.Version)
+		if mv.target.UpdatedBy != "" {
+			target += " by " + mv.target.UpdatedBy
+		}
+		target += ")"
+	}
+	b.WriteString(warningStyle.Render("  " + target))
+	b.WriteString("\n\n")
+	b.WriteString(dimStyle.Render("  r  replace it with the " + src + " copy\n  k  keep it and drop the " + src + " copy"))
+	b.WriteString("\n")
+	b.WriteString(statusBar("r replace • k keep existing • esc cancel"))
+	return m.box().Render(b.String())
+}
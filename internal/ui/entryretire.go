@@ -0,0 +1,66 @@
+package ui
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// entryRetireSyncMsg signals the repo sync before retiring an entry.
+type entryRetireSyncMsg struct{ err error }
+
+// startRetireEntry syncs the repo before removing the entry pending
+// deletion from it.
+func (m *Model) startRetireEntry() tea.Cmd {
+	m.deleteRetiring = true
+	m.errMsg = ""
+	m.statusMsg = ""
+	return func() tea.Msg {
+		err := gsync.EnsureRepo(m.cfg.RepoURL, m.cfg.RepoPath)
+		if err == nil {
+			err = gsync.CheckoutAll(m.cfg.RepoPath)
+		}
+		return entryRetireSyncMsg{err: err}
+	}
+}
+
+// finishRetireEntry removes every copy of the entry from the repo, leaves a
+// tombstone in the manifest so other devices untrack it, commits, and stops
+// tracking it here.
+func (m *Model) finishRetireEntry(msg entryRetireSyncMsg) {
+	sel := m.deleteConfirmEntry
+	m.deleteRetiring = false
+	m.deleteConfirmEntry = nil
+	if sel == nil {
+		return
+	}
+	if msg.err != nil {
+		m.errMsg = fmt.Sprintf("Repo sync failed: %v", msg.err)
+		return
+	}
+	e := m.cfg.Entries[sel.index]
+
+	mf, err := manifest.Load(m.cfg.RepoPath)
+	if err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	if err := storage.RetireEntry(m.cfg.RepoPath, mf, e); err != nil {
+		m.errMsg = fmt.Sprintf("Could not remove %s from the repo: %v", e.Path, err)
+		return
+	}
+	if err := mf.Save(m.cfg.RepoPath); err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	if err := gsync.CommitAndPush(m.cfg.RepoPath, fmt.Sprintf("dfc: retire %s", e.Path)); err != nil {
+		m.errMsg = fmt.Sprintf("Push failed: %v", err)
+	} else {
+		m.statusMsg = fmt.Sprintf("Retired %s — other devices untrack it on their next sync", e.Path)
+	}
+	_ = m.cfg.RemoveEntry(sel.index)
+	m.buildEntryList()
+}
@@ -0,0 +1,60 @@
+package ui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/solarisjon/dfc/internal/hooks"
+)
+
+// Hooks another device shared for an entry wait in Entry.PendingHooks until
+// they are accepted here: they are commands, and the repo is writable by
+// anyone who can push to it.
+
+func (m Model) updateHookReview(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	e := &m.cfg.Entries[m.hookReviewEntry.index]
+	switch msg.String() {
+	case "y", "Y":
+		e.AcceptHooks()
+		m.statusMsg = "Accepted the hooks of " + e.Path
+	case "r", "R":
+		e.RejectHooks()
+		m.statusMsg = "Kept this device's hooks for " + e.Path + " — your next backup shares them"
+	case "esc", "n", "N":
+		m.hookReviewEntry = nil
+		return m, nil
+	default:
+		return m, nil
+	}
+	m.hookReviewEntry = nil
+	if err := m.cfg.Save(); err != nil {
+		m.statusMsg = ""
+		m.errMsg = "Could not save config: " + err.Error()
+	}
+	m.buildEntryList()
+	return m, nil
+}
+
+func (m Model) viewHookReview() string {
+	var b strings.Builder
+	e := m.cfg.Entries[m.hookReviewEntry.index]
+
+	b.WriteString(sectionHeader("⚠", "Hooks From Another Device"))
+	b.WriteString("\n\n")
+	b.WriteString(normalStyle.Render("  Name:  " + m.hookReviewEntry.name))
+	b.WriteString("\n")
+	b.WriteString(normalStyle.Render("  Path:  " + e.Path))
+	b.WriteString("\n\n")
+	b.WriteString("These commands would run on this machine around backup and restore:\n\n")
+	if e.PendingHooks != nil {
+		for _, c := range hooks.Changes(e.Hooks, *e.PendingHooks) {
+			b.WriteString(warningStyle.Render("  " + c))
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render("  Until you accept them, this device keeps running its own hooks."))
+	b.WriteString("\n")
+	b.WriteString(statusBar("y accept • r keep mine • esc decide later"))
+	return m.box().Render(b.String())
+}
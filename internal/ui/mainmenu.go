@@ -3,10 +3,10 @@ package ui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	gsync "github.com/solarisjon/dfc/internal/sync"
 )
 
 func (m Model) updateMainMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -26,7 +26,7 @@ func (m Model) updateMainMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case 0: // Backup
 				if m.needsProfile() {
 					m.profileInput.SetValue("")
-					m.profileInput.Focus()
+					m.resetProfileFields()
 					m.profileReturn = viewBackup
 					m.currentView = viewProfileEdit
 					m.errMsg = ""
@@ -37,7 +37,7 @@ func (m Model) updateMainMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case 1: // Restore
 				if m.needsProfile() {
 					m.profileInput.SetValue("")
-					m.profileInput.Focus()
+					m.resetProfileFields()
 					m.profileReturn = viewRestore
 					m.currentView = viewProfileEdit
 					m.errMsg = ""
@@ -60,17 +60,16 @@ func (m Model) updateMainMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			case 6: // Device Profile
 				m.profileInput.SetValue(m.cfg.DeviceProfile)
-				m.profileInput.Focus()
+				m.resetProfileFields()
 				m.profileReturn = viewMainMenu
 				m.currentView = viewProfileEdit
 				m.errMsg = ""
 				return m, m.profileInput.Focus()
 			case 7: // Settings
 				m.currentView = viewSetup
-				m.setupStep = setupStepGhCheck
-				m.ghStatus = gsync.GhChecking
+				m.setupStep = setupStepGitID
 				m.errMsg = ""
-				return m, m.checkGh()
+				return m, m.checkGitID()
 			}
 			return m, nil
 		case "q", "esc":
@@ -89,6 +88,9 @@ func (m Model) viewMainMenu() string {
 
 	for i, item := range m.menuItems {
 		icon := menuIcons[i]
+		if i == 0 && !m.cfg.UnpushedSince.IsZero() {
+			item += " " + warningStyle.Render("⇡ pending push")
+		}
 		if i == m.menuCursor {
 			b.WriteString(menuSelectedStyle.Render("▸ " + icon + "  " + item))
 			b.WriteString("\n")
@@ -119,6 +121,19 @@ func (m Model) viewMainMenu() string {
 			b.WriteString(lipgloss.NewStyle().Foreground(accentColor).Render(m.cfg.DeviceProfile))
 			b.WriteString("\n")
 		}
+		if m.lastRun != nil {
+			b.WriteString(dimStyle.Render("  ⏱ "))
+			b.WriteString(m.lastRunLine())
+			b.WriteString("\n")
+		}
+		if line := m.unpushedLine(); line != "" {
+			b.WriteString("  " + line)
+			b.WriteString("\n")
+		}
+		if n := m.pendingHooks(); n > 0 {
+			b.WriteString("  " + warningStyle.Render("⚠ Hooks from another device wait for review on "+pluralize(n, "entry", "entries")+" — press h in Manage Entries"))
+			b.WriteString("\n")
+		}
 	} else {
 		b.WriteString(helpStyle.Render("  No entries tracked yet — start with Manage Entries"))
 		b.WriteString("\n")
@@ -129,6 +144,42 @@ func (m Model) viewMainMenu() string {
 	return m.box().Render(b.String())
 }
 
+// pendingHooks counts entries with hooks from another device to review.
+func (m Model) pendingHooks() int {
+	n := 0
+	for _, e := range m.cfg.Entries {
+		if e.PendingHooks != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// lastRunLine summarises the most recent scheduled run for the info panel.
+func (m Model) lastRunLine() string {
+	r := m.lastRun
+	label := fmt.Sprintf("Scheduled %s %s", r.Mode, timeAgo(r.FinishedAt))
+	if !r.OK {
+		return errorStyle.Render("✗ " + label + " — failed")
+	}
+	return helpStyle.Render(label+" — ") + successStyle.Render("✓ "+r.Summary)
+}
+
+// timeAgo renders t relative to now, e.g. "5m ago".
+func timeAgo(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
 var menuIcons = []string{"⬆", "⬇", "📦", "📋", "🌐", "🔄", "👤", "⚙"}
 
 // needsProfile returns true if there are profile-specific entries but no device profile set.
@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"strings"
+
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
@@ -9,8 +11,12 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/solarisjon/dfc/internal/backup"
 	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/devices"
+	"github.com/solarisjon/dfc/internal/hooks"
 	"github.com/solarisjon/dfc/internal/manifest"
 	"github.com/solarisjon/dfc/internal/restore"
+	"github.com/solarisjon/dfc/internal/schedule"
+	"github.com/solarisjon/dfc/internal/storage"
 	gsync "github.com/solarisjon/dfc/internal/sync"
 )
 
@@ -28,6 +34,8 @@ const (
 	viewRemote
 	viewReset
 	viewProfileEdit
+	viewVariants
+	viewPrune
 )
 
 // Model is the root bubbletea model.
@@ -40,11 +48,20 @@ type Model struct {
 	// Main menu
 	menuItems    []string
 	menuCursor   int
+	lastRun      *schedule.LastRun // most recent scheduled backup/pull, if any
 
 	// Entry list
 	entryCursor        int
 	entryList          *list.Model
 	deleteConfirmEntry *entryItem // entry pending deletion (nil = not confirming)
+	deleteRetiring     bool       // removing the entry from the repo
+	tagEditEntry       *entryItem // entry whose tags are being edited (nil = not editing)
+	hookReviewEntry    *entryItem // entry whose pending hooks are being reviewed (nil = none)
+	entryMove          *entryMove // profile toggle or rename in progress (nil = none)
+	tagInput           textinput.Model
+	editEntry          *entryItem // entry being edited (nil = not editing)
+	editInputs         []textinput.Model
+	editField          int
 
 	// Add entry (huh form)
 	addForm            *huh.Form
@@ -53,6 +70,7 @@ type Model struct {
 	addStep            int // 0=path phase, 1=name+profile phase
 	addIsDir           bool
 	addProfileSpecific bool
+	addTags            string // comma-separated
 
 	// Config browser
 	browserDirs   []browserItem
@@ -62,6 +80,9 @@ type Model struct {
 	setupStep   int // setupStep* constants
 	setupMethod int // 0=existing, 1=create
 	setupInput  textinput.Model
+	setupURL    string // remote URL being verified
+	setupProvider    int    // index into provider.Kinds for a new repo
+	setupProviderURL string // self-hosted server for a new repo
 	ghStatus    gsync.GhStatus
 	gitID       gsync.GitIdentity   // current git identity
 	gitNameIn   textinput.Model     // input for git user.name
@@ -75,6 +96,13 @@ type Model struct {
 	backupCh         <-chan backup.Progress
 	backupConflicts  []string // entry paths that were updated remotely
 	backupConfirmed  bool
+	backupLayerAsk   []layerQuestion // layered entries whose new files need a layer
+	backupDiverged   *divergedBackup   // backup commit that could not be rebased onto the remote
+	backupContests   []storage.Contest // entries another device backed up at the same time
+	backupPlanning   bool              // working out what the backup adds to the repo
+	backupPlan       []backup.Progress // a backup over the confirm size, awaiting confirmation
+	backupSizeOK     bool              // the user confirmed the backup's size
+	offline          bool              // the last repo sync couldn't reach the remote
 
 	// Restore selection
 	restoreStep      int
@@ -83,6 +111,7 @@ type Model struct {
 	restoreCh        <-chan restore.Progress
 	restoreManifest  *manifest.Manifest
 	restoreConfirmed bool
+	restoreHidden    int // entries excluded by tags
 
 	// Bootstrap (import from repo)
 	bootstrapStep     int
@@ -97,14 +126,33 @@ type Model struct {
 	remoteEntries []remoteEntry
 	remoteSyncing bool
 	remoteTable   *table.Model
+	remoteDevices *devices.Registry
+	remoteShowDev bool // show the device matrix instead of the entry table
+
+	// Variants view
+	variantEntry      int // index in cfg.Entries
+	variantItems      []variantItem
+	variantCursor     int
+	variantSyncing    bool
+	variantConfirmDel bool
+
+	// Prune view
+	pruneOrphans storage.Orphans
+	pruneSyncing bool
+	pruneDone    bool
 
 	// Reset view
 	resetStep      int
 	resetConfirmed bool
 	resetType      int
+	resetLocalWork []string // what a local reset would lose; the clone is moved aside instead
 
 	// Profile edit
 	profileInput   textinput.Model
+	deviceTagsIn   textinput.Model
+	parentsIn      textinput.Model
+	parentsLoaded  string // parents as loaded, to detect edits
+	profileField   int    // 0=profile, 1=device tags, 2=parents
 	profileReturn  view // view to return to after profile edit
 
 	quitting bool
@@ -119,6 +167,40 @@ type progressItem struct {
 	skipped     int
 	skipReasons []string
 	warning     string
+	hooks       []hooks.Result
+	layers      []string
+	repoFiles   int   // files the backup added to or changed in the repo
+	repoNew     int   // of repoFiles, files new to the repo
+	repoBytes   int64 // their size
+	lfsBytes    int64 // of repoBytes, what went through Git LFS
+}
+
+// maxHookOutputLines limits how much of a hook's output is shown per result.
+const maxHookOutputLines = 3
+
+// renderHookResults renders hook outcomes and the tail of their output
+// beneath a progress line. Returns "" if no hooks ran.
+func renderHookResults(results []hooks.Result) string {
+	var b strings.Builder
+	for _, r := range results {
+		b.WriteString("\n      ")
+		if r.Failed() {
+			b.WriteString(warningStyle.Render("↳ " + r.Summary()))
+		} else {
+			b.WriteString(helpStyle.Render("↳ " + r.Summary()))
+		}
+		if r.Output == "" {
+			continue
+		}
+		lines := strings.Split(r.Output, "\n")
+		if len(lines) > maxHookOutputLines {
+			lines = lines[len(lines)-maxHookOutputLines:]
+		}
+		for _, line := range lines {
+			b.WriteString("\n      " + dimStyle.Render("  │ "+line))
+		}
+	}
+	return b.String()
 }
 
 const (
@@ -177,34 +259,48 @@ func New(cfg *config.Config) Model {
 	profileTi.CharLimit = 50
 	profileTi.Width = 30
 
+	deviceTagsTi := textinput.New()
+	deviceTagsTi.Placeholder = "laptop, gui"
+	deviceTagsTi.CharLimit = 200
+	deviceTagsTi.Width = 30
+
+	parentsTi := textinput.New()
+	parentsTi.Placeholder = "base"
+	parentsTi.CharLimit = 200
+	parentsTi.Width = 30
+
+	tagTi := textinput.New()
+	tagTi.Placeholder = "work, linux"
+	tagTi.CharLimit = 200
+	tagTi.Width = 30
+
 	startView := viewMainMenu
 	if !cfg.IsConfigured() {
 		startView = viewSetup
 	}
 
-	// Check gh status synchronously before building model
-	var ghSt gsync.GhStatus
-	if startView == viewSetup {
-		ghSt = gsync.CheckGh()
-	}
-
-	initialStep := setupStepGhCheck
-	if ghSt == gsync.GhReady {
-		_ = gsync.SetupGitCredentialHelper()
-		initialStep = setupStepChoose
+	lastRun, _ := schedule.LoadLastRun()
+	if startView == viewMainMenu {
+		gsync.TrackUnpushed(cfg) // a scheduled run may have pushed since
 	}
 
 	return Model{
 		cfg:         cfg,
+		lastRun:     lastRun,
 		currentView: startView,
 		menuItems:   []string{"Backup", "Restore", "Import from Repo", "Manage Entries", "Remote Status", "Reset", "Device Profile", "Settings"},
 		profileInput: profileTi,
-		ghStatus:    ghSt,
-		setupStep:   initialStep,
+		deviceTagsIn: deviceTagsTi,
+		parentsIn:    parentsTi,
+		tagInput:     tagTi,
+		setupStep:   setupStepGitID,
 	}
 }
 
 func (m Model) Init() tea.Cmd {
+	if m.currentView == viewSetup {
+		return m.checkGitID()
+	}
 	return nil
 }
 
@@ -229,6 +325,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	case backupProgressMsg:
 		return m.handleBackupProgress(msg)
+	case backupPlanMsg:
+		return m.handleBackupPlan(msg)
 	case repoSyncDoneMsg:
 		return m.handleRepoSyncDone(msg)
 	case restoreProgressMsg:
@@ -280,6 +378,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.updateResetView(msg)
 	case viewProfileEdit:
 		return m.updateProfileEdit(msg)
+	case viewVariants:
+		return m.updateVariantsView(msg)
+	case viewPrune:
+		return m.updatePruneView(msg)
 	}
 
 	return m, nil
@@ -313,6 +415,10 @@ func (m Model) View() string {
 		return m.viewResetView()
 	case viewProfileEdit:
 		return m.viewProfileEdit()
+	case viewVariants:
+		return m.viewVariants()
+	case viewPrune:
+		return m.viewPrune()
 	}
 
 	return ""
@@ -0,0 +1,38 @@
+package ui
+
+import (
+	"errors"
+
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// noteSync records whether a repo sync found the remote unreachable. An
+// offline sync is not an error: backup and restore carry on against the
+// local clone as last fetched. Returns err unless it was only that.
+func (m *Model) noteSync(err error) error {
+	m.offline = errors.Is(err, gsync.ErrOffline)
+	if m.offline {
+		return nil
+	}
+	return err
+}
+
+// offlineNotice warns that the repo shown is the last fetched state.
+func (m Model) offlineNotice() string {
+	if !m.offline {
+		return ""
+	}
+	when := "at an unknown time"
+	if t := gsync.LastFetched(m.cfg.RepoPath); !t.IsZero() {
+		when = timeAgo(t)
+	}
+	return warningStyle.Render("⚠ Offline — the remote can't be reached. Using the repo as last fetched " + when + ".")
+}
+
+// unpushedLine describes backups waiting to be pushed, for the main menu.
+func (m Model) unpushedLine() string {
+	if m.cfg.UnpushedSince.IsZero() {
+		return ""
+	}
+	return warningStyle.Render("⇡ Backups not pushed since " + timeAgo(m.cfg.UnpushedSince) + " — they go up on the next sync")
+}
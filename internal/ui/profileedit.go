@@ -1,11 +1,44 @@
 package ui
 
 import (
+	"fmt"
+	"runtime"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/storage"
+	gsync "github.com/solarisjon/dfc/internal/sync"
 )
 
+// resetProfileFields loads the current device tags and profile parents and
+// puts focus back on the profile name field.
+func (m *Model) resetProfileFields() {
+	m.deviceTagsIn.SetValue(strings.Join(m.cfg.DeviceTags, ", "))
+	m.deviceTagsIn.Blur()
+
+	m.parentsLoaded = ""
+	if profiles, err := storage.LoadProfiles(m.cfg.RepoPath); err == nil && m.cfg.DeviceProfile != "" {
+		m.parentsLoaded = strings.Join(profiles.Profiles[m.cfg.DeviceProfile].Parents, ", ")
+	}
+	m.parentsIn.SetValue(m.parentsLoaded)
+	m.parentsIn.Blur()
+
+	m.profileField = 0
+}
+
+// focusProfileField focuses the input for m.profileField and blurs the others.
+func (m *Model) focusProfileField() tea.Cmd {
+	inputs := []*textinput.Model{&m.profileInput, &m.deviceTagsIn, &m.parentsIn}
+	for i, in := range inputs {
+		if i != m.profileField {
+			in.Blur()
+		}
+	}
+	return inputs[m.profileField].Focus()
+}
+
 func (m Model) updateProfileEdit(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -13,14 +46,33 @@ func (m Model) updateProfileEdit(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "esc":
 			m.currentView = m.profileReturn
 			return m, nil
+		case "tab":
+			m.profileField = (m.profileField + 1) % 3
+			return m, m.focusProfileField()
+		case "shift+tab":
+			m.profileField = (m.profileField + 2) % 3
+			return m, m.focusProfileField()
 		case "enter":
 			profile := strings.ToLower(strings.TrimSpace(m.profileInput.Value()))
 			if profile == "" {
 				m.errMsg = "Profile name cannot be empty"
 				return m, nil
 			}
+			if parents := strings.TrimSpace(m.parentsIn.Value()); parents != m.parentsLoaded {
+				list := strings.FieldsFunc(parents, func(r rune) bool { return r == ',' || r == ' ' })
+				if err := m.saveProfileParents(profile, list); err != nil {
+					m.errMsg = fmt.Sprintf("Could not save layers: %v", err)
+					return m, nil
+				}
+			}
 			m.cfg.DeviceProfile = profile
+			m.cfg.DeviceTags = config.ParseTags(m.deviceTagsIn.Value())
 			_ = m.cfg.Save()
+			gsync.SetCheckout(m.cfg)
+			if err := gsync.UpdateSparse(m.cfg.RepoPath); err != nil {
+				m.errMsg = fmt.Sprintf("Could not check out the profile's content: %v", err)
+				return m, nil
+			}
 			m.errMsg = ""
 			m.currentView = m.profileReturn
 			// If returning to backup or restore, start the action
@@ -35,10 +87,35 @@ func (m Model) updateProfileEdit(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 
 	var cmd tea.Cmd
-	m.profileInput, cmd = m.profileInput.Update(msg)
+	switch m.profileField {
+	case 0:
+		m.profileInput, cmd = m.profileInput.Update(msg)
+	case 1:
+		m.deviceTagsIn, cmd = m.deviceTagsIn.Update(msg)
+	case 2:
+		m.parentsIn, cmd = m.parentsIn.Update(msg)
+	}
 	return m, cmd
 }
 
+// saveProfileParents records the layers profile inherits from in the repo
+// and pushes the change so every device resolves the same layers.
+func (m *Model) saveProfileParents(profile string, parents []string) error {
+	profiles, err := storage.LoadProfiles(m.cfg.RepoPath)
+	if err != nil {
+		return err
+	}
+	profiles.SetParents(profile, parents)
+	if err := profiles.Save(m.cfg.RepoPath); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("dfc: profile %s inherits %s", profile, strings.Join(parents, ", "))
+	if len(parents) == 0 {
+		msg = fmt.Sprintf("dfc: profile %s inherits nothing", profile)
+	}
+	return gsync.CommitAndPush(m.cfg.RepoPath, msg)
+}
+
 func (m Model) viewProfileEdit() string {
 	var b strings.Builder
 
@@ -56,13 +133,23 @@ func (m Model) viewProfileEdit() string {
 	b.WriteString(m.profileInput.View())
 	b.WriteString("\n\n")
 	b.WriteString(helpStyle.Render("Examples: work, home, laptop, server"))
+	b.WriteString("\n\n")
+	b.WriteString("Device tags:\n\n")
+	b.WriteString(m.deviceTagsIn.View())
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("Tagged entries restore only on devices with a matching tag.\nThe profile name and OS (" + runtime.GOOS + ") are always included."))
+	b.WriteString("\n\n")
+	b.WriteString("Inherits from:\n\n")
+	b.WriteString(m.parentsIn.View())
+	b.WriteString("\n\n")
+	b.WriteString(helpStyle.Render("Profile-specific entries fall back to these layers, most specific first.\nShared by every device using this profile."))
 
 	if m.errMsg != "" {
 		b.WriteString("\n\n")
 		b.WriteString(errorStyle.Render("✗ " + m.errMsg))
 	}
 
-	b.WriteString(statusBar("enter save • esc cancel"))
+	b.WriteString(statusBar("tab switch field • enter save • esc cancel"))
 
 	return m.box().Render(b.String())
 }
@@ -0,0 +1,144 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// pruneSyncDoneMsg signals the repo sync before looking for orphans.
+type pruneSyncDoneMsg struct{ err error }
+
+func (m *Model) initPruneView() tea.Cmd {
+	m.pruneOrphans = storage.Orphans{}
+	m.pruneSyncing = true
+	m.pruneDone = false
+	m.errMsg = ""
+	m.statusMsg = ""
+	return func() tea.Msg {
+		err := gsync.EnsureRepo(m.cfg.RepoURL, m.cfg.RepoPath)
+		if err == nil {
+			// Other profiles' content must be on disk, or it looks missing.
+			err = gsync.CheckoutAll(m.cfg.RepoPath)
+		}
+		return pruneSyncDoneMsg{err: err}
+	}
+}
+
+func (m Model) updatePruneView(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case pruneSyncDoneMsg:
+		m.pruneSyncing = false
+		if msg.err != nil {
+			m.errMsg = fmt.Sprintf("Repo sync failed: %v", msg.err)
+			return m, nil
+		}
+		mf, err := manifest.Load(m.cfg.RepoPath)
+		if err != nil {
+			m.errMsg = err.Error()
+			return m, nil
+		}
+		m.pruneOrphans = storage.FindOrphans(m.cfg.RepoPath, mf)
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.pruneSyncing {
+			return m, nil
+		}
+		switch msg.String() {
+		case "y", "enter":
+			if !m.pruneOrphans.Empty() && !m.pruneDone {
+				m.prune()
+			}
+		case "esc", "q", "n":
+			m.currentView = viewRemote
+			return m, m.initRemoteView()
+		}
+	}
+	return m, nil
+}
+
+// prune removes the orphans found and commits the result.
+func (m *Model) prune() {
+	mf, err := manifest.Load(m.cfg.RepoPath)
+	if err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	o := m.pruneOrphans
+	if err := storage.RemoveOrphans(m.cfg.RepoPath, mf, o); err != nil {
+		m.errMsg = fmt.Sprintf("Prune failed: %v", err)
+		return
+	}
+	if err := mf.Save(m.cfg.RepoPath); err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	msg := fmt.Sprintf("dfc: prune %d orphaned paths, %d manifest keys", len(o.Paths), len(o.Keys))
+	if err := gsync.CommitAndPush(m.cfg.RepoPath, msg); err != nil {
+		m.errMsg = fmt.Sprintf("Push failed: %v", err)
+		return
+	}
+	m.pruneDone = true
+	m.statusMsg = fmt.Sprintf("Removed %d paths and %d manifest keys", len(o.Paths), len(o.Keys))
+}
+
+func (m Model) viewPrune() string {
+	var b strings.Builder
+
+	b.WriteString(sectionHeader("🧹", "Prune Repository"))
+	b.WriteString("\n\n")
+
+	if m.pruneSyncing {
+		b.WriteString(lipgloss.NewStyle().Foreground(accentColor).Render("⟳ "))
+		b.WriteString(normalStyle.Render("Syncing repository..."))
+		b.WriteString("\n")
+		b.WriteString(statusBar("please wait"))
+		return m.box().Render(b.String())
+	}
+
+	if m.errMsg != "" {
+		b.WriteString(errorStyle.Render("✗ " + m.errMsg))
+		b.WriteString(statusBar("esc back"))
+		return m.box().Render(b.String())
+	}
+	if m.pruneDone {
+		b.WriteString(successStyle.Render("✓ " + m.statusMsg))
+		b.WriteString(statusBar("esc back"))
+		return m.box().Render(b.String())
+	}
+
+	o := m.pruneOrphans
+	if o.Empty() {
+		b.WriteString(successStyle.Render("✓ Nothing to prune — repo content and manifest match"))
+		b.WriteString(statusBar("esc back"))
+		return m.box().Render(b.String())
+	}
+
+	if len(o.Paths) > 0 {
+		b.WriteString(normalStyle.Render("In the repo but not in the manifest:"))
+		b.WriteString("\n")
+		for _, p := range o.Paths {
+			b.WriteString(warningStyle.Render("  − " + p))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	if len(o.Keys) > 0 {
+		b.WriteString(normalStyle.Render("In the manifest but missing from the repo:"))
+		b.WriteString("\n")
+		for _, k := range o.Keys {
+			b.WriteString(warningStyle.Render("  − " + k))
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(dimStyle.Render("Everything above is removed in one commit. Local files are not touched."))
+	b.WriteString(statusBar("y prune • esc cancel"))
+	return m.box().Render(b.String())
+}
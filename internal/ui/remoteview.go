@@ -2,11 +2,15 @@ package ui
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/devices"
 	"github.com/solarisjon/dfc/internal/entry"
 	"github.com/solarisjon/dfc/internal/hash"
 	"github.com/solarisjon/dfc/internal/manifest"
@@ -20,8 +24,8 @@ func (m Model) updateRemoteView(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case remoteViewSyncMsg:
 		m.remoteSyncing = false
-		if msg.err != nil {
-			m.errMsg = msg.err.Error()
+		if err := m.noteSync(msg.err); err != nil {
+			m.errMsg = err.Error()
 		} else {
 			m.loadRemoteData()
 			m.buildRemoteTable()
@@ -30,10 +34,26 @@ func (m Model) updateRemoteView(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "esc", "q":
+			if m.remoteShowDev {
+				m.remoteShowDev = false
+				return m, nil
+			}
 			m.currentView = viewMainMenu
 			return m, nil
+		case "d":
+			m.remoteShowDev = !m.remoteShowDev
+			return m, nil
+		case "p":
+			if m.remoteSyncing {
+				return m, nil
+			}
+			m.currentView = viewPrune
+			return m, m.initPruneView()
 		}
 	}
+	if m.remoteShowDev {
+		return m, nil
+	}
 	// Forward to the table for scrolling/navigation
 	if m.remoteTable != nil {
 		t, cmd := m.remoteTable.Update(msg)
@@ -47,7 +67,7 @@ func (m *Model) buildRemoteTable() {
 	cw := m.contentWidth()
 
 	// Compute proportional column widths
-	fixedW := 8 + 8 + 22 + 6 // Remote + Local + Status + spacing
+	fixedW := 12 + 8 + 8 + 22 + 8 // Layer + Remote + Local + Status + spacing
 	flexW := cw - fixedW
 	if flexW < 20 {
 		flexW = 20
@@ -58,6 +78,7 @@ func (m *Model) buildRemoteTable() {
 	cols := []table.Column{
 		{Title: "Name", Width: nameW},
 		{Title: "Path", Width: pathW},
+		{Title: "Layer", Width: 12},
 		{Title: "Remote", Width: 8},
 		{Title: "Local", Width: 8},
 		{Title: "Status", Width: 22},
@@ -98,7 +119,7 @@ func (m *Model) buildRemoteTable() {
 			status = "—"
 		}
 
-		rows[i] = table.Row{re.name, re.path, remoteStr, localStr, status}
+		rows[i] = table.Row{re.name, re.path, re.layer, remoteStr, localStr, status}
 	}
 
 	s := table.DefaultStyles()
@@ -116,6 +137,9 @@ func (m *Model) buildRemoteTable() {
 
 	height := len(rows)
 	maxH := m.listHeight(10) // header + detail panel + status + chrome
+	if m.offline {
+		maxH -= 2
+	}
 	if height > maxH {
 		height = maxH
 	}
@@ -142,12 +166,17 @@ type remoteEntry struct {
 	isLocal         bool // exists in local config
 	isRemote        bool // exists in remote manifest
 	localModified   bool // local content differs from last known hash
-	profileSpecific bool // entry is profile-specific
+	profileSpecific bool   // entry is profile-specific
+	layer           string // where the repo copy lives: shared, a profile, or layers like "work+base"
+	conflict        string // set when a manifest merge picked between two devices' versions
 }
 
 func (m *Model) initRemoteView() tea.Cmd {
 	m.remoteSyncing = true
+	m.offline = false
 	m.remoteEntries = nil
+	m.remoteDevices = nil
+	m.remoteShowDev = false
 	m.errMsg = ""
 	return func() tea.Msg {
 		err := gsync.EnsureRepo(m.cfg.RepoURL, m.cfg.RepoPath)
@@ -162,6 +191,14 @@ func (m *Model) loadRemoteData() {
 		return
 	}
 
+	if storage.Reconcile(m.cfg, mf).Changed {
+		_ = m.cfg.Save()
+	}
+	gsync.TrackUnpushed(m.cfg)
+
+	// Device registry is optional — older repos don't have one.
+	m.remoteDevices, _ = devices.Load(m.cfg.RepoPath)
+
 	var entries []remoteEntry
 
 	// Track which manifest keys we've seen
@@ -181,12 +218,17 @@ func (m *Model) loadRemoteData() {
 			isRemote:  ev.Version > 0,
 			isLocal:   true,
 			localVer:  e.LocalVersion,
+			conflict:  ev.Conflict,
 		}
 		if re.name == "" {
 			re.name = entry.FriendlyName(e.Path)
 		}
-		if e.ProfileSpecific {
+		re.layer = "shared"
+		if e.Variant != "" {
+			re.layer = e.Variant
+		} else if e.ProfileSpecific {
 			re.profileSpecific = true
+			re.layer = entryLayerLabel(m.cfg.RepoPath, e, m.cfg.DeviceProfile)
 		}
 		// Detect local modifications via hash comparison
 		if e.LastHash != "" {
@@ -207,11 +249,13 @@ func (m *Model) loadRemoteData() {
 		displayPath := manifestKeyToPath(mkey)
 		re := remoteEntry{
 			path:      displayPath,
+			layer:     manifestKeyLayer(mkey),
 			name:      entry.FriendlyName(displayPath),
 			repoVer:   ev.Version,
 			updatedBy: ev.UpdatedBy,
 			isRemote:  true,
 			isLocal:   false,
+			conflict:  ev.Conflict,
 		}
 		entries = append(entries, re)
 	}
@@ -219,10 +263,46 @@ func (m *Model) loadRemoteData() {
 	m.remoteEntries = entries
 }
 
+// entryLayerLabel describes which layers a profile-specific entry is restored
+// from on this device, most specific first, e.g. "work+base".
+func entryLayerLabel(repoPath string, e config.Entry, profile string) string {
+	layers := storage.EntryLayers(repoPath, e, profile)
+	if len(layers) <= 1 {
+		return orDash(profile)
+	}
+	found := storage.ExistingLayers(repoPath, e, layers)
+	if len(found) == 0 {
+		return "—"
+	}
+	return strings.Join(found, "+")
+}
+
+// manifestKeyLayer returns "shared", the profile name or the variant name
+// from a manifest key.
+func manifestKeyLayer(key string) string {
+	if strings.HasPrefix(key, "variants/") || strings.HasPrefix(key, "profiles/") {
+		rest := key[len("profiles/"):]
+		if idx := strings.Index(rest, "/"); idx >= 0 {
+			return rest[:idx]
+		}
+	}
+	if strings.HasPrefix(key, "shared/") {
+		return "shared"
+	}
+	return "—"
+}
+
 // manifestKeyToPath extracts the original entry path from a manifest key.
 // "shared/~/.bashrc" → "~/.bashrc"
 // "profiles/work/~/.config/claude" → "~/.config/claude"
+// "variants/os-linux/shared/~/.bashrc" → "~/.bashrc"
 func manifestKeyToPath(key string) string {
+	if strings.HasPrefix(key, "variants/") {
+		rest := key[len("variants/"):]
+		if idx := strings.Index(rest, "/"); idx >= 0 {
+			return manifestKeyToPath(rest[idx+1:])
+		}
+	}
 	if strings.HasPrefix(key, "shared/") {
 		return key[len("shared/"):]
 	}
@@ -256,6 +336,11 @@ func (m Model) viewRemoteView() string {
 		return m.box().Render(b.String())
 	}
 
+	if notice := m.offlineNotice(); notice != "" {
+		b.WriteString(notice)
+		b.WriteString("\n\n")
+	}
+
 	if len(m.remoteEntries) == 0 {
 		b.WriteString(helpStyle.Render("No entries found in remote or local config."))
 		b.WriteString("\n\n")
@@ -263,13 +348,19 @@ func (m Model) viewRemoteView() string {
 		return m.box().Render(b.String())
 	}
 
+	if m.remoteShowDev {
+		b.WriteString(m.viewDeviceMatrix())
+		b.WriteString(statusBar("d entries • esc back"))
+		return m.box().Render(b.String())
+	}
+
 	if m.remoteTable != nil {
 		b.WriteString(m.remoteTable.View())
 		b.WriteString("\n")
 
 		// Color-coded status legend
 		row := m.remoteTable.SelectedRow()
-		if len(row) > 4 {
+		if len(row) > 5 {
 			detail := m.remoteStatusDetail(row)
 			if detail != "" {
 				b.WriteString("\n")
@@ -278,14 +369,113 @@ func (m Model) viewRemoteView() string {
 		}
 	}
 
-	b.WriteString(statusBar("↑/↓ navigate • esc back"))
+	b.WriteString(statusBar("↑/↓ navigate • d devices • p prune repo • esc back"))
 
 	return m.box().Render(b.String())
 }
 
+// viewDeviceMatrix renders every registered device and, per manifest key,
+// which version each device last synced compared to the repo.
+func (m Model) viewDeviceMatrix() string {
+	var b strings.Builder
+
+	reg := m.remoteDevices
+	if reg == nil || len(reg.Devices) == 0 {
+		b.WriteString(helpStyle.Render("No devices registered yet — devices appear after their next backup or restore."))
+		b.WriteString("\n")
+		return b.String()
+	}
+	hosts := reg.Hostnames()
+	self := devices.Hostname()
+
+	// Device summary
+	for _, h := range hosts {
+		d := reg.Devices[h]
+		name := h
+		if h == self {
+			name += " (this device)"
+		}
+		b.WriteString(selectedStyle.Render("  " + name))
+		b.WriteString(helpStyle.Render(fmt.Sprintf("  %s · %s · dfc %s", orDash(d.Profile), d.OS, d.Version)))
+		b.WriteString("\n")
+		b.WriteString(dimStyle.Render(fmt.Sprintf("    backup %s · restore %s", agoOrNever(d.LastBackup), agoOrNever(d.LastRestore))))
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	mf, err := manifest.Load(m.cfg.RepoPath)
+	if err != nil || len(mf.Entries) == 0 {
+		return b.String()
+	}
+	keys := make([]string, 0, len(mf.Entries))
+	for k := range mf.Entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Matrix: one row per manifest key, one column per device
+	cw := m.contentWidth()
+	colW := 10
+	nameW := cw - colW*len(hosts) - 2
+	if nameW < 16 {
+		nameW = 16
+	}
+	header := "  " + padRight("ENTRY", nameW)
+	for _, h := range hosts {
+		header += padRight(h, colW)
+	}
+	b.WriteString(dimStyle.Render(header))
+	b.WriteString("\n")
+
+	for _, k := range keys {
+		repoVer := mf.GetVersion(k)
+		b.WriteString("  " + normalStyle.Render(padRight(k, nameW)))
+		for _, h := range hosts {
+			v, ok := reg.Devices[h].Entries[k]
+			switch {
+			case !ok:
+				b.WriteString(dimStyle.Render(padRight("—", colW)))
+			case v >= repoVer:
+				b.WriteString(successStyle.Render(padRight(fmt.Sprintf("v%d ✓", v), colW)))
+			default:
+				b.WriteString(warningStyle.Render(padRight(fmt.Sprintf("v%d -%d", v, repoVer-v), colW)))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func agoOrNever(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return timeAgo(t)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
+
 // remoteStatusDetail returns a color-styled detail line for the selected row.
 func (m Model) remoteStatusDetail(row table.Row) string {
-	status := row[4]
+	var lines []string
+	if detail := m.remoteStatusLine(row[5]); detail != "" {
+		lines = append(lines, detail)
+	}
+	if layers := strings.Split(row[2], "+"); len(layers) > 1 {
+		lines = append(lines, helpStyle.Render("  ◫ Layered: each file comes from the first of "+strings.Join(layers, " → ")+" that has it"))
+	}
+	if i := m.remoteTable.Cursor(); i >= 0 && i < len(m.remoteEntries) && m.remoteEntries[i].conflict != "" {
+		lines = append(lines, warningStyle.Render("  ⚡ Backed up on two devices at once: "+m.remoteEntries[i].conflict))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m Model) remoteStatusLine(status string) string {
 	switch {
 	case strings.Contains(status, "conflict"):
 		return errorStyle.Render("  ⚡ Both local and remote have changed — manual review needed")
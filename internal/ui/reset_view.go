@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/solarisjon/dfc/internal/manifest"
@@ -61,6 +62,10 @@ func (m Model) updateResetView(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case "enter":
 				m.resetStep = resetStepConfirm
 				m.resetConfirmed = false
+				m.resetLocalWork = nil
+				if m.resetType == resetTypeLocal {
+					m.resetLocalWork = gsync.LocalWork(m.cfg.RepoPath)
+				}
 				return m, nil
 			case "esc", "q":
 				m.currentView = viewMainMenu
@@ -71,8 +76,10 @@ func (m Model) updateResetView(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case "y", "Y":
 				m.resetConfirmed = true
 				if m.resetType == resetTypeLocal {
-					if err := m.performReset(); err != nil {
+					if aside, err := m.performReset(); err != nil {
 						m.errMsg = fmt.Sprintf("Reset failed: %v", err)
+					} else if aside != "" {
+						m.statusMsg = "Local reset complete! The old clone was moved to " + aside
 					} else {
 						m.statusMsg = "Local reset complete!"
 					}
@@ -99,25 +106,27 @@ func (m Model) updateResetView(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-func (m *Model) performReset() error {
+// performReset removes the local clone and clears the entry list. A clone
+// with unpushed commits, stashes or uncommitted files is moved aside
+// instead; its new path is returned.
+func (m *Model) performReset() (string, error) {
 	// 1. Remove the local repo clone
-	repoPath := expandHome(m.cfg.RepoPath)
-	if _, err := os.Stat(repoPath); err == nil {
-		if err := os.RemoveAll(repoPath); err != nil {
-			return fmt.Errorf("removing repo at %s: %w", repoPath, err)
-		}
+	aside, err := gsync.RemoveClone(m.cfg.RepoPath)
+	if err != nil {
+		return "", err
 	}
 
 	// 2. Clear all entries and reset config (keep repo URL and path)
 	m.cfg.Entries = nil
+	m.cfg.UnpushedSince = time.Time{}
 	if err := m.cfg.Save(); err != nil {
-		return fmt.Errorf("saving config: %w", err)
+		return aside, fmt.Errorf("saving config: %w", err)
 	}
 
 	// 3. The manifest lives in the repo, so it's already gone.
 	_ = (&manifest.Manifest{Entries: make(map[string]manifest.EntryVersion)}).Save(m.cfg.RepoPath)
 
-	return nil
+	return aside, nil
 }
 
 func (m *Model) performRemoteWipe() tea.Cmd {
@@ -184,6 +193,12 @@ func (m Model) viewResetView() string {
 			b.WriteString(normalStyle.Render("  • Reset all version and hash tracking"))
 			b.WriteString("\n\n")
 			b.WriteString(helpStyle.Render("Your dotfiles and the remote repo will NOT be affected."))
+			if len(m.resetLocalWork) > 0 {
+				b.WriteString("\n\n")
+				b.WriteString(warningStyle.Render("The clone has " + strings.Join(m.resetLocalWork, ", ") + " that the remote doesn't."))
+				b.WriteString("\n")
+				b.WriteString(helpStyle.Render("It will be moved aside to " + expandHome(m.cfg.RepoPath) + ".old-<date> instead of deleted."))
+			}
 		} else {
 			b.WriteString(errorStyle.Render("💣 FULL REMOTE WIPE — this will:"))
 			b.WriteString("\n\n")
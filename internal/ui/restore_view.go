@@ -2,8 +2,6 @@ package ui
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -40,6 +38,7 @@ type restoreEntryItem struct {
 
 func (m *Model) initRestoreView() tea.Cmd {
 	m.restoreCursor = 0
+	m.offline = false
 	m.restoreStep = restoreStepSyncing
 	m.progressDone = false
 	m.errMsg = ""
@@ -56,7 +55,24 @@ func (m *Model) initRestoreView() tea.Cmd {
 }
 
 func (m *Model) buildRestoreEntries() {
-	filtered := m.cfg.Entries
+	// Hide entries whose tags exclude this device. The repo's tags win over
+	// local ones so a retag from another device applies here too.
+	var filtered []config.Entry
+	deviceTags := m.cfg.DeviceTagSet()
+	m.restoreHidden = 0
+	for _, e := range m.cfg.Entries {
+		tags := e.Tags
+		if m.restoreManifest != nil {
+			if ev, ok := m.restoreManifest.Entries[storage.ManifestKey(e, m.cfg.DeviceProfile)]; ok {
+				tags = ev.Tags
+			}
+		}
+		if !config.TagsMatch(tags, deviceTags) {
+			m.restoreHidden++
+			continue
+		}
+		filtered = append(filtered, e)
+	}
 
 	// Check conflicts
 	var conflicts []restore.ConflictResult
@@ -64,20 +80,16 @@ func (m *Model) buildRestoreEntries() {
 		conflicts = restore.CheckConflicts(filtered, m.restoreManifest, m.cfg.DeviceProfile)
 	}
 
-	repoPath := expandHome(m.cfg.RepoPath)
-
 	m.restoreEntries = make([]restoreEntryItem, len(filtered))
 	for i, e := range filtered {
-		// Check if entry exists in repo
-		relPath := storage.RepoDir(e, m.cfg.DeviceProfile)
-		srcPath := filepath.Join(repoPath, relPath)
-		_, statErr := os.Stat(srcPath)
+		// Check if entry exists in repo (in any layer it inherits)
+		inRepo := len(storage.SourceDirs(m.cfg.RepoPath, e, m.cfg.DeviceProfile)) > 0
 
 		item := restoreEntryItem{
 			entry:    e,
 			idx:      i,
-			selected: statErr == nil, // only pre-select if exists in repo
-			inRepo:   statErr == nil,
+			selected: inRepo, // only pre-select if exists in repo
+			inRepo:   inRepo,
 		}
 		if conflicts != nil {
 			item.conflict = conflicts[i].State
@@ -112,7 +124,7 @@ func (m *Model) runRestore() tea.Cmd {
 	}
 	m.progressDone = false
 
-	ch := restore.Run(entries, m.cfg.RepoPath, m.cfg.DeviceProfile)
+	ch := restore.Run(entries, m.cfg.RepoPath, m.cfg.DeviceProfile, m.cfg.Hooks)
 	m.restoreCh = ch
 
 	return waitForRestoreProgress(ch)
@@ -129,8 +141,8 @@ func waitForRestoreProgress(ch <-chan restore.Progress) tea.Cmd {
 }
 
 func (m Model) handleRestoreSyncDone(msg restoreSyncDoneMsg) (tea.Model, tea.Cmd) {
-	if msg.err != nil {
-		m.errMsg = fmt.Sprintf("Repo sync failed: %v", msg.err)
+	if err := m.noteSync(msg.err); err != nil {
+		m.errMsg = fmt.Sprintf("Repo sync failed: %v", err)
 		m.progressDone = true
 		return m, nil
 	}
@@ -144,6 +156,7 @@ func (m Model) handleRestoreProgress(msg restoreProgressMsg) (tea.Model, tea.Cmd
 		item.err = msg.Err
 		item.skipped = msg.Skipped
 		item.skipReasons = msg.SkipReasons
+		item.hooks = msg.Hooks
 		if msg.BytesTotal > 0 {
 			item.percent = float64(msg.BytesCopied) / float64(msg.BytesTotal)
 		} else if msg.Done {
@@ -163,28 +176,13 @@ func (m Model) handleRestoreProgress(msg restoreProgressMsg) (tea.Model, tea.Cmd
 		m.progressDone = true
 
 		// Update local versions and hashes from manifest for successfully restored entries
-		mf, err := manifest.Load(m.cfg.RepoPath)
-		if err == nil {
-			var restored []config.Entry
-			for _, item := range m.restoreEntries {
-				if item.selected {
-					restored = append(restored, item.entry)
-				}
-			}
-			for i, item := range m.progressItems {
-				if item.done && item.err == nil && i < len(restored) {
-					for j := range m.cfg.Entries {
-						if m.cfg.Entries[j].Path == restored[i].Path {
-							mkey := storage.ManifestKey(m.cfg.Entries[j], m.cfg.DeviceProfile)
-							m.cfg.Entries[j].LocalVersion = mf.GetVersion(mkey)
-							m.cfg.Entries[j].LastHash = mf.Entries[mkey].ContentHash
-							break
-						}
-					}
-				}
+		var restored []config.Entry
+		for _, item := range m.restoreEntries {
+			if item.selected {
+				restored = append(restored, item.entry)
 			}
-			_ = m.cfg.Save()
 		}
+		m.recordRestore(restored)
 
 		m.statusMsg = "Restore complete!"
 		return m, nil
@@ -196,6 +194,20 @@ func (m Model) handleRestoreProgress(msg restoreProgressMsg) (tea.Model, tea.Cmd
 	return m, nil
 }
 
+// recordRestore updates versions for restored entries; the next backup
+// records them in the repo's device registry. entries is in progress order.
+func (m *Model) recordRestore(entries []config.Entry) {
+	var results []restore.Progress
+	for i, item := range m.progressItems {
+		if i < len(entries) {
+			results = append(results, restore.Progress{Entry: entries[i], Index: i, Done: item.done, Err: item.err})
+		}
+	}
+	if err := restore.Record(m.cfg, results); err != nil {
+		m.errMsg = fmt.Sprintf("Could not record restore: %v", err)
+	}
+}
+
 func (m Model) updateRestoreView(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -211,12 +223,21 @@ func (m Model) updateRestoreView(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateRestoreRunning(msg)
 		}
 	case restorePreSyncDoneMsg:
-		if msg.err != nil {
-			m.errMsg = fmt.Sprintf("Repo sync failed: %v", msg.err)
+		if err := m.noteSync(msg.err); err != nil {
+			m.errMsg = fmt.Sprintf("Repo sync failed: %v", err)
 			// Still build entries from local state so user can see what's available
 		}
 		// Now that repo is synced, load manifest and build entries
 		m.restoreManifest, _ = manifest.Load(m.cfg.RepoPath)
+		changed := false
+		if m.restoreManifest != nil {
+			changed = storage.Reconcile(m.cfg, m.restoreManifest).Changed
+		} else {
+			changed = storage.ResolveVariants(m.cfg)
+		}
+		if changed {
+			_ = m.cfg.Save()
+		}
 		m.buildRestoreEntries()
 		m.restoreStep = restoreStepEntries
 		return m, nil
@@ -334,9 +355,18 @@ func (m Model) viewRestoreEntries() string {
 
 	b.WriteString(sectionHeader("⬇", "Restore — Select Entries"))
 	b.WriteString("\n\n")
+	notice := m.offlineNotice()
+	if notice != "" {
+		b.WriteString(notice)
+		b.WriteString("\n\n")
+	}
 
 	if len(m.restoreEntries) == 0 {
-		b.WriteString(helpStyle.Render("No entries to restore."))
+		msg := "No entries to restore."
+		if m.restoreHidden > 0 {
+			msg = fmt.Sprintf("No entries to restore (%d hidden by tags).", m.restoreHidden)
+		}
+		b.WriteString(helpStyle.Render(msg))
 		b.WriteString("\n\n")
 		b.WriteString(statusBar("esc back"))
 		return m.box().Render(b.String())
@@ -351,6 +381,9 @@ func (m Model) viewRestoreEntries() string {
 
 	// Scrollable list
 	maxVisible := m.listHeight(10) // header + selected count + help + chrome
+	if notice != "" {
+		maxVisible -= 2
+	}
 	start := 0
 	if len(m.restoreEntries) > maxVisible {
 		start = m.restoreCursor - maxVisible/2
@@ -491,6 +524,9 @@ func (m Model) viewRestoreEntries() string {
 
 	b.WriteString("\n")
 	b.WriteString(helpStyle.Render(fmt.Sprintf("%d/%d selected", selCount, len(m.restoreEntries))))
+	if m.restoreHidden > 0 {
+		b.WriteString(helpStyle.Render(fmt.Sprintf(" • %d hidden by tags", m.restoreHidden)))
+	}
 	b.WriteString("\n\n")
 	b.WriteString(statusBar("space toggle • a all • n none • enter restore • esc back"))
 
@@ -541,6 +577,7 @@ func (m Model) viewRestoreRunning() string {
 					b.WriteString("\n      " + helpStyle.Render("  · "+reason))
 				}
 			}
+			b.WriteString(renderHookResults(item.hooks))
 			b.WriteString("\n")
 		}
 	}
@@ -6,16 +6,21 @@ import (
 
 "github.com/charmbracelet/bubbles/textinput"
 tea "github.com/charmbracelet/bubbletea"
+"github.com/solarisjon/dfc/internal/provider"
 gsync "github.com/solarisjon/dfc/internal/sync"
 )
 
 // setupStep constants
 const (
-setupStepGhCheck   = 0 // checking gh status
+setupStepGhCheck   = 0 // checking gh status (GitHub only)
 setupStepGitID     = 1 // checking/setting git identity
 setupStepChoose    = 2 // choose: existing URL or create new
 setupStepInput     = 3 // enter URL or repo name
 setupStepWorking   = 4 // creating repo / cloning
+setupStepInitBare  = 5 // offer to create a bare repo at a local path
+setupStepProvider  = 6 // choose where to create the new repo
+setupStepProviderURL = 7 // enter a self-hosted server's URL
+setupStepPublic    = 8 // warn that the repo is public
 )
 
 type ghCheckDoneMsg struct{ status gsync.GhStatus }
@@ -23,10 +28,23 @@ type ghAuthDoneMsg struct{ err error }
 type gitIDCheckMsg struct{ id gsync.GitIdentity }
 type gitIDSetMsg struct{ err error }
 type repoCreateDoneMsg struct {
+url     string
+err     error
+existed bool // the repo already existed and is reused
+public  bool
+}
+type providerAuthMsg struct{ err error }
+type repoCloneDoneMsg struct{ err error }
+type remoteCheckMsg struct {
+url     string
+err     error
+canInit bool // url is a local path where a bare repo can be created
+public  bool // the hosting provider reports the repo as public
+}
+type bareInitDoneMsg struct {
 url string
 err error
 }
-type repoCloneDoneMsg struct{ err error }
 
 func (m *Model) initSetupInput() {
 ti := textinput.New()
@@ -43,10 +61,13 @@ case ghCheckDoneMsg:
 m.ghStatus = msg.status
 if msg.status == gsync.GhReady {
 _ = gsync.SetupGitCredentialHelper()
-// Check git identity before proceeding
-m.setupStep = setupStepGitID
-return m, m.checkGitID()
+return m.afterGh()
+}
+if m.setupMethod == 0 && !strings.HasPrefix(strings.ToLower(m.setupURL), "https://") {
+// SSH keys authenticate GitHub without gh
+return m.afterGh()
 }
+m.setupStep = setupStepGhCheck
 return m, nil
 
 case ghAuthDoneMsg:
@@ -56,9 +77,45 @@ return m, nil
 }
 _ = gsync.SetupGitCredentialHelper()
 m.ghStatus = gsync.GhReady
-m.setupStep = setupStepGitID
 m.errMsg = ""
-return m, m.checkGitID()
+return m.afterGh()
+
+case remoteCheckMsg:
+if msg.err != nil && msg.canInit {
+m.setupStep = setupStepInitBare
+m.errMsg = ""
+return m, nil
+}
+if msg.err != nil {
+m.errMsg = fmt.Sprintf("Can't reach %s: %v", msg.url, msg.err)
+m.setupStep = setupStepInput
+return m, m.setupInput.Focus()
+}
+if msg.public {
+m.setupStep = setupStepPublic
+return m, nil
+}
+return m.useRemote(msg.url)
+
+case providerAuthMsg:
+if msg.err != nil {
+m.errMsg = msg.err.Error()
+m.setupStep = setupStepProviderURL
+return m, m.setupInput.Focus()
+}
+m.initSetupInput()
+m.setupInput.Placeholder = "dotfiles"
+m.setupStep = setupStepInput
+m.errMsg = ""
+return m, m.setupInput.Focus()
+
+case bareInitDoneMsg:
+if msg.err != nil {
+m.errMsg = fmt.Sprintf("Failed to create repo: %v", msg.err)
+m.setupStep = setupStepInput
+return m, m.setupInput.Focus()
+}
+return m.useRemote(msg.url)
 
 case gitIDCheckMsg:
 m.gitID = msg.id
@@ -88,15 +145,14 @@ m.errMsg = fmt.Sprintf("Failed to create repo: %v", msg.err)
 m.setupStep = setupStepInput
 return m, nil
 }
-m.cfg.RepoURL = msg.url
-if err := m.cfg.Save(); err != nil {
-m.errMsg = fmt.Sprintf("Error saving config: %v", err)
-m.setupStep = setupStepInput
+m.cfg.Provider = provider.Kinds[m.setupProvider]
+m.cfg.ProviderURL = m.setupProviderURL
+m.setupURL = msg.url
+if msg.public {
+m.setupStep = setupStepPublic
 return m, nil
 }
-m.statusMsg = "Repository created!"
-m.setupStep = setupStepWorking
-return m, m.cloneRepo()
+return m.useRemote(msg.url)
 
 case repoCloneDoneMsg:
 if msg.err != nil {
@@ -112,7 +168,27 @@ return m, nil
 case tea.KeyMsg:
 switch msg.String() {
 case "esc":
-if m.setupStep == setupStepInput {
+if m.setupStep == setupStepProviderURL {
+m.setupStep = setupStepProvider
+m.errMsg = ""
+return m, nil
+}
+if m.setupStep == setupStepGhCheck || m.setupStep == setupStepInitBare || m.setupStep == setupStepPublic {
+if m.setupMethod == 0 {
+m.setupStep = setupStepInput
+m.errMsg = ""
+return m, m.setupInput.Focus()
+}
+m.setupStep = setupStepChoose
+m.errMsg = ""
+return m, nil
+}
+if m.setupStep == setupStepInput && m.setupMethod == 1 {
+m.setupStep = setupStepProvider
+m.errMsg = ""
+return m, nil
+}
+if m.setupStep == setupStepInput || m.setupStep == setupStepProvider {
 m.setupStep = setupStepChoose
 m.errMsg = ""
 return m, nil
@@ -132,14 +208,27 @@ return m, tea.Quit
 case "enter":
 return m.handleSetupEnter()
 
+case "c":
+if m.setupStep == setupStepGhCheck && m.setupMethod == 0 {
+// Use the GitHub URL without gh, e.g. with a stored token
+m.errMsg = ""
+return m.afterGh()
+}
+
 case "up", "k":
 if m.setupStep == setupStepChoose && m.setupMethod > 0 {
 m.setupMethod--
 }
+if m.setupStep == setupStepProvider && m.setupProvider > 0 {
+m.setupProvider--
+}
 case "down", "j":
 if m.setupStep == setupStepChoose && m.setupMethod < 1 {
 m.setupMethod++
 }
+if m.setupStep == setupStepProvider && m.setupProvider < len(provider.Kinds)-1 {
+m.setupProvider++
+}
 case "tab":
 if m.setupStep == setupStepGitID {
 m.gitIDField = (m.gitIDField + 1) % 2
@@ -167,7 +256,7 @@ return m, nil
 }
 }
 
-if m.setupStep == setupStepInput {
+if m.setupStep == setupStepInput || m.setupStep == setupStepProviderURL {
 var cmd tea.Cmd
 m.setupInput, cmd = m.setupInput.Update(msg)
 return m, cmd
@@ -198,6 +287,55 @@ m.errMsg = "Run 'gh auth login' in another terminal, then press enter to retry"
 return m, m.checkGh()
 }
 
+case setupStepInitBare:
+m.setupStep = setupStepWorking
+m.statusMsg = "Creating bare repository..."
+m.errMsg = ""
+return m, m.initBare(m.setupURL)
+
+case setupStepPublic:
+return m.useRemote(m.setupURL)
+
+case setupStepProvider:
+m.errMsg = ""
+kind := provider.Kinds[m.setupProvider]
+if kind == "github" {
+m.setupProviderURL = ""
+m.initSetupInput()
+m.setupInput.Placeholder = "dotfiles"
+if m.ghStatus != gsync.GhReady {
+// Creating a GitHub repo needs gh
+m.setupStep = setupStepGhCheck
+m.ghStatus = gsync.GhChecking
+return m, m.checkGh()
+}
+m.setupStep = setupStepInput
+return m, m.setupInput.Focus()
+}
+m.initSetupInput()
+m.setupInput.Placeholder = "https://" + kind + ".example.com"
+switch {
+case m.cfg.Provider == kind && m.cfg.ProviderURL != "":
+m.setupInput.SetValue(m.cfg.ProviderURL)
+case kind == "gitlab":
+m.setupInput.SetValue("https://gitlab.com")
+}
+m.setupStep = setupStepProviderURL
+return m, m.setupInput.Focus()
+
+case setupStepProviderURL:
+val := strings.TrimRight(strings.TrimSpace(m.setupInput.Value()), "/")
+p, err := provider.New(provider.Kinds[m.setupProvider], val)
+if err != nil {
+m.errMsg = err.Error()
+return m, nil
+}
+m.setupProviderURL = val
+m.setupStep = setupStepWorking
+m.statusMsg = "Checking " + p.Name() + " access..."
+m.errMsg = ""
+return m, func() tea.Msg { return providerAuthMsg{err: p.CheckAuth()} }
+
 case setupStepGitID:
 name := strings.TrimSpace(m.gitNameIn.Value())
 email := strings.TrimSpace(m.gitEmailIn.Value())
@@ -209,19 +347,22 @@ m.errMsg = ""
 return m, m.setGitID(name, email)
 
 case setupStepChoose:
-m.setupStep = setupStepInput
 m.initSetupInput()
 if m.setupMethod == 0 {
 // Pre-fill with current URL if configured
 if m.cfg.RepoURL != "" {
 m.setupInput.SetValue(m.cfg.RepoURL)
 }
-m.setupInput.Placeholder = "https://github.com/username/dotfiles.git"
+m.setupInput.Placeholder = "git@host:you/dotfiles.git or /mnt/nas/dotfiles.git"
 } else {
 m.setupInput.Placeholder = "dotfiles"
 }
-m.setupInput.Focus()
 m.errMsg = ""
+if m.setupMethod == 1 {
+m.setupStep = setupStepProvider
+return m, nil
+}
+m.setupStep = setupStepInput
 return m, m.setupInput.Focus()
 
 case setupStepInput:
@@ -232,9 +373,52 @@ return m, nil
 }
 
 if m.setupMethod == 0 {
-m.cfg.RepoURL = val
+switch {
+case gsync.IsDirStore(val):
+val = "dir:" + gsync.DirStorePath(val)
+case gsync.IsDedupStore(val):
+val = "dedup:" + gsync.DedupStorePath(val)
+case gsync.IsLocalRemote(val) && !strings.HasPrefix(val, "file://"):
+val = gsync.LocalRemotePath(val) // git doesn't expand ~ or relative paths
+}
+m.setupURL = val
+m.errMsg = ""
+if gsync.IsGitHubURL(val) && m.ghStatus != gsync.GhReady {
+// Offer gh for authentication, but don't require it
+m.ghStatus = gsync.GhChecking
+return m, m.checkGh()
+}
+return m.afterGh()
+}
+
+// Create new repo
+m.setupStep = setupStepWorking
+m.statusMsg = "Creating repository..."
+m.errMsg = ""
+return m, m.createRepo(val)
+}
+
+return m, nil
+}
+
+// afterGh continues setup once gh is ready or not needed: verify the
+// entered remote, or ask for the name of the GitHub repo to create.
+func (m Model) afterGh() (tea.Model, tea.Cmd) {
+if m.setupMethod == 1 {
+m.setupStep = setupStepInput
+return m, m.setupInput.Focus()
+}
+m.setupStep = setupStepWorking
+m.statusMsg = "Checking " + m.setupURL + "..."
+return m, m.checkRemote(m.setupURL)
+}
+
+// useRemote saves a verified remote URL and clones it.
+func (m Model) useRemote(url string) (tea.Model, tea.Cmd) {
+m.cfg.RepoURL = url
 if err := m.cfg.Save(); err != nil {
 m.errMsg = fmt.Sprintf("Error saving config: %v", err)
+m.setupStep = setupStepInput
 return m, nil
 }
 m.setupStep = setupStepWorking
@@ -243,14 +427,22 @@ m.errMsg = ""
 return m, m.cloneRepo()
 }
 
-// Create new repo
-m.setupStep = setupStepWorking
-m.statusMsg = "Creating repository..."
-m.errMsg = ""
-return m, m.createRepo(val)
+func (m Model) checkRemote(url string) tea.Cmd {
+kind, baseURL := m.cfg.Provider, m.cfg.ProviderURL
+return func() tea.Msg {
+err := gsync.CheckRemote(url)
+msg := remoteCheckMsg{url: url, err: err, canInit: err != nil && gsync.CanInitBare(url)}
+if p := provider.ForURL(url, kind, baseURL); err == nil && p != nil {
+msg.public, _ = p.IsPublic(url)
+}
+return msg
+}
 }
 
-return m, nil
+func (m Model) initBare(url string) tea.Cmd {
+return func() tea.Msg {
+return bareInitDoneMsg{url: url, err: gsync.InitBareRepo(url)}
+}
 }
 
 func (m Model) checkGh() tea.Cmd {
@@ -259,9 +451,20 @@ return ghCheckDoneMsg{status: gsync.CheckGh()}
 }
 }
 
+// createRepo creates a private repo with the chosen provider, or reuses
+// one of that name that already exists.
 func (m Model) createRepo(name string) tea.Cmd {
+kind, baseURL := provider.Kinds[m.setupProvider], m.setupProviderURL
 return func() tea.Msg {
-url, err := gsync.CreateGitHubRepo(name)
+p, err := provider.New(kind, baseURL)
+if err != nil {
+return repoCreateDoneMsg{err: err}
+}
+if url, err := p.CloneURL(name); err == nil {
+public, _ := p.IsPublic(url)
+return repoCreateDoneMsg{url: url, existed: true, public: public}
+}
+url, err := p.CreateRepo(name)
 return repoCreateDoneMsg{url: url, err: err}
 }
 }
@@ -320,8 +523,9 @@ b.WriteString(helpStyle.Render("Current repo: "))
 b.WriteString(selectedStyle.Render(m.cfg.RepoURL))
 b.WriteString("\n\n")
 } else {
-b.WriteString("DFC backs up your dotfiles to a GitHub repository so you can\n")
-b.WriteString("keep your configurations in sync across multiple machines.\n\n")
+b.WriteString("DFC backs up your dotfiles to a git repository — GitHub, Gitea,\n")
+b.WriteString("a bare repo over SSH or a local path — so you can keep your\n")
+b.WriteString("configurations in sync across multiple machines.\n\n")
 }
 
 switch m.setupStep {
@@ -332,25 +536,39 @@ b.WriteString("Checking for GitHub CLI...")
 case gsync.GhNotInstalled:
 b.WriteString(errorStyle.Render("✗ GitHub CLI (gh) is not installed"))
 b.WriteString("\n\n")
-b.WriteString("DFC uses the GitHub CLI to handle authentication.\n")
+if m.setupMethod == 1 {
+b.WriteString("DFC uses the GitHub CLI to create repositories.\n")
+} else {
+b.WriteString("DFC can use the GitHub CLI to authenticate HTTPS remotes.\n")
+}
 b.WriteString("Install it from: ")
 b.WriteString(selectedStyle.Render("https://cli.github.com"))
 b.WriteString("\n\n")
+if m.setupMethod == 0 {
+b.WriteString(statusBar("c continue without gh • esc back"))
+} else {
 b.WriteString(statusBar("esc back"))
+}
 case gsync.GhNotAuthenticated:
 b.WriteString(warningStyle.Render("⚠ GitHub CLI is installed but not logged in"))
 b.WriteString("\n\n")
 b.WriteString("Run this in another terminal:\n\n")
 b.WriteString(selectedStyle.Render("  gh auth login"))
 b.WriteString("\n\n")
+if m.setupMethod == 0 {
+b.WriteString(statusBar("enter retry • c continue without gh • esc back"))
+} else {
 b.WriteString(statusBar("enter retry • esc back"))
+}
 case gsync.GhReady:
 b.WriteString(successStyle.Render("✓ GitHub CLI authenticated"))
 }
 
 case setupStepGitID:
-b.WriteString(successStyle.Render("✓ GitHub CLI authenticated"))
-b.WriteString("\n\n")
+if m.gitNameIn.Placeholder == "" { // identity check still running
+b.WriteString("Checking git identity...")
+break
+}
 b.WriteString("Git needs to know who you are for commits.\n")
 b.WriteString("Enter your name and email:\n\n")
 
@@ -370,15 +588,13 @@ b.WriteString("\n\n")
 b.WriteString(statusBar("tab switch • enter confirm • esc skip"))
 
 case setupStepChoose:
-b.WriteString(successStyle.Render("✓ GitHub CLI authenticated"))
-b.WriteString("\n")
 b.WriteString(successStyle.Render(fmt.Sprintf("✓ Git identity: %s <%s>", m.gitID.Name, m.gitID.Email)))
 b.WriteString("\n\n")
 b.WriteString("Choose how to set up your dotfiles repository:\n\n")
 
 methods := []string{
-"Use an existing GitHub repository",
-"Create a new private repository",
+"Use an existing git remote (GitHub, Gitea, SSH, local path), directory or S3 bucket",
+"Create a new private repository (GitHub, GitLab or Gitea)",
 }
 for i, method := range methods {
 if i == m.setupMethod {
@@ -394,14 +610,79 @@ b.WriteString(statusBar("↑/↓ select • enter confirm • esc back"))
 
 case setupStepInput:
 if m.setupMethod == 0 {
-b.WriteString("Enter your repository URL:\n\n")
+b.WriteString("Enter your repository URL or path:\n")
+b.WriteString(helpStyle.Render("Use dir:<path> to sync through a plain directory, e.g. on a USB drive,\n" +
+"dedup:<path> for a deduplicating one, or s3://bucket/prefix\n" +
+"(s3+https://host/bucket/prefix for MinIO and others) for object storage."))
+b.WriteString("\n\n")
 } else {
-b.WriteString("Enter a name for your new repository:\n\n")
+p, _ := provider.New(provider.Kinds[m.setupProvider], m.setupProviderURL)
+b.WriteString("Enter a name for your new private " + p.Name() + " repository.\n")
+b.WriteString(helpStyle.Render("An existing repository with that name is used as is."))
+b.WriteString("\n\n")
 }
 b.WriteString(m.setupInput.View())
 b.WriteString("\n\n")
 b.WriteString(statusBar("enter confirm • esc back"))
 
+case setupStepInitBare:
+if gsync.IsDirStore(m.setupURL) {
+b.WriteString(warningStyle.Render("⚠ There is no dfc store at " + gsync.DirStorePath(m.setupURL)))
+b.WriteString("\n\n")
+b.WriteString("DFC can set up the directory as a store, keeping your dotfiles there\n")
+b.WriteString("as plain files with dated snapshots of past versions.\n\n")
+} else if gsync.IsDedupStore(m.setupURL) {
+b.WriteString(warningStyle.Render("⚠ There is no dfc store at " + gsync.DedupStorePath(m.setupURL)))
+b.WriteString("\n\n")
+b.WriteString("DFC can set up the directory as a deduplicating store, keeping each\n")
+b.WriteString("distinct file once, compressed, with snapshots of past versions.\n\n")
+} else if gsync.IsS3Store(m.setupURL) {
+b.WriteString(warningStyle.Render("⚠ There is no dfc store at " + m.setupURL))
+b.WriteString("\n\n")
+b.WriteString("DFC can set up the bucket as a store, creating it if needed and turning\n")
+b.WriteString("on versioning to keep past versions.\n\n")
+} else {
+b.WriteString(warningStyle.Render("⚠ There is no git repository at " + gsync.LocalRemotePath(m.setupURL)))
+b.WriteString("\n\n")
+b.WriteString("DFC can create an empty bare repository there to use as the remote,\n")
+b.WriteString("e.g. on a NAS share or a removable drive.\n\n")
+}
+b.WriteString(statusBar("enter create • esc back"))
+
+case setupStepProvider:
+b.WriteString("Where should the new repository live?\n\n")
+names := map[string]string{
+"github": "GitHub (via the GitHub CLI)",
+"gitlab": "GitLab (gitlab.com or self-hosted)",
+"gitea":  "Gitea / Forgejo (self-hosted)",
+}
+for i, kind := range provider.Kinds {
+if i == m.setupProvider {
+b.WriteString(selectedStyle.Render("▸ " + names[kind]))
+} else {
+b.WriteString(normalStyle.Render("  " + names[kind]))
+}
+b.WriteString("\n")
+}
+b.WriteString("\n")
+b.WriteString(statusBar("↑/↓ select • enter confirm • esc back"))
+
+case setupStepProviderURL:
+kind := provider.Kinds[m.setupProvider]
+b.WriteString("Enter the server's URL:\n\n")
+b.WriteString(m.setupInput.View())
+b.WriteString("\n\n")
+b.WriteString(helpStyle.Render("DFC uses the token in $" + strings.ToUpper(kind) + "_TOKEN, or the password git stores for the server."))
+b.WriteString("\n\n")
+b.WriteString(statusBar("enter confirm • esc back"))
+
+case setupStepPublic:
+b.WriteString(warningStyle.Render("⚠ " + m.setupURL + " is public"))
+b.WriteString("\n\n")
+b.WriteString("Anyone can read a public repository, including any secrets in\n")
+b.WriteString("your dotfiles. Consider making it private first.\n\n")
+b.WriteString(statusBar("enter use it anyway • esc back"))
+
 case setupStepWorking:
 b.WriteString(m.statusMsg)
 }
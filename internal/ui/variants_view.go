@@ -0,0 +1,362 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/solarisjon/dfc/internal/backup"
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/entry"
+	"github.com/solarisjon/dfc/internal/manifest"
+	"github.com/solarisjon/dfc/internal/storage"
+	gsync "github.com/solarisjon/dfc/internal/sync"
+)
+
+// variantsSyncDoneMsg signals the repo sync before listing variants.
+type variantsSyncDoneMsg struct{ err error }
+
+// variantCreatedMsg carries the backup of local content into a new variant.
+type variantCreatedMsg struct {
+	variant string
+	result  backup.Progress
+}
+
+type variantItem struct {
+	name      string // "" for the default copy
+	version   int
+	updatedBy string
+	inEffect  bool // used by this device
+	matches   bool // applies to this device (host or OS)
+}
+
+func (m *Model) initVariantsView(index int) tea.Cmd {
+	m.variantEntry = index
+	m.variantItems = nil
+	m.variantCursor = 0
+	m.variantSyncing = true
+	m.variantConfirmDel = false
+	m.errMsg = ""
+	m.statusMsg = ""
+	return func() tea.Msg {
+		err := gsync.EnsureRepo(m.cfg.RepoURL, m.cfg.RepoPath)
+		return variantsSyncDoneMsg{err: err}
+	}
+}
+
+// loadVariants lists the default copy and every variant of the entry.
+func (m *Model) loadVariants() {
+	if storage.ResolveVariants(m.cfg) {
+		_ = m.cfg.Save()
+	}
+	e := m.cfg.Entries[m.variantEntry]
+	mf, err := manifest.Load(m.cfg.RepoPath)
+	if err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+
+	matching := make(map[string]bool)
+	for _, v := range storage.DeviceVariants() {
+		matching[v] = true
+	}
+
+	names := append([]string{""}, storage.ListVariants(m.cfg.RepoPath, e, m.cfg.DeviceProfile)...)
+	m.variantItems = make([]variantItem, len(names))
+	for i, name := range names {
+		ev := mf.GetEntry(storage.VariantKey(e, m.cfg.DeviceProfile, name))
+		m.variantItems[i] = variantItem{
+			name:      name,
+			version:   ev.Version,
+			updatedBy: ev.UpdatedBy,
+			inEffect:  name == e.Variant,
+			matches:   matching[name],
+		}
+	}
+	if m.variantCursor >= len(m.variantItems) {
+		m.variantCursor = len(m.variantItems) - 1
+	}
+}
+
+func (m Model) updateVariantsView(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case variantsSyncDoneMsg:
+		m.variantSyncing = false
+		if msg.err != nil {
+			m.errMsg = fmt.Sprintf("Repo sync failed: %v", msg.err)
+			return m, nil
+		}
+		m.loadVariants()
+		return m, nil
+
+	case variantCreatedMsg:
+		m.variantSyncing = false
+		m.finishCreateVariant(msg)
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.variantSyncing {
+			return m, nil
+		}
+		key := msg.String()
+		if key != "x" {
+			m.variantConfirmDel = false
+		}
+		switch key {
+		case "up", "k":
+			if m.variantCursor > 0 {
+				m.variantCursor--
+			}
+		case "down", "j":
+			if m.variantCursor < len(m.variantItems)-1 {
+				m.variantCursor++
+			}
+		case "h", "o", "a":
+			return m, m.createVariant(deviceVariantFor(key))
+		case "p":
+			m.promoteVariant()
+		case "x":
+			if m.variantCursor >= len(m.variantItems) || m.variantItems[m.variantCursor].name == "" {
+				return m, nil
+			}
+			if !m.variantConfirmDel {
+				m.variantConfirmDel = true
+				return m, nil
+			}
+			m.variantConfirmDel = false
+			m.deleteVariant()
+		case "esc", "q":
+			m.currentView = viewEntryList
+			m.errMsg = ""
+			m.statusMsg = ""
+			m.buildEntryList()
+		}
+	}
+	return m, nil
+}
+
+// deviceVariantFor maps a key to this device's host, OS+arch or OS variant.
+func deviceVariantFor(key string) string {
+	variants := storage.DeviceVariants()
+	offset := len(variants) - 3 // no host variant if the hostname is unknown
+	switch key {
+	case "h":
+		if offset < 0 {
+			return ""
+		}
+		return variants[0]
+	case "a":
+		return variants[offset+1]
+	default:
+		return variants[offset+2]
+	}
+}
+
+// createVariant copies this device's local content into a new variant.
+func (m *Model) createVariant(variant string) tea.Cmd {
+	m.errMsg = ""
+	m.statusMsg = ""
+	if variant == "" {
+		m.errMsg = "Hostname unknown — cannot create a host variant"
+		return nil
+	}
+	e := m.cfg.Entries[m.variantEntry]
+	if e.Variant == variant {
+		m.errMsg = fmt.Sprintf("%s already exists — back up to update it", variant)
+		return nil
+	}
+	// Only create variants this device would use, so its versions stay
+	// attached to the copy it backs up to.
+	for _, v := range storage.DeviceVariants() {
+		if v == variant {
+			break
+		}
+		if v == e.Variant {
+			m.errMsg = fmt.Sprintf("The more specific %s is in effect here — promote or delete it first", v)
+			return nil
+		}
+	}
+
+	m.variantSyncing = true
+	e.Variant = variant
+	repoPath, profile, global, limits := m.cfg.RepoPath, m.cfg.DeviceProfile, m.cfg.Hooks, m.cfg.Limits
+	return func() tea.Msg {
+		var res backup.Progress
+		for p := range backup.Run([]config.Entry{e}, repoPath, profile, global, limits) {
+			res = p
+		}
+		return variantCreatedMsg{variant: variant, result: res}
+	}
+}
+
+func (m *Model) finishCreateVariant(msg variantCreatedMsg) {
+	if msg.result.Err != nil {
+		m.errMsg = fmt.Sprintf("Backup into %s failed: %v", msg.variant, msg.result.Err)
+		return
+	}
+	e := &m.cfg.Entries[m.variantEntry]
+	e.Variant = msg.variant
+	if _, _, err := backup.Record(m.cfg, []backup.Progress{msg.result}); err != nil {
+		m.errMsg = fmt.Sprintf("Could not record variant: %v", err)
+		return
+	}
+	if err := gsync.CommitAndPush(m.cfg.RepoPath, fmt.Sprintf("dfc: add variant %s of %s", msg.variant, e.Path)); err != nil {
+		m.errMsg = fmt.Sprintf("Push failed: %v", err)
+	} else {
+		m.statusMsg = fmt.Sprintf("Created %s from local content", msg.variant)
+	}
+	m.loadVariants()
+}
+
+// promoteVariant makes the selected variant the default copy for every
+// device without a more specific variant.
+func (m *Model) promoteVariant() {
+	m.errMsg = ""
+	m.statusMsg = ""
+	if m.variantCursor >= len(m.variantItems) || m.variantItems[m.variantCursor].name == "" {
+		m.errMsg = "Select a variant to promote"
+		return
+	}
+	variant := m.variantItems[m.variantCursor].name
+	e := &m.cfg.Entries[m.variantEntry]
+
+	mf, err := manifest.Load(m.cfg.RepoPath)
+	if err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	if err := storage.PromoteVariant(m.cfg.RepoPath, mf, *e, m.cfg.DeviceProfile, variant); err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	if err := mf.Save(m.cfg.RepoPath); err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	m.rekeyAfterVariantChange(e, mf)
+	if err := gsync.CommitAndPush(m.cfg.RepoPath, fmt.Sprintf("dfc: promote variant %s of %s to default", variant, e.Path)); err != nil {
+		m.errMsg = fmt.Sprintf("Push failed: %v", err)
+	} else {
+		m.statusMsg = fmt.Sprintf("%s is now the default", variant)
+	}
+	m.loadVariants()
+}
+
+func (m *Model) deleteVariant() {
+	m.errMsg = ""
+	m.statusMsg = ""
+	variant := m.variantItems[m.variantCursor].name
+	e := &m.cfg.Entries[m.variantEntry]
+
+	mf, err := manifest.Load(m.cfg.RepoPath)
+	if err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	if err := storage.DeleteVariant(m.cfg.RepoPath, mf, *e, m.cfg.DeviceProfile, variant); err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	if err := mf.Save(m.cfg.RepoPath); err != nil {
+		m.errMsg = err.Error()
+		return
+	}
+	m.rekeyAfterVariantChange(e, mf)
+	if err := gsync.CommitAndPush(m.cfg.RepoPath, fmt.Sprintf("dfc: delete variant %s of %s", variant, e.Path)); err != nil {
+		m.errMsg = fmt.Sprintf("Push failed: %v", err)
+	} else {
+		m.statusMsg = fmt.Sprintf("Deleted %s", variant)
+	}
+	m.loadVariants()
+}
+
+// rekeyAfterVariantChange re-resolves the variant in effect for e. If it
+// changed, the local version is taken from the new copy's manifest key when
+// its content matches what this device last synced, otherwise reset so
+// Restore offers the new copy.
+func (m *Model) rekeyAfterVariantChange(e *config.Entry, mf *manifest.Manifest) {
+	old := e.Variant
+	e.Variant = storage.ResolveVariant(m.cfg.RepoPath, *e, m.cfg.DeviceProfile)
+	if e.Variant != old {
+		ev := mf.GetEntry(storage.ManifestKey(*e, m.cfg.DeviceProfile))
+		if ev.ContentHash != "" && ev.ContentHash == e.LastHash {
+			e.LocalVersion = ev.Version
+		} else {
+			e.LocalVersion = 0
+		}
+	}
+	_ = m.cfg.Save()
+}
+
+func (m Model) viewVariants() string {
+	var b strings.Builder
+
+	e := m.cfg.Entries[m.variantEntry]
+	name := e.Name
+	if name == "" {
+		name = entry.FriendlyName(e.Path)
+	}
+	b.WriteString(sectionHeader("🔀", "Variants — "+name))
+	b.WriteString("\n\n")
+
+	if m.variantSyncing {
+		b.WriteString(lipgloss.NewStyle().Foreground(accentColor).Render("⟳ "))
+		b.WriteString(normalStyle.Render("Syncing repository..."))
+		b.WriteString("\n")
+		b.WriteString(statusBar("please wait"))
+		return m.box().Render(b.String())
+	}
+
+	defaultDir := storage.VariantRepoDir(e, m.cfg.DeviceProfile, "")
+	nameW := len(defaultDir) + 13
+	for i, item := range m.variantItems {
+		label := item.name
+		if label == "" {
+			label = "default (" + defaultDir + ")"
+		}
+		ver := "—"
+		if item.version > 0 {
+			ver = fmt.Sprintf("v%d", item.version)
+		}
+		line := padRight(label, nameW) + padRight(ver, 6)
+		switch {
+		case item.inEffect:
+			line += successStyle.Render("✓ in effect")
+		case item.matches:
+			line += helpStyle.Render("matches this device")
+		}
+		if item.updatedBy != "" {
+			line += dimStyle.Render("  by " + item.updatedBy)
+		}
+
+		if i == m.variantCursor {
+			b.WriteString(selectedStyle.Render("▸ ") + line)
+		} else {
+			b.WriteString("  " + line)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render("This device: " + strings.Join(storage.DeviceVariants(), ", ")))
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render("The most specific matching variant is restored and backed up; otherwise the default."))
+
+	if m.variantConfirmDel {
+		b.WriteString("\n\n")
+		b.WriteString(warningStyle.Render("Press x again to delete " + m.variantItems[m.variantCursor].name + " from the repo"))
+	}
+	if m.statusMsg != "" {
+		b.WriteString("\n\n")
+		b.WriteString(successStyle.Render("✓ " + m.statusMsg))
+	}
+	if m.errMsg != "" {
+		b.WriteString("\n\n")
+		b.WriteString(errorStyle.Render("✗ " + m.errMsg))
+	}
+
+	b.WriteString(statusBar("h host • o OS • a OS+arch (new variant from local) • p promote • x delete • esc back"))
+
+	return m.box().Render(b.String())
+}
@@ -0,0 +1,20 @@
+package version
+
+import "runtime/debug"
+
+// Version is set at build time:
+//
+//	go build -ldflags "-X github.com/solarisjon/dfc/internal/version.Version=v1.2.3"
+var Version = ""
+
+// String returns the dfc version, falling back to the module version
+// recorded by `go install`, or "dev" for local builds.
+func String() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
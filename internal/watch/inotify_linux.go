@@ -0,0 +1,178 @@
+//go:build linux
+
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/solarisjon/dfc/internal/config"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF
+
+// inotifyWatcher watches directory entries recursively and file entries
+// through their parent directory, so editors that replace files atomically
+// are still seen.
+type inotifyWatcher struct {
+	fd     int      // raw descriptor; f.Fd() would switch it to blocking mode
+	f      *os.File // wraps fd so Close unblocks a pending Read
+	events chan string
+	errors chan error
+	done   chan struct{}
+
+	mu        sync.Mutex
+	dirs      map[int32]string // watch descriptor → directory
+	recursive map[int32]bool   // descriptor belongs to a directory entry
+	roots     []string         // expanded entry paths, reported on queue overflow
+}
+
+func newWatcher(entries []config.Entry) (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+	w := &inotifyWatcher{
+		fd:        fd,
+		f:         os.NewFile(uintptr(fd), "inotify"),
+		events:    make(chan string, 256),
+		errors:    make(chan error, 16),
+		done:      make(chan struct{}),
+		dirs:      make(map[int32]string),
+		recursive: make(map[int32]bool),
+	}
+
+	for _, e := range entries {
+		path := expandHome(e.Path)
+		w.roots = append(w.roots, path)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			w.addTree(path)
+			continue
+		}
+		// Files (and entries not created yet) are watched via their parent.
+		if err := w.add(filepath.Dir(path), false); err != nil {
+			w.sendErr(fmt.Errorf("watching %s: %w", e.Path, err))
+		}
+	}
+
+	go w.readLoop()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Events() <-chan string { return w.events }
+func (w *inotifyWatcher) Errors() <-chan error  { return w.errors }
+
+func (w *inotifyWatcher) Close() error {
+	close(w.done)
+	return w.f.Close()
+}
+
+func (w *inotifyWatcher) add(dir string, recursive bool) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.dirs[int32(wd)] = dir
+	if recursive {
+		w.recursive[int32(wd)] = true
+	}
+	w.mu.Unlock()
+	return nil
+}
+
+// addTree watches dir and every subdirectory, skipping .git like backup does.
+func (w *inotifyWatcher) addTree(dir string) {
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if err := w.add(p, true); err != nil {
+			w.sendErr(fmt.Errorf("watching %s: %w", p, err))
+		}
+		return nil
+	})
+}
+
+func (w *inotifyWatcher) readLoop() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.sendErr(fmt.Errorf("reading inotify events: %w", err))
+			}
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameStart := off + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+int(ev.Len)]), "\x00")
+			off = nameStart + int(ev.Len)
+
+			if ev.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				// Events were lost — treat every entry as changed.
+				for _, root := range w.roots {
+					if !w.send(root) {
+						return
+					}
+				}
+				continue
+			}
+
+			w.mu.Lock()
+			dir, ok := w.dirs[ev.Wd]
+			recursive := w.recursive[ev.Wd]
+			if ev.Mask&syscall.IN_IGNORED != 0 {
+				delete(w.dirs, ev.Wd)
+				delete(w.recursive, ev.Wd)
+			}
+			w.mu.Unlock()
+			if !ok {
+				continue
+			}
+
+			path := dir
+			if name != "" {
+				path = filepath.Join(dir, name)
+			}
+			// New directories inside a directory entry need their own watch.
+			if recursive && ev.Mask&syscall.IN_ISDIR != 0 &&
+				ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 && name != ".git" {
+				w.addTree(path)
+			}
+			if !w.send(path) {
+				return
+			}
+		}
+	}
+}
+
+// send delivers path unless the watcher is closed first.
+func (w *inotifyWatcher) send(path string) bool {
+	select {
+	case w.events <- path:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func (w *inotifyWatcher) sendErr(err error) {
+	select {
+	case w.errors <- err:
+	default: // don't block the watcher if nobody is reading errors
+	}
+}
@@ -0,0 +1,69 @@
+//go:build !linux
+
+package watch
+
+import (
+	"time"
+
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/hash"
+)
+
+// pollInterval is how often entries are re-hashed on platforms without inotify.
+const pollInterval = 10 * time.Second
+
+// pollWatcher detects changes by periodically hashing each entry.
+type pollWatcher struct {
+	entries []config.Entry
+	hashes  map[string]string
+	events  chan string
+	errors  chan error
+	done    chan struct{}
+}
+
+func newWatcher(entries []config.Entry) (watcher, error) {
+	w := &pollWatcher{
+		entries: entries,
+		hashes:  make(map[string]string),
+		events:  make(chan string, len(entries)),
+		errors:  make(chan error),
+		done:    make(chan struct{}),
+	}
+	for _, e := range entries {
+		w.hashes[e.Path], _ = hash.HashEntry(e)
+	}
+	go w.loop()
+	return w, nil
+}
+
+func (w *pollWatcher) Events() <-chan string { return w.events }
+func (w *pollWatcher) Errors() <-chan error  { return w.errors }
+
+func (w *pollWatcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+func (w *pollWatcher) loop() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			for _, e := range w.entries {
+				h, _ := hash.HashEntry(e)
+				if h == w.hashes[e.Path] {
+					continue
+				}
+				w.hashes[e.Path] = h
+				select {
+				case w.events <- expandHome(e.Path):
+				case <-w.done:
+					return
+				}
+			}
+		}
+	}
+}
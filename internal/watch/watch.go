@@ -0,0 +1,275 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/solarisjon/dfc/internal/backup"
+	"github.com/solarisjon/dfc/internal/config"
+	"github.com/solarisjon/dfc/internal/manifest"
+)
+
+const (
+	// DefaultDebounce is how long writes must settle before a backup runs.
+	DefaultDebounce = 5 * time.Second
+	// DefaultMaxBackoff caps the retry delay while the remote is unreachable.
+	DefaultMaxBackoff = 15 * time.Minute
+
+	initialBackoff = 30 * time.Second
+)
+
+// Options configures the watch daemon.
+type Options struct {
+	Debounce   time.Duration
+	MaxBackoff time.Duration
+	Logger     *log.Logger
+}
+
+// watcher reports absolute paths that changed under the tracked entries.
+// The Linux implementation uses inotify; other platforms poll content hashes.
+type watcher interface {
+	Events() <-chan string
+	Errors() <-chan error
+	Close() error
+}
+
+type daemon struct {
+	opts        Options
+	log         *log.Logger
+	cfg         *config.Config
+	dirty       map[string]bool // entry paths with unsaved changes
+	pendingPush bool            // a commit was made but its push failed
+}
+
+// Run watches every tracked entry and, once writes have settled, runs the
+// normal backup → manifest bump → commit/push cycle for the entries that
+// changed. Paths inside .git directories and the local repo clone are
+// ignored, matching what backup copies. Entries in a conflict state per
+// restore.CheckConflicts are never pushed automatically.
+// Run blocks until ctx is cancelled.
+func Run(ctx context.Context, opts Options) error {
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(os.Stderr, "dfc watch: ", log.LstdFlags)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if !cfg.IsConfigured() {
+		return fmt.Errorf("dfc is not configured — run dfc to complete setup first")
+	}
+
+	d := &daemon{opts: opts, log: opts.Logger, cfg: cfg, dirty: make(map[string]bool)}
+
+	w, err := newWatcher(cfg.Entries)
+	if err != nil {
+		return fmt.Errorf("starting watcher: %w", err)
+	}
+	defer func() { w.Close() }()
+	watched := entryPaths(cfg.Entries) // what w watches
+	d.log.Printf("watching %d %s", len(cfg.Entries), plural(len(cfg.Entries), "entry", "entries"))
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	backoff := time.Duration(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+
+		case path := <-w.Events():
+			e := d.entryFor(path)
+			if e == nil {
+				continue
+			}
+			d.dirty[e.Path] = true
+			// While backing off, let the retry timer run its course.
+			if backoff == 0 {
+				timer.Reset(opts.Debounce)
+			}
+
+		case err := <-w.Errors():
+			d.log.Printf("watch error: %v", err)
+
+		case <-timer.C:
+			if len(d.dirty) == 0 && !d.pendingPush {
+				continue
+			}
+			err := d.cycle()
+			if err == nil {
+				backoff = 0
+			} else if errors.Is(err, backup.ErrUnreachable) {
+				backoff = nextBackoff(backoff, opts.MaxBackoff)
+				d.log.Printf("%v — retrying in %s", err, backoff)
+				timer.Reset(backoff)
+			} else {
+				backoff = 0
+				d.log.Printf("backup failed: %v", err)
+			}
+
+			// Re-arm the watcher if the tracked entries changed on disk.
+			// If that fails the old one keeps running, and the next cycle
+			// tries again.
+			if paths := entryPaths(d.cfg.Entries); paths != watched {
+				next, err := newWatcher(d.cfg.Entries)
+				if err != nil {
+					d.log.Printf("tracked entries changed, still watching the old ones: restarting watcher: %v", err)
+					continue
+				}
+				w.Close()
+				w, watched = next, paths
+				d.log.Printf("tracked entries changed — now watching %d", len(d.cfg.Entries))
+			}
+		}
+	}
+}
+
+// cycle backs up the dirty entries that are safe to push and commits them.
+func (d *daemon) cycle() error {
+	// Reload so edits made in the TUI while we run are not overwritten.
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	d.cfg = cfg
+
+	var entries []config.Entry
+	for _, e := range cfg.Entries {
+		if d.dirty[e.Path] {
+			entries = append(entries, e)
+		}
+	}
+
+	res, err := backup.Unattended(cfg, entries, "dfc: auto-backup")
+	committed := append(append([]string(nil), res.Bumped...), res.Retagged...)
+	if res.Pushed && len(committed) == 0 {
+		d.log.Printf("pushed queued commit")
+	}
+	for _, e := range res.Hooks {
+		d.log.Printf("%s: hooks changed by another device, not run until accepted (dfc hooks)", e.Path)
+	}
+	for _, cr := range res.Held {
+		d.log.Printf("not pushing %s: %s — resolve it in dfc", cr.Entry.Path, cr.State)
+	}
+	for _, p := range res.Progress {
+		for _, h := range p.Hooks {
+			d.log.Printf("%s: %s", p.Entry.Path, h.Summary())
+		}
+		switch {
+		case p.Err != nil:
+			d.log.Printf("%s: %v", p.Entry.Path, p.Err)
+		case p.Warning != "":
+			d.log.Printf("%s: %s", p.Entry.Path, p.Warning)
+		}
+		if p.Err == nil {
+			for _, reason := range p.SkipReasons {
+				d.log.Printf("%s: skipped %s", p.Entry.Path, reason)
+			}
+		}
+	}
+
+	if errors.Is(err, backup.ErrUnreachable) {
+		d.pendingPush = len(committed) > 0 || d.pendingPush
+		if len(committed) > 0 {
+			// Already committed locally — only the push is outstanding.
+			d.dirty = make(map[string]bool)
+			d.log.Printf("committed %s locally", strings.Join(committed, ", "))
+		}
+		return err
+	}
+	// Held, failed and untracked entries are dropped until they change again.
+	d.dirty = make(map[string]bool)
+	d.pendingPush = false
+	if err != nil {
+		return err
+	}
+
+	mf, _ := manifest.Load(cfg.RepoPath)
+	for _, key := range res.Bumped {
+		d.log.Printf("committed %s v%d", key, mf.GetVersion(key))
+	}
+	for _, key := range res.Retagged {
+		d.log.Printf("committed tags or definition of %s, still v%d", key, mf.GetVersion(key))
+	}
+	if len(res.Bumped) > 0 && res.Impact.Files > 0 {
+		d.log.Printf("added to the repo: %s", res.Impact)
+	}
+	return nil
+}
+
+// entryFor returns the tracked entry containing path, or nil if the path
+// is not tracked or should be ignored.
+func (d *daemon) entryFor(path string) *config.Entry {
+	repo := expandHome(d.cfg.RepoPath)
+	if path == repo || strings.HasPrefix(path, repo+string(filepath.Separator)) {
+		return nil
+	}
+	for i, e := range d.cfg.Entries {
+		root := expandHome(e.Path)
+		if path != root && !strings.HasPrefix(path, root+string(filepath.Separator)) {
+			continue
+		}
+		rel, _ := filepath.Rel(root, path)
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			if part == ".git" {
+				return nil
+			}
+		}
+		return &d.cfg.Entries[i]
+	}
+	return nil
+}
+
+func nextBackoff(cur, max time.Duration) time.Duration {
+	if cur == 0 {
+		cur = initialBackoff
+	} else {
+		cur *= 2
+	}
+	if cur > max {
+		cur = max
+	}
+	return cur
+}
+
+// entryPaths returns a stable key describing the set of tracked paths.
+func entryPaths(entries []config.Entry) string {
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.Path
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, "\n")
+}
+
+func plural(n int, singular, pl string) string {
+	if n == 1 {
+		return singular
+	}
+	return pl
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}